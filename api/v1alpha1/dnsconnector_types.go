@@ -25,14 +25,31 @@ import (
 )
 
 const (
-	CorednsOriginalConfBkpSuffix      string = "-original-configmap"      // CorednsOriginalConfBkpSuffix suffix that will be used to create a copy of the original coredns conf
-	ConditionConnectorTypeReady       string = "Ready"                    // ConditionConnectorTypeReady is used to update condition type
-	ConditionReasonConnectorActive    string = "Active"                   // ConditionReasonConnectorActive represents state of the DNSConnector
-	ConditionReasonConnectorError     string = "Error"                    // ConditionReasonConnectorError represents the error state of the DNSConnector
-	ConditionReasonConnectorUpdating  string = "Updating"                 // ConditionReasonConnectorUpdating represents the
-	ConditionReasonConnectorUpdateErr string = "UpdateError"              // ConditionReasonConnectorUpdateErr represents state of the DNSConnector
-	ConditionReasonConnectorUnknown   string = "Unknown"                  // ConditionReasonConnectorUnknown string = "Unknown"
-	DnsConnectorsFinalizerName        string = "dnsconnectors/finalizers" // DnsConnectorsFinalizerName is finalizer used by DNSConnector controller
+	CorednsOriginalConfBkpSuffix       string = "-original-configmap"              // CorednsOriginalConfBkpSuffix suffix that will be used to create a copy of the original coredns conf
+	CorednsCheckpointConfSuffix        string = "-checkpoint-configmap"            // CorednsCheckpointConfSuffix suffix of the configmap that keeps the last known-good corefile, volumes and volume mounts
+	CorednsCheckpointVolumesKey        string = "volumes"                          // CorednsCheckpointVolumesKey is the checkpoint configmap key that keeps zonefile volumes
+	CorednsCheckpointVolumeMountsKey   string = "volumeMounts"                     // CorednsCheckpointVolumeMountsKey is the checkpoint configmap key that keeps zonefile volume mounts
+	CorednsCheckpointZoneInfix         string = "-checkpoint-"                     // CorednsCheckpointZoneInfix joins the CoreDNS configmap name and the zone configmap name into the name of the checkpoint zone configmap
+	CorednsCheckpointLabel             string = "monkale.io/checkpoint-of"         // CorednsCheckpointLabel is the DNSConnector whose last known-good zonefile the checkpoint zone configmap keeps
+	CorefileManagedBlocksAnnotation    string = "monkale.io/managed-server-blocks" // CorefileManagedBlocksAnnotation lists the keys of the server blocks generated by the DNSConnector in the CoreDNS ConfigMap
+	ConditionConnectorTypeReady        string = "Ready"                            // ConditionConnectorTypeReady is used to update condition type
+	ConditionReasonConnectorActive     string = "Active"                           // ConditionReasonConnectorActive represents state of the DNSConnector
+	ConditionReasonConnectorError      string = "Error"                            // ConditionReasonConnectorError represents the error state of the DNSConnector
+	ConditionReasonConnectorUpdating   string = "Updating"                         // ConditionReasonConnectorUpdating represents the
+	ConditionReasonConnectorUpdateErr  string = "UpdateError"                      // ConditionReasonConnectorUpdateErr represents state of the DNSConnector
+	ConditionReasonConnectorRolledBack string = "RolledBack"                       // ConditionReasonConnectorRolledBack represents state of the DNSConnector in which the last update has been reverted
+	ConditionReasonConnectorCorefile   string = "CorefileError"                    // ConditionReasonConnectorCorefile represents state of the DNSConnector in which the Corefile can not be parsed or has conflicting server blocks
+	ConditionReasonConnectorDegraded   string = "Degraded"                         // ConditionReasonConnectorDegraded represents state of the DNSConnector in which CoreDNS does not serve the expected serials of some zones
+	ConditionReasonConnectorUnknown    string = "Unknown"                          // ConditionReasonConnectorUnknown string = "Unknown"
+	DnsConnectorsFinalizerName         string = "dnsconnectors/finalizers"         // DnsConnectorsFinalizerName is finalizer used by DNSConnector controller
+	DnsConnectorWorkloadIndex          string = "spec.corednsDeployment"           // DnsConnectorWorkloadIndex is used for indexing the DNSConnectors by the CoreDNS workload type and name
+	RolloutStrategyRestart             string = "Restart"                          // RolloutStrategyRestart restarts the CoreDNS pods on every change
+	RolloutStrategyReload              string = "Reload"                           // RolloutStrategyReload lets CoreDNS reload the changed Corefile and zonefiles
+	RolloutPhaseApplying               string = "Applying"                         // RolloutPhaseApplying represents the rollout in which the changes are being applied to the CoreDNS
+	RolloutPhaseWaitingForRollout      string = "WaitingForRollout"                // RolloutPhaseWaitingForRollout represents the rollout in which the CoreDNS workload is rolling out the changes
+	RolloutPhaseVerifying              string = "Verifying"                        // RolloutPhaseVerifying represents the rollout in which the served zone serials are being verified
+	RolloutPhaseActive                 string = "Active"                           // RolloutPhaseActive represents the completed rollout
+	RolloutPhaseRolledBack             string = "RolledBack"                       // RolloutPhaseRolledBack represents the rollout that has been reverted
 )
 
 type CoreDNSConfigMap struct {
@@ -70,11 +87,39 @@ type CoreDNSDeploymentType struct {
 // DNSConnectorSpec defines the desired state of DNSConnector
 type DNSConnectorSpec struct {
 	// waitForUpdateTimeout specifies how long the DNSConnector for coredns to complete update.
-	// if coredns deployment haven't complete the update, the controller will perform rollback.
+	// if coredns deployment haven't complete the update, the controller will perform rollback:
+	// it restores the last known-good Corefile and the zonefile volumes and volume mounts.
 	// The default value is 120 seconds (2 min)
 	// +kubebuilder:default:=120
 	WaitForUpdateTimeout int `json:"waitForUpdateTimeout"`
 
+	// rolloutStrategy specifies how the changes are rolled out to the CoreDNS.
+	// Restart - the CoreDNS pods are restarted on every change.
+	// Reload - the zonefiles are mounted as directories and reloaded by the file plugin, the Corefile is reloaded
+	// by the reload plugin. The CoreDNS pods are restarted only when the set of zones changes.
+	// The rollout is completed when the CoreDNS pods serve the SOA serials of the zones.
+	// The default value is Restart.
+	// +kubebuilder:default:=Restart
+	// +kubebuilder:validation:Enum=Restart;Reload
+	// +kubebuilder:validation:Optional
+	RolloutStrategy string `json:"rolloutStrategy,omitempty"`
+
+	// minRolloutInterval is the coalescing window of the zone changes in seconds.
+	// The changes are rolled out once the window has passed since the first pending change,
+	// so the changes of the DNSZones and DNSForwardZones arriving within the window produce one CoreDNS rollout.
+	// 0 rolls out every change immediately.
+	// The default value is 0, the coalescing is opt-in.
+	// +kubebuilder:default:=0
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinRolloutInterval int `json:"minRolloutInterval,omitempty"`
+
+	// verificationAddress is the address the SOA queries are sent to after the rollout, e.g. the CoreDNS service 10.96.0.10:53.
+	// The served serials of the zones are compared with the serials of the DNSZones.
+	// If not set, every ready CoreDNS pod is queried on port 53.
+	// +kubebuilder:validation:Optional
+	VerificationAddress string `json:"verificationAddress,omitempty"`
+
 	// corednsCM is the name of the CoreDNS ConfigMap.
 	CorednsCM CoreDNSConfigMap `json:"corednsCM"`
 
@@ -93,6 +138,78 @@ type ProvisionedDNSZone struct {
 	Name         string `json:"name"`
 	Domain       string `json:"domain"`
 	SerialNumber string `json:"serialNumber"`
+
+	// mismatch explains why CoreDNS does not serve the zone with the serial of the DNSZone,
+	// e.g. the zone has not been loaded. Empty if the served serial has been verified.
+	// +optional
+	Mismatch string `json:"mismatch,omitempty"`
+}
+
+// ProvisionedDNSForwardZone used to display the status of the forward zones provisioned to the Coredns
+type ProvisionedDNSForwardZone struct {
+	Name       string `json:"name"`
+	Domain     string `json:"domain"`
+	Generation int64  `json:"generation"`
+}
+
+// ConnectorRollback describes the last rollback performed by the DNSConnector.
+type ConnectorRollback struct {
+	// rolledBackAt is the time when the rollback has been performed.
+	RolledBackAt metav1.Time `json:"rolledBackAt"`
+
+	// reason explains why the update has been reverted.
+	Reason string `json:"reason"`
+
+	// observedGeneration is the DNSConnector generation that failed to be applied.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// attemptedZones is the full set of zones the DNSConnector tried to provision.
+	// The DNSConnector will not try to apply the same set of zones again until
+	// one of the zones or the DNSConnector itself is changed.
+	// +optional
+	AttemptedZones []ProvisionedDNSZone `json:"attemptedZones,omitempty"`
+
+	// revertedZones lists the zone changes that have been reverted.
+	// The serialNumber is the serial of the zone version that has not been applied.
+	// +optional
+	RevertedZones []ProvisionedDNSZone `json:"revertedZones,omitempty"`
+
+	// attemptedForwardZones is the full set of forward zones the DNSConnector tried to provision.
+	// +optional
+	AttemptedForwardZones []ProvisionedDNSForwardZone `json:"attemptedForwardZones,omitempty"`
+
+	// revertedForwardZones lists the forward zone changes that have been reverted.
+	// +optional
+	RevertedForwardZones []ProvisionedDNSForwardZone `json:"revertedForwardZones,omitempty"`
+}
+
+// ConnectorRollout tracks the rollout of the changes to the CoreDNS.
+type ConnectorRollout struct {
+	// phase is the phase of the rollout: Applying, WaitingForRollout, Verifying, Active or RolledBack.
+	Phase string `json:"phase"`
+
+	// lastTransitionTime is the time the rollout has entered the phase.
+	// The WaitingForRollout and Verifying phases time out after waitForUpdateTimeout.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+
+	// observedGeneration is the DNSConnector generation being rolled out.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// workloadGeneration is the generation of the CoreDNS workload the rollout waits for.
+	// +optional
+	WorkloadGeneration int64 `json:"workloadGeneration,omitempty"`
+
+	// zones is the set of zones being rolled out.
+	// +optional
+	Zones []ProvisionedDNSZone `json:"zones,omitempty"`
+
+	// forwardZones is the set of forward zones being rolled out.
+	// +optional
+	ForwardZones []ProvisionedDNSForwardZone `json:"forwardZones,omitempty"`
+
+	// message explains what the rollout is waiting for.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // DNSConnectorStatus defines the observed state of DNSConnector
@@ -106,12 +223,34 @@ type DNSConnectorStatus struct {
 	// provisionedZones maps domain names to their serial numbers.
 	// +optional
 	ProvisionedDNSZones []ProvisionedDNSZone `json:"provisionedZones,omitempty"`
+
+	// provisionedForwardZones lists the forward zones provisioned to the CoreDNS with their generations.
+	// +optional
+	ProvisionedForwardZones []ProvisionedDNSForwardZone `json:"provisionedForwardZones,omitempty"`
+
+	// lastRollback displays the last update that has been reverted because coredns
+	// did not become healthy within waitForUpdateTimeout.
+	// +optional
+	LastRollback *ConnectorRollback `json:"lastRollback,omitempty"`
+
+	// rollout tracks the rollout of the last changes.
+	// +optional
+	Rollout *ConnectorRollout `json:"rollout,omitempty"`
+
+	// pendingChanges is the number of the changed DNSZones and DNSForwardZones waiting for the rollout.
+	// +optional
+	PendingChanges int `json:"pendingChanges,omitempty"`
+
+	// pendingSince is the time the first pending change has been detected.
+	// +optional
+	PendingSince *metav1.Time `json:"pendingSince,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Last Change",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].lastTransitionTime",description="Last Change"
 //+kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason",description="The current state"
+//+kubebuilder:printcolumn:name="Rollout",type="string",JSONPath=".status.rollout.phase",description="The phase of the rollout"
 //+kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description="The current state"
 
 // DNSConnector is the Schema for the dnsconnectors API
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ConditionForwardZoneTypeReady       string = "Ready"              // ConditionForwardZoneTypeReady is used to update condition type
+	ConditionReasonForwardZoneActive    string = "Active"             // ConditionReasonForwardZoneActive represents state of the DNSForwardZone
+	ConditionReasonForwardZonePending   string = "Pending"            // ConditionReasonForwardZonePending represents state of the DNSForwardZone
+	ConditionReasonForwardZoneUpdateErr string = "UpdateError"        // ConditionReasonForwardZoneUpdateErr represents state of the DNSForwardZone
+	DnsForwardZoneConnectorIndex        string = "spec.ConnectorName" // DnsForwardZoneConnectorIndex is used for indexing and watching
+	ForwardPolicyRandom                 string = "random"             // ForwardPolicyRandom picks a random upstream for every query
+	ForwardPolicyRoundRobin             string = "round_robin"        // ForwardPolicyRoundRobin picks the upstreams in turn
+	ForwardPolicySequential             string = "sequential"         // ForwardPolicySequential picks the upstreams in the listed order
+)
+
+// DNSForwardZoneSpec defines the desired state of DNSForwardZone.
+// DNSForwardZone forwards the queries for the domain to the upstream name servers.
+type DNSForwardZoneSpec struct {
+	// domain specifies the domain whose queries are forwarded.
+	// +kubebuilder:validation:Required
+	Domain string `json:"domain"`
+
+	// upstreams is the list of the upstream name servers, e.g. 10.0.0.10, 10.0.0.10:53 or tls://10.0.0.10.
+	// +kubebuilder:validation:MinItems=1
+	Upstreams []string `json:"upstreams"`
+
+	// policy specifies how the upstream is selected for the query: random, round_robin or sequential.
+	// The default value is random.
+	// +kubebuilder:default:=random
+	// +kubebuilder:validation:Enum=random;round_robin;sequential
+	// +kubebuilder:validation:Optional
+	Policy string `json:"policy,omitempty"`
+
+	// healthCheck is the interval of the upstream health checks in seconds.
+	// If not set, the CoreDNS default is used (0.5 seconds).
+	// +kubebuilder:validation:Optional
+	HealthCheck uint `json:"healthCheck,omitempty"`
+
+	// tlsServerName is the server name used to verify the TLS certificate of the upstreams.
+	// Used with tls:// upstreams.
+	// +kubebuilder:validation:Optional
+	TLSServerName string `json:"tlsServerName,omitempty"`
+
+	// connectorName is the pointer to the DNSConnector Resource.
+	// Must contain the name of the DNSConnector Resource.
+	// +kubebuilder:validation:Required
+	ConnectorName string `json:"connectorName"`
+}
+
+// DNSForwardZoneStatus defines the observed state of DNSForwardZone
+type DNSForwardZoneStatus struct {
+	// conditions indidicate the status of a DNSForwardZone.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Domain Name",type="string",JSONPath=".spec.domain",description="Domain name"
+//+kubebuilder:printcolumn:name="Upstreams",type="string",JSONPath=".spec.upstreams",description="Upstream name servers"
+//+kubebuilder:printcolumn:name="Last Change",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].lastTransitionTime",description="Last Change"
+//+kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason",description="DNSForwardZone state"
+
+// DNSForwardZone is the Schema for the dnsforwardzones API
+type DNSForwardZone struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DNSForwardZoneSpec   `json:"spec,omitempty"`
+	Status DNSForwardZoneStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DNSForwardZoneList contains a list of DNSForwardZone
+type DNSForwardZoneList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DNSForwardZone `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DNSForwardZone{}, &DNSForwardZoneList{})
+}
@@ -34,13 +34,113 @@ const (
 	ValidationPassedIndex         string = ".status.ValidationPassed" // ValidationPassedIndex is used for indexing and watching
 )
 
+// MXData defines the data of the MX record.
+type MXData struct {
+	// preference is the preference of the mail exchanger. Lower values are preferred.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	Preference uint16 `json:"preference"`
+
+	// exchange is the hostname of the mail exchanger.
+	// +kubebuilder:validation:MinLength=1
+	Exchange string `json:"exchange"`
+}
+
+// SRVData defines the data of the SRV record.
+type SRVData struct {
+	// priority of the target host. Lower values are preferred.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	Priority uint16 `json:"priority"`
+
+	// weight is a relative weight for records with the same priority.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	Weight uint16 `json:"weight"`
+
+	// port is the port of the service on the target host.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	Port uint16 `json:"port"`
+
+	// target is the hostname of the machine providing the service.
+	// +kubebuilder:validation:MinLength=1
+	Target string `json:"target"`
+}
+
+// CAAData defines the data of the CAA record.
+type CAAData struct {
+	// flag is the issuer critical flag. Set it to 128 to mark the property critical.
+	// The default value is 0.
+	// +kubebuilder:default:=0
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=255
+	// +kubebuilder:validation:Optional
+	Flag uint8 `json:"flag"`
+
+	// tag is the property tag, for example issue, issuewild or iodef.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9]+$`
+	Tag string `json:"tag"`
+
+	// value is the property value. It is quoted and escaped automatically.
+	Value string `json:"value"`
+}
+
+// TXTData defines the data of the TXT record.
+type TXTData struct {
+	// strings are the character strings of the record. They are quoted and escaped automatically.
+	// Strings longer than 255 bytes are split into 255 bytes chunks.
+	// +kubebuilder:validation:MinItems=1
+	Strings []string `json:"strings"`
+}
+
+// NAPTRData defines the data of the NAPTR record.
+type NAPTRData struct {
+	// order in which the records must be processed. Lower values are processed first.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	Order uint16 `json:"order"`
+
+	// preference of the records with the same order. Lower values are preferred.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	Preference uint16 `json:"preference"`
+
+	// flags control the rewriting and interpretation of the fields, for example "U", "S", "A" or "P".
+	// +kubebuilder:validation:Optional
+	Flags string `json:"flags,omitempty"`
+
+	// service specifies the service parameters, for example "E2U+sip".
+	// +kubebuilder:validation:Optional
+	Service string `json:"service,omitempty"`
+
+	// regexp is the substitution expression applied to the original string.
+	// +kubebuilder:validation:Optional
+	Regexp string `json:"regexp,omitempty"`
+
+	// replacement is the next domain name to query. Use "." if regexp is set.
+	// The default value is ".".
+	// +kubebuilder:default:=.
+	// +kubebuilder:validation:Optional
+	Replacement string `json:"replacement,omitempty"`
+}
+
 // Record defines DNS record.
 type Record struct {
 	// name specifes the record name.
 	Name string `json:"name"`
 
-	// value is a value of the record
-	Value string `json:"value"`
+	// value is a value of the record.
+	// Either value, values, or one of the typed fields (mx, srv, caa, txt, naptr) must be set.
+	// +kubebuilder:validation:Optional
+	Value string `json:"value,omitempty"`
+
+	// values is a list of values of the record. The DNSRecord owns the whole RRset,
+	// and every value produces its own resource record with the same name, type and ttl.
+	// For example, a list of IP addresses for round-robin A records.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MinItems=1
+	Values []string `json:"values,omitempty"`
 
 	// type is a record type according to RFC1035.
 	// Supported types: A;AAAA;CNAME;MX;TXT;NS;PTR;SRV;CAA;DNSKEY;DS;NAPTR;RRSIG;DNAME;HINFO;
@@ -51,6 +151,26 @@ type Record struct {
 	// if not set, the default is minimumTTL value in the SOA record.
 	// +kubebuilder:validation:Optional
 	TTL string `json:"ttl,omitempty"`
+
+	// mx defines the data of the MX record. Can be used instead of value if type is MX.
+	// +kubebuilder:validation:Optional
+	MX *MXData `json:"mx,omitempty"`
+
+	// srv defines the data of the SRV record. Can be used instead of value if type is SRV.
+	// +kubebuilder:validation:Optional
+	SRV *SRVData `json:"srv,omitempty"`
+
+	// caa defines the data of the CAA record. Can be used instead of value if type is CAA.
+	// +kubebuilder:validation:Optional
+	CAA *CAAData `json:"caa,omitempty"`
+
+	// txt defines the data of the TXT record. Can be used instead of value if type is TXT.
+	// +kubebuilder:validation:Optional
+	TXT *TXTData `json:"txt,omitempty"`
+
+	// naptr defines the data of the NAPTR record. Can be used instead of value if type is NAPTR.
+	// +kubebuilder:validation:Optional
+	NAPTR *NAPTRData `json:"naptr,omitempty"`
 }
 
 type DNSRecordSpec struct {
@@ -73,7 +193,12 @@ type DNSRecordStatus struct {
 	ValidationPassed bool `json:"validationPassed,omitempty"`
 
 	// generatedRecord displayes the generated dns record.
+	// If the record has multiple values, it contains all resource records separated by a new line.
 	GeneratedRecord string `json:"generatedRecord,omitempty"`
+
+	// generatedRecords displays every generated resource record of the RRset.
+	// +optional
+	GeneratedRecords []string `json:"generatedRecords,omitempty"`
 }
 
 //+kubebuilder:object:root=true
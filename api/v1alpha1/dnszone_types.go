@@ -17,20 +17,51 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
-	ConditionZoneTypeReady         string = "Ready"               // ConditionZoneTypeReady is used to update condition type
-	ConditionReasonZoneActive      string = "Active"              // ConditionReasonZoneActive represents state of the DNSZone
-	ConditionReasonZonePending     string = "Pending"             // ConditionReasonRecordPending represents state of the DNSZone
-	ConditionReasonZoneUpdateErr   string = "UpdateError"         // ConditionReasonZoneUpdateErr represents state of the DNSZone
-	ConditionReasonZoneNoConnector string = "NoConnector"         // ConditionReasonZoneNoConnector represents state of the DNSZone in which the zone has no connector
-	ConditionReasonZoneUnknown     string = "Unknown"             // ConditionReasonZoneUnknown string = "Unknown"
-	DnsZonesFinalizerName          string = "dnszones/finalizers" // DnsZonesFinalizerName is finalizer used by DNSZone controller
-	DnsZoneConnectorIndex          string = "spec.ConnectorName"  // DnsZoneConnectorIndex  is used for indexing and watching
+	ConditionZoneTypeReady         string = "Ready"                 // ConditionZoneTypeReady is used to update condition type
+	ConditionReasonZoneActive      string = "Active"                // ConditionReasonZoneActive represents state of the DNSZone
+	ConditionReasonZonePending     string = "Pending"               // ConditionReasonRecordPending represents state of the DNSZone
+	ConditionReasonZoneUpdateErr   string = "UpdateError"           // ConditionReasonZoneUpdateErr represents state of the DNSZone
+	ConditionReasonZoneNoConnector string = "NoConnector"           // ConditionReasonZoneNoConnector represents state of the DNSZone in which the zone has no connector
+	ConditionReasonZoneUnknown     string = "Unknown"               // ConditionReasonZoneUnknown string = "Unknown"
+	DnsZonesFinalizerName          string = "dnszones/finalizers"   // DnsZonesFinalizerName is finalizer used by DNSZone controller
+	DnsZoneConnectorIndex          string = "spec.ConnectorName"    // DnsZoneConnectorIndex  is used for indexing and watching
+	SerialStrategyDateCounter      string = "dateCounter"           // SerialStrategyDateCounter generates serial numbers formatted as YYYYMMDDnn
+	SerialStrategyUnixTime         string = "unixTime"              // SerialStrategyUnixTime generates serial numbers out of the unix timestamp
+	SerialStrategyIncrement        string = "increment"             // SerialStrategyIncrement increments the previous serial number
+	DnsZoneReverseOfLabel          string = "monkale.io/reverse-of" // DnsZoneReverseOfLabel marks companion reverse zones with the name of the forward DNSZone
+	DnsZoneDNSSECSecretSuffix      string = "-dnssec-keys"          // DnsZoneDNSSECSecretSuffix is the suffix of the Secret with the DNSSEC keys of the zone
+	DNSSECKeyTypeKSK               string = "KSK"                   // DNSSECKeyTypeKSK represents the key signing key
+	DNSSECKeyTypeZSK               string = "ZSK"                   // DNSSECKeyTypeZSK represents the zone signing key
+	DNSSECKeyStateActive           string = "Active"                // DNSSECKeyStateActive represents the key that signs the zone
+	DNSSECKeyStatePublished        string = "Published"             // DNSSECKeyStatePublished represents the key that is published before it becomes active
+	DNSSECKeyStateRetired          string = "Retired"               // DNSSECKeyStateRetired represents the key that is still published after it stopped signing
+	TSIGSecretKeyName              string = "keyName"               // TSIGSecretKeyName is the key of the TSIG Secret with the TSIG key name
+	TSIGSecretKeySecret            string = "secret"                // TSIGSecretKeySecret is the key of the TSIG Secret with the base64 encoded TSIG key
+	DNSZoneTypePrimary             string = "Primary"               // DNSZoneTypePrimary represents the zone generated by the operator
+	DNSZoneTypeSecondary           string = "Secondary"             // DNSZoneTypeSecondary represents the zone transferred from the external primaries
+	ConditionZoneTypeLinted        string = "Linted"                // ConditionZoneTypeLinted is the condition type of the zone lint result
+	ConditionReasonLintPassed      string = "Passed"                // ConditionReasonLintPassed represents the zone without lint findings
+	ConditionReasonLintFindings    string = "Findings"              // ConditionReasonLintFindings represents the zone with the lint findings that do not block publishing
+	ConditionReasonLintBlocked     string = "Blocked"               // ConditionReasonLintBlocked represents the zone whose publishing is blocked by the lint findings
+	LintCheckCNAMEAndOtherData     string = "CNAMEAndOtherData"     // LintCheckCNAMEAndOtherData reports CNAME records coexisting with other data at the same owner name
+	LintCheckTargetIsCNAME         string = "TargetIsCNAME"         // LintCheckTargetIsCNAME reports MX, SRV and NS records whose target is a CNAME
+	LintCheckDanglingTarget        string = "DanglingTarget"        // LintCheckDanglingTarget reports in-zone targets that do not resolve to anything
+	LintCheckDuplicateRR           string = "DuplicateRR"           // LintCheckDuplicateRR reports resource records defined more than once
+	LintCheckTTLMismatch           string = "TTLMismatch"           // LintCheckTTLMismatch reports RRsets whose records have different TTLs
+	LintCheckMissingGlue           string = "MissingGlue"           // LintCheckMissingGlue reports in-zone name servers without A or AAAA records
+	LintSeverityError              string = "Error"                 // LintSeverityError represents the findings that break the resolution
+	LintSeverityWarning            string = "Warning"               // LintSeverityWarning represents the findings that are likely mistakes
+	LintSeverityInfo               string = "Info"                  // LintSeverityInfo represents the findings that are only reported
+	LintSeverityIgnore             string = "Ignore"                // LintSeverityIgnore disables the check
+	LintBlockOnNone                string = "None"                  // LintBlockOnNone never blocks publishing of the zone
 )
 
 // primaryNS defines the primary Nameserver for the DNSZone.
@@ -38,12 +69,14 @@ const (
 // the "name" could be negligenced.
 type PrimaryNS struct {
 	// hostname is the server name of the primary name server for this zone.
+	// An absolute hostname ending with a dot, e.g. "ns1.example.com.", is a name server out of the zone,
+	// its address record is not generated in the zone.
 	// The default value is "ns1".
 	// +kubebuilder:default:=ns1
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:validation:MaxLength=253
-	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?)*$`
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?)*\.?$`
 	Hostname string `json:"hostname"`
 
 	// ipAddress defines IP address to the dns server where the zone hosted.
@@ -62,6 +95,8 @@ type PrimaryNS struct {
 // DNSZoneSpec defines the desired state of DNSZone.
 // DNSZoneSpec creates the new zone file with the SOA record.
 // DNSZoneSpec creates DNSRecords of type NS.
+// +kubebuilder:validation:XValidation:rule="self.type == 'Secondary' || (has(self.primaryNS) && has(self.respPersonEmail))",message="primaryNS and respPersonEmail are required for Primary zones"
+// +kubebuilder:validation:XValidation:rule="self.type != 'Secondary' || (has(self.primaries) && size(self.primaries) > 0)",message="primaries are required for Secondary zones"
 type DNSZoneSpec struct {
 	// cmPrefix specifies the prefix for the zone file configmap.
 	// The default value is coredns-zone-.
@@ -75,16 +110,31 @@ type DNSZoneSpec struct {
 	// +kubebuilder:validation:Required
 	Domain string `json:"domain"`
 
+	// type is the type of the zone.
+	// Primary - the zone file is generated by the operator out of the DNSRecords.
+	// Secondary - the zone is transferred from the external primary name servers.
+	// The default value is Primary.
+	// +kubebuilder:default:=Primary
+	// +kubebuilder:validation:Enum=Primary;Secondary
+	// +kubebuilder:validation:Optional
+	Type string `json:"type,omitempty"`
+
+	// primaries is the list of the primary name servers of the Secondary zone, e.g. 192.0.2.1 or 192.0.2.1:53.
+	// +kubebuilder:validation:Optional
+	Primaries []string `json:"primaries,omitempty"`
+
 	// primaryNS defines NS record for the zone, and its A/AAAA record.
-	// +kubebuilder:validation:Required
-	PrimaryNS *PrimaryNS `json:"primaryNS"`
+	// Required for Primary zones.
+	// +kubebuilder:validation:Optional
+	PrimaryNS *PrimaryNS `json:"primaryNS,omitempty"`
 
 	// respPersonEmail is responsible party's email for the domain.
 	// Typically formatted as admin@example.com but represented with a dot (.)
 	// instead of an at (@) in DNS records. The first dot separates the user name from the domain.
-	// +kubebuilder:validation:Required
+	// Required for Primary zones.
+	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,6}$`
-	RespPersonEmail string `json:"respPersonEmail"`
+	RespPersonEmail string `json:"respPersonEmail,omitempty"`
 
 	// ttl specified default Time to Lieve for the zone's records, indicates how long
 	// these records should be cached by DNS resolvers.
@@ -123,10 +173,239 @@ type DNSZoneSpec struct {
 	// +kubebuilder:validation:Optional
 	MinimumTTL uint `json:"minimumTTL,omitempty"`
 
+	// serialStrategy defines how the zone serial number is generated.
+	// dateCounter - YYYYMMDDnn, where nn is the revision of the day (RFC 1912).
+	// unixTime - the unix timestamp of the change.
+	// increment - the previous serial number incremented by one.
+	// Every strategy guarantees the new serial is greater than the previous one
+	// according to the serial number arithmetic (RFC 1982).
+	// The default value is dateCounter.
+	// +kubebuilder:default:=dateCounter
+	// +kubebuilder:validation:Enum=dateCounter;unixTime;increment
+	// +kubebuilder:validation:Optional
+	SerialStrategy string `json:"serialStrategy,omitempty"`
+
+	// minRenderInterval is the coalescing window of the DNSRecord changes in seconds.
+	// The zone is rendered once the window has passed since the first pending change,
+	// so the changes arriving within the window produce one zone render and one CoreDNS rollout.
+	// 0 renders every change immediately.
+	// The default value is 0, the coalescing is opt-in.
+	// +kubebuilder:default:=0
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinRenderInterval int `json:"minRenderInterval,omitempty"`
+
 	// connectorName is the pointer to the DNSConnector Resource.
 	// Must contain the name of the DNSConnector Resource.
 	// +kubebuilder:validation:Required
 	ConnectorName string `json:"connectorName,omitempty"`
+
+	// dnssec defines DNSSEC signing of the zone.
+	// +kubebuilder:validation:Optional
+	DNSSEC *DNSSEC `json:"dnssec,omitempty"`
+
+	// transfer allows zone transfers (AXFR/IXFR) to the secondary name servers.
+	// +kubebuilder:validation:Optional
+	Transfer *ZoneTransfer `json:"transfer,omitempty"`
+
+	// reverseZones is the list of networks in CIDR notation, e.g. 10.0.0.0/24 or fd00::/64.
+	// For every network the companion in-addr.arpa or ip6.arpa DNSZone is created, with PTR records
+	// derived from the A and AAAA records of this zone.
+	// IPv4 prefix length must be a multiple of 8, IPv6 prefix length must be a multiple of 4.
+	// +kubebuilder:validation:Optional
+	ReverseZones []string `json:"reverseZones,omitempty"`
+
+	// lint defines the severity policy of the zone lint.
+	// By default only the Error findings block publishing of the zone.
+	// +kubebuilder:validation:Optional
+	Lint *ZoneLint `json:"lint,omitempty"`
+
+	// allowedSourceNamespaces lists the namespaces whose Services, Ingresses and HTTPRoutes may publish records into the zone.
+	// The sources in the namespace of the DNSZone are always allowed. "*" allows the sources of every namespace.
+	// By default only the sources in the namespace of the DNSZone are allowed.
+	// +kubebuilder:validation:Optional
+	AllowedSourceNamespaces []string `json:"allowedSourceNamespaces,omitempty"`
+}
+
+// ZoneLint defines which lint findings block publishing of the zone.
+// The zone is linted before every render. The DNSRecords involved in the findings blocking publishing are excluded from the zone.
+// If the findings involving no DNSRecord block publishing, the previous version of the zone is preserved.
+type ZoneLint struct {
+	// blockOn is the lowest severity of the findings that block publishing of the zone.
+	// Error - the errors block publishing.
+	// Warning - the errors and the warnings block publishing.
+	// None - the findings are only reported.
+	// The default value is Error.
+	// +kubebuilder:default:=Error
+	// +kubebuilder:validation:Enum=Error;Warning;None
+	// +kubebuilder:validation:Optional
+	BlockOn string `json:"blockOn,omitempty"`
+
+	// severities overrides the default severities of the checks.
+	// The defaults are: CNAMEAndOtherData - Error, MissingGlue - Error, TargetIsCNAME - Warning,
+	// DanglingTarget - Warning, DuplicateRR - Warning, TTLMismatch - Info.
+	// +listType=map
+	// +listMapKey=check
+	// +kubebuilder:validation:Optional
+	Severities []LintSeverity `json:"severities,omitempty"`
+}
+
+// LintSeverity overrides the severity of the lint check.
+type LintSeverity struct {
+	// check is the name of the lint check.
+	// +kubebuilder:validation:Enum=CNAMEAndOtherData;TargetIsCNAME;DanglingTarget;DuplicateRR;TTLMismatch;MissingGlue
+	Check string `json:"check"`
+
+	// severity of the findings of the check. Ignore disables the check.
+	// +kubebuilder:validation:Enum=Error;Warning;Info;Ignore
+	Severity string `json:"severity"`
+}
+
+// LintFinding represents the finding of the zone lint.
+type LintFinding struct {
+	// check is the name of the lint check.
+	Check string `json:"check"`
+
+	// severity is Error, Warning or Info.
+	Severity string `json:"severity"`
+
+	// name is the owner name of the records.
+	Name string `json:"name"`
+
+	// type is the type of the records.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// message describes the finding.
+	Message string `json:"message"`
+
+	// dnsRecords are the names of the DNSRecords involved. The SOA and NS records of the zone are not DNSRecords.
+	// +optional
+	DNSRecords []string `json:"dnsRecords,omitempty"`
+}
+
+// DNSSEC defines DNSSEC signing of the zone.
+// The keys are stored in the Secret named "metadata.name" + "-dnssec-keys".
+type DNSSEC struct {
+	// enabled turns on DNSSEC signing of the zone.
+	Enabled bool `json:"enabled"`
+
+	// algorithm is the DNSSEC algorithm of the keys.
+	// Changing the algorithm generates new keys, the DS record must be updated at the parent zone.
+	// The default value is ECDSAP256SHA256.
+	// +kubebuilder:default:=ECDSAP256SHA256
+	// +kubebuilder:validation:Enum=ECDSAP256SHA256;ECDSAP384SHA384;ED25519;RSASHA256
+	// +kubebuilder:validation:Optional
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// signatureValidity is the validity period of the signatures (RRSIG) in seconds.
+	// The default value is 1209600 seconds (2 weeks)
+	// +kubebuilder:default:=1209600
+	// +kubebuilder:validation:Minimum=86400
+	// +kubebuilder:validation:Optional
+	SignatureValidity uint `json:"signatureValidity,omitempty"`
+
+	// resignBefore defines how long before the expiration the signatures are renewed, in seconds.
+	// Must be less than signatureValidity.
+	// The default value is 432000 seconds (5 days)
+	// +kubebuilder:default:=432000
+	// +kubebuilder:validation:Minimum=3600
+	// +kubebuilder:validation:Optional
+	ResignBefore uint `json:"resignBefore,omitempty"`
+
+	// zskRolloverPeriod is the lifetime of the zone signing key in seconds. 0 disables the rollover.
+	// The default value is 7776000 seconds (90 days)
+	// +kubebuilder:default:=7776000
+	// +kubebuilder:validation:Optional
+	ZSKRolloverPeriod uint `json:"zskRolloverPeriod"`
+
+	// zskPrePublish defines how long the new zone signing key is published before it becomes active,
+	// and how long the old key is published after it stopped signing, in seconds.
+	// Must be longer than the TTL of the zone records.
+	// The default value is 172800 seconds (2 days)
+	// +kubebuilder:default:=172800
+	// +kubebuilder:validation:Optional
+	ZSKPrePublish uint `json:"zskPrePublish,omitempty"`
+}
+
+// ZoneTransfer defines the secondary name servers allowed to transfer the zone.
+// The secondaries are notified when the zone changes.
+type ZoneTransfer struct {
+	// to is the list of the secondary name servers allowed to transfer the zone.
+	// Each entry is an IP address, an IP address with the port, e.g. 192.0.2.10:53, or "*" to allow any address.
+	// +kubebuilder:validation:MinItems=1
+	To []string `json:"to"`
+
+	// tsigSecretName is the name of the Secret with the TSIG key in the namespace of the DNSZone.
+	// The Secret must contain the "keyName" and the "secret" (base64) keys.
+	// If set, the transfers are allowed only to the clients signing the requests with the key.
+	// +kubebuilder:validation:Optional
+	TSIGSecretName string `json:"tsigSecretName,omitempty"`
+}
+
+// DNSSECKey represents the DNSSEC key of the zone.
+type DNSSECKey struct {
+	// keyTag is the key tag of the DNSKEY.
+	KeyTag uint16 `json:"keyTag"`
+
+	// type is KSK or ZSK.
+	Type string `json:"type"`
+
+	// state is Active, Published or Retired.
+	State string `json:"state"`
+
+	// algorithm is the DNSSEC algorithm of the key.
+	Algorithm string `json:"algorithm"`
+}
+
+// DNSSECStatus represents the DNSSEC state of the zone.
+type DNSSECStatus struct {
+	// ds are the DS records of the key signing key. Publish one of them in the parent zone.
+	// +optional
+	DS []string `json:"ds,omitempty"`
+
+	// keys are the DNSKEYs published in the zone.
+	// +optional
+	Keys []DNSSECKey `json:"keys,omitempty"`
+
+	// signatureExpiration is the expiration time of the signatures.
+	// +optional
+	SignatureExpiration *metav1.Time `json:"signatureExpiration,omitempty"`
+
+	// nextZSKRollover is the time when the next zone signing key rollover step takes place.
+	// +optional
+	NextZSKRollover *metav1.Time `json:"nextZSKRollover,omitempty"`
+}
+
+// ReverseZone represents the companion reverse DNSZone generated for the network.
+type ReverseZone struct {
+	// cidr is the network from spec.reverseZones.
+	CIDR string `json:"cidr"`
+
+	// domain is the in-addr.arpa or ip6.arpa domain of the network.
+	// +optional
+	Domain string `json:"domain,omitempty"`
+
+	// dnsZoneName is the name of the companion DNSZone.
+	// +optional
+	DNSZoneName string `json:"dnsZoneName,omitempty"`
+
+	// recordCount is the number of PTR records generated for the network.
+	// +optional
+	RecordCount int `json:"recordCount,omitempty"`
+
+	// message explains why the reverse zone could not be generated.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ExcludedDNSRecord represents the DNSRecord excluded from the zone.
+type ExcludedDNSRecord struct {
+	// name is the name of the DNSRecord.
+	Name string `json:"name"`
+
+	// message is the parser error of the record within the zone, or the lint finding blocking publishing.
+	Message string `json:"message"`
 }
 
 // DNSZoneStatus defines the observed state of DNSZone
@@ -140,8 +419,10 @@ type DNSZoneStatus struct {
 	// currentZoneSerial is a version number that changes update of the zone file,
 	// signaling to secondary DNS servers when they should synchronize their data.
 	// In our reality we use it to represent the zone file version.
-	// Zone Serial implemented as time now formatted to MMDDHHMMSS.
+	// Zone Serial is generated according to spec.serialStrategy, and it always grows.
 	// Zone Serial represents the current version of the zone file.
+	// For Secondary zones it is the serial of the zone on the primary name servers, as queried by the operator.
+	// It is not the serial transferred into CoreDNS, a failed zone transfer is not reflected.
 	// +optional
 	// +kubebuilder:default:="000000001"
 	CurrentZoneSerial string `json:"currentZoneSerial,omitempty"`
@@ -162,15 +443,45 @@ type DNSZoneStatus struct {
 	// This flag is used to instruct the DNSConnector to preserve the old version of the DNSZone
 	// in case the update process encounters an issue.
 	Checkpoint bool `json:"checkpoint,omitempty"`
+
+	// dnssec displays the DNSSEC keys and the DS records of the zone.
+	// +optional
+	DNSSEC *DNSSECStatus `json:"dnssec,omitempty"`
+
+	// reverseZones displays the companion reverse DNSZones generated from spec.reverseZones.
+	// +optional
+	ReverseZones []ReverseZone `json:"reverseZones,omitempty"`
+
+	// excludedRecords are the DNSRecords excluded from the zone, because they fail the validation within the zone,
+	// or they are involved in the lint findings blocking publishing.
+	// The other DNSRecords of the zone are published.
+	// +optional
+	ExcludedRecords []ExcludedDNSRecord `json:"excludedRecords,omitempty"`
+
+	// lintFindings are the findings of the last zone lint, ordered by severity.
+	// At most 50 findings are listed, the Linted condition reports the total.
+	// +optional
+	LintFindings []LintFinding `json:"lintFindings,omitempty"`
+
+	// pendingChanges is the number of the changed DNSRecords waiting for the zone render.
+	// +optional
+	PendingChanges int `json:"pendingChanges,omitempty"`
+
+	// pendingSince is the time the first pending change has been detected.
+	// +optional
+	PendingSince *metav1.Time `json:"pendingSince,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Domain Name",type="string",JSONPath=".spec.domain",description="Domain name"
+//+kubebuilder:printcolumn:name="Type",type="string",JSONPath=".spec.type",description="Zone type",priority=1
 //+kubebuilder:printcolumn:name="Record Count",type="integer",JSONPath=".status.recordCount",description="Record Count. Without SOA and First NS"
 //+kubebuilder:printcolumn:name="Last Change",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].lastTransitionTime",description="Last Change"
 //+kubebuilder:printcolumn:name="Current Serial",type="string",JSONPath=".status.currentZoneSerial",description="Represents the current version of the zonefile"
 //+kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason",description="DNSZone state"
+//+kubebuilder:printcolumn:name="Lint",type="string",JSONPath=".status.conditions[?(@.type==\"Linted\")].reason",description="Zone lint result"
+//+kubebuilder:printcolumn:name="Pending",type="integer",JSONPath=".status.pendingChanges",description="DNSRecord changes waiting for the zone render"
 
 // DNSZone is the Schema for the dnszones API
 type DNSZone struct {
@@ -194,8 +505,9 @@ type DNSZoneList struct {
 // values needed to define the SOA, its NS and A records.
 type DNSZoneHeader struct {
 	DomainName        string // Zone origin
-	PrimaryNSHostname string // Primary nameserver hostname
-	PrimaryNSIp       string // Primary nameserver IP
+	PrimaryNSName     string // Primary nameserver FQDN
+	PrimaryNSHostname string // Primary nameserver hostname relative to the zone origin
+	PrimaryNSIp       string // Primary nameserver IP, empty if the nameserver is out of the zone
 	PrimaryNSType     string // Primary nameserver record type: A or AAAA
 	RespPerson        string // Responsible person's email
 	Serial            string // Serial number
@@ -206,13 +518,57 @@ type DNSZoneHeader struct {
 	MinimumTTL        uint   // Minimum TTL
 }
 
-// DNSZoneGenerateSerial generates serial number in format using time formatted to MMDDHHMMSS
-func DNSZoneGenerateSerial() (string, error) {
-	now := time.Now()
-	timePart := now.Format("0102150405")
+// DNSZoneGenerateSerial generates the next serial number for the zone according to the strategy.
+// previousSerials are the serial numbers the zone has been published with. The generated serial is
+// strictly greater than the greatest of them according to the serial number arithmetic (RFC 1982).
+// If the strategy cannot produce a greater serial, for example two changes within the same second
+// or more than 99 changes per day, the previous serial is incremented by one.
+func DNSZoneGenerateSerial(strategy string, previousSerials ...string) (string, error) {
+	return generateSerial(strategy, time.Now().UTC(), previousSerials...)
+}
+
+// generateSerial generates the next serial number for the zone at the given time, see DNSZoneGenerateSerial.
+func generateSerial(strategy string, now time.Time, previousSerials ...string) (string, error) {
+	var previous uint32
+	found := false
+	for _, serial := range previousSerials {
+		if serial == "" {
+			continue
+		}
+		parsed, err := strconv.ParseUint(serial, 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("could not parse serial number %q: %v", serial, err)
+		}
+		if !found || SerialIsGreater(uint32(parsed), previous) {
+			previous = uint32(parsed)
+			found = true
+		}
+	}
+
+	var candidate uint32
+	switch strategy {
+	case SerialStrategyDateCounter, "":
+		date, _ := strconv.ParseUint(now.Format("20060102"), 10, 32)
+		candidate = uint32(date) * 100
+	case SerialStrategyUnixTime:
+		candidate = uint32(now.Unix())
+	case SerialStrategyIncrement:
+		candidate = previous + 1
+	default:
+		return "", fmt.Errorf("unsupported serial strategy: %s", strategy)
+	}
+
+	if !SerialIsGreater(candidate, previous) {
+		candidate = previous + 1
+	}
+	return strconv.FormatUint(uint64(candidate), 10), nil
+}
 
-	// Ensure that the final serial number is a string
-	return timePart, nil
+// SerialIsGreater compares two serial numbers according to RFC 1982 with SERIAL_BITS 32.
+// Returns true if s1 is greater than s2.
+func SerialIsGreater(s1, s2 uint32) bool {
+	const half uint32 = 1 << 31
+	return (s1 < s2 && s2-s1 > half) || (s1 > s2 && s1-s2 < half)
 }
 
 func init() {
@@ -0,0 +1,105 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerateSerial(t *testing.T) {
+	now := time.Date(2024, time.May, 17, 12, 30, 45, 0, time.UTC)
+	unixNow := "1715949045"
+	tests := []struct {
+		name     string
+		strategy string
+		now      time.Time
+		previous []string
+		want     string
+	}{
+		{name: "dateCounter first serial", strategy: SerialStrategyDateCounter, now: now, want: "2024051700"},
+		{name: "dateCounter is the default", strategy: "", now: now, want: "2024051700"},
+		{name: "dateCounter second change of the day", strategy: SerialStrategyDateCounter, now: now, previous: []string{"2024051700"}, want: "2024051701"},
+		{name: "dateCounter next day", strategy: SerialStrategyDateCounter, now: now, previous: []string{"2024051605"}, want: "2024051700"},
+		{name: "dateCounter new year", strategy: SerialStrategyDateCounter, now: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), previous: []string{"2024123142"}, want: "2025010100"},
+		{name: "dateCounter 100th change of the day", strategy: SerialStrategyDateCounter, now: now, previous: []string{"2024051799"}, want: "2024051800"},
+		{name: "dateCounter after more than 99 changes per day", strategy: SerialStrategyDateCounter, now: now, previous: []string{"2024051805"}, want: "2024051806"},
+		{name: "dateCounter clock set back", strategy: SerialStrategyDateCounter, now: now, previous: []string{"2024060100"}, want: "2024060101"},
+		{name: "legacy MMDDHHMMSS to dateCounter", strategy: SerialStrategyDateCounter, now: now, previous: []string{"1231235959"}, want: "2024051700"},
+		{name: "greatest of the previous serials", strategy: SerialStrategyDateCounter, now: now, previous: []string{"2024051703", "", "2024051707", "1231235959"}, want: "2024051708"},
+		{name: "unixTime", strategy: SerialStrategyUnixTime, now: now, want: unixNow},
+		{name: "unixTime within the same second", strategy: SerialStrategyUnixTime, now: now, previous: []string{unixNow}, want: "1715949046"},
+		{name: "increment first serial", strategy: SerialStrategyIncrement, now: now, want: "1"},
+		{name: "increment", strategy: SerialStrategyIncrement, now: now, previous: []string{"41"}, want: "42"},
+		{name: "unixTime to dateCounter", strategy: SerialStrategyDateCounter, now: now, previous: []string{unixNow}, want: "2024051700"},
+		{name: "dateCounter to unixTime", strategy: SerialStrategyUnixTime, now: now, previous: []string{"2024051703"}, want: "2024051704"},
+		{name: "dateCounter to increment", strategy: SerialStrategyIncrement, now: now, previous: []string{"2024051703"}, want: "2024051704"},
+		{name: "increment wraps around", strategy: SerialStrategyIncrement, now: now, previous: []string{"4294967295"}, want: "0"},
+		{name: "dateCounter after wraparound", strategy: SerialStrategyDateCounter, now: now, previous: []string{"4294967295"}, want: "2024051700"},
+		{name: "dateCounter close before wraparound", strategy: SerialStrategyDateCounter, now: now, previous: []string{"3000000000"}, want: "3000000001"},
+		{name: "greatest of the previous serials across wraparound", strategy: SerialStrategyIncrement, now: now, previous: []string{"4294967290", "5"}, want: "6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generateSerial(tt.strategy, tt.now, tt.previous...)
+			if err != nil {
+				t.Fatalf("generateSerial() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("generateSerial() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSerialErrors(t *testing.T) {
+	now := time.Date(2024, time.May, 17, 12, 30, 45, 0, time.UTC)
+	if _, err := generateSerial("weekly", now); err == nil {
+		t.Errorf("generateSerial() with an unsupported strategy error = nil, want an error")
+	}
+	if _, err := generateSerial(SerialStrategyDateCounter, now, "not-a-serial"); err == nil {
+		t.Errorf("generateSerial() with an invalid serial error = nil, want an error")
+	}
+	if _, err := generateSerial(SerialStrategyDateCounter, now, "4294967296"); err == nil {
+		t.Errorf("generateSerial() with a serial greater than 2^32-1 error = nil, want an error")
+	}
+}
+
+func TestSerialIsGreater(t *testing.T) {
+	tests := []struct {
+		s1, s2 uint32
+		want   bool
+	}{
+		{s1: 2, s2: 1, want: true},
+		{s1: 1, s2: 2, want: false},
+		{s1: 1, s2: 1, want: false},
+		{s1: 0, s2: 4294967295, want: true},
+		{s1: 4294967295, s2: 0, want: false},
+		{s1: 2147483647, s2: 0, want: true},
+		{s1: 100, s2: 4294967200, want: true},
+		{s1: 2024051700, s2: 1715949045, want: true},
+		{s1: 1715949045, s2: 2024051700, want: false},
+		// the serials 2^31 apart are undefined by RFC 1982, neither is greater
+		{s1: 2147483648, s2: 0, want: false},
+		{s1: 0, s2: 2147483648, want: false},
+	}
+	for _, tt := range tests {
+		if got := SerialIsGreater(tt.s1, tt.s2); got != tt.want {
+			t.Errorf("SerialIsGreater(%d, %d) = %v, want %v", tt.s1, tt.s2, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Sources are kubernetes objects, such as Services, Ingresses and HTTPRoutes, which publish their addresses as DNSRecords.
+// The source controllers create DNSRecords in the namespace of the target DNSZone and track them by labels,
+// because the owner references cannot cross namespaces.
+const (
+	SourceHostnameAnnotation string = "monkale.io/hostname"           // SourceHostnameAnnotation is a comma separated list of hostnames to publish
+	SourceDNSZoneAnnotation  string = "monkale.io/dnszone"            // SourceDNSZoneAnnotation references the target DNSZone as "name" or "namespace/name"
+	SourceTTLAnnotation      string = "monkale.io/ttl"                // SourceTTLAnnotation sets the TTL of the published records
+	SourceKindLabel          string = "monkale.io/source-kind"        // SourceKindLabel is the kind of the source object that owns the DNSRecord
+	SourceNamespaceLabel     string = "monkale.io/source-namespace"   // SourceNamespaceLabel is the namespace of the source object that owns the DNSRecord
+	SourceNameLabel          string = "monkale.io/source-name"        // SourceNameLabel is the name of the source object that owns the DNSRecord, truncated and hashed if longer than 63 characters
+	SourceNameAnnotation     string = "monkale.io/source-name"        // SourceNameAnnotation is the full name of the source object that owns the DNSRecord
+	SourceFinalizerName      string = "monkale.io/dnsrecords-cleanup" // SourceFinalizerName is finalizer used by source controllers to clean up DNSRecords
+	SourceKindService        string = "Service"                       // SourceKindService is the source kind for Services
+	SourceKindIngress        string = "Ingress"                       // SourceKindIngress is the source kind for Ingresses
+	SourceKindHTTPRoute      string = "HTTPRoute"                     // SourceKindHTTPRoute is the source kind for Gateway API HTTPRoutes
+	SourceKindDNSZone        string = "DNSZone"                       // SourceKindDNSZone is the source kind for PTR records derived from the forward DNSZone
+	SourceKindDNSUpdate      string = "DNSUpdate"                     // SourceKindDNSUpdate is the source kind for records created by RFC 2136 dynamic updates
+	SourceKindExternalDNS    string = "ExternalDNS"                   // SourceKindExternalDNS is the source kind for records created through the external-dns webhook provider
+	SourceKindACMEChallenge  string = "ACMEChallenge"                 // SourceKindACMEChallenge is the source kind for TXT records presented by the cert-manager DNS-01 solver
+	SourceNamespacesAll      string = "*"                             // SourceNamespacesAll in DNSZone spec.allowedSourceNamespaces allows the sources of every namespace
+)
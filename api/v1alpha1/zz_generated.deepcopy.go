@@ -27,6 +27,83 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAAData) DeepCopyInto(out *CAAData) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAAData.
+func (in *CAAData) DeepCopy() *CAAData {
+	if in == nil {
+		return nil
+	}
+	out := new(CAAData)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConnectorRollback) DeepCopyInto(out *ConnectorRollback) {
+	*out = *in
+	in.RolledBackAt.DeepCopyInto(&out.RolledBackAt)
+	if in.AttemptedZones != nil {
+		in, out := &in.AttemptedZones, &out.AttemptedZones
+		*out = make([]ProvisionedDNSZone, len(*in))
+		copy(*out, *in)
+	}
+	if in.RevertedZones != nil {
+		in, out := &in.RevertedZones, &out.RevertedZones
+		*out = make([]ProvisionedDNSZone, len(*in))
+		copy(*out, *in)
+	}
+	if in.AttemptedForwardZones != nil {
+		in, out := &in.AttemptedForwardZones, &out.AttemptedForwardZones
+		*out = make([]ProvisionedDNSForwardZone, len(*in))
+		copy(*out, *in)
+	}
+	if in.RevertedForwardZones != nil {
+		in, out := &in.RevertedForwardZones, &out.RevertedForwardZones
+		*out = make([]ProvisionedDNSForwardZone, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConnectorRollback.
+func (in *ConnectorRollback) DeepCopy() *ConnectorRollback {
+	if in == nil {
+		return nil
+	}
+	out := new(ConnectorRollback)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConnectorRollout) DeepCopyInto(out *ConnectorRollout) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make([]ProvisionedDNSZone, len(*in))
+		copy(*out, *in)
+	}
+	if in.ForwardZones != nil {
+		in, out := &in.ForwardZones, &out.ForwardZones
+		*out = make([]ProvisionedDNSForwardZone, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConnectorRollout.
+func (in *ConnectorRollout) DeepCopy() *ConnectorRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(ConnectorRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CoreDNSConfigMap) DeepCopyInto(out *CoreDNSConfigMap) {
 	*out = *in
@@ -153,6 +230,25 @@ func (in *DNSConnectorStatus) DeepCopyInto(out *DNSConnectorStatus) {
 		*out = make([]ProvisionedDNSZone, len(*in))
 		copy(*out, *in)
 	}
+	if in.ProvisionedForwardZones != nil {
+		in, out := &in.ProvisionedForwardZones, &out.ProvisionedForwardZones
+		*out = make([]ProvisionedDNSForwardZone, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastRollback != nil {
+		in, out := &in.LastRollback, &out.LastRollback
+		*out = new(ConnectorRollback)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(ConnectorRollout)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PendingSince != nil {
+		in, out := &in.PendingSince, &out.PendingSince
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSConnectorStatus.
@@ -165,6 +261,107 @@ func (in *DNSConnectorStatus) DeepCopy() *DNSConnectorStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSForwardZone) DeepCopyInto(out *DNSForwardZone) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSForwardZone.
+func (in *DNSForwardZone) DeepCopy() *DNSForwardZone {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSForwardZone)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DNSForwardZone) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSForwardZoneList) DeepCopyInto(out *DNSForwardZoneList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DNSForwardZone, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSForwardZoneList.
+func (in *DNSForwardZoneList) DeepCopy() *DNSForwardZoneList {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSForwardZoneList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DNSForwardZoneList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSForwardZoneSpec) DeepCopyInto(out *DNSForwardZoneSpec) {
+	*out = *in
+	if in.Upstreams != nil {
+		in, out := &in.Upstreams, &out.Upstreams
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSForwardZoneSpec.
+func (in *DNSForwardZoneSpec) DeepCopy() *DNSForwardZoneSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSForwardZoneSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSForwardZoneStatus) DeepCopyInto(out *DNSForwardZoneStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSForwardZoneStatus.
+func (in *DNSForwardZoneStatus) DeepCopy() *DNSForwardZoneStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSForwardZoneStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSRecord) DeepCopyInto(out *DNSRecord) {
 	*out = *in
@@ -230,7 +427,7 @@ func (in *DNSRecordSpec) DeepCopyInto(out *DNSRecordSpec) {
 	if in.Record != nil {
 		in, out := &in.Record, &out.Record
 		*out = new(Record)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.DNSZoneRef != nil {
 		in, out := &in.DNSZoneRef, &out.DNSZoneRef
@@ -259,6 +456,11 @@ func (in *DNSRecordStatus) DeepCopyInto(out *DNSRecordStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.GeneratedRecords != nil {
+		in, out := &in.GeneratedRecords, &out.GeneratedRecords
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSRecordStatus.
@@ -271,6 +473,69 @@ func (in *DNSRecordStatus) DeepCopy() *DNSRecordStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSSEC) DeepCopyInto(out *DNSSEC) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSSEC.
+func (in *DNSSEC) DeepCopy() *DNSSEC {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSSEC)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSSECKey) DeepCopyInto(out *DNSSECKey) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSSECKey.
+func (in *DNSSECKey) DeepCopy() *DNSSECKey {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSSECKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSSECStatus) DeepCopyInto(out *DNSSECStatus) {
+	*out = *in
+	if in.DS != nil {
+		in, out := &in.DS, &out.DS
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]DNSSECKey, len(*in))
+		copy(*out, *in)
+	}
+	if in.SignatureExpiration != nil {
+		in, out := &in.SignatureExpiration, &out.SignatureExpiration
+		*out = (*in).DeepCopy()
+	}
+	if in.NextZSKRollover != nil {
+		in, out := &in.NextZSKRollover, &out.NextZSKRollover
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSSECStatus.
+func (in *DNSSECStatus) DeepCopy() *DNSSECStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSSECStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSZone) DeepCopyInto(out *DNSZone) {
 	*out = *in
@@ -348,11 +613,41 @@ func (in *DNSZoneList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSZoneSpec) DeepCopyInto(out *DNSZoneSpec) {
 	*out = *in
+	if in.Primaries != nil {
+		in, out := &in.Primaries, &out.Primaries
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.PrimaryNS != nil {
 		in, out := &in.PrimaryNS, &out.PrimaryNS
 		*out = new(PrimaryNS)
 		**out = **in
 	}
+	if in.DNSSEC != nil {
+		in, out := &in.DNSSEC, &out.DNSSEC
+		*out = new(DNSSEC)
+		**out = **in
+	}
+	if in.Transfer != nil {
+		in, out := &in.Transfer, &out.Transfer
+		*out = new(ZoneTransfer)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReverseZones != nil {
+		in, out := &in.ReverseZones, &out.ReverseZones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Lint != nil {
+		in, out := &in.Lint, &out.Lint
+		*out = new(ZoneLint)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AllowedSourceNamespaces != nil {
+		in, out := &in.AllowedSourceNamespaces, &out.AllowedSourceNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSZoneSpec.
@@ -375,6 +670,32 @@ func (in *DNSZoneStatus) DeepCopyInto(out *DNSZoneStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.DNSSEC != nil {
+		in, out := &in.DNSSEC, &out.DNSSEC
+		*out = new(DNSSECStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReverseZones != nil {
+		in, out := &in.ReverseZones, &out.ReverseZones
+		*out = make([]ReverseZone, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludedRecords != nil {
+		in, out := &in.ExcludedRecords, &out.ExcludedRecords
+		*out = make([]ExcludedDNSRecord, len(*in))
+		copy(*out, *in)
+	}
+	if in.LintFindings != nil {
+		in, out := &in.LintFindings, &out.LintFindings
+		*out = make([]LintFinding, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PendingSince != nil {
+		in, out := &in.PendingSince, &out.PendingSince
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSZoneStatus.
@@ -387,6 +708,86 @@ func (in *DNSZoneStatus) DeepCopy() *DNSZoneStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExcludedDNSRecord) DeepCopyInto(out *ExcludedDNSRecord) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExcludedDNSRecord.
+func (in *ExcludedDNSRecord) DeepCopy() *ExcludedDNSRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(ExcludedDNSRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LintFinding) DeepCopyInto(out *LintFinding) {
+	*out = *in
+	if in.DNSRecords != nil {
+		in, out := &in.DNSRecords, &out.DNSRecords
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LintFinding.
+func (in *LintFinding) DeepCopy() *LintFinding {
+	if in == nil {
+		return nil
+	}
+	out := new(LintFinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LintSeverity) DeepCopyInto(out *LintSeverity) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LintSeverity.
+func (in *LintSeverity) DeepCopy() *LintSeverity {
+	if in == nil {
+		return nil
+	}
+	out := new(LintSeverity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MXData) DeepCopyInto(out *MXData) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MXData.
+func (in *MXData) DeepCopy() *MXData {
+	if in == nil {
+		return nil
+	}
+	out := new(MXData)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NAPTRData) DeepCopyInto(out *NAPTRData) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NAPTRData.
+func (in *NAPTRData) DeepCopy() *NAPTRData {
+	if in == nil {
+		return nil
+	}
+	out := new(NAPTRData)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PrimaryNS) DeepCopyInto(out *PrimaryNS) {
 	*out = *in
@@ -402,6 +803,21 @@ func (in *PrimaryNS) DeepCopy() *PrimaryNS {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProvisionedDNSForwardZone) DeepCopyInto(out *ProvisionedDNSForwardZone) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProvisionedDNSForwardZone.
+func (in *ProvisionedDNSForwardZone) DeepCopy() *ProvisionedDNSForwardZone {
+	if in == nil {
+		return nil
+	}
+	out := new(ProvisionedDNSForwardZone)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProvisionedDNSZone) DeepCopyInto(out *ProvisionedDNSZone) {
 	*out = *in
@@ -420,6 +836,36 @@ func (in *ProvisionedDNSZone) DeepCopy() *ProvisionedDNSZone {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Record) DeepCopyInto(out *Record) {
 	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MX != nil {
+		in, out := &in.MX, &out.MX
+		*out = new(MXData)
+		**out = **in
+	}
+	if in.SRV != nil {
+		in, out := &in.SRV, &out.SRV
+		*out = new(SRVData)
+		**out = **in
+	}
+	if in.CAA != nil {
+		in, out := &in.CAA, &out.CAA
+		*out = new(CAAData)
+		**out = **in
+	}
+	if in.TXT != nil {
+		in, out := &in.TXT, &out.TXT
+		*out = new(TXTData)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NAPTR != nil {
+		in, out := &in.NAPTR, &out.NAPTR
+		*out = new(NAPTRData)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Record.
@@ -431,3 +877,93 @@ func (in *Record) DeepCopy() *Record {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReverseZone) DeepCopyInto(out *ReverseZone) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReverseZone.
+func (in *ReverseZone) DeepCopy() *ReverseZone {
+	if in == nil {
+		return nil
+	}
+	out := new(ReverseZone)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SRVData) DeepCopyInto(out *SRVData) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SRVData.
+func (in *SRVData) DeepCopy() *SRVData {
+	if in == nil {
+		return nil
+	}
+	out := new(SRVData)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TXTData) DeepCopyInto(out *TXTData) {
+	*out = *in
+	if in.Strings != nil {
+		in, out := &in.Strings, &out.Strings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TXTData.
+func (in *TXTData) DeepCopy() *TXTData {
+	if in == nil {
+		return nil
+	}
+	out := new(TXTData)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZoneLint) DeepCopyInto(out *ZoneLint) {
+	*out = *in
+	if in.Severities != nil {
+		in, out := &in.Severities, &out.Severities
+		*out = make([]LintSeverity, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZoneLint.
+func (in *ZoneLint) DeepCopy() *ZoneLint {
+	if in == nil {
+		return nil
+	}
+	out := new(ZoneLint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZoneTransfer) DeepCopyInto(out *ZoneTransfer) {
+	*out = *in
+	if in.To != nil {
+		in, out := &in.To, &out.To
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZoneTransfer.
+func (in *ZoneTransfer) DeepCopy() *ZoneTransfer {
+	if in == nil {
+		return nil
+	}
+	out := new(ZoneTransfer)
+	in.DeepCopyInto(out)
+	return out
+}
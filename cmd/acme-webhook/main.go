@@ -0,0 +1,39 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The acme-webhook command runs the cert-manager DNS-01 webhook solver, which presents the ACME challenges
+// as DNSRecords. cert-manager reaches the solver through the kubernetes API aggregation layer.
+package main
+
+import (
+	"os"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/cmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/monkale.io/coredns-manager-operator/internal/controller"
+)
+
+func main() {
+	groupName := os.Getenv("GROUP_NAME")
+	if groupName == "" {
+		panic("GROUP_NAME must be specified")
+	}
+	ctrl.SetLogger(zap.New())
+
+	cmd.RunWebhookServer(groupName, &controller.ACMESolver{})
+}
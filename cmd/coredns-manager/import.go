@@ -0,0 +1,200 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/yaml"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+// importFlags are the flags of the import command.
+type importFlags struct {
+	filename          string
+	origin            string
+	name              string
+	connector         string
+	namespace         string
+	primaryNSHostname string
+	primaryNSIP       string
+	email             string
+	outputDir         string
+	apply             bool
+	kubeconfig        string
+}
+
+// newImportCommand builds the import command.
+func newImportCommand() *cobra.Command {
+	flags := importFlags{}
+	importCmd := &cobra.Command{
+		Use:   "import -f ZONEFILE --origin DOMAIN --connector CONNECTOR",
+		Short: "Import the BIND zone file into the DNSZone and DNSRecord manifests",
+		Long: `Import the RFC 1035 zone file, e.g. of BIND, into one DNSZone and one DNSRecord per RRset.
+The SOA record is converted into the DNSZone, its primary name server must be within the zone, or be set with the flags.
+$ORIGIN, $TTL and $INCLUDE directives and relative names are supported. The records which cannot be imported,
+e.g. out of zone or DNSSEC records, are reported as warnings.`,
+		Example: `  # Print the manifests
+  coredns-manager import -f db.example.com --origin example.com --connector coredns
+
+  # Write one manifest per resource into the directory
+  coredns-manager import -f db.example.com --origin example.com --connector coredns --output-dir manifests/
+
+  # Create or update the resources in the cluster
+  coredns-manager import -f db.example.com --origin example.com --connector coredns --apply`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImport(cmd.Context(), cmd.OutOrStdout(), cmd.ErrOrStderr(), flags)
+		},
+	}
+	importCmd.Flags().StringVarP(&flags.filename, "filename", "f", "", "Zone file to import. The $INCLUDE files are resolved relative to it. Use - to read from stdin.")
+	importCmd.Flags().StringVar(&flags.origin, "origin", "", "Domain of the zone, the relative names of the zone file are completed with it.")
+	importCmd.Flags().StringVar(&flags.name, "name", "", "Name of the DNSZone. If not set, it is derived from the origin, e.g. example-com.")
+	importCmd.Flags().StringVar(&flags.connector, "connector", "", "Name of the DNSConnector of the DNSZone.")
+	importCmd.Flags().StringVarP(&flags.namespace, "namespace", "n", "kube-system", "Namespace of the DNSZone and the DNSRecords.")
+	importCmd.Flags().StringVar(&flags.primaryNSHostname, "primary-ns-hostname", "", "Hostname of the primary name server, relative to the origin. If not set, it is taken from the SOA record.")
+	importCmd.Flags().StringVar(&flags.primaryNSIP, "primary-ns-ip", "", "IP address of the primary name server. If not set, it is taken from the A or AAAA record of the primary name server.")
+	importCmd.Flags().StringVar(&flags.email, "email", "", "Email of the person responsible for the zone. If not set, it is taken from the SOA record.")
+	importCmd.Flags().StringVar(&flags.outputDir, "output-dir", "", "Directory the manifests are written into, one file per resource. If not set, the manifests are written to stdout.")
+	importCmd.Flags().BoolVar(&flags.apply, "apply", false, "Create or update the resources in the cluster instead of writing the manifests.")
+	importCmd.Flags().StringVar(&flags.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file used with --apply. If not set, the KUBECONFIG environment variable or the in-cluster config is used.")
+	_ = importCmd.MarkFlagRequired("filename")
+	_ = importCmd.MarkFlagRequired("origin")
+	_ = importCmd.MarkFlagRequired("connector")
+	return importCmd
+}
+
+// runImport imports the zone file and writes the manifests, or applies them.
+func runImport(ctx context.Context, stdout, stderr io.Writer, flags importFlags) error {
+	var reader io.Reader = os.Stdin
+	if flags.filename != "-" {
+		f, err := os.Open(flags.filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		reader = f
+	}
+	result, err := render.ImportZone(reader, flags.filename, render.ImportOptions{
+		Origin:            flags.origin,
+		Namespace:         flags.namespace,
+		ZoneName:          flags.name,
+		ConnectorName:     flags.connector,
+		PrimaryNSHostname: flags.primaryNSHostname,
+		PrimaryNSIP:       flags.primaryNSIP,
+		RespPersonEmail:   flags.email,
+	})
+	if err != nil {
+		return fmt.Errorf("import failure: %v", err)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(stderr, "Warning: %s\n", warning)
+	}
+
+	if flags.apply {
+		return applyImport(ctx, stdout, result, flags.kubeconfig)
+	}
+	objs := []client.Object{&result.DNSZone}
+	for i := range result.DNSRecords {
+		objs = append(objs, &result.DNSRecords[i])
+	}
+	var files []renderOutputFile
+	for _, obj := range objs {
+		content, err := marshalManifest(obj)
+		if err != nil {
+			return err
+		}
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		files = append(files, renderOutputFile{name: strings.ToLower(kind) + "-" + obj.GetName() + ".yaml", content: content})
+	}
+	return writeOutputFiles(stdout, files, flags.outputDir, false)
+}
+
+// marshalManifest returns the resource as a YAML manifest, without the empty creationTimestamp and status.
+func marshalManifest(obj client.Object) (string, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert %s: %v", obj.GetName(), err)
+	}
+	unstructured.RemoveNestedField(content, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(content, "status")
+	data, err := yaml.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s: %v", obj.GetName(), err)
+	}
+	return string(data), nil
+}
+
+// applyImport creates the imported DNSZone and DNSRecords in the cluster, or updates the spec of the existing ones.
+func applyImport(ctx context.Context, stdout io.Writer, result *render.ImportResult, kubeconfig string) error {
+	var config *rest.Config
+	var err error
+	if kubeconfig != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		config, err = ctrl.GetConfig()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load the kubeconfig: %v", err)
+	}
+	scheme := runtime.NewScheme()
+	if err := monkalev1alpha1.AddToScheme(scheme); err != nil {
+		return err
+	}
+	k8sClient, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create the kubernetes client: %v", err)
+	}
+
+	dnsZone := &monkalev1alpha1.DNSZone{ObjectMeta: *result.DNSZone.ObjectMeta.DeepCopy()}
+	operation, err := controllerutil.CreateOrUpdate(ctx, k8sClient, dnsZone, func() error {
+		dnsZone.Spec = result.DNSZone.Spec
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply DNSZone %s: %v", dnsZone.Name, err)
+	}
+	fmt.Fprintf(stdout, "dnszone/%s %s\n", dnsZone.Name, operation)
+
+	for i := range result.DNSRecords {
+		imported := &result.DNSRecords[i]
+		dnsRecord := &monkalev1alpha1.DNSRecord{ObjectMeta: *imported.ObjectMeta.DeepCopy()}
+		operation, err := controllerutil.CreateOrUpdate(ctx, k8sClient, dnsRecord, func() error {
+			dnsRecord.Spec = imported.Spec
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply DNSRecord %s: %v", dnsRecord.Name, err)
+		}
+		fmt.Fprintf(stdout, "dnsrecord/%s %s\n", dnsRecord.Name, operation)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The coredns-manager command works with the resources of the operator without a cluster, e.g. it renders the zone files
+// and the Corefile out of the manifests, so GitOps pipelines can review them before the manifests are applied,
+// and imports the existing zone files into the manifests.
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// newRootCommand builds the coredns-manager command with its subcommands.
+func newRootCommand() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:          "coredns-manager",
+		Short:        "Work with the resources of the coredns-manager-operator without a cluster",
+		SilenceUsage: true,
+	}
+	rootCmd.AddCommand(newRenderCommand())
+	rootCmd.AddCommand(newImportCommand())
+	return rootCmd
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	structuraldefaulting "k8s.io/apiextensions-apiserver/pkg/apiserver/schema/defaulting"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/config/crd"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+// loadCRDSchemas returns the structural schemas of the embedded CustomResourceDefinitions by kind.
+func loadCRDSchemas() (map[string]*structuralschema.Structural, error) {
+	files, err := fs.Glob(crd.Bases, "bases/*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]*structuralschema.Structural)
+	for _, file := range files {
+		data, err := crd.Bases.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var definition apiextensionsv1.CustomResourceDefinition
+		if err := yaml.Unmarshal(data, &definition); err != nil {
+			return nil, fmt.Errorf("failed to parse CustomResourceDefinition %s: %v", file, err)
+		}
+		for _, version := range definition.Spec.Versions {
+			if version.Name != monkalev1alpha1.GroupVersion.Version || version.Schema == nil {
+				continue
+			}
+			props := &apiextensions.JSONSchemaProps{}
+			if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(version.Schema.OpenAPIV3Schema, props, nil); err != nil {
+				return nil, fmt.Errorf("failed to convert the schema of %s: %v", definition.Name, err)
+			}
+			schema, err := structuralschema.NewStructural(props)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build the structural schema of %s: %v", definition.Name, err)
+			}
+			schemas[definition.Spec.Names.Kind] = schema
+		}
+	}
+	return schemas, nil
+}
+
+// getManifestFiles returns the YAML and JSON files of the paths. Directories are walked recursively, "-" reads from stdin.
+func getManifestFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		if path == "-" {
+			files = append(files, path)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(file)) {
+			case ".yaml", ".yml", ".json":
+				if !entry.IsDir() {
+					files = append(files, file)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// loadManifests reads the DNSZones, DNSRecords, DNSForwardZones, DNSConnectors, ConfigMaps and Secrets from the files.
+// Other kinds are skipped. The resources without a namespace are put into the namespace. The defaults of the
+// CustomResourceDefinitions are applied, the same way as the kubernetes API server does.
+func loadManifests(paths []string, namespace string) (*render.Manifests, error) {
+	files, err := getManifestFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	schemas, err := loadCRDSchemas()
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := &render.Manifests{}
+	for _, file := range files {
+		if err := loadManifestFile(manifests, file, namespace, schemas); err != nil {
+			return nil, err
+		}
+	}
+	return manifests, nil
+}
+
+// loadManifestFile reads the resources of the multi-document YAML or JSON file. Lists are expanded into their items.
+func loadManifestFile(manifests *render.Manifests, file, namespace string, schemas map[string]*structuralschema.Structural) error {
+	var reader io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(reader, 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		objs := []unstructured.Unstructured{*obj}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			objs = list.Items
+		}
+		for i := range objs {
+			if err := addManifest(manifests, &objs[i], namespace, schemas); err != nil {
+				return fmt.Errorf("%s: %s %s: %v", file, objs[i].GetKind(), objs[i].GetName(), err)
+			}
+		}
+	}
+}
+
+// addManifest applies the defaults to the resource and adds it to the manifests.
+func addManifest(manifests *render.Manifests, obj *unstructured.Unstructured, namespace string, schemas map[string]*structuralschema.Structural) error {
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(namespace)
+	}
+	gvk := obj.GroupVersionKind()
+	if gvk.GroupVersion() == monkalev1alpha1.GroupVersion {
+		schema, ok := schemas[gvk.Kind]
+		if !ok {
+			return nil
+		}
+		structuraldefaulting.Default(obj.Object, schema)
+	}
+
+	converter := runtime.DefaultUnstructuredConverter
+	switch {
+	case gvk == monkalev1alpha1.GroupVersion.WithKind("DNSZone"):
+		var dnsZone monkalev1alpha1.DNSZone
+		if err := converter.FromUnstructured(obj.Object, &dnsZone); err != nil {
+			return err
+		}
+		manifests.DNSZones = append(manifests.DNSZones, dnsZone)
+	case gvk == monkalev1alpha1.GroupVersion.WithKind("DNSRecord"):
+		var dnsRecord monkalev1alpha1.DNSRecord
+		if err := converter.FromUnstructured(obj.Object, &dnsRecord); err != nil {
+			return err
+		}
+		manifests.DNSRecords = append(manifests.DNSRecords, dnsRecord)
+	case gvk == monkalev1alpha1.GroupVersion.WithKind("DNSForwardZone"):
+		var forwardZone monkalev1alpha1.DNSForwardZone
+		if err := converter.FromUnstructured(obj.Object, &forwardZone); err != nil {
+			return err
+		}
+		manifests.DNSForwardZones = append(manifests.DNSForwardZones, forwardZone)
+	case gvk == monkalev1alpha1.GroupVersion.WithKind("DNSConnector"):
+		var dnsConnector monkalev1alpha1.DNSConnector
+		if err := converter.FromUnstructured(obj.Object, &dnsConnector); err != nil {
+			return err
+		}
+		manifests.DNSConnectors = append(manifests.DNSConnectors, dnsConnector)
+	case gvk == corev1.SchemeGroupVersion.WithKind("ConfigMap"):
+		var configMap corev1.ConfigMap
+		if err := converter.FromUnstructured(obj.Object, &configMap); err != nil {
+			return err
+		}
+		manifests.ConfigMaps = append(manifests.ConfigMaps, configMap)
+	case gvk == corev1.SchemeGroupVersion.WithKind("Secret"):
+		var secret corev1.Secret
+		if err := converter.FromUnstructured(obj.Object, &secret); err != nil {
+			return err
+		}
+		// the API server merges stringData into data
+		for key, value := range secret.StringData {
+			if secret.Data == nil {
+				secret.Data = make(map[string][]byte)
+			}
+			secret.Data[key] = []byte(value)
+		}
+		manifests.Secrets = append(manifests.Secrets, secret)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+const (
+	renderOutputConfigMap string = "configmap" // renderOutputConfigMap writes the ConfigMaps as YAML manifests
+	renderOutputRaw       string = "raw"       // renderOutputRaw writes the zone files and the Corefile as they are mounted into CoreDNS
+)
+
+// renderFlags are the flags of the render command.
+type renderFlags struct {
+	filenames []string
+	namespace string
+	corefile  string
+	serial    string
+	output    string
+	outputDir string
+	strict    bool
+}
+
+// newRenderCommand builds the render command.
+func newRenderCommand() *cobra.Command {
+	flags := renderFlags{}
+	renderCmd := &cobra.Command{
+		Use:   "render -f FILENAME [--corefile COREFILE]",
+		Short: "Render the zone files and the Corefile out of the manifests",
+		Long: `Render the zone files and the Corefile out of the DNSZone, DNSRecord, DNSForwardZone and DNSConnector manifests,
+the same way the operator does. No cluster is needed. The DNSRecords excluded from the zones and the lint findings
+are reported as warnings. The problems which make the operator preserve the previous version of a zone or of the
+Corefile fail the render.`,
+		Example: `  # Print the zone ConfigMaps and the CoreDNS ConfigMap
+  coredns-manager render -f manifests/ --corefile Corefile
+
+  # Write the zone files and the Corefile into the directory
+  coredns-manager render -f manifests/ --corefile Corefile --serial 1 -o raw --output-dir rendered/`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRender(cmd.OutOrStdout(), cmd.ErrOrStderr(), flags)
+		},
+	}
+	renderCmd.Flags().StringSliceVarP(&flags.filenames, "filename", "f", nil, "Files or directories with the manifests, directories are read recursively. Use - to read from stdin.")
+	renderCmd.Flags().StringVarP(&flags.namespace, "namespace", "n", "kube-system", "Namespace of the manifests without a namespace.")
+	renderCmd.Flags().StringVar(&flags.corefile, "corefile", "", "Corefile the server blocks are merged into. If not set, the CoreDNS ConfigMap of the DNSConnector is taken from the manifests.")
+	renderCmd.Flags().StringVar(&flags.serial, "serial", "", "Serial number of the zones. If not set, it is generated with the serial strategy of the zone. Set it for reproducible output.")
+	renderCmd.Flags().StringVarP(&flags.output, "output", "o", renderOutputConfigMap, "Output format: configmap or raw.")
+	renderCmd.Flags().StringVar(&flags.outputDir, "output-dir", "", "Directory the output is written into, one file per ConfigMap or zone file. If not set, the output is written to stdout.")
+	renderCmd.Flags().BoolVar(&flags.strict, "strict", false, "Fail if any warning is reported.")
+	_ = renderCmd.MarkFlagRequired("filename")
+	return renderCmd
+}
+
+// runRender renders the manifests and writes the output.
+func runRender(stdout, stderr io.Writer, flags renderFlags) error {
+	if flags.output != renderOutputConfigMap && flags.output != renderOutputRaw {
+		return fmt.Errorf("unsupported output format %q, must be %s or %s", flags.output, renderOutputConfigMap, renderOutputRaw)
+	}
+	manifests, err := loadManifests(flags.filenames, flags.namespace)
+	if err != nil {
+		return err
+	}
+	options := render.Options{Serial: flags.serial}
+	if flags.corefile != "" {
+		corefile, err := os.ReadFile(flags.corefile)
+		if err != nil {
+			return err
+		}
+		options.Corefile = string(corefile)
+	}
+
+	result, err := render.Render(manifests, options)
+	if result != nil {
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(stderr, "Warning: %s\n", warning)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("render failure:\n%v", err)
+	}
+
+	configMaps := append(append([]corev1.ConfigMap{}, result.ZoneConfigMaps...), result.CorednsConfigMaps...)
+	files, err := getRenderOutputFiles(configMaps, flags.output)
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFiles(stdout, files, flags.outputDir, flags.output == renderOutputRaw); err != nil {
+		return err
+	}
+	if flags.strict && len(result.Warnings) > 0 {
+		return fmt.Errorf("%d warnings reported", len(result.Warnings))
+	}
+	return nil
+}
+
+// renderOutputFile is a file of the render output.
+type renderOutputFile struct {
+	name    string
+	content string
+}
+
+// getRenderOutputFiles returns the ConfigMaps as YAML manifests, or their data as raw files named <ConfigMap name>/<key>.
+func getRenderOutputFiles(configMaps []corev1.ConfigMap, output string) ([]renderOutputFile, error) {
+	var files []renderOutputFile
+	for _, configMap := range configMaps {
+		if output == renderOutputRaw {
+			keys := make([]string, 0, len(configMap.Data))
+			for key := range configMap.Data {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				files = append(files, renderOutputFile{name: filepath.Join(configMap.Name, key), content: configMap.Data[key]})
+			}
+			continue
+		}
+		configMap.APIVersion = corev1.SchemeGroupVersion.String()
+		configMap.Kind = "ConfigMap"
+		content, err := yaml.Marshal(configMap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal ConfigMap %s: %v", configMap.Name, err)
+		}
+		files = append(files, renderOutputFile{name: configMap.Name + ".yaml", content: string(content)})
+	}
+	return files, nil
+}
+
+// writeOutputFiles writes the files into the output directory, or to stdout: the YAML manifests as one multi-document
+// stream, the raw files each after a "==> name <==" header.
+func writeOutputFiles(stdout io.Writer, files []renderOutputFile, outputDir string, raw bool) error {
+	if outputDir != "" {
+		for _, file := range files {
+			path := filepath.Join(outputDir, file.name)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, []byte(file.content), 0o644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i, file := range files {
+		var err error
+		if raw {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			_, err = fmt.Fprintf(stdout, "==> %s <==\n%s\n", file.name, file.content)
+		} else {
+			_, err = fmt.Fprintf(stdout, "---\n%s", file.content)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -18,18 +18,22 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
 	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
 	"github.com/monkale.io/coredns-manager-operator/internal/controller"
@@ -44,6 +48,8 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(gatewayv1beta1.AddToScheme(scheme))
+
 	utilruntime.Must(monkalev1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
@@ -52,11 +58,38 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var enableServiceSource bool
+	var enableIngressSource bool
+	var enableHTTPRouteSource bool
+	var dnsUpdateAddr string
+	var dnsUpdateTSIGSecret string
+	var externalDNSWebhookAddr string
+	var externalDNSWebhookDNSZone string
+	var enableWebhooks bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableServiceSource, "enable-service-source", true,
+		"Enable publishing DNSRecords from Services annotated with "+monkalev1alpha1.SourceHostnameAnnotation+".")
+	flag.BoolVar(&enableIngressSource, "enable-ingress-source", false,
+		"Enable publishing DNSRecords from the hosts of all Ingresses.")
+	flag.BoolVar(&enableHTTPRouteSource, "enable-httproute-source", false,
+		"Enable publishing DNSRecords from the hostnames of all Gateway API HTTPRoutes. Requires Gateway API CRDs.")
+	flag.StringVar(&dnsUpdateAddr, "dns-update-bind-address", "",
+		"The address the RFC 2136 dynamic update server binds to, e.g. :5353. The server is disabled if empty.")
+	flag.StringVar(&dnsUpdateTSIGSecret, "dns-update-tsig-secret", "",
+		"The Secret with the TSIG key the dynamic updates must be signed with, as namespace/name. "+
+			"Required by the dynamic update server.")
+	flag.StringVar(&externalDNSWebhookAddr, "external-dns-webhook-bind-address", "",
+		"The address the external-dns webhook provider binds to, e.g. localhost:8888. The provider is disabled if empty.")
+	flag.StringVar(&externalDNSWebhookDNSZone, "external-dns-webhook-dnszone", "",
+		"The DNSZone the external-dns webhook provider publishes the records to, as namespace/name. "+
+			"Required by the external-dns webhook provider.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable the validating admission webhooks of DNSRecords, DNSZones and DNSConnectors. "+
+			"The serving certificate is read from /tmp/k8s-webhook-server/serving-certs.")
 	opts := zap.Options{
 		Development: false,
 	}
@@ -104,12 +137,92 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controller.DNSConnectorReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		APIReader: mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DNSConnector")
 		os.Exit(1)
 	}
+	if enableServiceSource {
+		if err = (&controller.ServiceSourceReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ServiceSource")
+			os.Exit(1)
+		}
+	}
+	if enableIngressSource {
+		if err = (&controller.IngressSourceReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "IngressSource")
+			os.Exit(1)
+		}
+	}
+	if enableHTTPRouteSource {
+		if err = (&controller.HTTPRouteSourceReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "HTTPRouteSource")
+			os.Exit(1)
+		}
+	}
+	if dnsUpdateAddr != "" {
+		secretRef, err := parseNamespacedName(dnsUpdateTSIGSecret)
+		if err != nil {
+			setupLog.Error(err, "bad dns-update-tsig-secret")
+			os.Exit(1)
+		}
+		if err = mgr.Add(&controller.DNSUpdateServer{
+			Client:     mgr.GetClient(),
+			APIReader:  mgr.GetAPIReader(),
+			Addr:       dnsUpdateAddr,
+			TSIGSecret: secretRef,
+		}); err != nil {
+			setupLog.Error(err, "unable to add dns update server")
+			os.Exit(1)
+		}
+	}
+	if externalDNSWebhookAddr != "" {
+		dnsZoneRef, err := parseNamespacedName(externalDNSWebhookDNSZone)
+		if err != nil {
+			setupLog.Error(err, "bad external-dns-webhook-dnszone")
+			os.Exit(1)
+		}
+		if err = mgr.Add(&controller.ExternalDNSWebhook{
+			Client:    mgr.GetClient(),
+			APIReader: mgr.GetAPIReader(),
+			Addr:      externalDNSWebhookAddr,
+			DNSZone:   dnsZoneRef,
+		}); err != nil {
+			setupLog.Error(err, "unable to add external-dns webhook provider")
+			os.Exit(1)
+		}
+	}
+	if enableWebhooks {
+		if err = (&controller.DNSRecordValidator{
+			Client: mgr.GetClient(),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DNSRecord")
+			os.Exit(1)
+		}
+		if err = (&controller.DNSZoneValidator{
+			Client: mgr.GetClient(),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DNSZone")
+			os.Exit(1)
+		}
+		if err = (&controller.DNSConnectorValidator{
+			Client: mgr.GetClient(),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DNSConnector")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -127,3 +240,12 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// parseNamespacedName parses the object reference set as namespace/name.
+func parseNamespacedName(ref string) (types.NamespacedName, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("%q must be set as namespace/name", ref)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+// acmeSolverConfig is the solver configuration of the cert-manager Issuer.
+type acmeSolverConfig struct {
+	// DNSZone references the DNSZone the challenges are presented in as "name" or "namespace/name".
+	// The name is looked up in the namespace of the Issuer. If not set, the DNSZone is matched by the domain.
+	DNSZone string `json:"dnsZone,omitempty"`
+}
+
+// loadACMESolverConfig decodes the solver configuration of the challenge request.
+func loadACMESolverConfig(cfgJSON *apiextensionsv1.JSON) (acmeSolverConfig, error) {
+	cfg := acmeSolverConfig{}
+	if cfgJSON == nil || len(cfgJSON.Raw) == 0 {
+		return cfg, nil
+	}
+	if err := json.Unmarshal(cfgJSON.Raw, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to decode solver config: %v", err)
+	}
+	return cfg, nil
+}
+
+// getACMEDNSZoneRef parses the DNSZone reference of the solver configuration.
+// The DNSZone can be referenced as "name" (the namespace of the Issuer) or "namespace/name".
+func getACMEDNSZoneRef(ref, namespace string) (types.NamespacedName, error) {
+	parts := strings.Split(strings.TrimSpace(ref), "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return types.NamespacedName{Namespace: namespace, Name: parts[0]}, nil
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+	default:
+		return types.NamespacedName{}, fmt.Errorf("bad dnsZone %q, expected \"name\" or \"namespace/name\"", ref)
+	}
+}
+
+// getACMEChallengeValue returns the TXT rdata of the challenge key.
+// The key is base64url encoded, so it never needs escaping.
+func getACMEChallengeValue(key string) string {
+	return `"` + key + `"`
+}
+
+// getACMERecordValues returns the values of the challenge DNSRecord.
+func getACMERecordValues(dnsRecord *monkalev1alpha1.DNSRecord) []string {
+	record := dnsRecord.Spec.Record
+	switch {
+	case record == nil:
+		return nil
+	case record.Value != "":
+		return []string{record.Value}
+	default:
+		return append([]string{}, record.Values...)
+	}
+}
+
+// isACMEOwned checks whether the DNSRecord has been created by the ACME solver for the DNSZone.
+func isACMEOwned(dnsRecord *monkalev1alpha1.DNSRecord, dnsZone *monkalev1alpha1.DNSZone) bool {
+	return isSourceRecordOf(dnsRecord, monkalev1alpha1.SourceKindACMEChallenge, types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace})
+}
+
+// constructACMERecord builds the TXT DNSRecord with the challenge values of the name. All challenges of the name,
+// e.g. for the domain and its wildcard, share one DNSRecord, since the DNSRecord owns the whole RRset.
+// The existing DNSRecord is reused if set.
+func constructACMERecord(dnsZone *monkalev1alpha1.DNSZone, fqdn string, values []string, existing *monkalev1alpha1.DNSRecord) (monkalev1alpha1.DNSRecord, error) {
+	zoneRef := types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace}
+	// Short TTL, so the resolvers see the new key on the next challenge.
+	record := monkalev1alpha1.Record{Name: fqdn, Type: "TXT", TTL: strconv.Itoa(acmeRecordTTL)}
+	if len(values) == 1 {
+		record.Value = values[0]
+	} else {
+		record.Values = values
+	}
+
+	var dnsRecord monkalev1alpha1.DNSRecord
+	if existing != nil {
+		dnsRecord = *existing.DeepCopy()
+	} else {
+		dnsRecord = monkalev1alpha1.DNSRecord{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        getSourceRecordName(monkalev1alpha1.SourceKindACMEChallenge, zoneRef, fqdn, record.Type),
+				Namespace:   dnsZone.Namespace,
+				Labels:      getSourceRecordLabels(monkalev1alpha1.SourceKindACMEChallenge, zoneRef),
+				Annotations: getSourceRecordAnnotations(zoneRef),
+			},
+			Spec: monkalev1alpha1.DNSRecordSpec{
+				DNSZoneRef: &corev1.ObjectReference{Name: dnsZone.Name},
+			},
+		}
+	}
+	dnsRecord.Spec.Record = &record
+
+	generatedRecord, err := render.ConstructRecord(dnsRecord)
+	if err != nil {
+		return dnsRecord, err
+	}
+	if err := render.ValidateRecords(generatedRecord); err != nil {
+		return dnsRecord, err
+	}
+	return dnsRecord, nil
+}
+
+// getACMEChallengeFQDN returns the name of the challenge TXT record. The name must belong to the DNSZone.
+func getACMEChallengeFQDN(resolvedFQDN string, dnsZone *monkalev1alpha1.DNSZone) (string, error) {
+	fqdn := dns.Fqdn(strings.ToLower(resolvedFQDN))
+	if !hostnameInZone(fqdn, dnsZone.Spec.Domain) {
+		return "", fmt.Errorf("%s does not belong to DNSZone %s/%s (%s)", fqdn, dnsZone.Namespace, dnsZone.Name, dnsZone.Spec.Domain)
+	}
+	return fqdn, nil
+}
+
+// checkACMEChallengeProvisioned checks whether the challenge value is served by the CoreDNS.
+// The value must be rendered into the zone ConfigMap, the DNSZone status must report the serial of the ConfigMap,
+// and the DNSConnector must report the same or a newer serial of the zone as provisioned.
+// Returns nil if the challenge is provisioned, otherwise the reason.
+func checkACMEChallengeProvisioned(dnsZone *monkalev1alpha1.DNSZone, zoneCM *corev1.ConfigMap, dnsConnector *monkalev1alpha1.DNSConnector, value string) error {
+	zonefile := zoneCM.Data[monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain)+"zone"]
+	if !strings.Contains(zonefile, value) {
+		return fmt.Errorf("challenge is not rendered into the zone ConfigMap %s yet", zoneCM.Name)
+	}
+	serial, err := strconv.ParseUint(zoneCM.Annotations["SerialNumber"], 10, 32)
+	if err != nil {
+		return fmt.Errorf("bad serial of the zone ConfigMap %s: %v", zoneCM.Name, err)
+	}
+	if dnsZone.Status.CurrentZoneSerial != zoneCM.Annotations["SerialNumber"] {
+		return fmt.Errorf("DNSZone reports serial %s, waiting for %d", dnsZone.Status.CurrentZoneSerial, serial)
+	}
+	for _, zone := range dnsConnector.Status.ProvisionedDNSZones {
+		if zone.Name != dnsZone.Name {
+			continue
+		}
+		provisioned, err := strconv.ParseUint(zone.SerialNumber, 10, 32)
+		if err != nil || monkalev1alpha1.SerialIsGreater(uint32(serial), uint32(provisioned)) {
+			return fmt.Errorf("DNSConnector %s reports serial %s, waiting for %d", dnsConnector.Name, zone.SerialNumber, serial)
+		}
+		if zone.Mismatch != "" {
+			return fmt.Errorf("DNSConnector %s reports the zone is not served: %s", dnsConnector.Name, zone.Mismatch)
+		}
+		return nil
+	}
+	return fmt.Errorf("DNSConnector %s does not provision the zone yet, waiting for serial %d", dnsConnector.Name, serial)
+}
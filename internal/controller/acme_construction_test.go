@@ -0,0 +1,284 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+func getACMETestDNSZone() *monkalev1alpha1.DNSZone {
+	return &monkalev1alpha1.DNSZone{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-com", Namespace: "kube-system"},
+		Spec:       monkalev1alpha1.DNSZoneSpec{Domain: "example.com", TTL: 3600},
+		Status:     monkalev1alpha1.DNSZoneStatus{CurrentZoneSerial: "2024010101"},
+	}
+}
+
+func TestGetACMEChallengeFQDN(t *testing.T) {
+	tests := []struct {
+		name         string
+		resolvedFQDN string
+		wantFQDN     string
+		wantErr      bool
+	}{
+		{name: "domain", resolvedFQDN: "_acme-challenge.example.com.", wantFQDN: "_acme-challenge.example.com."},
+		{name: "subdomain", resolvedFQDN: "_acme-challenge.www.example.com.", wantFQDN: "_acme-challenge.www.example.com."},
+		{name: "without trailing dot", resolvedFQDN: "_acme-challenge.example.com", wantFQDN: "_acme-challenge.example.com."},
+		{name: "upper case", resolvedFQDN: "_ACME-Challenge.WWW.Example.com.", wantFQDN: "_acme-challenge.www.example.com."},
+		{name: "other domain", resolvedFQDN: "_acme-challenge.example.org.", wantErr: true},
+		{name: "domain with the same suffix", resolvedFQDN: "_acme-challenge.myexample.com.", wantErr: true},
+		{name: "parent domain", resolvedFQDN: "com.", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getACMEChallengeFQDN(tt.resolvedFQDN, getACMETestDNSZone())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getACMEChallengeFQDN() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.wantFQDN {
+				t.Errorf("getACMEChallengeFQDN() = %s, want %s", got, tt.wantFQDN)
+			}
+		})
+	}
+}
+
+func TestConstructACMERecord(t *testing.T) {
+	const fqdn = "_acme-challenge.example.com."
+	dnsZone := getACMETestDNSZone()
+	zoneRef := types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace}
+	recordName := getSourceRecordName(monkalev1alpha1.SourceKindACMEChallenge, zoneRef, fqdn, "TXT")
+	// existingRecord returns the DNSRecord previously written by the ACME solver with the values.
+	existingRecord := func(values ...string) *monkalev1alpha1.DNSRecord {
+		dnsRecord, err := constructACMERecord(dnsZone, fqdn, values, nil)
+		if err != nil {
+			t.Fatalf("constructACMERecord() error = %v", err)
+		}
+		dnsRecord.ResourceVersion = "42"
+		return &dnsRecord
+	}
+	key1 := getACMEChallengeValue("LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0")
+	key2 := getACMEChallengeValue("gZ8Vd_jYxnMDJLsiHWTLpQqCq6EXWv1zgJqHjSCcRRo")
+	key3 := getACMEChallengeValue("Qb0-7t5Tl5hFpEZ2dA9x3U8v1cK6mN4rWsYzJ2uLoIe")
+
+	tests := []struct {
+		name       string
+		fqdn       string
+		existing   *monkalev1alpha1.DNSRecord
+		values     []string
+		wantRecord monkalev1alpha1.Record
+		wantErr    bool
+	}{
+		{
+			name:       "new record with one challenge",
+			values:     []string{key1},
+			wantRecord: monkalev1alpha1.Record{Name: fqdn, Type: "TXT", TTL: "60", Value: key1},
+		},
+		{
+			name:       "new record with the challenges of the domain and its wildcard",
+			values:     []string{key1, key2},
+			wantRecord: monkalev1alpha1.Record{Name: fqdn, Type: "TXT", TTL: "60", Values: []string{key1, key2}},
+		},
+		{
+			name:       "add a challenge",
+			existing:   existingRecord(key1),
+			values:     []string{key1, key2},
+			wantRecord: monkalev1alpha1.Record{Name: fqdn, Type: "TXT", TTL: "60", Values: []string{key1, key2}},
+		},
+		{
+			name:       "add a third challenge",
+			existing:   existingRecord(key1, key2),
+			values:     []string{key1, key2, key3},
+			wantRecord: monkalev1alpha1.Record{Name: fqdn, Type: "TXT", TTL: "60", Values: []string{key1, key2, key3}},
+		},
+		{
+			name:       "remove a challenge",
+			existing:   existingRecord(key1, key2, key3),
+			values:     []string{key1, key3},
+			wantRecord: monkalev1alpha1.Record{Name: fqdn, Type: "TXT", TTL: "60", Values: []string{key1, key3}},
+		},
+		{
+			name:       "remove all challenges but one",
+			existing:   existingRecord(key1, key2),
+			values:     []string{key2},
+			wantRecord: monkalev1alpha1.Record{Name: fqdn, Type: "TXT", TTL: "60", Value: key2},
+		},
+		{
+			name:    "bad challenge name",
+			fqdn:    "_acme-challenge..example.com.",
+			values:  []string{key1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := fqdn
+			if tt.fqdn != "" {
+				name = tt.fqdn
+			}
+			got, err := constructACMERecord(dnsZone, name, tt.values, tt.existing)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("constructACMERecord() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(*got.Spec.Record, tt.wantRecord) {
+				t.Errorf("constructACMERecord() record = %+v, want %+v", *got.Spec.Record, tt.wantRecord)
+			}
+			if values := getACMERecordValues(&got); !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("getACMERecordValues() = %v, want %v", values, tt.values)
+			}
+			if got.Name != recordName || got.Namespace != dnsZone.Namespace {
+				t.Errorf("constructACMERecord() name = %s/%s, want %s/%s", got.Namespace, got.Name, dnsZone.Namespace, recordName)
+			}
+			if !isACMEOwned(&got, dnsZone) {
+				t.Errorf("constructACMERecord() is not owned by the ACME solver: labels %v, annotations %v", got.Labels, got.Annotations)
+			}
+			if got.Spec.DNSZoneRef == nil || got.Spec.DNSZoneRef.Name != dnsZone.Name {
+				t.Errorf("constructACMERecord() dnsZoneRef = %v, want %s", got.Spec.DNSZoneRef, dnsZone.Name)
+			}
+			if tt.existing != nil && got.ResourceVersion != tt.existing.ResourceVersion {
+				t.Errorf("constructACMERecord() resourceVersion = %s, want %s", got.ResourceVersion, tt.existing.ResourceVersion)
+			}
+		})
+	}
+}
+
+func TestCheckACMEChallengeProvisioned(t *testing.T) {
+	value := getACMEChallengeValue("LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0")
+	zonefile := "_acme-challenge.example.com.\t60\tIN\tTXT\t" + value + "\n"
+
+	tests := []struct {
+		name        string
+		zonefile    string
+		cmSerial    string
+		zoneSerial  string
+		provisioned []monkalev1alpha1.ProvisionedDNSZone
+		wantReason  string
+	}{
+		{
+			name:        "provisioned serial",
+			zonefile:    zonefile,
+			cmSerial:    "2024010102",
+			zoneSerial:  "2024010102",
+			provisioned: []monkalev1alpha1.ProvisionedDNSZone{{Name: "example-com", SerialNumber: "2024010102"}},
+		},
+		{
+			name:        "newer provisioned serial",
+			zonefile:    zonefile,
+			cmSerial:    "2024010102",
+			zoneSerial:  "2024010102",
+			provisioned: []monkalev1alpha1.ProvisionedDNSZone{{Name: "example-org"}, {Name: "example-com", SerialNumber: "2024010105"}},
+		},
+		{
+			name:        "provisioned serial wrapped around",
+			zonefile:    zonefile,
+			cmSerial:    "4294967290",
+			zoneSerial:  "4294967290",
+			provisioned: []monkalev1alpha1.ProvisionedDNSZone{{Name: "example-com", SerialNumber: "5"}},
+		},
+		{
+			name:        "older provisioned serial",
+			zonefile:    zonefile,
+			cmSerial:    "2024010102",
+			zoneSerial:  "2024010102",
+			provisioned: []monkalev1alpha1.ProvisionedDNSZone{{Name: "example-com", SerialNumber: "2024010101"}},
+			wantReason:  "DNSConnector coredns reports serial 2024010101, waiting for 2024010102",
+		},
+		{
+			name:        "older provisioned serial before the wrap around",
+			zonefile:    zonefile,
+			cmSerial:    "5",
+			zoneSerial:  "5",
+			provisioned: []monkalev1alpha1.ProvisionedDNSZone{{Name: "example-com", SerialNumber: "4294967290"}},
+			wantReason:  "DNSConnector coredns reports serial 4294967290, waiting for 5",
+		},
+		{
+			name:        "bad provisioned serial",
+			zonefile:    zonefile,
+			cmSerial:    "2024010102",
+			zoneSerial:  "2024010102",
+			provisioned: []monkalev1alpha1.ProvisionedDNSZone{{Name: "example-com", SerialNumber: "unknown"}},
+			wantReason:  "DNSConnector coredns reports serial unknown, waiting for 2024010102",
+		},
+		{
+			name:        "provisioned zone mismatch",
+			zonefile:    zonefile,
+			cmSerial:    "2024010102",
+			zoneSerial:  "2024010102",
+			provisioned: []monkalev1alpha1.ProvisionedDNSZone{{Name: "example-com", SerialNumber: "2024010102", Mismatch: "served serial 2024010101"}},
+			wantReason:  "DNSConnector coredns reports the zone is not served: served serial 2024010101",
+		},
+		{
+			name:        "zone not provisioned",
+			zonefile:    zonefile,
+			cmSerial:    "2024010102",
+			zoneSerial:  "2024010102",
+			provisioned: []monkalev1alpha1.ProvisionedDNSZone{{Name: "example-org", SerialNumber: "2024010102"}},
+			wantReason:  "DNSConnector coredns does not provision the zone yet, waiting for serial 2024010102",
+		},
+		{
+			name:       "DNSZone reports the previous serial",
+			zonefile:   zonefile,
+			cmSerial:   "2024010102",
+			zoneSerial: "2024010101",
+			wantReason: "DNSZone reports serial 2024010101, waiting for 2024010102",
+		},
+		{
+			name:       "bad serial of the zone ConfigMap",
+			zonefile:   zonefile,
+			cmSerial:   "",
+			zoneSerial: "2024010102",
+			wantReason: "bad serial of the zone ConfigMap example-com-zone",
+		},
+		{
+			name:       "challenge not rendered",
+			zonefile:   "www.example.com.\t3600\tIN\tA\t192.0.2.10\n",
+			cmSerial:   "2024010102",
+			zoneSerial: "2024010102",
+			wantReason: "challenge is not rendered into the zone ConfigMap example-com-zone yet",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dnsZone := getACMETestDNSZone()
+			dnsZone.Status.CurrentZoneSerial = tt.zoneSerial
+			zoneCM := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "example-com-zone", Namespace: dnsZone.Namespace, Annotations: map[string]string{"SerialNumber": tt.cmSerial}},
+				Data:       map[string]string{"example.com.zone": tt.zonefile},
+			}
+			dnsConnector := &monkalev1alpha1.DNSConnector{ObjectMeta: metav1.ObjectMeta{Name: "coredns"}}
+			dnsConnector.Status.ProvisionedDNSZones = tt.provisioned
+
+			err := checkACMEChallengeProvisioned(dnsZone, zoneCM, dnsConnector, value)
+			switch {
+			case tt.wantReason == "" && err != nil:
+				t.Errorf("checkACMEChallengeProvisioned() = %v, want provisioned", err)
+			case tt.wantReason != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantReason)):
+				t.Errorf("checkACMEChallengeProvisioned() = %v, want %s", err, tt.wantReason)
+			}
+		})
+	}
+}
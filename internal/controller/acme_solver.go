@@ -0,0 +1,281 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	acmev1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+const (
+	ACMESolverName          string        = "coredns-manager" // ACMESolverName is the solverName of the cert-manager Issuer
+	acmeRecordTTL           int           = 60                // acmeRecordTTL is the TTL of the challenge records
+	acmeRequestTimeout      time.Duration = 30 * time.Second  // acmeRequestTimeout limits the kubernetes API calls of one challenge request
+	acmePropagationTimeout  time.Duration = 45 * time.Second  // acmePropagationTimeout is the default time Present waits for the challenge to be provisioned
+	acmePropagationInterval time.Duration = 2 * time.Second   // acmePropagationInterval is the interval of the provisioning checks
+	acmeChallengeTypeDNS01  string        = "dns-01"          // acmeChallengeTypeDNS01 is the only challenge type supported by the webhook solvers
+)
+
+// ACMESolver is the cert-manager DNS-01 webhook solver. It presents the ACME challenges as TXT DNSRecords
+// in the DNSZone of the challenge, and waits until the DNSConnector provisions the zone serial with the challenge,
+// so the ACME server finds the challenge on its first lookup.
+type ACMESolver struct {
+	// PropagationTimeout is the time Present waits for the challenge to be provisioned.
+	// If the challenge is not provisioned in time, Present fails and cert-manager retries it later.
+	PropagationTimeout time.Duration
+
+	client client.Client
+}
+
+// Name implements webhook.Solver. It is the solverName of the Issuer configuration.
+func (s *ACMESolver) Name() string {
+	return ACMESolverName
+}
+
+// Initialize implements webhook.Solver. It creates the kubernetes client.
+func (s *ACMESolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(monkalev1alpha1.AddToScheme(scheme))
+
+	c, err := client.New(kubeClientConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+	s.client = c
+	if s.PropagationTimeout == 0 {
+		s.PropagationTimeout = acmePropagationTimeout
+	}
+	return nil
+}
+
+// Present implements webhook.Solver. It adds the challenge to the TXT DNSRecord of the challenge name
+// and waits until the challenge is provisioned. Present can be called again for the same challenge.
+func (s *ACMESolver) Present(ch *acmev1alpha1.ChallengeRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), acmeRequestTimeout+s.PropagationTimeout)
+	defer cancel()
+
+	dnsZone, fqdn, err := s.getChallengeDNSZone(ctx, ch)
+	if err != nil {
+		return err
+	}
+	value := getACMEChallengeValue(ch.Key)
+	logKV := []interface{}{"DNSZone.Name", dnsZone.Name, "DNSZone.Namespace", dnsZone.Namespace, "Name", fqdn, "DNSName", ch.DNSName}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return s.updateChallengeRecord(ctx, dnsZone, fqdn, func(values []string) []string {
+			for _, existing := range values {
+				if existing == value {
+					return values
+				}
+			}
+			return append(values, value)
+		})
+	})
+	if err != nil {
+		log.Log.Error(err, "ACME solver. Failed to present challenge", logKV...)
+		return fmt.Errorf("failed to present challenge %s: %v", fqdn, err)
+	}
+	log.Log.Info("ACME solver. Challenge presented. Waiting for the zone to be provisioned", logKV...)
+
+	var reason error
+	err = wait.PollUntilContextTimeout(ctx, acmePropagationInterval, s.PropagationTimeout, true, func(ctx context.Context) (bool, error) {
+		reason = s.checkChallengeProvisioned(ctx, dnsZone, value)
+		return reason == nil, nil
+	})
+	if err != nil {
+		log.Log.Info("ACME solver. Challenge is not provisioned yet", append(logKV, "Reason", reason.Error())...)
+		return fmt.Errorf("challenge %s is not provisioned yet: %v", fqdn, reason)
+	}
+	log.Log.Info("ACME solver. Challenge provisioned", logKV...)
+	return nil
+}
+
+// CleanUp implements webhook.Solver. It removes the challenge from the TXT DNSRecord, and deletes the DNSRecord
+// when no challenges are left. CleanUp does not wait for the zone to be provisioned.
+func (s *ACMESolver) CleanUp(ch *acmev1alpha1.ChallengeRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), acmeRequestTimeout)
+	defer cancel()
+
+	dnsZone, fqdn, err := s.getChallengeDNSZone(ctx, ch)
+	if err != nil {
+		return err
+	}
+	value := getACMEChallengeValue(ch.Key)
+	logKV := []interface{}{"DNSZone.Name", dnsZone.Name, "DNSZone.Namespace", dnsZone.Namespace, "Name", fqdn, "DNSName", ch.DNSName}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return s.updateChallengeRecord(ctx, dnsZone, fqdn, func(values []string) []string {
+			kept := []string{}
+			for _, existing := range values {
+				if existing != value {
+					kept = append(kept, existing)
+				}
+			}
+			return kept
+		})
+	})
+	if err != nil {
+		log.Log.Error(err, "ACME solver. Failed to clean up challenge", logKV...)
+		return fmt.Errorf("failed to clean up challenge %s: %v", fqdn, err)
+	}
+	log.Log.Info("ACME solver. Challenge cleaned up", logKV...)
+	return nil
+}
+
+// getChallengeDNSZone returns the DNSZone of the challenge and the name of the challenge record.
+// The DNSZone is taken from the solver configuration, otherwise it is the Primary DNSZone with the longest matching domain.
+func (s *ACMESolver) getChallengeDNSZone(ctx context.Context, ch *acmev1alpha1.ChallengeRequest) (*monkalev1alpha1.DNSZone, string, error) {
+	if ch.Type != "" && ch.Type != acmeChallengeTypeDNS01 {
+		return nil, "", fmt.Errorf("unsupported challenge type %s", ch.Type)
+	}
+	cfg, err := loadACMESolverConfig(ch.Config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dnsZone := &monkalev1alpha1.DNSZone{}
+	if cfg.DNSZone != "" {
+		zoneRef, err := getACMEDNSZoneRef(cfg.DNSZone, ch.ResourceNamespace)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := s.client.Get(ctx, zoneRef, dnsZone); err != nil {
+			return nil, "", fmt.Errorf("failed to get DNSZone %s: %v", zoneRef, err)
+		}
+	} else {
+		dnsZones := monkalev1alpha1.DNSZoneList{}
+		if err := s.client.List(ctx, &dnsZones); err != nil {
+			return nil, "", fmt.Errorf("failed to list DNSZones: %v", err)
+		}
+		primaryZones := []monkalev1alpha1.DNSZone{}
+		for _, zone := range dnsZones.Items {
+			if zone.Spec.Type != monkalev1alpha1.DNSZoneTypeSecondary {
+				primaryZones = append(primaryZones, zone)
+			}
+		}
+		match, ok := getLongestMatchingDNSZone(ch.ResolvedFQDN, primaryZones)
+		if !ok {
+			return nil, "", fmt.Errorf("no DNSZone serves %s", ch.ResolvedFQDN)
+		}
+		dnsZone = match
+	}
+
+	if dnsZone.Spec.Type == monkalev1alpha1.DNSZoneTypeSecondary {
+		return nil, "", fmt.Errorf("DNSZone %s/%s is a Secondary zone", dnsZone.Namespace, dnsZone.Name)
+	}
+	fqdn, err := getACMEChallengeFQDN(ch.ResolvedFQDN, dnsZone)
+	if err != nil {
+		return nil, "", err
+	}
+	return dnsZone, fqdn, nil
+}
+
+// updateChallengeRecord applies the change of the challenge values to the TXT DNSRecord of the name.
+// The DNSRecord is created if missing, and deleted if no values are left.
+func (s *ACMESolver) updateChallengeRecord(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone, fqdn string, change func([]string) []string) error {
+	zoneRef := types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace}
+	recordRef := types.NamespacedName{
+		Name:      getSourceRecordName(monkalev1alpha1.SourceKindACMEChallenge, zoneRef, fqdn, "TXT"),
+		Namespace: dnsZone.Namespace,
+	}
+
+	var existing *monkalev1alpha1.DNSRecord
+	dnsRecord := &monkalev1alpha1.DNSRecord{}
+	err := s.client.Get(ctx, recordRef, dnsRecord)
+	switch {
+	case err == nil && !isACMEOwned(dnsRecord, dnsZone):
+		return fmt.Errorf("DNSRecord %s is not owned by the ACME solver", recordRef)
+	case err == nil:
+		existing = dnsRecord
+	case !apierrors.IsNotFound(err):
+		return err
+	}
+
+	var values []string
+	if existing != nil {
+		values = getACMERecordValues(existing)
+	}
+	values = change(values)
+
+	switch {
+	case len(values) == 0 && existing == nil:
+		return nil
+	case len(values) == 0:
+		if err := s.client.Delete(ctx, existing, client.Preconditions{ResourceVersion: &existing.ResourceVersion}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	case existing != nil && len(values) == len(getACMERecordValues(existing)):
+		return nil
+	}
+
+	upcoming, err := constructACMERecord(dnsZone, fqdn, values, existing)
+	if err != nil {
+		return fmt.Errorf("record validation failure: %v", err)
+	}
+	if existing == nil {
+		err = s.client.Create(ctx, &upcoming)
+		if apierrors.IsAlreadyExists(err) {
+			// Created by a concurrent request, retry with the current DNSRecord.
+			return apierrors.NewConflict(monkalev1alpha1.GroupVersion.WithResource("dnsrecords").GroupResource(), recordRef.Name, err)
+		}
+		return err
+	}
+	return s.client.Update(ctx, &upcoming)
+}
+
+// checkChallengeProvisioned checks whether the DNSConnector of the DNSZone provisions the challenge value.
+func (s *ACMESolver) checkChallengeProvisioned(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone, value string) error {
+	zoneRef := types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace}
+	currentZone := &monkalev1alpha1.DNSZone{}
+	if err := s.client.Get(ctx, zoneRef, currentZone); err != nil {
+		return fmt.Errorf("failed to get DNSZone: %v", err)
+	}
+	if currentZone.Status.ZoneConfigmap == "" {
+		return fmt.Errorf("zone ConfigMap has not been created yet")
+	}
+	if currentZone.Spec.ConnectorName == "" {
+		return fmt.Errorf("DNSZone does not reference a DNSConnector")
+	}
+
+	zoneCM := &corev1.ConfigMap{}
+	if err := s.client.Get(ctx, types.NamespacedName{Name: currentZone.Status.ZoneConfigmap, Namespace: currentZone.Namespace}, zoneCM); err != nil {
+		return fmt.Errorf("failed to get zone ConfigMap: %v", err)
+	}
+	dnsConnector := &monkalev1alpha1.DNSConnector{}
+	if err := s.client.Get(ctx, types.NamespacedName{Name: currentZone.Spec.ConnectorName, Namespace: currentZone.Namespace}, dnsConnector); err != nil {
+		return fmt.Errorf("failed to get DNSConnector: %v", err)
+	}
+	return checkACMEChallengeProvisioned(currentZone, zoneCM, dnsConnector, value)
+}
@@ -17,7 +17,9 @@ limitations under the License.
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -26,87 +28,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
 )
 
-// generateCorefile is used to generate Corefile based on originalCorefile(string) and DNSZone's zonefile configMaps.
-// receives original corednsConfCM and zoneConfigMaps as args.
-func generateCorefileCM(dnsConnector *monkalev1alpha1.DNSConnector, corednsConfCM *corev1.ConfigMap, zoneConfigMaps *corev1.ConfigMapList) (corev1.ConfigMap, error) {
-	corefileConfigBlockStartPrefix := "# COREDNS CONTROLLER MANAGED BLOCK BEGINNING -- "
-	corefileConfigBlockEndPrefix := "# COREDNS CONTROLLER MANAGED BLOCK END -- "
-	corefileBlocks := make(map[string]string)
-	configMapDomains := make(map[string]bool)
-	var newCorefileBuilder strings.Builder
-
-	cmDataKey := dnsConnector.Spec.CorednsCM.CorefileKey
-	newCorednsConfCM := corednsConfCM.DeepCopy()
-
-	corednsCorefileContent, ok := corednsConfCM.Data[cmDataKey]
-	if !ok {
-		return corev1.ConfigMap{}, fmt.Errorf("key %s not found in CoreDNS ConfigMap", cmDataKey)
-	}
-
-	for _, configMap := range zoneConfigMaps.Items {
-		// extract domain
-		domainName, ok := configMap.Annotations["DomainName"]
-		if !ok {
-			return corev1.ConfigMap{}, fmt.Errorf("configMap %s does not have a domain annotation", configMap.Name)
-		}
-
-		// get enabled plugins
-		pluginString := ""
-		for _, plugin := range dnsConnector.Spec.CorednsZoneEnaledPlugins {
-			pluginString += fmt.Sprintf("\n\t%s", plugin)
-		}
-
-		// Ensure that zonefile contains zonefile in the cm.data
-		zonefileName := monkalev1alpha1.EnsureFQDN(domainName) + "zone"
-		if _, ok := configMap.Data[zonefileName]; !ok {
-			return corev1.ConfigMap{}, fmt.Errorf("configMap %s does not contain zonefile data", configMap.Name)
-		}
-
-		// generate zone config block
-		configBlock := fmt.Sprintf(`
-%s %s
-%s:53 {
-	file %s/%s%s
-}
-%s %s`, corefileConfigBlockStartPrefix, domainName, domainName, dnsConnector.Spec.CorednsDeployment.ZoneFileMountDir, zonefileName, pluginString, corefileConfigBlockEndPrefix, domainName)
-
-		corefileBlocks[domainName] = configBlock
-		configMapDomains[domainName] = true
-	}
-
-	// iterate over corefile
-	lines := strings.Split(corednsCorefileContent, "\n")
-	inBlock := false
-
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmedLine, corefileConfigBlockStartPrefix) {
-			inBlock = true
-			currentDomain := strings.TrimPrefix(trimmedLine, corefileConfigBlockStartPrefix)
-			if _, exists := corefileBlocks[currentDomain]; exists {
-				newCorefileBuilder.WriteString(corefileBlocks[currentDomain])
-				delete(corefileBlocks, currentDomain)
-			}
-		} else if strings.HasPrefix(trimmedLine, corefileConfigBlockEndPrefix) {
-			inBlock = false
-		} else if !inBlock {
-			newCorefileBuilder.WriteString(line + "\n")
-		}
-	}
-
-	for _, block := range corefileBlocks {
-		newCorefileBuilder.WriteString(block)
-	}
-
-	corefileContent := newCorefileBuilder.String()
-	// modify configmap
-	newCorednsConfCM.Data[cmDataKey] = corefileContent
-
-	return *newCorednsConfCM, nil
-}
-
 // getDesiredVolumes iterates over zone configmaps list and returns a map where the key is volume name based on the
 // domain name annotation, and values are two string: configMap.Name and configmap.Data zone key
 func getDesiredVolumes(configMaps *corev1.ConfigMapList) (map[string][2]string, error) {
@@ -116,8 +40,11 @@ func getDesiredVolumes(configMaps *corev1.ConfigMapList) (map[string][2]string,
 		if !ok {
 			return nil, fmt.Errorf("configMap %s does not have a domain annotation", configMap.Name)
 		}
-		volumeName := fmt.Sprintf("dnszone-%s", strings.ReplaceAll(domainName, ".", "-"))
-		volumeName = strings.TrimSuffix(volumeName, "-")
+		// Secondary zones have no zonefile
+		if configMap.Annotations["ZoneType"] == monkalev1alpha1.DNSZoneTypeSecondary {
+			continue
+		}
+		volumeName := render.GetZonefileVolumeName(domainName)
 
 		if len(configMap.Data) != 1 {
 			return nil, fmt.Errorf("configMap %s should contain only one key", configMap.Name)
@@ -133,27 +60,50 @@ func getDesiredVolumes(configMaps *corev1.ConfigMapList) (map[string][2]string,
 	return desiredVolumes, nil
 }
 
-// setZoneFileConifgMaps attaches ConfigMaps to a CoreDNS deployment by adding them as volumes
-// and volume mounts to the PodTemplateSpec of the provided StatefulSet, Deployment, or DaemonSet.
-// It returns the modified deployment object.
-func setZoneFileConifgMaps(dnsConnector monkalev1alpha1.DNSConnector, corednsDeployment client.Object, configMaps *corev1.ConfigMapList) (client.Object, error) {
-	var podTemplateSpec *corev1.PodTemplateSpec
+// getPodTemplateSpec returns the PodTemplateSpec of the provided StatefulSet, Deployment, or DaemonSet.
+func getPodTemplateSpec(corednsDeployment client.Object) (*corev1.PodTemplateSpec, error) {
 	switch res := corednsDeployment.(type) {
 	case *appsv1.StatefulSet:
-		podTemplateSpec = &res.Spec.Template
+		return &res.Spec.Template, nil
 	case *appsv1.Deployment:
-		podTemplateSpec = &res.Spec.Template
+		return &res.Spec.Template, nil
 	case *appsv1.DaemonSet:
-		podTemplateSpec = &res.Spec.Template
+		return &res.Spec.Template, nil
 	default:
 		return nil, fmt.Errorf("unsupported resource type: %T", res)
 	}
+}
 
-	// trigger coredns deployment reconciliation
+// requestCorednsRestart stamps the pod template with the reconcilation-request annotation
+// to trigger coredns deployment reconciliation.
+func requestCorednsRestart(podTemplateSpec *corev1.PodTemplateSpec) {
 	if podTemplateSpec.Annotations == nil {
 		podTemplateSpec.Annotations = make(map[string]string)
 	}
 	podTemplateSpec.Annotations["reconcilation-request"] = fmt.Sprintf("%d", metav1.Now().Unix())
+}
+
+// setZoneFileConifgMaps attaches ConfigMaps to a CoreDNS deployment by adding them as volumes
+// and volume mounts to the PodTemplateSpec of the provided StatefulSet, Deployment, or DaemonSet.
+// It returns the modified deployment object.
+func setZoneFileConifgMaps(dnsConnector monkalev1alpha1.DNSConnector, corednsDeployment client.Object, configMaps *corev1.ConfigMapList) (client.Object, error) {
+	podTemplateSpec, err := getPodTemplateSpec(corednsDeployment)
+	if err != nil {
+		return nil, err
+	}
+
+	// coredns reloads the zonefiles, the pod template changes only if the set of zones changes
+	if render.IsReloadRollout(&dnsConnector) {
+		volumes, volumeMounts, err := getReloadZoneFileVolumes(&dnsConnector, configMaps)
+		if err != nil {
+			return nil, err
+		}
+		replaceZoneFileVolumes(podTemplateSpec, volumes, volumeMounts)
+		return corednsDeployment, nil
+	}
+
+	// trigger coredns deployment reconciliation
+	requestCorednsRestart(podTemplateSpec)
 
 	// get desired volumes from the provided configmaps
 	desiredVolumes, err := getDesiredVolumes(configMaps)
@@ -165,8 +115,9 @@ func setZoneFileConifgMaps(dnsConnector monkalev1alpha1.DNSConnector, corednsDep
 	newVolumes := make([]corev1.Volume, 0)
 	newVolumeMounts := make([]corev1.VolumeMount, 0)
 	for _, volume := range podTemplateSpec.Spec.Volumes {
-		if strings.HasPrefix(volume.Name, "dnszone-") {
-			if _, exists := desiredVolumes[volume.Name]; exists {
+		if strings.HasPrefix(volume.Name, render.ZonefileVolumePrefix) {
+			// the volumes restored by the rollback point at the checkpoint zone configmaps, they are replaced
+			if desired, exists := desiredVolumes[volume.Name]; exists && volume.ConfigMap != nil && volume.ConfigMap.Name == desired[0] {
 				newVolumes = append(newVolumes, volume) // keep desired volume
 			}
 		} else {
@@ -175,7 +126,7 @@ func setZoneFileConifgMaps(dnsConnector monkalev1alpha1.DNSConnector, corednsDep
 	}
 
 	for _, volumeMount := range podTemplateSpec.Spec.Containers[0].VolumeMounts {
-		if strings.HasPrefix(volumeMount.Name, "dnszone-") {
+		if strings.HasPrefix(volumeMount.Name, render.ZonefileVolumePrefix) {
 			if _, exists := desiredVolumes[volumeMount.Name]; exists {
 				newVolumeMounts = append(newVolumeMounts, volumeMount) // keep desired volumemount
 			}
@@ -244,3 +195,256 @@ func setZoneFileConifgMaps(dnsConnector monkalev1alpha1.DNSConnector, corednsDep
 
 	return corednsDeployment, nil
 }
+
+// getZoneFileVolumes returns zonefile volumes and volume mounts of the CoreDNS deployment.
+func getZoneFileVolumes(corednsDeployment client.Object) ([]corev1.Volume, []corev1.VolumeMount, error) {
+	podTemplateSpec, err := getPodTemplateSpec(corednsDeployment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	volumes := make([]corev1.Volume, 0)
+	volumeMounts := make([]corev1.VolumeMount, 0)
+	for _, volume := range podTemplateSpec.Spec.Volumes {
+		if strings.HasPrefix(volume.Name, render.ZonefileVolumePrefix) {
+			volumes = append(volumes, volume)
+		}
+	}
+	if len(podTemplateSpec.Spec.Containers) > 0 {
+		for _, volumeMount := range podTemplateSpec.Spec.Containers[0].VolumeMounts {
+			if strings.HasPrefix(volumeMount.Name, render.ZonefileVolumePrefix) {
+				volumeMounts = append(volumeMounts, volumeMount)
+			}
+		}
+	}
+	return volumes, volumeMounts, nil
+}
+
+// setZoneFileVolumes replaces zonefile volumes and volume mounts of the CoreDNS deployment with the provided ones.
+// Other volumes and volume mounts are kept as is. It returns the modified deployment object.
+func setZoneFileVolumes(corednsDeployment client.Object, volumes []corev1.Volume, volumeMounts []corev1.VolumeMount) (client.Object, error) {
+	podTemplateSpec, err := getPodTemplateSpec(corednsDeployment)
+	if err != nil {
+		return nil, err
+	}
+
+	// trigger coredns deployment reconciliation
+	requestCorednsRestart(podTemplateSpec)
+	replaceZoneFileVolumes(podTemplateSpec, volumes, volumeMounts)
+
+	return corednsDeployment, nil
+}
+
+// replaceZoneFileVolumes replaces zonefile volumes and volume mounts of the PodTemplateSpec with the provided ones.
+func replaceZoneFileVolumes(podTemplateSpec *corev1.PodTemplateSpec, volumes []corev1.Volume, volumeMounts []corev1.VolumeMount) {
+	newVolumes := make([]corev1.Volume, 0)
+	for _, volume := range podTemplateSpec.Spec.Volumes {
+		if !strings.HasPrefix(volume.Name, render.ZonefileVolumePrefix) {
+			newVolumes = append(newVolumes, volume)
+		}
+	}
+	newVolumes = append(newVolumes, volumes...)
+	podTemplateSpec.Spec.Volumes = newVolumes
+
+	for i := range podTemplateSpec.Spec.Containers {
+		newVolumeMounts := make([]corev1.VolumeMount, 0)
+		for _, volumeMount := range podTemplateSpec.Spec.Containers[i].VolumeMounts {
+			if !strings.HasPrefix(volumeMount.Name, render.ZonefileVolumePrefix) {
+				newVolumeMounts = append(newVolumeMounts, volumeMount)
+			}
+		}
+		podTemplateSpec.Spec.Containers[i].VolumeMounts = append(newVolumeMounts, volumeMounts...)
+	}
+}
+
+// constructCheckpointConfigMap constructs the configmap that keeps the last known-good state of coredns:
+// the Corefile content, zonefile volumes and volume mounts.
+func constructCheckpointConfigMap(dnsConnector *monkalev1alpha1.DNSConnector, corefileContent string, volumes []corev1.Volume, volumeMounts []corev1.VolumeMount) (corev1.ConfigMap, error) {
+	volumesJSON, err := json.Marshal(volumes)
+	if err != nil {
+		return corev1.ConfigMap{}, fmt.Errorf("could not encode zonefile volumes: %v", err)
+	}
+	volumeMountsJSON, err := json.Marshal(volumeMounts)
+	if err != nil {
+		return corev1.ConfigMap{}, fmt.Errorf("could not encode zonefile volume mounts: %v", err)
+	}
+	cm := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dnsConnector.Spec.CorednsCM.Name + monkalev1alpha1.CorednsCheckpointConfSuffix,
+			Namespace: dnsConnector.Namespace,
+			Labels:    map[string]string{"app": "coredns-addon-operator"},
+		},
+		Data: map[string]string{
+			dnsConnector.Spec.CorednsCM.CorefileKey:          corefileContent,
+			monkalev1alpha1.CorednsCheckpointVolumesKey:      string(volumesJSON),
+			monkalev1alpha1.CorednsCheckpointVolumeMountsKey: string(volumeMountsJSON),
+		},
+	}
+	return cm, nil
+}
+
+// parseCheckpointConfigMap extracts the Corefile content, zonefile volumes and volume mounts from the checkpoint configmap.
+func parseCheckpointConfigMap(dnsConnector *monkalev1alpha1.DNSConnector, checkpointCM *corev1.ConfigMap) (string, []corev1.Volume, []corev1.VolumeMount, error) {
+	corefileContent, ok := checkpointCM.Data[dnsConnector.Spec.CorednsCM.CorefileKey]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("key %s not found in checkpoint ConfigMap", dnsConnector.Spec.CorednsCM.CorefileKey)
+	}
+	volumes := []corev1.Volume{}
+	if err := json.Unmarshal([]byte(checkpointCM.Data[monkalev1alpha1.CorednsCheckpointVolumesKey]), &volumes); err != nil {
+		return "", nil, nil, fmt.Errorf("could not decode zonefile volumes: %v", err)
+	}
+	volumeMounts := []corev1.VolumeMount{}
+	if err := json.Unmarshal([]byte(checkpointCM.Data[monkalev1alpha1.CorednsCheckpointVolumeMountsKey]), &volumeMounts); err != nil {
+		return "", nil, nil, fmt.Errorf("could not decode zonefile volume mounts: %v", err)
+	}
+	return corefileContent, volumes, volumeMounts, nil
+}
+
+// getCheckpointZoneConfigMapName returns the name of the configmap that keeps the last known-good content of the zone configmap.
+func getCheckpointZoneConfigMapName(dnsConnector *monkalev1alpha1.DNSConnector, zoneCMName string) string {
+	return dnsConnector.Spec.CorednsCM.Name + monkalev1alpha1.CorednsCheckpointZoneInfix + zoneCMName
+}
+
+// constructCheckpointZoneConfigMap copies the zonefile and the annotations of the zone configmap into the checkpoint zone configmap.
+func constructCheckpointZoneConfigMap(dnsConnector *monkalev1alpha1.DNSConnector, zoneCM *corev1.ConfigMap) corev1.ConfigMap {
+	zoneCM = zoneCM.DeepCopy()
+	return corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        getCheckpointZoneConfigMapName(dnsConnector, zoneCM.Name),
+			Namespace:   dnsConnector.Namespace,
+			Labels:      map[string]string{"app": "coredns-addon-operator", monkalev1alpha1.CorednsCheckpointLabel: dnsConnector.Name},
+			Annotations: zoneCM.Annotations,
+		},
+		Data: zoneCM.Data,
+	}
+}
+
+// getRestoredDNSZones returns the zones served after the rollback. The zonefiles are restored with the serials of the
+// checkpoint, by volume name. The zones without zonefile volume, the Secondary zones, are restored by the Corefile.
+// The zonefiles which could not be restored, with an empty serial, are left out.
+func getRestoredDNSZones(provisioned []monkalev1alpha1.ProvisionedDNSZone, restoredZonefiles map[string]string) []monkalev1alpha1.ProvisionedDNSZone {
+	restored := []monkalev1alpha1.ProvisionedDNSZone{}
+	for _, zone := range provisioned {
+		serial, ok := restoredZonefiles[render.GetZonefileVolumeName(zone.Domain)]
+		switch {
+		case !ok:
+			restored = append(restored, zone)
+		case serial != "":
+			zone.SerialNumber = serial
+			restored = append(restored, zone)
+		}
+	}
+	return restored
+}
+
+// getProvisionedDNSZones builds the list of provisioned zones out of the annotations of the zonefile configMaps.
+func getProvisionedDNSZones(zoneConfigMaps *corev1.ConfigMapList) ([]monkalev1alpha1.ProvisionedDNSZone, error) {
+	dnsZoneStats := []monkalev1alpha1.ProvisionedDNSZone{}
+	for _, zoneCM := range zoneConfigMaps.Items {
+		var dnsZoneStat monkalev1alpha1.ProvisionedDNSZone
+		var okN, okD, okS bool
+		dnsZoneStat.Name, okN = zoneCM.Annotations["DNSZoneRef"]
+		dnsZoneStat.Domain, okD = zoneCM.Annotations["DomainName"]
+		dnsZoneStat.SerialNumber, okS = zoneCM.Annotations["SerialNumber"]
+		if !okN || !okD || !okS {
+			return nil, fmt.Errorf("configMap %s is missing required annotation: DNSZoneRef=%t, DomainName=%t, SerialNumber=%t", zoneCM.Name, okN, okD, okS)
+		}
+		dnsZoneStats = append(dnsZoneStats, dnsZoneStat)
+	}
+	return dnsZoneStats, nil
+}
+
+// getProvisionedDNSZoneSerial returns the serial of the DNSZone in the provisioned zones.
+func getProvisionedDNSZoneSerial(zones []monkalev1alpha1.ProvisionedDNSZone, name string) string {
+	for _, zone := range zones {
+		if zone.Name == name {
+			return zone.SerialNumber
+		}
+	}
+	return ""
+}
+
+// getRevertedDNSZones compares the zones restored by the rollback with the zones the update tried to provision,
+// and returns the zone changes that are reverted by the rollback.
+func getRevertedDNSZones(restored, attempted []monkalev1alpha1.ProvisionedDNSZone) []monkalev1alpha1.ProvisionedDNSZone {
+	reverted := []monkalev1alpha1.ProvisionedDNSZone{}
+	restoredSet := make(map[monkalev1alpha1.ProvisionedDNSZone]bool)
+	for _, zone := range restored {
+		restoredSet[getProvisionedDNSZoneKey(zone)] = true
+	}
+	attemptedNames := make(map[string]bool)
+	for _, zone := range attempted {
+		attemptedNames[zone.Name] = true
+		// zone has been added or changed
+		if !restoredSet[getProvisionedDNSZoneKey(zone)] {
+			reverted = append(reverted, getProvisionedDNSZoneKey(zone))
+		}
+	}
+	// zone has been removed
+	for _, zone := range restored {
+		if !attemptedNames[zone.Name] {
+			reverted = append(reverted, getProvisionedDNSZoneKey(zone))
+		}
+	}
+	return reverted
+}
+
+// equalProvisionedDNSZones returns true if both lists contain the same zones with the same serial numbers.
+func equalProvisionedDNSZones(a, b []monkalev1alpha1.ProvisionedDNSZone) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	zoneSet := make(map[monkalev1alpha1.ProvisionedDNSZone]int)
+	for _, zone := range a {
+		zoneSet[getProvisionedDNSZoneKey(zone)]++
+	}
+	for _, zone := range b {
+		if zoneSet[getProvisionedDNSZoneKey(zone)] == 0 {
+			return false
+		}
+		zoneSet[getProvisionedDNSZoneKey(zone)]--
+	}
+	return true
+}
+
+// countProvisionedDNSZoneChanges counts the zones added, removed or changed compared to the provisioned zones.
+func countProvisionedDNSZoneChanges(provisioned, upcoming []monkalev1alpha1.ProvisionedDNSZone) int {
+	provisionedZones := make(map[string]monkalev1alpha1.ProvisionedDNSZone)
+	for _, zone := range provisioned {
+		provisionedZones[zone.Name] = getProvisionedDNSZoneKey(zone)
+	}
+	changes := 0
+	for _, zone := range upcoming {
+		if provisionedZone, ok := provisionedZones[zone.Name]; !ok || provisionedZone != getProvisionedDNSZoneKey(zone) {
+			changes++
+		}
+		delete(provisionedZones, zone.Name)
+	}
+	return changes + len(provisionedZones)
+}
+
+// getProvisionedDNSZoneKey returns the provisioned zone without the verification result, so the zones are compared by the serial only.
+func getProvisionedDNSZoneKey(zone monkalev1alpha1.ProvisionedDNSZone) monkalev1alpha1.ProvisionedDNSZone {
+	zone.Mismatch = ""
+	return zone
+}
+
+// setProvisionedDNSZoneMismatches reports the mismatches of the served serials in the provisioned zones.
+func setProvisionedDNSZoneMismatches(dnsZoneStats []monkalev1alpha1.ProvisionedDNSZone, mismatches map[string]string) {
+	for i := range dnsZoneStats {
+		dnsZoneStats[i].Mismatch = mismatches[dnsZoneStats[i].Name]
+	}
+}
+
+// getConnectorReadyMessage returns the message of the DNSConnector after the rollout, which lists the zones not served with the expected serial.
+func getConnectorReadyMessage(mismatches map[string]string) string {
+	if len(mismatches) == 0 {
+		return "CoreDNS Ready"
+	}
+	zoneNames := make([]string, 0, len(mismatches))
+	for zoneName := range mismatches {
+		zoneNames = append(zoneNames, zoneName)
+	}
+	sort.Strings(zoneNames)
+	return fmt.Sprintf("CoreDNS Degraded. Zones not served with the expected serial: %s", strings.Join(zoneNames, ", "))
+}
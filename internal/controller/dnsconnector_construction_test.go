@@ -0,0 +1,103 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+func provisionedZone(name, domain, serial string) monkalev1alpha1.ProvisionedDNSZone {
+	return monkalev1alpha1.ProvisionedDNSZone{Name: name, Domain: domain, SerialNumber: serial}
+}
+
+func TestGetRevertedDNSZones(t *testing.T) {
+	exampleCom := provisionedZone("example-com", "example.com", "2024060101")
+	exampleOrg := provisionedZone("example-org", "example.org", "2024060101")
+	changedOrg := provisionedZone("example-org", "example.org", "2024060102")
+	mismatchedOrg := changedOrg
+	mismatchedOrg.Mismatch = "pod coredns serves serial 2024060101, expected 2024060102"
+	tests := []struct {
+		name      string
+		restored  []monkalev1alpha1.ProvisionedDNSZone
+		attempted []monkalev1alpha1.ProvisionedDNSZone
+		want      []monkalev1alpha1.ProvisionedDNSZone
+	}{
+		{name: "nothing reverted", restored: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}, attempted: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}, want: []monkalev1alpha1.ProvisionedDNSZone{}},
+		{name: "changed zone", restored: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}, attempted: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, changedOrg}, want: []monkalev1alpha1.ProvisionedDNSZone{changedOrg}},
+		{name: "added zone", restored: []monkalev1alpha1.ProvisionedDNSZone{exampleCom}, attempted: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}, want: []monkalev1alpha1.ProvisionedDNSZone{exampleOrg}},
+		{name: "removed zone", restored: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}, attempted: []monkalev1alpha1.ProvisionedDNSZone{exampleCom}, want: []monkalev1alpha1.ProvisionedDNSZone{exampleOrg}},
+		{name: "nothing restored", restored: nil, attempted: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}, want: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}},
+		{name: "mismatch is not a change", restored: []monkalev1alpha1.ProvisionedDNSZone{mismatchedOrg}, attempted: []monkalev1alpha1.ProvisionedDNSZone{changedOrg}, want: []monkalev1alpha1.ProvisionedDNSZone{}},
+		{name: "reverted without the mismatch", restored: []monkalev1alpha1.ProvisionedDNSZone{exampleOrg}, attempted: []monkalev1alpha1.ProvisionedDNSZone{mismatchedOrg}, want: []monkalev1alpha1.ProvisionedDNSZone{changedOrg}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getRevertedDNSZones(tt.restored, tt.attempted); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getRevertedDNSZones() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountProvisionedDNSZoneChanges(t *testing.T) {
+	exampleCom := provisionedZone("example-com", "example.com", "2024060101")
+	exampleOrg := provisionedZone("example-org", "example.org", "2024060101")
+	changedOrg := provisionedZone("example-org", "example.org", "2024060102")
+	mismatchedOrg := exampleOrg
+	mismatchedOrg.Mismatch = "no ready coredns pods"
+	tests := []struct {
+		name        string
+		provisioned []monkalev1alpha1.ProvisionedDNSZone
+		upcoming    []monkalev1alpha1.ProvisionedDNSZone
+		want        int
+	}{
+		{name: "no zones", want: 0},
+		{name: "unchanged", provisioned: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}, upcoming: []monkalev1alpha1.ProvisionedDNSZone{exampleOrg, exampleCom}, want: 0},
+		{name: "mismatch is not a change", provisioned: []monkalev1alpha1.ProvisionedDNSZone{mismatchedOrg}, upcoming: []monkalev1alpha1.ProvisionedDNSZone{exampleOrg}, want: 0},
+		{name: "changed serial", provisioned: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}, upcoming: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, changedOrg}, want: 1},
+		{name: "added zone", provisioned: []monkalev1alpha1.ProvisionedDNSZone{exampleCom}, upcoming: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}, want: 1},
+		{name: "removed zone", provisioned: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}, upcoming: []monkalev1alpha1.ProvisionedDNSZone{exampleCom}, want: 1},
+		{name: "first rollout", upcoming: []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg}, want: 2},
+		{name: "replaced zone", provisioned: []monkalev1alpha1.ProvisionedDNSZone{exampleCom}, upcoming: []monkalev1alpha1.ProvisionedDNSZone{changedOrg}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countProvisionedDNSZoneChanges(tt.provisioned, tt.upcoming); got != tt.want {
+				t.Errorf("countProvisionedDNSZoneChanges() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRestoredDNSZones(t *testing.T) {
+	exampleCom := provisionedZone("example-com", "example.com", "2024060102")
+	exampleOrg := provisionedZone("example-org", "example.org", "2024060102")
+	secondary := provisionedZone("example-net", "example.net", "2024060102")
+	provisioned := []monkalev1alpha1.ProvisionedDNSZone{exampleCom, exampleOrg, secondary}
+	restoredZonefiles := map[string]string{
+		render.GetZonefileVolumeName(exampleCom.Domain): "2024060101",
+		render.GetZonefileVolumeName(exampleOrg.Domain): "",
+	}
+	want := []monkalev1alpha1.ProvisionedDNSZone{provisionedZone("example-com", "example.com", "2024060101"), secondary}
+	if got := getRestoredDNSZones(provisioned, restoredZonefiles); !reflect.DeepEqual(got, want) {
+		t.Errorf("getRestoredDNSZones() = %v, want %v", got, want)
+	}
+}
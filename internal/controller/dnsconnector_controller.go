@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -32,31 +33,39 @@ import (
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
 )
 
 // DNSConnectorReconciler reconciles a DNSConnector object
 type DNSConnectorReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// APIReader lists the CoreDNS pods bypassing the cache, so the pods are not watched cluster-wide.
+	// The apps workloads are watched to follow the rollouts, see corednsWorkloadChangedPredicate.
+	APIReader client.Reader
 }
 
 // +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnsconnectors,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnsconnectors/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnsconnectors/finalizers,verbs=update
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnsforwardzones,verbs=get;list;watch
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnsforwardzones/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list
 
 func (r *DNSConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	_ = log.FromContext(ctx)
@@ -89,6 +98,12 @@ func (r *DNSConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return r.reconcileDelete(ctx, &dnsConnector)
 	}
 
+	// the rollout of the applied changes is in progress. the changes made meanwhile are applied once it is completed.
+	if isRolloutInProgress(dnsConnector.Status.Rollout) {
+		log.Log.Info("DNSConnector instance. Tracking the rollout", "DNSConnector.Name", dnsConnector.Name, "Phase", dnsConnector.Status.Rollout.Phase)
+		return r.reconcileRollout(ctx, &dnsConnector)
+	}
+
 	log.Log.Info("DNSConnector instance. Reconciling", "DNSConnector.Name", dnsConnector.Name)
 	return r.reconcileDNSConnector(ctx, &dnsConnector)
 }
@@ -161,22 +176,77 @@ func (r *DNSConnectorReconciler) reconcileDNSConnector(ctx context.Context, dnsC
 
 	// get good zonefiles cm
 	log.Log.Info("DNSConnector instance. Reconciling. Fetch DNSZones and Zonefile configMaps", "DNSConnector.Name", dnsConnector.Name)
-	dnsZonesList, zonefileCMList, err := r.fetchGoodZonefileCM(ctx, dnsConnector)
+	_, zonefileCMList, err := r.fetchGoodZonefileCM(ctx, dnsConnector)
 	if err != nil {
 		log.Log.Error(err, "DNSConnector instance. Reconciling. Could not fetch zonefile configMaps", "DNSConnector.Name", dnsConnector.Name)
 		return ctrl.Result{}, err
 	}
+	dnsZoneStats, err := getProvisionedDNSZones(&zonefileCMList)
+	if err != nil {
+		log.Log.Error(err, "DNSConnector instance. Reconciling. Could not find required annotation", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+
+	// get good forward zones
+	log.Log.Info("DNSConnector instance. Reconciling. Fetch DNSForwardZones", "DNSConnector.Name", dnsConnector.Name)
+	forwardZonesList, err := r.fetchGoodForwardZones(ctx, dnsConnector, &zonefileCMList)
+	if err != nil {
+		log.Log.Error(err, "DNSConnector instance. Reconciling. Could not fetch DNSForwardZones", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+	forwardZoneStats := getProvisionedForwardZones(&forwardZonesList)
+
+	// the same set of zones has been rolled back before. it will fail again, so wait until the zones or the connector are changed.
+	if lastRollback := dnsConnector.Status.LastRollback; lastRollback != nil && lastRollback.ObservedGeneration == dnsConnector.Generation && equalProvisionedDNSZones(lastRollback.AttemptedZones, dnsZoneStats) && equalProvisionedForwardZones(lastRollback.AttemptedForwardZones, forwardZoneStats) {
+		log.Log.Info("DNSConnector instance. Reconciling. These changes have been rolled back before. Waiting for DNSZones or DNSConnector to be changed", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, nil
+	}
+
+	// coalesce the zone changes arriving within spec.minRolloutInterval into one rollout
+	pendingChanges := countProvisionedDNSZoneChanges(dnsConnector.Status.ProvisionedDNSZones, dnsZoneStats) + countProvisionedForwardZoneChanges(dnsConnector.Status.ProvisionedForwardZones, forwardZoneStats)
+	if requeueAfter := deferRollout(dnsConnector, pendingChanges, time.Now()); requeueAfter > 0 {
+		if err := r.refreshDNSConnectorResource(ctx, previousState); err != nil {
+			log.Log.Error(err, "DNSConnector instance. Reconciling. Failed to refresh DNSConnector resource", "DNSConnector.Name", dnsConnector.Name)
+			return ctrl.Result{}, err
+		}
+		if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
+			return ctrl.Result{}, err
+		}
+		log.Log.Info("DNSConnector instance. Reconciling. Waiting for more changes before the rollout", "DNSConnector.Name", dnsConnector.Name, "Pending changes", pendingChanges, "Requeue after", requeueAfter)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	// fetch TSIG keys of the zone transfers
+	tsigKeys, err := r.fetchTSIGKeys(ctx, &zonefileCMList)
+	if err != nil {
+		if err := r.refreshDNSConnectorResource(ctx, previousState); err != nil {
+			log.Log.Error(err, "DNSConnector instance. Reconciling. Failed to refresh DNSConnector resource", "DNSConnector.Name", dnsConnector.Name)
+			return ctrl.Result{}, err
+		}
+		message := fmt.Sprintf("could not fetch TSIG keys: %v", err)
+		setDnsConnectorCondition(dnsConnector, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonConnectorUpdateErr, message)
+		if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
+			return ctrl.Result{}, err
+		}
+		log.Log.Error(err, "DNSConnector instance. Reconciling. Could not fetch TSIG keys", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
 
 	// prepare corefile content.
 	log.Log.Info("DNSConnector instance. Reconciling. Generate a new Corefile content for the configMap", "DNSConnector.Name", dnsConnector.Name, "ConfigMap.metadata.name", dnsConnector.Spec.CorednsCM.Name, "CorednsDeployment.Name", corednsDeployment.GetName())
-	updatedCorefileCM, err := generateCorefileCM(dnsConnector, &corednsConfCM, &zonefileCMList)
+	updatedCorefileCM, err := render.GenerateCorefileCM(dnsConnector, &corednsConfCM, &zonefileCMList, &forwardZonesList, tsigKeys)
 	if err != nil {
 		if err := r.refreshDNSConnectorResource(ctx, previousState); err != nil {
 			log.Log.Error(err, "DNSConnector instance. Reconciling. Failed to refresh DNSConnector resource", "DNSConnector.Name", dnsConnector.Name)
 			return ctrl.Result{}, err
 		}
 		message := fmt.Sprintf("could not generate a new corefile: %v", err)
-		setDnsConnectorCondition(dnsConnector, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonConnectorUpdateErr, message)
+		reason := monkalev1alpha1.ConditionReasonConnectorUpdateErr
+		var corefileErr *render.CorefileError
+		if errors.As(err, &corefileErr) {
+			reason = monkalev1alpha1.ConditionReasonConnectorCorefile
+		}
+		setDnsConnectorCondition(dnsConnector, metav1.ConditionFalse, reason, message)
 		if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
 			return ctrl.Result{}, err
 		}
@@ -184,7 +254,23 @@ func (r *DNSConnectorReconciler) reconcileDNSConnector(ctx context.Context, dnsC
 		return ctrl.Result{}, err
 	}
 
+	// validate the whole corefile before anything is applied, coredns would not start with a broken corefile.
+	if err := render.ValidateCorefile(updatedCorefileCM.Data[dnsConnector.Spec.CorednsCM.CorefileKey]); err != nil {
+		if err := r.refreshDNSConnectorResource(ctx, previousState); err != nil {
+			log.Log.Error(err, "DNSConnector instance. Reconciling. Failed to refresh DNSConnector resource", "DNSConnector.Name", dnsConnector.Name)
+			return ctrl.Result{}, err
+		}
+		message := fmt.Sprintf("generated corefile is invalid: %v", err)
+		setDnsConnectorCondition(dnsConnector, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonConnectorCorefile, message)
+		if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
+			return ctrl.Result{}, err
+		}
+		log.Log.Error(err, "DNSConnector instance. Reconciling. Generated Corefile validation failure.", "DNSConnector.Name", dnsConnector.Name, "ConfigMap.metadata.name", dnsConnector.Spec.CorednsCM.Name)
+		return ctrl.Result{}, err
+	}
+
 	// attach configmap to the zone configmaps to the corednsDeployment, but not updates!
+	corednsGeneration := corednsDeployment.GetGeneration()
 	log.Log.Info("DNSConnector instance. Reconciling. Attach configmaps to coredns deployment", "DNSConnector.Name", dnsConnector.Name, "CorednsDeployment.Name", corednsDeployment.GetName())
 	updatedCorednsDeployment, err := setZoneFileConifgMaps(*dnsConnector, corednsDeployment, &zonefileCMList)
 	if err != nil {
@@ -201,6 +287,24 @@ func (r *DNSConnectorReconciler) reconcileDNSConnector(ctx context.Context, dnsC
 		return ctrl.Result{}, err
 	}
 
+	// the changes are being applied
+	if err := r.refreshDNSConnectorResource(ctx, previousState); err != nil {
+		log.Log.Error(err, "DNSConnector instance. Reconciling. Failed to refresh DNSConnector resource", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+	dnsConnector.Status.Rollout = &monkalev1alpha1.ConnectorRollout{
+		ObservedGeneration: dnsConnector.Generation,
+		Zones:              dnsZoneStats,
+		ForwardZones:       forwardZoneStats,
+	}
+	dnsConnector.Status.PendingChanges = 0
+	dnsConnector.Status.PendingSince = nil
+	setRolloutPhase(dnsConnector, monkalev1alpha1.RolloutPhaseApplying, "")
+	setDnsConnectorCondition(dnsConnector, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonConnectorUpdating, "coredns is being updated")
+	if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// apply changes corefile
 	log.Log.Info("DNSConnector instance. Reconciling. Apply all pending changes", "DNSConnector.Name", dnsConnector.Name, "CorednsDeployment.Name", corednsDeployment.GetName())
 	if err := r.Update(ctx, updatedCorednsDeployment); err != nil {
@@ -230,68 +334,310 @@ func (r *DNSConnectorReconciler) reconcileDNSConnector(ctx context.Context, dnsC
 		return ctrl.Result{}, err
 	}
 
-	// update status
+	// coredns rolls out the changes. with the Reload rollout strategy the pods are restarted only if the set of zones changes.
 	if err := r.refreshDNSConnectorResource(ctx, previousState); err != nil {
 		log.Log.Error(err, "DNSConnector instance. Reconciling. Failed to refresh DNSConnector resource", "DNSConnector.Name", dnsConnector.Name)
 		return ctrl.Result{}, err
 	}
-	setDnsConnectorCondition(dnsConnector, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonConnectorUpdating, "coredns is being updated")
+	dnsConnector.Status.Rollout.WorkloadGeneration = updatedCorednsDeployment.GetGeneration()
+	if render.IsReloadRollout(dnsConnector) && updatedCorednsDeployment.GetGeneration() == corednsGeneration {
+		setRolloutPhase(dnsConnector, monkalev1alpha1.RolloutPhaseVerifying, "waiting for coredns to serve the zone serials")
+	} else {
+		setRolloutPhase(dnsConnector, monkalev1alpha1.RolloutPhaseWaitingForRollout, "waiting for the update to be observed")
+	}
 	if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	// wait until coredns finishes to load changes
-	if err := r.corednsIsHealthy(ctx, dnsConnector); err != nil {
-		if err := r.refreshDNSConnectorResource(ctx, previousState); err != nil {
-			log.Log.Error(err, "DNSConnector instance. Reconciling. Failed to refresh DNSConnector resource", "DNSConnector.Name", dnsConnector.Name)
-			return ctrl.Result{}, err
+	log.Log.Info("DNSConnector instance. Reconciling. Changes have been applied. Tracking the rollout", "DNSConnector.Name", dnsConnector.Name, "Phase", dnsConnector.Status.Rollout.Phase)
+	return ctrl.Result{RequeueAfter: corednsRolloutCheckInterval}, nil
+}
+
+// reconcileRollout tracks the rollout of the applied changes. The checks never block, the DNSConnector is requeued until
+// the CoreDNS workload rolls out the changes and serves the zone serials, or the phase times out after waitForUpdateTimeout.
+// The CoreDNS workload is watched, so the DNSConnector is also woken up when the rollout progresses.
+func (r *DNSConnectorReconciler) reconcileRollout(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+	previousState := dnsConnector.DeepCopy()
+	rollout := dnsConnector.Status.Rollout
+	timeout := time.Duration(dnsConnector.Spec.WaitForUpdateTimeout) * time.Second
+
+	corednsDeployment, err := r.fetchCorednsDeployment(ctx, dnsConnector)
+	if err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollout. Could not detect coredns deployment", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+
+	switch rollout.Phase {
+	case monkalev1alpha1.RolloutPhaseWaitingForRollout:
+		rolledOut, status, err := isCorednsRolledOut(corednsDeployment, rollout.WorkloadGeneration)
+		if err != nil {
+			healthErr := fmt.Errorf("coredns is not healthy: %v. Check coredns deployment log", err)
+			log.Log.Error(healthErr, "DNSConnector instance. Rollout. Healthcheck failure. Rolling back", "DNSConnector.Name", dnsConnector.Name, "ConfigMap.metadata.name", dnsConnector.Spec.CorednsCM.Name)
+			return r.rollbackRollout(ctx, dnsConnector, healthErr)
 		}
-		err := errors.New("coredns is not healthy. Check coredns deployment log")
-		message := fmt.Sprintf("healthcheck failure: %v", err)
-		setDnsConnectorCondition(dnsConnector, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonConnectorUpdateErr, message)
+		if !rolledOut {
+			if isRolloutTimedOut(rollout, timeout) {
+				healthErr := errors.New("coredns is not healthy. Check coredns deployment log")
+				log.Log.Error(healthErr, "DNSConnector instance. Rollout. Healthcheck failure. Rolling back", "DNSConnector.Name", dnsConnector.Name, "ConfigMap.metadata.name", dnsConnector.Spec.CorednsCM.Name)
+				return r.rollbackRollout(ctx, dnsConnector, healthErr)
+			}
+			log.Log.Info("DNSConnector instance. Waiting for CorednsDeployment to become healhy", "DNSConnector.Name", dnsConnector.Name, "Status", status)
+			setRolloutPhase(dnsConnector, monkalev1alpha1.RolloutPhaseWaitingForRollout, status)
+			if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: getRolloutRequeueAfter(rollout, timeout)}, nil
+		}
+		setRolloutPhase(dnsConnector, monkalev1alpha1.RolloutPhaseVerifying, "waiting for coredns to serve the zone serials")
 		if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
 			return ctrl.Result{}, err
 		}
-		log.Log.Error(err, "DNSConnector instance. Reconciling. Healthcheck failure", "DNSConnector.Name", dnsConnector.Name, "ConfigMap.metadata.name", dnsConnector.Spec.CorednsCM.Name)
+		return ctrl.Result{Requeue: true}, nil
+
+	case monkalev1alpha1.RolloutPhaseVerifying:
+		// verify that coredns serves the serials of the DNSZones
+		dnsZonesList, err := r.fetchGoodZones(ctx, dnsConnector)
+		if err != nil {
+			log.Log.Error(err, "DNSConnector instance. Rollout. Could not fetch DNSZones", "DNSConnector.Name", dnsConnector.Name)
+			return ctrl.Result{}, err
+		}
+		rolloutZonesList := getRolloutDNSZones(&dnsZonesList, rollout.Zones)
+		// the serials applied by the rollout, the DNSZones may have been rendered again since then
+		expectedSerials, err := getRolloutZoneSerials(rollout.Zones)
+		if err != nil {
+			log.Log.Error(err, "DNSConnector instance. Rollout. Could not get the zone serials", "DNSConnector.Name", dnsConnector.Name)
+			return ctrl.Result{}, err
+		}
+		var mismatches map[string]string
+		if targets, err := r.getVerificationTargets(ctx, dnsConnector, corednsDeployment); err != nil {
+			mismatches = make(map[string]string)
+			for _, zone := range expectedSerials {
+				mismatches[zone.name] = err.Error()
+			}
+		} else {
+			mismatches = checkServedSerials(ctx, targets, expectedSerials)
+		}
+		if len(mismatches) > 0 && !isRolloutTimedOut(rollout, timeout) {
+			log.Log.Info("DNSConnector instance. Waiting for CoreDNS to serve the zone serials", "DNSConnector.Name", dnsConnector.Name, "Mismatches", mismatches)
+			setRolloutPhase(dnsConnector, monkalev1alpha1.RolloutPhaseVerifying, fmt.Sprintf("waiting for coredns to serve the zone serials, %d zones mismatch", len(mismatches)))
+			if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: getRolloutRequeueAfter(rollout, timeout)}, nil
+		}
+		return r.completeRollout(ctx, dnsConnector, corednsDeployment, &rolloutZonesList, mismatches)
+	}
+	return ctrl.Result{}, nil
+}
+
+// completeRollout saves the rolled out state as the checkpoint, notifies the DNSZones and DNSForwardZones, and activates the DNSConnector.
+// Only the zones served with the expected serial are Active and advance their checkpoint, the DNSConnector is Degraded while
+// any zone mismatches. The DNSConnector is requeued if the DNSZones, the DNSForwardZones or the DNSConnector have been changed
+// during the rollout.
+func (r *DNSConnectorReconciler) completeRollout(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector, corednsDeployment client.Object, dnsZonesList *monkalev1alpha1.DNSZoneList, mismatches map[string]string) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+	previousState := dnsConnector.DeepCopy()
+	rollout := dnsConnector.Status.Rollout
+
+	// coredns is healthy, remember the applied state of the verified zones
+	corednsConfCM, err := r.fetchCorednsConfCM(ctx, dnsConnector)
+	if err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollout. Could not fetch coredns Configmap", "DNSConnector.Name", dnsConnector.Name, "ConfigMap.metadata.name", dnsConnector.Spec.CorednsCM.Name)
+		return ctrl.Result{}, err
+	}
+	if err := r.saveCorednsCheckpoint(ctx, dnsConnector, corednsConfCM.Data[dnsConnector.Spec.CorednsCM.CorefileKey], corednsDeployment, rollout.Zones, mismatches); err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollout. Could not save coredns checkpoint", "DNSConnector.Name", dnsConnector.Name)
 		return ctrl.Result{}, err
 	}
 
-	// Update status for all related Good DNSZones
+	// Update status for all related Good DNSZones. Only the zones served with the expected serial are Active.
 	statusGood := metav1.ConditionTrue
 	reasonGood := monkalev1alpha1.ConditionReasonZoneActive
 	messageGood := "Picked up by DNSConnector."
-	if err := r.notifyGoodDNSZones(ctx, &dnsZonesList, statusGood, reasonGood, messageGood); err != nil {
-		log.Log.Error(err, "DNSConnector instance. Reconciling. Could update DNSZone status", "DNSConnector.Name", dnsConnector.Name)
+	verifiedZonesList := monkalev1alpha1.DNSZoneList{}
+	for _, dnsZone := range dnsZonesList.Items {
+		mismatch, ok := mismatches[dnsZone.Name]
+		if !ok {
+			verifiedZonesList.Items = append(verifiedZonesList.Items, dnsZone)
+			continue
+		}
+		mismatchedZonesList := monkalev1alpha1.DNSZoneList{Items: []monkalev1alpha1.DNSZone{dnsZone}}
+		mismatchMessage := fmt.Sprintf("CoreDNS does not serve the zone serial %s: %s", getProvisionedDNSZoneSerial(rollout.Zones, dnsZone.Name), mismatch)
+		if err := r.notifyGoodDNSZones(ctx, &mismatchedZonesList, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonZoneUpdateErr, mismatchMessage); err != nil {
+			log.Log.Error(err, "DNSConnector instance. Rollout. Could update DNSZone status", "DNSConnector.Name", dnsConnector.Name)
+			return ctrl.Result{}, err
+		}
+	}
+	if err := r.notifyGoodDNSZones(ctx, &verifiedZonesList, statusGood, reasonGood, messageGood); err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollout. Could update DNSZone status", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+	forwardZonesList, err := r.fetchForwardZones(ctx, dnsConnector)
+	if err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollout. Could not fetch DNSForwardZones", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+	rolloutForwardZonesList := getRolloutForwardZones(&forwardZonesList, rollout.ForwardZones)
+	if err := r.notifyForwardZones(ctx, &rolloutForwardZonesList, metav1.ConditionTrue, monkalev1alpha1.ConditionReasonForwardZoneActive, messageGood); err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollout. Could update DNSForwardZone status", "DNSConnector.Name", dnsConnector.Name)
 		return ctrl.Result{}, err
 	}
 
 	// Update status DNSConnector
-	dnsZoneStats := []monkalev1alpha1.ProvisionedDNSZone{}
-	for _, zoneCM := range zonefileCMList.Items {
-		var dnsZoneStat monkalev1alpha1.ProvisionedDNSZone
-		var okN, okD, okS bool
-		dnsZoneStat.Name, okN = zoneCM.Annotations["DNSZoneRef"]
-		dnsZoneStat.Domain, okD = zoneCM.Annotations["DomainName"]
-		dnsZoneStat.SerialNumber, okS = zoneCM.Annotations["SerialNumber"]
-		if !okN || !okD || !okS {
-			err := errors.New("missing required annotation")
-			log.Log.Error(err, "DNSConnector instance. Reconciling. Could not find required annotation", "ConfigMap.Name", zoneCM.Name, "Missing DNSZoneRef", !okN, "Missing Domain", !okD, "Missing SerialNumber", !okS)
+	if err := r.refreshDNSConnectorResource(ctx, previousState); err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollout. Failed to refresh DNSConnector resource", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+	dnsZoneStats := append([]monkalev1alpha1.ProvisionedDNSZone{}, rollout.Zones...)
+	setProvisionedDNSZoneMismatches(dnsZoneStats, mismatches)
+	dnsConnector.Status.ProvisionedDNSZones = dnsZoneStats
+	dnsConnector.Status.ProvisionedForwardZones = rollout.ForwardZones
+	setRolloutPhase(dnsConnector, monkalev1alpha1.RolloutPhaseActive, "")
+	if len(mismatches) > 0 {
+		setDnsConnectorCondition(dnsConnector, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonConnectorDegraded, getConnectorReadyMessage(mismatches))
+	} else {
+		setDnsConnectorCondition(dnsConnector, metav1.ConditionTrue, monkalev1alpha1.ConditionReasonConnectorActive, getConnectorReadyMessage(mismatches))
+	}
+	if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// the changes made during the rollout are applied by the next reconcilation
+	pendingChanges, err := r.hasPendingChanges(ctx, dnsConnector)
+	if err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollout. Could not check for pending changes", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+	log.Log.Info("DNSConnector instance. Reconcilation has been completed", "DNSConnector.Name", dnsConnector.Name, "Pending changes", pendingChanges)
+	return ctrl.Result{Requeue: pendingChanges}, nil
+}
+
+// rollbackRollout reverts the rollout in progress. The DNSConnector is requeued, so the changes made during the rollout are applied.
+// The reverted set of zones is not applied again, see LastRollback.
+func (r *DNSConnectorReconciler) rollbackRollout(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector, healthErr error) (ctrl.Result, error) {
+	dnsZonesList, err := r.fetchGoodZones(ctx, dnsConnector)
+	if err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollback. Could not fetch DNSZones", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+	forwardZonesList, err := r.fetchForwardZones(ctx, dnsConnector)
+	if err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollback. Could not fetch DNSForwardZones", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+	rollout := dnsConnector.Status.Rollout
+	return r.reconcileRollback(ctx, dnsConnector, &dnsZonesList, rollout.Zones, &forwardZonesList, rollout.ForwardZones, healthErr)
+}
+
+// hasPendingChanges checks whether the DNSConnector, its DNSZones or DNSForwardZones have been changed since the rollout has started.
+func (r *DNSConnectorReconciler) hasPendingChanges(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector) (bool, error) {
+	rollout := dnsConnector.Status.Rollout
+	if dnsConnector.Generation != rollout.ObservedGeneration {
+		return true, nil
+	}
+	_, zonefileCMList, err := r.fetchGoodZonefileCM(ctx, dnsConnector)
+	if err != nil {
+		return false, err
+	}
+	dnsZoneStats, err := getProvisionedDNSZones(&zonefileCMList)
+	if err != nil {
+		return false, err
+	}
+	forwardZonesList, err := r.fetchGoodForwardZones(ctx, dnsConnector, &zonefileCMList)
+	if err != nil {
+		return false, err
+	}
+	return !equalProvisionedDNSZones(rollout.Zones, dnsZoneStats) || !equalProvisionedForwardZones(rollout.ForwardZones, getProvisionedForwardZones(&forwardZonesList)), nil
+}
+
+// reconcileRollback reverts coredns to the last known-good state, notifies DNSZones whose changes have been reverted
+// and reports the rollback in the DNSConnector status.
+func (r *DNSConnectorReconciler) reconcileRollback(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector, dnsZonesList *monkalev1alpha1.DNSZoneList, attemptedZones []monkalev1alpha1.ProvisionedDNSZone, forwardZonesList *monkalev1alpha1.DNSForwardZoneList, attemptedForwardZones []monkalev1alpha1.ProvisionedDNSForwardZone, healthErr error) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+	previousState := dnsConnector.DeepCopy()
+
+	restoredZonefiles, err := r.rollbackCoredns(ctx, dnsConnector)
+	if err != nil {
+		if err := r.refreshDNSConnectorResource(ctx, previousState); err != nil {
+			log.Log.Error(err, "DNSConnector instance. Rollback. Failed to refresh DNSConnector resource", "DNSConnector.Name", dnsConnector.Name)
+			return ctrl.Result{}, err
+		}
+		message := fmt.Sprintf("healthcheck failure: %v. rollback failure: %v", healthErr, err)
+		setDnsConnectorCondition(dnsConnector, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonConnectorUpdateErr, message)
+		if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
 			return ctrl.Result{}, err
 		}
-		dnsZoneStats = append(dnsZoneStats, dnsZoneStat)
+		log.Log.Error(err, "DNSConnector instance. Rollback failure", "DNSConnector.Name", dnsConnector.Name, "ConfigMap.metadata.name", dnsConnector.Spec.CorednsCM.Name)
+		return ctrl.Result{}, err
+	}
+
+	// find out which zone changes have been reverted
+	revertedZones := getRevertedDNSZones(getRestoredDNSZones(dnsConnector.Status.ProvisionedDNSZones, restoredZonefiles), attemptedZones)
+	revertedZoneNames := make(map[string]bool)
+	revertedZoneDescriptions := []string{}
+	for _, zone := range revertedZones {
+		revertedZoneNames[zone.Name] = true
+		revertedZoneDescriptions = append(revertedZoneDescriptions, fmt.Sprintf("%s (serial %s)", zone.Name, zone.SerialNumber))
 	}
+	revertedForwardZones := getRevertedForwardZones(dnsConnector.Status.ProvisionedForwardZones, attemptedForwardZones)
+	revertedForwardZoneNames := make(map[string]bool)
+	for _, forwardZone := range revertedForwardZones {
+		revertedForwardZoneNames[forwardZone.Name] = true
+		revertedZoneDescriptions = append(revertedZoneDescriptions, fmt.Sprintf("%s (forward zone generation %d)", forwardZone.Name, forwardZone.Generation))
+	}
+	message := fmt.Sprintf("healthcheck failure: %v. Rolled back to the last known-good corefile. Reverted zone changes: %s", healthErr, strings.Join(revertedZoneDescriptions, ", "))
+
+	// notify DNSZones
+	revertedZonesList := monkalev1alpha1.DNSZoneList{}
+	for _, dnsZone := range dnsZonesList.Items {
+		if revertedZoneNames[dnsZone.Name] {
+			revertedZonesList.Items = append(revertedZonesList.Items, dnsZone)
+		}
+	}
+	zoneMessage := fmt.Sprintf("The change has been reverted by DNSConnector %s: %v", dnsConnector.Name, healthErr)
+	if err := r.notifyGoodDNSZones(ctx, &revertedZonesList, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonZoneUpdateErr, zoneMessage); err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollback. Could update DNSZone status", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+
+	// notify DNSForwardZones
+	revertedForwardZonesList := monkalev1alpha1.DNSForwardZoneList{}
+	for _, forwardZone := range forwardZonesList.Items {
+		if revertedForwardZoneNames[forwardZone.Name] {
+			revertedForwardZonesList.Items = append(revertedForwardZonesList.Items, forwardZone)
+		}
+	}
+	if err := r.notifyForwardZones(ctx, &revertedForwardZonesList, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonForwardZoneUpdateErr, zoneMessage); err != nil {
+		log.Log.Error(err, "DNSConnector instance. Rollback. Could update DNSForwardZone status", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+
+	// update status
 	if err := r.refreshDNSConnectorResource(ctx, previousState); err != nil {
-		log.Log.Error(err, "DNSConnector instance. Reconciling. Failed to refresh DNSConnector resource", "DNSConnector.Name", dnsConnector.Name)
+		log.Log.Error(err, "DNSConnector instance. Rollback. Failed to refresh DNSConnector resource", "DNSConnector.Name", dnsConnector.Name)
 		return ctrl.Result{}, err
 	}
-	dnsConnector.Status.ProvisionedDNSZones = dnsZoneStats
-	setDnsConnectorCondition(dnsConnector, metav1.ConditionTrue, monkalev1alpha1.ConditionReasonConnectorActive, "CoreDNS Ready")
+	dnsConnector.Status.LastRollback = &monkalev1alpha1.ConnectorRollback{
+		RolledBackAt:          metav1.Now(),
+		Reason:                healthErr.Error(),
+		ObservedGeneration:    dnsConnector.Generation,
+		AttemptedZones:        attemptedZones,
+		RevertedZones:         revertedZones,
+		AttemptedForwardZones: attemptedForwardZones,
+		RevertedForwardZones:  revertedForwardZones,
+	}
+	if dnsConnector.Status.Rollout != nil {
+		setRolloutPhase(dnsConnector, monkalev1alpha1.RolloutPhaseRolledBack, healthErr.Error())
+	}
+	setDnsConnectorCondition(dnsConnector, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonConnectorRolledBack, message)
 	if err := r.dnsConnectorUpdateStatus(ctx, previousState, dnsConnector); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	log.Log.Info("DNSConnector instance. Reconcilation has been completed")
-	return ctrl.Result{}, nil
+	// the same changes will fail again. user must fix it. the changes made during the rollout are picked up by the requeue.
+	log.Log.Info("DNSConnector instance. Rollback has been completed. Will not apply the same changes again", "DNSConnector.Name", dnsConnector.Name, "Reverted zones", revertedZoneDescriptions)
+	return ctrl.Result{Requeue: true}, nil
 }
 
 // notifyGoodDNSZones is used to iterate over ALL related validated&joined DNSZones and update theirs condition.
@@ -312,6 +658,22 @@ func (r *DNSConnectorReconciler) notifyGoodDNSZones(ctx context.Context, dnsZone
 	return nil
 }
 
+// notifyForwardZones updates the Ready condition of the DNSForwardZones.
+func (r *DNSConnectorReconciler) notifyForwardZones(ctx context.Context, forwardZonesList *monkalev1alpha1.DNSForwardZoneList, status metav1.ConditionStatus, reason, message string) error {
+	for _, forwardZone := range forwardZonesList.Items {
+		forwardZoneType := types.NamespacedName{Name: forwardZone.Name, Namespace: forwardZone.Namespace}
+		forwardZoneObj := forwardZone.DeepCopy()
+		if err := getObjFromK8s(ctx, r.Client, forwardZoneType, forwardZoneObj); err != nil {
+			return fmt.Errorf("failed to refresh DNSForwardZone resource: %v", err)
+		}
+		setDnsForwardZoneCondition(forwardZoneObj, status, reason, message)
+		if err := r.Status().Update(ctx, forwardZoneObj); err != nil {
+			return fmt.Errorf("failed to update status and condition: %v", err)
+		}
+	}
+	return nil
+}
+
 // fetchCorednsConfCM used to lookup for confCM for DNSConnector and then returns coredns configmap
 func (r *DNSConnectorReconciler) fetchCorednsConfCM(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector) (corev1.ConfigMap, error) {
 	//var corednsConfObj corev1.ConfigMap
@@ -371,6 +733,42 @@ func (r *DNSConnectorReconciler) fetchGoodZones(ctx context.Context, dnsConnecto
 	return *goodZones, nil
 }
 
+// fetchForwardZones fetches all DNSForwardZones related to dnsConnector, sorted a-z.
+func (r *DNSConnectorReconciler) fetchForwardZones(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector) (monkalev1alpha1.DNSForwardZoneList, error) {
+	forwardZones := monkalev1alpha1.DNSForwardZoneList{}
+	listOps := &client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(monkalev1alpha1.DnsForwardZoneConnectorIndex, dnsConnector.Name),
+		Namespace:     dnsConnector.Namespace,
+	}
+	if err := r.List(ctx, &forwardZones, listOps); err != nil {
+		return monkalev1alpha1.DNSForwardZoneList{}, fmt.Errorf("could not list DNSForwardZones: %v", err)
+	}
+	sort.Slice(forwardZones.Items, func(i, j int) bool {
+		return forwardZones.Items[i].Name < forwardZones.Items[j].Name
+	})
+	return forwardZones, nil
+}
+
+// fetchGoodForwardZones fetches DNSForwardZones related to dnsConnector, and filters out the invalid ones:
+// forward zones with bad upstreams, and forward zones whose domain is already served by a DNSZone or another DNSForwardZone.
+// Invalid forward zones are notified with the UpdateError condition.
+func (r *DNSConnectorReconciler) fetchGoodForwardZones(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector, zoneConfigMaps *corev1.ConfigMapList) (monkalev1alpha1.DNSForwardZoneList, error) {
+	forwardZones, err := r.fetchForwardZones(ctx, dnsConnector)
+	if err != nil {
+		return monkalev1alpha1.DNSForwardZoneList{}, err
+	}
+
+	goodForwardZones, invalidForwardZones := render.FilterForwardZones(dnsConnector, zoneConfigMaps, &forwardZones)
+	for _, invalid := range invalidForwardZones {
+		log.Log.Error(invalid.Err, "DNSConnector instance. Invalid DNSForwardZone. Skipping", "DNSConnector.Name", dnsConnector.Name, "DNSForwardZone.Name", invalid.ForwardZone.Name)
+		invalidForwardZoneList := monkalev1alpha1.DNSForwardZoneList{Items: []monkalev1alpha1.DNSForwardZone{invalid.ForwardZone}}
+		if err := r.notifyForwardZones(ctx, &invalidForwardZoneList, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonForwardZoneUpdateErr, fmt.Sprintf("Invalid forward zone: %v", invalid.Err)); err != nil {
+			return monkalev1alpha1.DNSForwardZoneList{}, err
+		}
+	}
+	return goodForwardZones, nil
+}
+
 // fetchGoodZonefileCM used to fetch zonefiles configMaps related to dnsConnector.
 // It will fetch all dnsZones for DnsZoneConnectorIndex, then it will filter only Ready dnsZones, and old version of zones that were previously ok.
 // Eventually it will extract configmaps. Returns list of zone configmaps sorted a-z
@@ -399,6 +797,28 @@ func (r *DNSConnectorReconciler) fetchGoodZonefileCM(ctx context.Context, dnsCon
 	return goodZones, configMapList, nil
 }
 
+// fetchTSIGKeys fetches the TSIG keys of the zone transfers. Returns TSIG keys by zonefile configMap name.
+func (r *DNSConnectorReconciler) fetchTSIGKeys(ctx context.Context, zoneConfigMaps *corev1.ConfigMapList) (map[string]render.TSIGKey, error) {
+	tsigKeys := make(map[string]render.TSIGKey)
+	for _, configMap := range zoneConfigMaps.Items {
+		secretName, ok := configMap.Annotations["TSIGSecretName"]
+		if !ok {
+			continue
+		}
+		var secret corev1.Secret
+		secretObj := types.NamespacedName{Name: secretName, Namespace: configMap.Namespace}
+		if err := getObjFromK8s(ctx, r.Client, secretObj, &secret); err != nil {
+			return nil, fmt.Errorf("could not get TSIG secret %s: %v", secretName, err)
+		}
+		key, err := render.GetTSIGKey(&secret)
+		if err != nil {
+			return nil, err
+		}
+		tsigKeys[configMap.Name] = key
+	}
+	return tsigKeys, nil
+}
+
 // backupOriginalCorefileCM check if backup coredns configfile is already exist. If not create it. Otherwise just exit.
 func (r *DNSConnectorReconciler) backupOriginalCorefileCM(ctx context.Context, corednsOrigConfCMObj corev1.ConfigMap) error {
 	corednsBkpConfObj := corednsOrigConfCMObj.DeepCopy()
@@ -418,6 +838,196 @@ func (r *DNSConnectorReconciler) backupOriginalCorefileCM(ctx context.Context, c
 	return nil
 }
 
+// saveCorednsCheckpoint stores the applied Corefile content together with the zonefile volumes and volume mounts
+// of the coredns deployment. The zonefiles are kept in the checkpoint zone configmaps the checkpoint volumes point at.
+// The checkpoint is used to roll back failed updates. The zones not served with the expected serial keep their previous checkpoint.
+func (r *DNSConnectorReconciler) saveCorednsCheckpoint(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector, corefileContent string, corednsDeployment client.Object, rolloutZones []monkalev1alpha1.ProvisionedDNSZone, mismatches map[string]string) error {
+	volumes, volumeMounts, err := getZoneFileVolumes(corednsDeployment)
+	if err != nil {
+		return fmt.Errorf("could not get zonefile volumes: %v", err)
+	}
+	volumes, err = r.saveZoneCheckpoints(ctx, dnsConnector, volumes, rolloutZones, mismatches)
+	if err != nil {
+		return fmt.Errorf("could not save zonefile checkpoints: %v", err)
+	}
+	upcomingCM, err := constructCheckpointConfigMap(dnsConnector, corefileContent, volumes, volumeMounts)
+	if err != nil {
+		return err
+	}
+	if err := controllerutil.SetOwnerReference(dnsConnector, &upcomingCM, r.Scheme); err != nil {
+		return fmt.Errorf("could not set owner reference: %v", err)
+	}
+
+	currentCM := corev1.ConfigMap{}
+	checkpointType := types.NamespacedName{Name: upcomingCM.Name, Namespace: upcomingCM.Namespace}
+	fetchErr := r.Get(ctx, checkpointType, &currentCM)
+	if apierrors.IsNotFound(fetchErr) {
+		if err := r.Create(ctx, &upcomingCM); err != nil {
+			return fmt.Errorf("failed to create coredns checkpoint configmap: %v", err)
+		}
+		return nil
+	} else if fetchErr != nil {
+		return fmt.Errorf("failure during getting the checkpoint configmap from k8s: %v", fetchErr)
+	}
+
+	if equality.Semantic.DeepEqual(currentCM.Data, upcomingCM.Data) {
+		return nil
+	}
+	currentCM.Data = upcomingCM.Data
+	if err := r.Update(ctx, &currentCM); err != nil {
+		return fmt.Errorf("failed to update coredns checkpoint configmap: %v", err)
+	}
+	return nil
+}
+
+// saveZoneCheckpoints copies the zone configmaps of the zonefile volumes into the checkpoint zone configmaps, and returns the volumes
+// pointing at them. The zone configmap changed during the rollout or not served with the expected serial is not the verified one,
+// its previous checkpoint is kept, or the volume keeps pointing at the zone configmap if there is none. The checkpoint zone configmaps
+// of the removed zones are deleted.
+func (r *DNSConnectorReconciler) saveZoneCheckpoints(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector, volumes []corev1.Volume, rolloutZones []monkalev1alpha1.ProvisionedDNSZone, mismatches map[string]string) ([]corev1.Volume, error) {
+	checkpointVolumes := make([]corev1.Volume, 0, len(volumes))
+	checkpointNames := make(map[string]bool)
+	for _, volume := range volumes {
+		volume := *volume.DeepCopy()
+		if volume.ConfigMap == nil {
+			checkpointVolumes = append(checkpointVolumes, volume)
+			continue
+		}
+		zoneCM := corev1.ConfigMap{}
+		if err := getObjFromK8s(ctx, r.Client, types.NamespacedName{Name: volume.ConfigMap.Name, Namespace: dnsConnector.Namespace}, &zoneCM); err != nil {
+			return nil, fmt.Errorf("could not get zone configmap %s: %v", volume.ConfigMap.Name, err)
+		}
+		// the volume has been restored by a rollback and still points at the checkpoint
+		if zoneCM.Labels[monkalev1alpha1.CorednsCheckpointLabel] == dnsConnector.Name {
+			checkpointNames[zoneCM.Name] = true
+			checkpointVolumes = append(checkpointVolumes, volume)
+			continue
+		}
+
+		upcomingCM := constructCheckpointZoneConfigMap(dnsConnector, &zoneCM)
+		if err := controllerutil.SetOwnerReference(dnsConnector, &upcomingCM, r.Scheme); err != nil {
+			return nil, fmt.Errorf("could not set owner reference: %v", err)
+		}
+		currentCM := corev1.ConfigMap{}
+		fetchErr := r.Get(ctx, types.NamespacedName{Name: upcomingCM.Name, Namespace: upcomingCM.Namespace}, &currentCM)
+		if fetchErr != nil && !apierrors.IsNotFound(fetchErr) {
+			return nil, fmt.Errorf("failure during getting the checkpoint zone configmap from k8s: %v", fetchErr)
+		}
+		exists := fetchErr == nil
+		if exists && currentCM.Labels[monkalev1alpha1.CorednsCheckpointLabel] != dnsConnector.Name {
+			return nil, fmt.Errorf("configmap %s exists and is not a checkpoint of DNSConnector %s", currentCM.Name, dnsConnector.Name)
+		}
+
+		_, mismatch := mismatches[zoneCM.Annotations["DNSZoneRef"]]
+		verified := !mismatch && zoneCM.Annotations["SerialNumber"] == getProvisionedDNSZoneSerial(rolloutZones, zoneCM.Annotations["DNSZoneRef"])
+		switch {
+		case verified && !exists:
+			if err := r.Create(ctx, &upcomingCM); err != nil {
+				return nil, fmt.Errorf("failed to create checkpoint zone configmap: %v", err)
+			}
+		case verified && !(equality.Semantic.DeepEqual(currentCM.Data, upcomingCM.Data) && equality.Semantic.DeepEqual(currentCM.Annotations, upcomingCM.Annotations)):
+			currentCM.Data = upcomingCM.Data
+			currentCM.Annotations = upcomingCM.Annotations
+			if err := r.Update(ctx, &currentCM); err != nil {
+				return nil, fmt.Errorf("failed to update checkpoint zone configmap: %v", err)
+			}
+		case !verified && !exists:
+			log.Log.Info("DNSConnector instance. Rollout. Zone has not been verified and has no checkpoint, the rollback keeps the current zonefile", "DNSConnector.Name", dnsConnector.Name, "ConfigMap.metadata.name", zoneCM.Name)
+			checkpointVolumes = append(checkpointVolumes, volume)
+			continue
+		}
+		checkpointNames[upcomingCM.Name] = true
+		volume.ConfigMap.Name = upcomingCM.Name
+		checkpointVolumes = append(checkpointVolumes, volume)
+	}
+
+	// delete the checkpoints of the removed zones
+	checkpointCMList := corev1.ConfigMapList{}
+	if err := r.List(ctx, &checkpointCMList, client.InNamespace(dnsConnector.Namespace), client.MatchingLabels{monkalev1alpha1.CorednsCheckpointLabel: dnsConnector.Name}); err != nil {
+		return nil, fmt.Errorf("could not list checkpoint zone configmaps: %v", err)
+	}
+	for i := range checkpointCMList.Items {
+		if checkpointNames[checkpointCMList.Items[i].Name] {
+			continue
+		}
+		if err := r.Delete(ctx, &checkpointCMList.Items[i]); err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to delete checkpoint zone configmap: %v", err)
+		}
+	}
+	return checkpointVolumes, nil
+}
+
+// fetchCorednsCheckpoint returns the last known-good Corefile content, zonefile volumes and volume mounts.
+// If coredns has never been updated successfully, it returns the original Corefile without zonefile volumes.
+func (r *DNSConnectorReconciler) fetchCorednsCheckpoint(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector) (string, []corev1.Volume, []corev1.VolumeMount, error) {
+	checkpointCM := corev1.ConfigMap{}
+	checkpointType := types.NamespacedName{Name: dnsConnector.Spec.CorednsCM.Name + monkalev1alpha1.CorednsCheckpointConfSuffix, Namespace: dnsConnector.Namespace}
+	fetchErr := r.Get(ctx, checkpointType, &checkpointCM)
+	if fetchErr == nil {
+		return parseCheckpointConfigMap(dnsConnector, &checkpointCM)
+	} else if !apierrors.IsNotFound(fetchErr) {
+		return "", nil, nil, fmt.Errorf("failure during getting the checkpoint configmap from k8s: %v", fetchErr)
+	}
+
+	// no checkpoint, fall back to the original corefile
+	backupCM := corev1.ConfigMap{}
+	backupType := types.NamespacedName{Name: dnsConnector.Spec.CorednsCM.Name + monkalev1alpha1.CorednsOriginalConfBkpSuffix, Namespace: dnsConnector.Namespace}
+	if err := getObjFromK8s(ctx, r.Client, backupType, &backupCM); err != nil {
+		return "", nil, nil, fmt.Errorf("failure during getting the backup configmap from k8s: %v", err)
+	}
+	corefileContent, ok := backupCM.Data[dnsConnector.Spec.CorednsCM.CorefileKey]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("key %s not found in backup ConfigMap", dnsConnector.Spec.CorednsCM.CorefileKey)
+	}
+	return corefileContent, []corev1.Volume{}, []corev1.VolumeMount{}, nil
+}
+
+// rollbackCoredns restores the last known-good Corefile and the zonefile volumes and volume mounts of the coredns deployment.
+// The volumes point at the checkpoint zone configmaps, so the zonefiles are restored too. It returns the serials of
+// the restored zonefiles by volume name, the serial is empty if the configmap of the volume does not exist.
+func (r *DNSConnectorReconciler) rollbackCoredns(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector) (map[string]string, error) {
+	corefileContent, volumes, volumeMounts, err := r.fetchCorednsCheckpoint(ctx, dnsConnector)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the last known-good state: %v", err)
+	}
+	restoredZonefiles := make(map[string]string)
+	for _, volume := range volumes {
+		if volume.ConfigMap == nil {
+			continue
+		}
+		zoneCM := corev1.ConfigMap{}
+		fetchErr := r.Get(ctx, types.NamespacedName{Name: volume.ConfigMap.Name, Namespace: dnsConnector.Namespace}, &zoneCM)
+		if fetchErr != nil && !apierrors.IsNotFound(fetchErr) {
+			return nil, fmt.Errorf("failure during getting the zone configmap from k8s: %v", fetchErr)
+		}
+		restoredZonefiles[volume.Name] = zoneCM.Annotations["SerialNumber"]
+	}
+
+	// restore corefile
+	corednsConfCM, err := r.fetchCorednsConfCM(ctx, dnsConnector)
+	if err != nil {
+		return nil, err
+	}
+	corednsConfCM.Data[dnsConnector.Spec.CorednsCM.CorefileKey] = corefileContent
+	if err := r.Update(ctx, &corednsConfCM); err != nil {
+		return nil, fmt.Errorf("failed to restore corefile: %v", err)
+	}
+
+	// restore volumes and volume mounts
+	corednsDeployment, err := r.fetchCorednsDeployment(ctx, dnsConnector)
+	if err != nil {
+		return nil, err
+	}
+	restoredCorednsDeployment, err := setZoneFileVolumes(corednsDeployment, volumes, volumeMounts)
+	if err != nil {
+		return nil, fmt.Errorf("could not restore zonefile volumes: %v", err)
+	}
+	if err := r.Update(ctx, restoredCorednsDeployment); err != nil {
+		return nil, fmt.Errorf("failed to restore coredns deployment: %v", err)
+	}
+	return restoredZonefiles, nil
+}
+
 // restoreOriginalCorefileCM restores the original CoreDNS ConfigMap from its backup during the reconcile delete process.
 func (r *DNSConnectorReconciler) restoreOriginalCorefileCM(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector) error {
 	// Define the name of the backup ConfigMap
@@ -446,44 +1056,29 @@ func (r *DNSConnectorReconciler) restoreOriginalCorefileCM(ctx context.Context,
 	originalConfigMapObj.ResourceVersion = ""
 	// overwrite cm data and apply
 	originalConfigMapObj.Data = backupConfigMapObj.Data
+	delete(originalConfigMapObj.Annotations, monkalev1alpha1.CorefileManagedBlocksAnnotation)
 	if err := r.Update(ctx, originalConfigMapObj); err != nil {
 		return fmt.Errorf("failed to restore original coredns configmap: %v", err)
 	}
 	return nil
 }
 
-// corednsIsHealthy waits for the CoreDNS deployment to be ready within the specified timeout.
-// If the deployment does not become ready within the timeout, it returns an error.
-func (r *DNSConnectorReconciler) corednsIsHealthy(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector) error {
-	_ = log.FromContext(ctx)
-	delay := 6 * time.Second
-	interval := 3 * time.Second
-	timeout := time.Duration(dnsConnector.Spec.WaitForUpdateTimeout) * time.Second
-	endTime := time.Now().Add(timeout)
-	return wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
-		time.Sleep(delay) // avoid race conditions, and false positive logs.
-		corednsActualState, err := r.fetchCorednsDeployment(ctx, dnsConnector)
-		if err != nil {
-			return false, err
-		}
-		waitMsg := "DNSConnector instance. Waiting for CorednsDeployment to become healhy"
-		remainingTime := int(time.Until(endTime).Seconds())
-		remainingTimeFormatted := fmt.Sprintf("%d seconds", remainingTime)
-
-		switch res := corednsActualState.(type) {
-		case *appsv1.StatefulSet:
-			log.Log.Info(waitMsg, "DNSConnector.Name", dnsConnector.Name, "Remaining time", remainingTimeFormatted)
-			return isStatefulSetReady(res), nil
-		case *appsv1.Deployment:
-			log.Log.Info(waitMsg, "DNSConnector.Name", dnsConnector.Name, "Remaining time", remainingTimeFormatted)
-			return isDeploymentReady(res), nil
-		case *appsv1.DaemonSet:
-			log.Log.Info(waitMsg, "DNSConnector.Name", dnsConnector.Name, "Remaining time", remainingTimeFormatted)
-			return isDaemonSetReady(res), nil
-		default:
-			return false, fmt.Errorf("unsupported resource type: %T", res)
-		}
-	})
+// getVerificationTargets returns the addresses the SOA queries are sent to: the verification address of the DNSConnector,
+// or the ready CoreDNS pods.
+func (r *DNSConnectorReconciler) getVerificationTargets(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector, corednsDeployment client.Object) (map[string]string, error) {
+	if dnsConnector.Spec.VerificationAddress != "" {
+		address := getVerificationAddress(dnsConnector.Spec.VerificationAddress)
+		return map[string]string{"address " + address: address}, nil
+	}
+	selector, err := getCorednsPodSelector(corednsDeployment)
+	if err != nil {
+		return nil, err
+	}
+	pods := &corev1.PodList{}
+	if err := r.APIReader.List(ctx, pods, client.InNamespace(dnsConnector.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("could not list coredns pods: %v", err)
+	}
+	return getPodVerificationTargets(pods), nil
 }
 
 // reconcileDelete reconciles if DNSConnector resource has been removed.
@@ -515,6 +1110,15 @@ func (r *DNSConnectorReconciler) reconcileDelete(ctx context.Context, dnsConnect
 		log.Log.Error(err, "DNSConnector instance. Reconciling. Could update DNSZone status", "DNSConnector.Name", dnsConnector.Name)
 		return ctrl.Result{}, err
 	}
+	forwardZones, err := r.fetchForwardZones(ctx, dnsConnector)
+	if err != nil {
+		log.Log.Error(err, "DNSConnector instance. Failed to notify DNSForwardZones", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
+	if err := r.notifyForwardZones(ctx, &forwardZones, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonForwardZonePending, "DNSConnector has been removed"); err != nil {
+		log.Log.Error(err, "DNSConnector instance. Reconciling. Could update DNSForwardZone status", "DNSConnector.Name", dnsConnector.Name)
+		return ctrl.Result{}, err
+	}
 	// Done
 	log.Log.Info("DNSConnector instance. The DNSConnector has been deleted.", "DNSConnector.Name", dnsConnector.Name)
 	return ctrl.Result{}, nil
@@ -554,6 +1158,38 @@ func (r *DNSConnectorReconciler) refreshDNSConnectorResource(ctx context.Context
 	return nil
 }
 
+// setDnsForwardZoneCondition adds or updates a given condition in the DNSForwardZone status.
+func setDnsForwardZoneCondition(forwardZone *monkalev1alpha1.DNSForwardZone, status metav1.ConditionStatus, reason, message string) {
+	cond := metav1.Condition{
+		Type:               monkalev1alpha1.ConditionForwardZoneTypeReady,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: forwardZone.Generation,
+	}
+	meta.SetStatusCondition(&forwardZone.Status.Conditions, cond)
+}
+
+// forwardZoneChangedReconcileRequest requests DNSConnector reconcilation if DNSForwardZone has been created/updated/deleted.
+func (r *DNSConnectorReconciler) forwardZoneChangedReconcileRequest(ctx context.Context, forwardZone client.Object) []reconcile.Request {
+	_ = log.FromContext(ctx)
+	forwardZoneObj, ok := forwardZone.(*monkalev1alpha1.DNSForwardZone)
+	if !ok {
+		log.Log.Error(nil, "DNSConnector instance. Failed to cast forwardZone to monkalev1alpha1.DNSForwardZone")
+		return []reconcile.Request{}
+	}
+	log.Log.Info("DNSConnector instance. DNSForwardZone change detected. Requesting reconcilation for the connector", "DNSConnector.Name", forwardZoneObj.Spec.ConnectorName, "DNSForwardZone.Name", forwardZoneObj.Name)
+	return []reconcile.Request{
+		{
+			NamespacedName: types.NamespacedName{
+				Name:      forwardZoneObj.Spec.ConnectorName,
+				Namespace: forwardZoneObj.GetNamespace(),
+			},
+		},
+	}
+}
+
 // dnsZoneChangedReconcileRequest requests DNSConnector reconcilation if DNSZone has been created/updated/deleted.
 func (r *DNSConnectorReconciler) dnsZoneChangedReconcileRequest(ctx context.Context, dnsZone client.Object) []reconcile.Request {
 	_ = log.FromContext(ctx)
@@ -562,8 +1198,6 @@ func (r *DNSConnectorReconciler) dnsZoneChangedReconcileRequest(ctx context.Cont
 		log.Log.Error(nil, "DNSConnector instance. Failed to cast dnsZone to monkalev1alpha1.DNSZone")
 		return []reconcile.Request{}
 	}
-	// delay before trying to reconcile. it avoids false positive logs
-	time.Sleep(3 * time.Second)
 	log.Log.Info("DNSConnector instance. DNSZone change detected. Requesting reconcilation for the connector", "DNSConnector.Name", dnsZoneObj.Spec.ConnectorName, "DNSZone.Name", dnsZoneObj.Name)
 	// create a reconcile request for the associated DNSConnector
 	return []reconcile.Request{
@@ -576,6 +1210,95 @@ func (r *DNSConnectorReconciler) dnsZoneChangedReconcileRequest(ctx context.Cont
 	}
 }
 
+// dnsZoneChangedPredicate passes the DNSZone changes the DNSConnector is interested in.
+// The pending changes of the DNSZone are not rendered yet, so they are skipped.
+func dnsZoneChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldZone, ok := e.ObjectOld.(*monkalev1alpha1.DNSZone)
+			if !ok {
+				return true
+			}
+			newZone, ok := e.ObjectNew.(*monkalev1alpha1.DNSZone)
+			if !ok {
+				return true
+			}
+			oldStatus := oldZone.Status.DeepCopy()
+			newStatus := newZone.Status.DeepCopy()
+			oldStatus.PendingChanges, oldStatus.PendingSince = 0, nil
+			newStatus.PendingChanges, newStatus.PendingSince = 0, nil
+			return oldZone.Generation != newZone.Generation || !oldZone.DeletionTimestamp.Equal(newZone.DeletionTimestamp) || !equality.Semantic.DeepEqual(oldStatus, newStatus)
+		},
+	}
+}
+
+// corednsWorkloadChangedReconcileRequest requests reconcilation of the DNSConnectors waiting for the CoreDNS workload to roll out the changes.
+func (r *DNSConnectorReconciler) corednsWorkloadChangedReconcileRequest(ctx context.Context, workload client.Object) []reconcile.Request {
+	_ = log.FromContext(ctx)
+	var workloadType string
+	switch workload.(type) {
+	case *appsv1.Deployment:
+		workloadType = "Deployment"
+	case *appsv1.StatefulSet:
+		workloadType = "StatefulSet"
+	case *appsv1.DaemonSet:
+		workloadType = "DaemonSet"
+	default:
+		return []reconcile.Request{}
+	}
+	dnsConnectors := &monkalev1alpha1.DNSConnectorList{}
+	if err := r.List(ctx, dnsConnectors, client.InNamespace(workload.GetNamespace()), client.MatchingFields{monkalev1alpha1.DnsConnectorWorkloadIndex: getCorednsWorkloadKey(workloadType, workload.GetName())}); err != nil {
+		log.Log.Error(err, "DNSConnector instance. Failed to list DNSConnectors", "Namespace", workload.GetNamespace())
+		return []reconcile.Request{}
+	}
+	requests := []reconcile.Request{}
+	for _, dnsConnector := range dnsConnectors.Items {
+		rollout := dnsConnector.Status.Rollout
+		if rollout == nil || rollout.Phase != monkalev1alpha1.RolloutPhaseWaitingForRollout {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      dnsConnector.Name,
+				Namespace: dnsConnector.Namespace,
+			},
+		})
+	}
+	return requests
+}
+
+// getCorednsWorkloadKey returns the key the DNSConnectors are indexed by their CoreDNS workload with.
+func getCorednsWorkloadKey(workloadType, name string) string {
+	return workloadType + "/" + name
+}
+
+// corednsWorkloadChangedPredicate passes the generation and the status changes of the workloads, which report the progress of a rollout.
+// The other events of the apps workloads of the cluster do not trigger the lookup of the DNSConnectors.
+func corednsWorkloadChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return false },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() {
+				return true
+			}
+			switch newWorkload := e.ObjectNew.(type) {
+			case *appsv1.Deployment:
+				oldWorkload, ok := e.ObjectOld.(*appsv1.Deployment)
+				return !ok || !equality.Semantic.DeepEqual(oldWorkload.Status, newWorkload.Status)
+			case *appsv1.StatefulSet:
+				oldWorkload, ok := e.ObjectOld.(*appsv1.StatefulSet)
+				return !ok || !equality.Semantic.DeepEqual(oldWorkload.Status, newWorkload.Status)
+			case *appsv1.DaemonSet:
+				oldWorkload, ok := e.ObjectOld.(*appsv1.DaemonSet)
+				return !ok || !equality.Semantic.DeepEqual(oldWorkload.Status, newWorkload.Status)
+			}
+			return false
+		},
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *DNSConnectorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// Index DNSZoneConnector Reference name
@@ -590,6 +1313,26 @@ func (r *DNSConnectorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	// Index DNSForwardZone Connector Reference name
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &monkalev1alpha1.DNSForwardZone{}, monkalev1alpha1.DnsForwardZoneConnectorIndex, func(rawObj client.Object) []string {
+		forwardZone := rawObj.(*monkalev1alpha1.DNSForwardZone)
+		if forwardZone.Spec.ConnectorName == "" {
+			return nil
+		}
+		return []string{forwardZone.Spec.ConnectorName}
+	}); err != nil {
+		return err
+	}
+
+	// Index DNSConnector CoreDNS workload, the workload events are mapped to the DNSConnectors without listing all of them
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &monkalev1alpha1.DNSConnector{}, monkalev1alpha1.DnsConnectorWorkloadIndex, func(rawObj client.Object) []string {
+		dnsConnector := rawObj.(*monkalev1alpha1.DNSConnector)
+		return []string{getCorednsWorkloadKey(dnsConnector.Spec.CorednsDeployment.Type, dnsConnector.Spec.CorednsDeployment.Name)}
+	}); err != nil {
+		return err
+	}
+
+	// The apps workloads are cached cluster-wide, only their generation and status changes are mapped to the DNSConnectors.
 	return ctrl.NewControllerManagedBy(mgr).
 		For(
 			&monkalev1alpha1.DNSConnector{},
@@ -598,7 +1341,27 @@ func (r *DNSConnectorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Watches(
 			&monkalev1alpha1.DNSZone{},
 			handler.EnqueueRequestsFromMapFunc(r.dnsZoneChangedReconcileRequest),
-			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+			builder.WithPredicates(dnsZoneChangedPredicate()),
+		).
+		Watches(
+			&monkalev1alpha1.DNSForwardZone{},
+			handler.EnqueueRequestsFromMapFunc(r.forwardZoneChangedReconcileRequest),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&appsv1.Deployment{},
+			handler.EnqueueRequestsFromMapFunc(r.corednsWorkloadChangedReconcileRequest),
+			builder.WithPredicates(corednsWorkloadChangedPredicate()),
+		).
+		Watches(
+			&appsv1.StatefulSet{},
+			handler.EnqueueRequestsFromMapFunc(r.corednsWorkloadChangedReconcileRequest),
+			builder.WithPredicates(corednsWorkloadChangedPredicate()),
+		).
+		Watches(
+			&appsv1.DaemonSet{},
+			handler.EnqueueRequestsFromMapFunc(r.corednsWorkloadChangedReconcileRequest),
+			builder.WithPredicates(corednsWorkloadChangedPredicate()),
 		).
 		Complete(r)
 }
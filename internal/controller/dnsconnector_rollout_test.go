@@ -0,0 +1,413 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+// indexedClient serves the field selectors of the DNSConnector reconciler. The operator resolves them with the indexes
+// of the manager cache, the API server does not support the field selectors of the custom resources.
+type indexedClient struct {
+	client.Client
+}
+
+func (c indexedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if listOpts.FieldSelector == nil || listOpts.FieldSelector.Empty() {
+		return c.Client.List(ctx, list, opts...)
+	}
+	selector := listOpts.FieldSelector
+	listOpts.FieldSelector = nil
+	if err := c.Client.List(ctx, list, listOpts); err != nil {
+		return err
+	}
+	switch list := list.(type) {
+	case *monkalev1alpha1.DNSZoneList:
+		items := list.Items[:0]
+		for _, item := range list.Items {
+			if selector.Matches(fields.Set{monkalev1alpha1.DnsZoneConnectorIndex: item.Spec.ConnectorName}) {
+				items = append(items, item)
+			}
+		}
+		list.Items = items
+	case *monkalev1alpha1.DNSForwardZoneList:
+		items := list.Items[:0]
+		for _, item := range list.Items {
+			if selector.Matches(fields.Set{monkalev1alpha1.DnsForwardZoneConnectorIndex: item.Spec.ConnectorName}) {
+				items = append(items, item)
+			}
+		}
+		list.Items = items
+	default:
+		return fmt.Errorf("no field index of %T", list)
+	}
+	return nil
+}
+
+var _ = Describe("DNSConnector rollout", func() {
+	const (
+		namespace     = "dnsconnector-rollout"
+		zoneCMName    = "example-org-zone"
+		zoneKey       = "example.org.zone"
+		initialSerial = "2024060101"
+		changedSerial = "2024060102"
+	)
+	ctx := context.Background()
+	connectorRef := types.NamespacedName{Name: "coredns", Namespace: namespace}
+	zoneRef := types.NamespacedName{Name: "example-org", Namespace: namespace}
+	originalCorefile := ".:53 {\n    errors\n    forward . /etc/resolv.conf\n}\n"
+
+	var reconciler *DNSConnectorReconciler
+	var soaServer *dns.Server
+	var servedSerial atomic.Uint32
+
+	startSOAServer := func() string {
+		packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		started := make(chan struct{})
+		soaServer = &dns.Server{PacketConn: packetConn, NotifyStartedFunc: func() { close(started) }, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			resp := new(dns.Msg)
+			resp.SetReply(req)
+			resp.Answer = append(resp.Answer, &dns.SOA{
+				Hdr:    dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+				Ns:     "ns1.example.org.",
+				Mbox:   "admin.example.org.",
+				Serial: servedSerial.Load(),
+			})
+			_ = w.WriteMsg(resp)
+		})}
+		go func() {
+			_ = soaServer.ActivateAndServe()
+		}()
+		Eventually(started).Should(BeClosed())
+		return packetConn.LocalAddr().String()
+	}
+	reconcile := func() ctrl.Result {
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: connectorRef})
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+	getConnector := func() *monkalev1alpha1.DNSConnector {
+		dnsConnector := &monkalev1alpha1.DNSConnector{}
+		Expect(k8sClient.Get(ctx, connectorRef, dnsConnector)).To(Succeed())
+		return dnsConnector
+	}
+	getCondition := func() *metav1.Condition {
+		return meta.FindStatusCondition(getConnector().Status.Conditions, monkalev1alpha1.ConditionConnectorTypeReady)
+	}
+	getConfigMap := func(name string) *corev1.ConfigMap {
+		configMap := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, configMap)).To(Succeed())
+		return configMap
+	}
+	getDeployment := func() *appsv1.Deployment {
+		deployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, connectorRef, deployment)).To(Succeed())
+		return deployment
+	}
+	getZoneVolume := func() *corev1.Volume {
+		for _, volume := range getDeployment().Spec.Template.Spec.Volumes {
+			if volume.ConfigMap != nil && volume.Name != "config-volume" {
+				volume := volume
+				return &volume
+			}
+		}
+		return nil
+	}
+	// renderZone writes the zone ConfigMap and the status of the DNSZone, as the DNSZone controller does.
+	renderZone := func(serial string) {
+		dnsZone := &monkalev1alpha1.DNSZone{}
+		Expect(k8sClient.Get(ctx, zoneRef, dnsZone)).To(Succeed())
+		zonefile, err := render.ConstructZoneFile(dnsZone, "www IN A 192.0.2.10\n", serial)
+		Expect(err).NotTo(HaveOccurred())
+		zoneCM := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: zoneCMName, Namespace: namespace}}
+		_, err = controllerutil.CreateOrUpdate(ctx, k8sClient, zoneCM, func() error {
+			zoneCM.Annotations = render.ConstructZoneAnnotations(dnsZone, serial)
+			zoneCM.Data = map[string]string{zoneKey: zonefile}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		dnsZone.Status.ZoneConfigmap = zoneCMName
+		dnsZone.Status.ValidationPassed = true
+		dnsZone.Status.CurrentZoneSerial = serial
+		setDnsZoneCondition(dnsZone, metav1.ConditionTrue, monkalev1alpha1.ConditionReasonZoneActive, "Zone rendered")
+		Expect(k8sClient.Status().Update(ctx, dnsZone)).To(Succeed())
+	}
+	// markRolledOut reports the Deployment as rolled out, there is no Deployment controller in the test environment.
+	markRolledOut := func() {
+		deployment := getDeployment()
+		deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: deployment.Generation, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+		Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+	}
+	// ageRolloutPhase moves the start of the current rollout phase to the past.
+	ageRolloutPhase := func(age time.Duration) {
+		dnsConnector := getConnector()
+		dnsConnector.Status.Rollout.LastTransitionTime = metav1.NewTime(time.Now().Add(-age))
+		Expect(k8sClient.Status().Update(ctx, dnsConnector)).To(Succeed())
+	}
+	// startRollout applies the zone changes to CoreDNS.
+	startRollout := func() {
+		Expect(reconcile().RequeueAfter).To(Equal(corednsRolloutCheckInterval))
+		Expect(getConnector().Status.Rollout.Phase).To(Equal(monkalev1alpha1.RolloutPhaseWaitingForRollout))
+	}
+	// completeRollout rolls out and verifies the zone changes.
+	completeRollout := func(serial string) {
+		startRollout()
+		markRolledOut()
+		Expect(reconcile().Requeue).To(BeTrue())
+		Expect(getConnector().Status.Rollout.Phase).To(Equal(monkalev1alpha1.RolloutPhaseVerifying))
+		servedSerial.Store(parseSerial(serial))
+		reconcile()
+		Expect(getConnector().Status.Rollout.Phase).To(Equal(monkalev1alpha1.RolloutPhaseActive))
+	}
+
+	BeforeEach(func() {
+		reconciler = &DNSConnectorReconciler{Client: indexedClient{k8sClient}, Scheme: scheme.Scheme, APIReader: k8sClient}
+		servedSerial.Store(0)
+		verificationAddress := startSOAServer()
+
+		err := k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(k8sClient.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: namespace},
+			Data:       map[string]string{"Corefile": originalCorefile},
+		})).To(Succeed())
+		podLabels := map[string]string{"k8s-app": "coredns"}
+		Expect(k8sClient.Create(ctx, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: connectorRef.Name, Namespace: namespace},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: int32Ptr(1),
+				Selector: &metav1.LabelSelector{MatchLabels: podLabels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name:         "coredns",
+							Image:        "coredns/coredns:1.11.1",
+							Args:         []string{"-conf", "/etc/coredns/Corefile"},
+							VolumeMounts: []corev1.VolumeMount{{Name: "config-volume", MountPath: "/etc/coredns"}},
+						}},
+						Volumes: []corev1.Volume{{
+							Name: "config-volume",
+							VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "coredns"},
+							}},
+						}},
+					},
+				},
+			},
+		})).To(Succeed())
+		Expect(k8sClient.Create(ctx, &monkalev1alpha1.DNSZone{
+			ObjectMeta: metav1.ObjectMeta{Name: zoneRef.Name, Namespace: namespace},
+			Spec: monkalev1alpha1.DNSZoneSpec{
+				Domain:          "example.org",
+				PrimaryNS:       &monkalev1alpha1.PrimaryNS{Hostname: "ns1", IPAddress: "192.0.2.1", RecordType: "A"},
+				RespPersonEmail: "admin@example.org",
+				TTL:             3600,
+				ConnectorName:   connectorRef.Name,
+			},
+		})).To(Succeed())
+		renderZone(initialSerial)
+		Expect(k8sClient.Create(ctx, &monkalev1alpha1.DNSConnector{
+			ObjectMeta: metav1.ObjectMeta{Name: connectorRef.Name, Namespace: namespace},
+			Spec: monkalev1alpha1.DNSConnectorSpec{
+				WaitForUpdateTimeout: 120,
+				RolloutStrategy:      monkalev1alpha1.RolloutStrategyRestart,
+				VerificationAddress:  verificationAddress,
+				CorednsCM:            monkalev1alpha1.CoreDNSConfigMap{Name: "coredns", CorefileKey: "Corefile"},
+				CorednsDeployment:    monkalev1alpha1.CoreDNSDeploymentType{Type: "Deployment", Name: connectorRef.Name, ZoneFileMountDir: "/opt/coredns"},
+			},
+		})).To(Succeed())
+
+		By("adding the finalizer")
+		Expect(reconcile().Requeue).To(BeTrue())
+	})
+
+	AfterEach(func() {
+		Expect(soaServer.Shutdown()).To(Succeed())
+		dnsConnector := getConnector()
+		controllerutil.RemoveFinalizer(dnsConnector, monkalev1alpha1.DnsConnectorsFinalizerName)
+		Expect(k8sClient.Update(ctx, dnsConnector)).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &monkalev1alpha1.DNSConnector{}, client.InNamespace(namespace))).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &monkalev1alpha1.DNSZone{}, client.InNamespace(namespace))).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &appsv1.Deployment{}, client.InNamespace(namespace))).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &corev1.ConfigMap{}, client.InNamespace(namespace))).To(Succeed())
+	})
+
+	It("moves through Applying, WaitingForRollout and Verifying to Active", func() {
+		By("applying the changes")
+		startRollout()
+		rollout := getConnector().Status.Rollout
+		Expect(rollout.Zones).To(ConsistOf(monkalev1alpha1.ProvisionedDNSZone{Name: zoneRef.Name, Domain: "example.org", SerialNumber: initialSerial}))
+		Expect(rollout.WorkloadGeneration).To(Equal(getDeployment().Generation))
+		Expect(getCondition().Reason).To(Equal(monkalev1alpha1.ConditionReasonConnectorUpdating))
+		Expect(getConfigMap("coredns").Data["Corefile"]).To(ContainSubstring("example.org"))
+		Expect(getZoneVolume().ConfigMap.Name).To(Equal(zoneCMName))
+
+		By("waiting for the Deployment to roll out")
+		result := reconcile()
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", corednsRolloutCheckInterval))
+		Expect(getConnector().Status.Rollout.Phase).To(Equal(monkalev1alpha1.RolloutPhaseWaitingForRollout))
+
+		By("verifying the served serials")
+		markRolledOut()
+		Expect(reconcile().Requeue).To(BeTrue())
+		Expect(getConnector().Status.Rollout.Phase).To(Equal(monkalev1alpha1.RolloutPhaseVerifying))
+		Expect(reconcile().RequeueAfter).To(BeNumerically(">", 0))
+		Expect(getConnector().Status.Rollout.Phase).To(Equal(monkalev1alpha1.RolloutPhaseVerifying))
+
+		By("completing the rollout once the serials are served")
+		servedSerial.Store(parseSerial(initialSerial))
+		reconcile()
+		dnsConnector := getConnector()
+		Expect(dnsConnector.Status.Rollout.Phase).To(Equal(monkalev1alpha1.RolloutPhaseActive))
+		Expect(dnsConnector.Status.ProvisionedDNSZones).To(ConsistOf(monkalev1alpha1.ProvisionedDNSZone{Name: zoneRef.Name, Domain: "example.org", SerialNumber: initialSerial}))
+		condition := getCondition()
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(monkalev1alpha1.ConditionReasonConnectorActive))
+		checkpointZoneCM := getConfigMap("coredns" + monkalev1alpha1.CorednsCheckpointZoneInfix + zoneCMName)
+		Expect(checkpointZoneCM.Annotations).To(HaveKeyWithValue("SerialNumber", initialSerial))
+	})
+
+	It("requeues the rollout when the phase times out", func() {
+		startRollout()
+		timeout := 120 * time.Second
+
+		By("requeueing after the check interval")
+		ageRolloutPhase(time.Minute)
+		Expect(isRolloutTimedOut(getConnector().Status.Rollout, timeout)).To(BeFalse())
+		Expect(reconcile().RequeueAfter).To(Equal(corednsRolloutCheckInterval))
+
+		By("requeueing when the phase times out")
+		ageRolloutPhase(timeout - 2*time.Second)
+		result := reconcile()
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", 2*time.Second))
+
+		By("rolling back once the phase has timed out")
+		ageRolloutPhase(timeout + time.Second)
+		Expect(isRolloutTimedOut(getConnector().Status.Rollout, timeout)).To(BeTrue())
+		reconcile()
+		Expect(getConnector().Status.Rollout.Phase).To(Equal(monkalev1alpha1.RolloutPhaseRolledBack))
+		Expect(getCondition().Reason).To(Equal(monkalev1alpha1.ConditionReasonConnectorRolledBack))
+		Expect(getConfigMap("coredns").Data["Corefile"]).To(Equal(originalCorefile))
+	})
+
+	It("completes the verification timed out as Degraded and keeps the checkpoint of the mismatched zone", func() {
+		completeRollout(initialSerial)
+
+		By("serving the previous serial after the zone change")
+		renderZone(changedSerial)
+		startRollout()
+		markRolledOut()
+		Expect(reconcile().Requeue).To(BeTrue())
+		reconcile()
+		Expect(getConnector().Status.Rollout.Phase).To(Equal(monkalev1alpha1.RolloutPhaseVerifying))
+
+		By("timing out the verification")
+		ageRolloutPhase(121 * time.Second)
+		reconcile()
+		dnsConnector := getConnector()
+		Expect(dnsConnector.Status.Rollout.Phase).To(Equal(monkalev1alpha1.RolloutPhaseActive))
+		Expect(dnsConnector.Status.ProvisionedDNSZones).To(HaveLen(1))
+		Expect(dnsConnector.Status.ProvisionedDNSZones[0].Mismatch).To(ContainSubstring(fmt.Sprintf("serves serial %s", initialSerial)))
+		condition := getCondition()
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(monkalev1alpha1.ConditionReasonConnectorDegraded))
+		Expect(condition.Message).To(ContainSubstring(zoneRef.Name))
+		checkpointZoneCM := getConfigMap("coredns" + monkalev1alpha1.CorednsCheckpointZoneInfix + zoneCMName)
+		Expect(checkpointZoneCM.Annotations).To(HaveKeyWithValue("SerialNumber", initialSerial))
+	})
+
+	It("restores the Corefile and the zone ConfigMaps when the health check fails", func() {
+		completeRollout(initialSerial)
+		checkpointCorefile := getConfigMap("coredns").Data["Corefile"]
+		checkpointZonefile := getConfigMap(zoneCMName).Data[zoneKey]
+
+		By("failing the rollout of the zone change")
+		renderZone(changedSerial)
+		startRollout()
+		Expect(getConfigMap(zoneCMName).Data[zoneKey]).NotTo(Equal(checkpointZonefile))
+		deployment := getDeployment()
+		deployment.Status = appsv1.DeploymentStatus{
+			ObservedGeneration: deployment.Generation,
+			Replicas:           2,
+			UpdatedReplicas:    1,
+			AvailableReplicas:  1,
+			Conditions: []appsv1.DeploymentCondition{{
+				Type:   appsv1.DeploymentProgressing,
+				Status: corev1.ConditionFalse,
+				Reason: deploymentProgressDeadlineExceeded,
+			}},
+		}
+		Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+		reconcile()
+
+		By("restoring the checkpoint")
+		dnsConnector := getConnector()
+		Expect(dnsConnector.Status.Rollout.Phase).To(Equal(monkalev1alpha1.RolloutPhaseRolledBack))
+		Expect(getCondition().Reason).To(Equal(monkalev1alpha1.ConditionReasonConnectorRolledBack))
+		Expect(getConfigMap("coredns").Data["Corefile"]).To(Equal(checkpointCorefile))
+		checkpointZoneCMName := "coredns" + monkalev1alpha1.CorednsCheckpointZoneInfix + zoneCMName
+		Expect(getZoneVolume().ConfigMap.Name).To(Equal(checkpointZoneCMName))
+		checkpointZoneCM := getConfigMap(checkpointZoneCMName)
+		Expect(checkpointZoneCM.Annotations).To(HaveKeyWithValue("SerialNumber", initialSerial))
+		Expect(checkpointZoneCM.Data).To(HaveKeyWithValue(zoneKey, checkpointZonefile))
+
+		By("reporting the reverted zone change")
+		Expect(dnsConnector.Status.LastRollback).NotTo(BeNil())
+		Expect(dnsConnector.Status.LastRollback.RevertedZones).To(ConsistOf(monkalev1alpha1.ProvisionedDNSZone{Name: zoneRef.Name, Domain: "example.org", SerialNumber: changedSerial}))
+		Expect(dnsConnector.Status.ProvisionedDNSZones).To(ConsistOf(monkalev1alpha1.ProvisionedDNSZone{Name: zoneRef.Name, Domain: "example.org", SerialNumber: initialSerial}))
+	})
+})
+
+// parseSerial converts the serial of the zone ConfigMap into the served SOA serial.
+func parseSerial(serial string) uint32 {
+	var value uint32
+	_, err := fmt.Sscan(serial, &value)
+	Expect(err).NotTo(HaveOccurred())
+	return value
+}
@@ -0,0 +1,481 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// dnssecZoneMarker separates the zone records from the DNSSEC records generated by the operator.
+// Everything after the marker is regenerated on every signing.
+const dnssecZoneMarker string = "; DNSSEC records generated by coredns-manager-operator"
+
+// Keys of the DNSSEC Secret.
+const (
+	dnssecSecretKSK         string = "ksk"          // key signing key
+	dnssecSecretZSK         string = "zsk"          // active zone signing key
+	dnssecSecretNextZSK     string = "zsk-next"     // pre-published zone signing key
+	dnssecSecretPreviousZSK string = "zsk-previous" // retired zone signing key, still published
+)
+
+// dnssecKey is the DNSSEC key pair. since is the time of the last state change of the key.
+type dnssecKey struct {
+	dnskey  *dns.DNSKEY
+	private crypto.Signer
+	since   time.Time
+}
+
+// dnssecKeys is the key set of the zone.
+type dnssecKeys struct {
+	ksk         *dnssecKey
+	zsk         *dnssecKey
+	nextZSK     *dnssecKey
+	previousZSK *dnssecKey
+}
+
+// getDNSSECAlgorithm converts the algorithm name to the DNSSEC algorithm number and the key size.
+func getDNSSECAlgorithm(name string) (uint8, int, error) {
+	switch name {
+	case "", "ECDSAP256SHA256":
+		return dns.ECDSAP256SHA256, 256, nil
+	case "ECDSAP384SHA384":
+		return dns.ECDSAP384SHA384, 384, nil
+	case "ED25519":
+		return dns.ED25519, 256, nil
+	case "RSASHA256":
+		return dns.RSASHA256, 2048, nil
+	default:
+		return 0, 0, fmt.Errorf("unsupported DNSSEC algorithm: %s", name)
+	}
+}
+
+// generateDNSSECKey generates the new key pair for the zone. flags is 257 for KSK and 256 for ZSK.
+func generateDNSSECKey(origin string, flags uint16, algorithm string, ttl uint32, now time.Time) (*dnssecKey, error) {
+	alg, bits, err := getDNSSECAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: origin, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: ttl},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: alg,
+	}
+	private, err := dnskey.Generate(bits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate DNSSEC key: %v", err)
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("failed to generate DNSSEC key: unsupported private key type %T", private)
+	}
+	return &dnssecKey{dnskey: dnskey, private: signer, since: now}, nil
+}
+
+// parseDNSSECKeys loads the key set from the Secret data. Missing keys are left nil.
+func parseDNSSECKeys(data map[string][]byte) (*dnssecKeys, error) {
+	keys := &dnssecKeys{}
+	for name, key := range map[string]**dnssecKey{
+		dnssecSecretKSK:         &keys.ksk,
+		dnssecSecretZSK:         &keys.zsk,
+		dnssecSecretNextZSK:     &keys.nextZSK,
+		dnssecSecretPreviousZSK: &keys.previousZSK,
+	} {
+		public, ok := data[name+".key"]
+		if !ok {
+			continue
+		}
+		rr, err := dns.NewRR(string(public))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DNSSEC key %s: %v", name, err)
+		}
+		dnskey, ok := rr.(*dns.DNSKEY)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse DNSSEC key %s: not a DNSKEY", name)
+		}
+		private, err := dnskey.ReadPrivateKey(strings.NewReader(string(data[name+".private"])), name+".private")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DNSSEC private key %s: %v", name, err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse DNSSEC private key %s: unsupported private key type %T", name, private)
+		}
+		since, err := time.Parse(time.RFC3339, string(data[name+".since"]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DNSSEC key %s: bad since: %v", name, err)
+		}
+		*key = &dnssecKey{dnskey: dnskey, private: signer, since: since}
+	}
+	return keys, nil
+}
+
+// toSecretData converts the key set to the Secret data.
+func (keys *dnssecKeys) toSecretData() map[string][]byte {
+	data := map[string][]byte{}
+	for name, key := range map[string]*dnssecKey{
+		dnssecSecretKSK:         keys.ksk,
+		dnssecSecretZSK:         keys.zsk,
+		dnssecSecretNextZSK:     keys.nextZSK,
+		dnssecSecretPreviousZSK: keys.previousZSK,
+	} {
+		if key == nil {
+			continue
+		}
+		data[name+".key"] = []byte(key.dnskey.String())
+		data[name+".private"] = []byte(key.dnskey.PrivateKeyString(key.private))
+		data[name+".since"] = []byte(key.since.UTC().Format(time.RFC3339))
+	}
+	return data
+}
+
+// published returns all keys published in the DNSKEY RRset.
+func (keys *dnssecKeys) published() []*dnssecKey {
+	var published []*dnssecKey
+	for _, key := range []*dnssecKey{keys.ksk, keys.zsk, keys.nextZSK, keys.previousZSK} {
+		if key != nil {
+			published = append(published, key)
+		}
+	}
+	return published
+}
+
+// keyTags returns the tags of the published keys. Used to detect key set changes.
+func (keys *dnssecKeys) keyTags() string {
+	var tags []string
+	for _, key := range keys.published() {
+		tags = append(tags, fmt.Sprintf("%d-%d-%d", key.dnskey.Flags, key.dnskey.Algorithm, key.dnskey.KeyTag()))
+	}
+	return strings.Join(tags, ",")
+}
+
+// rolloverDNSSECKeys generates the missing keys and performs the pre-publish ZSK rollover (RFC 6781):
+// the new ZSK is published zskPrePublish before the active ZSK expires, then it becomes active,
+// and the old ZSK stays published for zskPrePublish more. Returns true if the key set has changed.
+func rolloverDNSSECKeys(keys *dnssecKeys, dnsZone *monkalev1alpha1.DNSZone, now time.Time) (bool, error) {
+	spec := dnsZone.Spec.DNSSEC
+	origin := strings.ToLower(monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain))
+	ttl := uint32(dnsZone.Spec.TTL)
+	alg, _, err := getDNSSECAlgorithm(spec.Algorithm)
+	if err != nil {
+		return false, err
+	}
+
+	// New zone, new algorithm or new domain. Start over.
+	if keys.ksk == nil || keys.ksk.dnskey.Algorithm != alg || !strings.EqualFold(keys.ksk.dnskey.Hdr.Name, origin) {
+		ksk, err := generateDNSSECKey(origin, 257, spec.Algorithm, ttl, now)
+		if err != nil {
+			return false, err
+		}
+		zsk, err := generateDNSSECKey(origin, 256, spec.Algorithm, ttl, now)
+		if err != nil {
+			return false, err
+		}
+		*keys = dnssecKeys{ksk: ksk, zsk: zsk}
+		return true, nil
+	}
+
+	changed := false
+	// Keep DNSKEY TTL in line with the zone TTL.
+	for _, key := range keys.published() {
+		if key.dnskey.Hdr.Ttl != ttl {
+			key.dnskey.Hdr.Ttl = ttl
+			changed = true
+		}
+	}
+	prePublish := time.Duration(spec.ZSKPrePublish) * time.Second
+	// Remove the retired ZSK.
+	if keys.previousZSK != nil && !now.Before(keys.previousZSK.since.Add(prePublish)) {
+		keys.previousZSK = nil
+		changed = true
+	}
+	if spec.ZSKRolloverPeriod == 0 {
+		return changed, nil
+	}
+	// Activate the pre-published ZSK. The retired one must be gone first.
+	if keys.nextZSK != nil && keys.previousZSK == nil && !now.Before(keys.nextZSK.since.Add(prePublish)) {
+		keys.previousZSK = keys.zsk
+		keys.previousZSK.since = now
+		keys.zsk = keys.nextZSK
+		keys.zsk.since = now
+		keys.nextZSK = nil
+		changed = true
+	}
+	// Pre-publish the next ZSK.
+	rolloverAt := keys.zsk.since.Add(time.Duration(spec.ZSKRolloverPeriod) * time.Second)
+	if keys.nextZSK == nil && !now.Before(rolloverAt.Add(-prePublish)) {
+		nextZSK, err := generateDNSSECKey(origin, 256, spec.Algorithm, ttl, now)
+		if err != nil {
+			return false, err
+		}
+		keys.nextZSK = nextZSK
+		changed = true
+	}
+	return changed, nil
+}
+
+// getNextZSKRollover returns the time of the next ZSK rollover step.
+func getNextZSKRollover(keys *dnssecKeys, spec *monkalev1alpha1.DNSSEC) *metav1.Time {
+	prePublish := time.Duration(spec.ZSKPrePublish) * time.Second
+	var next time.Time
+	switch {
+	case keys.previousZSK != nil:
+		next = keys.previousZSK.since.Add(prePublish)
+	case spec.ZSKRolloverPeriod == 0:
+		return nil
+	case keys.nextZSK != nil:
+		next = keys.nextZSK.since.Add(prePublish)
+	default:
+		next = keys.zsk.since.Add(time.Duration(spec.ZSKRolloverPeriod) * time.Second).Add(-prePublish)
+	}
+	nextTime := metav1.NewTime(next)
+	return &nextTime
+}
+
+// canonicalNameLess compares domain names in the canonical DNS name order (RFC 4034 6.1).
+func canonicalNameLess(name1, name2 string) bool {
+	labels1 := dns.SplitDomainName(strings.ToLower(name1))
+	labels2 := dns.SplitDomainName(strings.ToLower(name2))
+	for i, j := len(labels1)-1, len(labels2)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if labels1[i] != labels2[j] {
+			return labels1[i] < labels2[j]
+		}
+	}
+	return len(labels1) < len(labels2)
+}
+
+// signZone signs the zonefile. Adds DNSKEY RRset, NSEC chain and RRSIGs after the dnssecZoneMarker.
+// RRsets are signed by the active ZSK, DNSKEY RRset is signed by the KSK.
+// Delegations (NS below the apex) and glue records are not signed, as defined by RFC 4035.
+// Returns the signed zonefile and the expiration of the signatures.
+func signZone(zonefile string, dnsZone *monkalev1alpha1.DNSZone, keys *dnssecKeys, now time.Time) (string, time.Time, error) {
+	origin := strings.ToLower(monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain))
+	inception := now.Add(-time.Hour)
+	expiration := now.Add(time.Duration(dnsZone.Spec.DNSSEC.SignatureValidity) * time.Second)
+
+	// Group the zone into RRsets.
+	type rrsetKey struct {
+		name   string
+		rrType uint16
+	}
+	rrsets := map[rrsetKey][]dns.RR{}
+	types := map[string]map[uint16]bool{}
+	addRR := func(rr dns.RR) {
+		name := strings.ToLower(rr.Header().Name)
+		key := rrsetKey{name: name, rrType: rr.Header().Rrtype}
+		for _, existing := range rrsets[key] {
+			if dns.IsDuplicate(existing, rr) {
+				return
+			}
+		}
+		rrsets[key] = append(rrsets[key], rr)
+		if types[name] == nil {
+			types[name] = map[uint16]bool{}
+		}
+		types[name][rr.Header().Rrtype] = true
+	}
+
+	var soa *dns.SOA
+	zoneParser := dns.NewZoneParser(strings.NewReader(zonefile), origin, "")
+	for rr, ok := zoneParser.Next(); ok; rr, ok = zoneParser.Next() {
+		switch rr.Header().Rrtype {
+		case dns.TypeDNSKEY, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM:
+			// DNSSEC records are managed by the operator
+			continue
+		case dns.TypeSOA:
+			soa = rr.(*dns.SOA)
+		}
+		addRR(rr)
+	}
+	if err := zoneParser.Err(); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse zone for signing: %v", err)
+	}
+	if soa == nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse zone for signing: SOA record not found")
+	}
+
+	// DNSKEY RRset
+	for _, key := range keys.published() {
+		addRR(key.dnskey)
+	}
+
+	// Delegation points and glue
+	var delegations []string
+	for name, nameTypes := range types {
+		if name != origin && nameTypes[dns.TypeNS] {
+			delegations = append(delegations, name)
+		}
+	}
+	isGlue := func(name string) bool {
+		for _, delegation := range delegations {
+			if name != delegation && dns.IsSubDomain(delegation, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// NSEC chain. TTL is the minimum of the SOA TTL and the SOA minimum (RFC 9077).
+	nsecTTL := soa.Minttl
+	if soa.Hdr.Ttl < nsecTTL {
+		nsecTTL = soa.Hdr.Ttl
+	}
+	var names []string
+	for name := range types {
+		if !isGlue(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return canonicalNameLess(names[i], names[j]) })
+	for i, name := range names {
+		bitmap := []uint16{dns.TypeNSEC, dns.TypeRRSIG}
+		for rrType := range types[name] {
+			bitmap = append(bitmap, rrType)
+		}
+		sort.Slice(bitmap, func(i, j int) bool { return bitmap[i] < bitmap[j] })
+		addRR(&dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: nsecTTL},
+			NextDomain: names[(i+1)%len(names)],
+			TypeBitMap: bitmap,
+		})
+	}
+
+	// Sign RRsets
+	var keysOrder []rrsetKey
+	for key := range rrsets {
+		keysOrder = append(keysOrder, key)
+	}
+	sort.Slice(keysOrder, func(i, j int) bool {
+		if keysOrder[i].name != keysOrder[j].name {
+			return canonicalNameLess(keysOrder[i].name, keysOrder[j].name)
+		}
+		return keysOrder[i].rrType < keysOrder[j].rrType
+	})
+
+	var signedBuilder strings.Builder
+	signedBuilder.WriteString(strings.TrimRight(zonefile, "\n"))
+	signedBuilder.WriteString("\n" + dnssecZoneMarker + "\n")
+	for _, key := range keysOrder {
+		rrset := rrsets[key]
+		rrType := rrset[0].Header().Rrtype
+		if rrType == dns.TypeDNSKEY || rrType == dns.TypeNSEC {
+			for _, rr := range rrset {
+				signedBuilder.WriteString(rr.String() + "\n")
+			}
+		}
+		if isGlue(key.name) || (key.name != origin && types[key.name][dns.TypeNS] && rrType != dns.TypeDS && rrType != dns.TypeNSEC) {
+			continue
+		}
+		signingKey := keys.zsk
+		if rrType == dns.TypeDNSKEY {
+			signingKey = keys.ksk
+		}
+		rrsig := &dns.RRSIG{
+			Hdr:        dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrset[0].Header().Ttl},
+			KeyTag:     signingKey.dnskey.KeyTag(),
+			SignerName: origin,
+			Algorithm:  signingKey.dnskey.Algorithm,
+			Inception:  uint32(inception.Unix()),
+			Expiration: uint32(expiration.Unix()),
+		}
+		if err := rrsig.Sign(signingKey.private, rrset); err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to sign %s %s: %v", key.name, dns.TypeToString[rrType], err)
+		}
+		signedBuilder.WriteString(rrsig.String() + "\n")
+	}
+	return signedBuilder.String(), expiration, nil
+}
+
+// removeDNSSECRecords removes the DNSSEC records generated by the operator from the zonefile.
+func removeDNSSECRecords(zonefile string) string {
+	if i := strings.Index(zonefile, "\n"+dnssecZoneMarker+"\n"); i >= 0 {
+		return zonefile[:i+1]
+	}
+	return zonefile
+}
+
+// constructDNSSECStatus builds the DNSSEC status of the zone: DS records of the KSK and the key states.
+func constructDNSSECStatus(keys *dnssecKeys, spec *monkalev1alpha1.DNSSEC, expiration time.Time) (*monkalev1alpha1.DNSSECStatus, error) {
+	status := &monkalev1alpha1.DNSSECStatus{NextZSKRollover: getNextZSKRollover(keys, spec)}
+	for _, digest := range []uint8{dns.SHA256, dns.SHA384} {
+		ds := keys.ksk.dnskey.ToDS(digest)
+		if ds == nil {
+			return nil, fmt.Errorf("failed to generate DS record")
+		}
+		status.DS = append(status.DS, ds.String())
+	}
+	for _, key := range []struct {
+		key     *dnssecKey
+		keyType string
+		state   string
+	}{
+		{keys.ksk, monkalev1alpha1.DNSSECKeyTypeKSK, monkalev1alpha1.DNSSECKeyStateActive},
+		{keys.zsk, monkalev1alpha1.DNSSECKeyTypeZSK, monkalev1alpha1.DNSSECKeyStateActive},
+		{keys.nextZSK, monkalev1alpha1.DNSSECKeyTypeZSK, monkalev1alpha1.DNSSECKeyStatePublished},
+		{keys.previousZSK, monkalev1alpha1.DNSSECKeyTypeZSK, monkalev1alpha1.DNSSECKeyStateRetired},
+	} {
+		if key.key == nil {
+			continue
+		}
+		status.Keys = append(status.Keys, monkalev1alpha1.DNSSECKey{
+			KeyTag:    key.key.dnskey.KeyTag(),
+			Type:      key.keyType,
+			State:     key.state,
+			Algorithm: dns.AlgorithmToString[key.key.dnskey.Algorithm],
+		})
+	}
+	if !expiration.IsZero() {
+		expirationTime := metav1.NewTime(expiration)
+		status.SignatureExpiration = &expirationTime
+	}
+	return status, nil
+}
+
+// getDNSSECRequeueAfter returns the delay before the next re-signing or ZSK rollover step of the zone, whichever comes first.
+// The delay is at most one hour and at least one minute.
+func getDNSSECRequeueAfter(dnsZone *monkalev1alpha1.DNSZone, now time.Time) time.Duration {
+	requeueAfter := time.Hour
+	status := dnsZone.Status.DNSSEC
+	if status == nil {
+		return requeueAfter
+	}
+	var next []time.Time
+	if status.SignatureExpiration != nil {
+		next = append(next, status.SignatureExpiration.Add(-time.Duration(dnsZone.Spec.DNSSEC.ResignBefore)*time.Second))
+	}
+	if status.NextZSKRollover != nil {
+		next = append(next, status.NextZSKRollover.Time)
+	}
+	for _, t := range next {
+		if until := t.Sub(now); until < requeueAfter {
+			requeueAfter = until
+		}
+	}
+	if requeueAfter < time.Minute {
+		requeueAfter = time.Minute
+	}
+	return requeueAfter
+}
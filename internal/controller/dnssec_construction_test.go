@@ -0,0 +1,421 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// dnssecTestZone returns the DNSZone example.org signed with the given ZSK rollover period and pre-publish time in days.
+func dnssecTestZone(rolloverDays, prePublishDays uint) *monkalev1alpha1.DNSZone {
+	return &monkalev1alpha1.DNSZone{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-org", Namespace: "default"},
+		Spec: monkalev1alpha1.DNSZoneSpec{
+			Domain: "example.org",
+			TTL:    3600,
+			DNSSEC: &monkalev1alpha1.DNSSEC{
+				Enabled:           true,
+				Algorithm:         "ECDSAP256SHA256",
+				SignatureValidity: 1209600,
+				ResignBefore:      432000,
+				ZSKRolloverPeriod: rolloverDays * 24 * 3600,
+				ZSKPrePublish:     prePublishDays * 24 * 3600,
+			},
+		},
+	}
+}
+
+func TestRolloverDNSSECKeys(t *testing.T) {
+	const day = 24 * time.Hour
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dnsZone := dnssecTestZone(30, 2)
+
+	// The steps share the key set. The keys are named in the order they appear, so the steps follow the ZSKs
+	// through the states: zsk1 is active, zsk2 is pre-published, activated, then zsk1 is retired and removed.
+	steps := []struct {
+		name             string
+		now              time.Duration
+		wantChanged      bool
+		wantZSK          string
+		wantNextZSK      string
+		wantPreviousZSK  string
+		wantNextRollover time.Duration
+	}{
+		{name: "generate the keys", now: 0, wantChanged: true, wantZSK: "zsk1", wantNextRollover: 28 * day},
+		{name: "keep the keys", now: time.Hour, wantZSK: "zsk1", wantNextRollover: 28 * day},
+		{name: "before the pre-publish", now: 28*day - time.Second, wantZSK: "zsk1", wantNextRollover: 28 * day},
+		{name: "pre-publish the next ZSK", now: 28 * day, wantChanged: true, wantZSK: "zsk1", wantNextZSK: "zsk2", wantNextRollover: 30 * day},
+		{name: "before the activation", now: 30*day - time.Second, wantZSK: "zsk1", wantNextZSK: "zsk2", wantNextRollover: 30 * day},
+		{name: "activate the next ZSK", now: 30 * day, wantChanged: true, wantZSK: "zsk2", wantPreviousZSK: "zsk1", wantNextRollover: 32 * day},
+		{name: "before the removal", now: 32*day - time.Second, wantZSK: "zsk2", wantPreviousZSK: "zsk1", wantNextRollover: 32 * day},
+		{name: "remove the retired ZSK", now: 32 * day, wantChanged: true, wantZSK: "zsk2", wantNextRollover: 58 * day},
+		{name: "pre-publish the following ZSK", now: 58 * day, wantChanged: true, wantZSK: "zsk2", wantNextZSK: "zsk3", wantNextRollover: 60 * day},
+	}
+
+	keys := &dnssecKeys{}
+	var ksk *dnssecKey
+	named := map[string]*dnssecKey{}
+	// checkKey matches the key with the expected name. A new name is given to the first key which has no name yet.
+	checkKey := func(t *testing.T, state string, got *dnssecKey, want string) {
+		t.Helper()
+		if want == "" {
+			if got != nil {
+				t.Errorf("rolloverDNSSECKeys() %s = %d, want none", state, got.dnskey.KeyTag())
+			}
+			return
+		}
+		if got == nil {
+			t.Errorf("rolloverDNSSECKeys() %s = none, want %s", state, want)
+			return
+		}
+		if _, ok := named[want]; !ok {
+			for name, key := range named {
+				if key == got {
+					t.Errorf("rolloverDNSSECKeys() %s = %s, want new key %s", state, name, want)
+					return
+				}
+			}
+			named[want] = got
+		}
+		if named[want] != got {
+			t.Errorf("rolloverDNSSECKeys() %s is not %s", state, want)
+		}
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			now := start.Add(step.now)
+			changed, err := rolloverDNSSECKeys(keys, dnsZone, now)
+			if err != nil {
+				t.Fatalf("rolloverDNSSECKeys() error = %v", err)
+			}
+			if changed != step.wantChanged {
+				t.Errorf("rolloverDNSSECKeys() = %v, want %v", changed, step.wantChanged)
+			}
+			if ksk == nil {
+				ksk = keys.ksk
+			}
+			if keys.ksk != ksk {
+				t.Errorf("rolloverDNSSECKeys() replaced the KSK")
+			}
+			checkKey(t, "ZSK", keys.zsk, step.wantZSK)
+			checkKey(t, "next ZSK", keys.nextZSK, step.wantNextZSK)
+			checkKey(t, "previous ZSK", keys.previousZSK, step.wantPreviousZSK)
+			for _, key := range keys.published() {
+				if key.dnskey.Hdr.Name != "example.org." || key.dnskey.Hdr.Ttl != 3600 {
+					t.Errorf("rolloverDNSSECKeys() DNSKEY %s", key.dnskey)
+				}
+				if key != keys.ksk && key.dnskey.Flags != 256 {
+					t.Errorf("rolloverDNSSECKeys() ZSK flags = %d, want 256", key.dnskey.Flags)
+				}
+			}
+			if keys.ksk.dnskey.Flags != 257 {
+				t.Errorf("rolloverDNSSECKeys() KSK flags = %d, want 257", keys.ksk.dnskey.Flags)
+			}
+
+			nextRollover := getNextZSKRollover(keys, dnsZone.Spec.DNSSEC)
+			if want := start.Add(step.wantNextRollover); nextRollover == nil || !nextRollover.Time.Equal(want) {
+				t.Errorf("getNextZSKRollover() = %v, want %v", nextRollover, want)
+			}
+		})
+	}
+}
+
+func TestRolloverDNSSECKeysChanges(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		update           func(dnsZone *monkalev1alpha1.DNSZone)
+		later            time.Duration
+		wantChanged      bool
+		wantNewKeys      bool
+		wantTTL          uint32
+		wantNextRollover bool
+	}{
+		{name: "no changes", later: 24 * time.Hour, wantTTL: 3600, wantNextRollover: true},
+		{
+			name:             "TTL change",
+			update:           func(dnsZone *monkalev1alpha1.DNSZone) { dnsZone.Spec.TTL = 300 },
+			wantChanged:      true,
+			wantTTL:          300,
+			wantNextRollover: true,
+		},
+		{
+			name:             "algorithm change",
+			update:           func(dnsZone *monkalev1alpha1.DNSZone) { dnsZone.Spec.DNSSEC.Algorithm = "ED25519" },
+			wantChanged:      true,
+			wantNewKeys:      true,
+			wantTTL:          3600,
+			wantNextRollover: true,
+		},
+		{
+			name:             "domain change",
+			update:           func(dnsZone *monkalev1alpha1.DNSZone) { dnsZone.Spec.Domain = "example.com" },
+			wantChanged:      true,
+			wantNewKeys:      true,
+			wantTTL:          3600,
+			wantNextRollover: true,
+		},
+		{
+			name:    "rollover disabled",
+			update:  func(dnsZone *monkalev1alpha1.DNSZone) { dnsZone.Spec.DNSSEC.ZSKRolloverPeriod = 0 },
+			later:   365 * 24 * time.Hour,
+			wantTTL: 3600,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dnsZone := dnssecTestZone(30, 2)
+			keys := &dnssecKeys{}
+			if _, err := rolloverDNSSECKeys(keys, dnsZone, now); err != nil {
+				t.Fatalf("rolloverDNSSECKeys() error = %v", err)
+			}
+			ksk, zsk := keys.ksk, keys.zsk
+			if tt.update != nil {
+				tt.update(dnsZone)
+			}
+
+			changed, err := rolloverDNSSECKeys(keys, dnsZone, now.Add(tt.later))
+			if err != nil {
+				t.Fatalf("rolloverDNSSECKeys() error = %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("rolloverDNSSECKeys() = %v, want %v", changed, tt.wantChanged)
+			}
+			if newKeys := keys.ksk != ksk || keys.zsk != zsk; newKeys != tt.wantNewKeys {
+				t.Errorf("rolloverDNSSECKeys() new keys = %v, want %v", newKeys, tt.wantNewKeys)
+			}
+			if keys.nextZSK != nil || keys.previousZSK != nil {
+				t.Errorf("rolloverDNSSECKeys() key tags = %s, want KSK and ZSK only", keys.keyTags())
+			}
+			origin := monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain)
+			for _, key := range keys.published() {
+				if key.dnskey.Hdr.Ttl != tt.wantTTL || key.dnskey.Hdr.Name != origin {
+					t.Errorf("rolloverDNSSECKeys() DNSKEY = %s, want TTL %d and owner %s", key.dnskey, tt.wantTTL, origin)
+				}
+			}
+			if nextRollover := getNextZSKRollover(keys, dnsZone.Spec.DNSSEC); (nextRollover != nil) != tt.wantNextRollover {
+				t.Errorf("getNextZSKRollover() = %v, want next rollover %v", nextRollover, tt.wantNextRollover)
+			}
+		})
+	}
+}
+
+// dnssecTestZonefile is the example.org zone with the delegation of sub.example.org and its glue.
+const dnssecTestZonefile = `$ORIGIN example.org.
+$TTL 3600
+@ IN SOA ns1.example.org. admin.example.org. 2024010101 7200 3600 1209600 300
+@ IN NS ns1
+ns1 IN A 192.0.2.1
+www IN A 192.0.2.10
+www IN AAAA 2001:db8::10
+Mail IN MX 10 www
+*.app IN CNAME www
+sub IN NS ns1.sub
+sub IN NS ns.example.net.
+sub IN DS 12345 13 2 abababababababababababababababababababababababababababababababab
+ns1.sub IN A 192.0.2.53
+`
+
+func TestSignZone(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newKeys := func(t *testing.T, rollover bool) *dnssecKeys {
+		keys := &dnssecKeys{}
+		for _, key := range []struct {
+			key   **dnssecKey
+			flags uint16
+		}{{&keys.ksk, 257}, {&keys.zsk, 256}, {&keys.nextZSK, 256}, {&keys.previousZSK, 256}} {
+			if key.key != &keys.ksk && key.key != &keys.zsk && !rollover {
+				continue
+			}
+			generated, err := generateDNSSECKey("example.org.", key.flags, "ECDSAP256SHA256", 3600, now)
+			if err != nil {
+				t.Fatalf("generateDNSSECKey() error = %v", err)
+			}
+			*key.key = generated
+		}
+		return keys
+	}
+
+	tests := []struct {
+		name         string
+		zonefile     string
+		rollover     bool
+		wantChain    []string
+		wantUnsigned []string
+		wantErr      bool
+	}{
+		{
+			name:      "apex only",
+			zonefile:  "$ORIGIN example.org.\n@ 3600 IN SOA ns1.example.org. admin.example.org. 1 7200 3600 1209600 300\n@ 3600 IN NS ns1.example.net.\n",
+			wantChain: []string{"example.org."},
+		},
+		{
+			name:         "delegation with glue",
+			zonefile:     dnssecTestZonefile,
+			wantChain:    []string{"example.org.", "*.app.example.org.", "mail.example.org.", "ns1.example.org.", "sub.example.org.", "www.example.org."},
+			wantUnsigned: []string{"ns1.sub.example.org. A", "sub.example.org. NS"},
+		},
+		{
+			name:         "ZSK rollover",
+			zonefile:     dnssecTestZonefile,
+			rollover:     true,
+			wantChain:    []string{"example.org.", "*.app.example.org.", "mail.example.org.", "ns1.example.org.", "sub.example.org.", "www.example.org."},
+			wantUnsigned: []string{"ns1.sub.example.org. A", "sub.example.org. NS"},
+		},
+		{
+			name:     "no SOA record",
+			zonefile: "$ORIGIN example.org.\nwww 3600 IN A 192.0.2.10\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dnsZone := dnssecTestZone(30, 2)
+			keys := newKeys(t, tt.rollover)
+			signed, expiration, err := signZone(tt.zonefile, dnsZone, keys, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("signZone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if want := now.Add(14 * 24 * time.Hour); !expiration.Equal(want) {
+				t.Errorf("signZone() expiration = %v, want %v", expiration, want)
+			}
+			if !strings.HasPrefix(signed, strings.TrimRight(tt.zonefile, "\n")+"\n"+dnssecZoneMarker+"\n") {
+				t.Errorf("signZone() does not keep the zonefile before the DNSSEC records")
+			}
+			if removed := removeDNSSECRecords(signed); removed != strings.TrimRight(tt.zonefile, "\n")+"\n" {
+				t.Errorf("removeDNSSECRecords() = %q, want the zonefile", removed)
+			}
+
+			// group the signed zone into RRsets
+			rrsets := map[string][]dns.RR{}
+			var rrsigs []*dns.RRSIG
+			var nsecs []*dns.NSEC
+			zoneParser := dns.NewZoneParser(strings.NewReader(signed), "example.org.", "")
+			for rr, ok := zoneParser.Next(); ok; rr, ok = zoneParser.Next() {
+				switch rr := rr.(type) {
+				case *dns.RRSIG:
+					rrsigs = append(rrsigs, rr)
+					continue
+				case *dns.NSEC:
+					nsecs = append(nsecs, rr)
+				}
+				key := strings.ToLower(rr.Header().Name) + " " + dns.TypeToString[rr.Header().Rrtype]
+				rrsets[key] = append(rrsets[key], rr)
+			}
+			if err := zoneParser.Err(); err != nil {
+				t.Fatalf("signZone() zone does not parse: %v", err)
+			}
+
+			// the DNSKEY RRset publishes all keys
+			if got, want := len(rrsets["example.org. DNSKEY"]), len(keys.published()); got != want {
+				t.Errorf("signZone() DNSKEY RRset has %d keys, want %d", got, want)
+			}
+
+			// the NSEC chain starts at the apex, follows the canonical order and closes back to the apex
+			nsecByName := map[string]*dns.NSEC{}
+			for _, nsec := range nsecs {
+				nsecByName[strings.ToLower(nsec.Hdr.Name)] = nsec
+				if nsec.Hdr.Ttl != 300 {
+					t.Errorf("signZone() NSEC %s TTL = %d, want 300", nsec.Hdr.Name, nsec.Hdr.Ttl)
+				}
+			}
+			var chain []string
+			for name := "example.org."; len(chain) <= len(nsecs); {
+				nsec, ok := nsecByName[name]
+				if !ok {
+					t.Fatalf("signZone() NSEC chain is broken at %s", name)
+				}
+				chain = append(chain, name)
+				if name = strings.ToLower(nsec.NextDomain); name == "example.org." {
+					break
+				}
+			}
+			if !reflect.DeepEqual(chain, tt.wantChain) || len(nsecs) != len(tt.wantChain) {
+				t.Errorf("signZone() NSEC chain = %v of %d NSEC records, want %v", chain, len(nsecs), tt.wantChain)
+			}
+			for name, nsec := range nsecByName {
+				var wantBitmap []uint16
+				for key := range rrsets {
+					if strings.HasPrefix(key, name+" ") {
+						wantBitmap = append(wantBitmap, dns.StringToType[strings.TrimPrefix(key, name+" ")])
+					}
+				}
+				wantBitmap = append(wantBitmap, dns.TypeRRSIG)
+				sort.Slice(wantBitmap, func(i, j int) bool { return wantBitmap[i] < wantBitmap[j] })
+				if !reflect.DeepEqual(nsec.TypeBitMap, wantBitmap) {
+					t.Errorf("signZone() NSEC %s type bitmap = %v, want %v", name, nsec.TypeBitMap, wantBitmap)
+				}
+			}
+
+			// every authoritative RRset has one RRSIG verified with the published DNSKEY: the KSK signs the DNSKEY RRset,
+			// the active ZSK signs the rest
+			dnskeys := map[uint16]*dns.DNSKEY{}
+			for _, rr := range rrsets["example.org. DNSKEY"] {
+				dnskeys[rr.(*dns.DNSKEY).KeyTag()] = rr.(*dns.DNSKEY)
+			}
+			signedRRsets := map[string]bool{}
+			for _, rrsig := range rrsigs {
+				key := strings.ToLower(rrsig.Hdr.Name) + " " + dns.TypeToString[rrsig.TypeCovered]
+				if signedRRsets[key] {
+					t.Errorf("signZone() RRset %s is signed twice", key)
+				}
+				signedRRsets[key] = true
+				wantKey := keys.zsk
+				if rrsig.TypeCovered == dns.TypeDNSKEY {
+					wantKey = keys.ksk
+				}
+				if rrsig.KeyTag != wantKey.dnskey.KeyTag() || rrsig.SignerName != "example.org." {
+					t.Errorf("signZone() RRset %s is signed with %d by %s, want %d by example.org.", key, rrsig.KeyTag, rrsig.SignerName, wantKey.dnskey.KeyTag())
+				}
+				dnskey, ok := dnskeys[rrsig.KeyTag]
+				if !ok {
+					t.Errorf("signZone() RRset %s is signed with the key %d which is not published", key, rrsig.KeyTag)
+					continue
+				}
+				if err := rrsig.Verify(dnskey, rrsets[key]); err != nil {
+					t.Errorf("signZone() RRSIG of %s does not verify: %v", key, err)
+				}
+				if !rrsig.ValidityPeriod(now) {
+					t.Errorf("signZone() RRSIG of %s is not valid at %v", key, now)
+				}
+			}
+			var unsigned []string
+			for key := range rrsets {
+				if !signedRRsets[key] {
+					unsigned = append(unsigned, key)
+				}
+			}
+			sort.Strings(unsigned)
+			if !reflect.DeepEqual(unsigned, tt.wantUnsigned) {
+				t.Errorf("signZone() unsigned RRsets = %v, want %v", unsigned, tt.wantUnsigned)
+			}
+		})
+	}
+}
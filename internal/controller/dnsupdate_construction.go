@@ -0,0 +1,453 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+// updateRRsetKey identifies the RRset of the zone by the lower case owner name and the record type.
+type updateRRsetKey struct {
+	name   string
+	rrtype uint16
+}
+
+// updateRRset is the RRset of the zone the dynamic update is applied to.
+// Only RRsets owned by the update server can be changed: the server never touches DNSRecords created by hand or by the sources.
+type updateRRset struct {
+	dnsRecord *monkalev1alpha1.DNSRecord // dnsRecord is the owned DNSRecord of the RRset, nil if the RRset is new
+	owned     bool
+	changed   bool
+	ttl       uint32
+	rrs       []dns.RR
+}
+
+// supportedUpdateTypes are the record types which can be added by the dynamic update. DNSSEC records are generated by the operator.
+var supportedUpdateTypes = map[uint16]bool{
+	dns.TypeA:     true,
+	dns.TypeAAAA:  true,
+	dns.TypeCNAME: true,
+	dns.TypeMX:    true,
+	dns.TypeTXT:   true,
+	dns.TypeNS:    true,
+	dns.TypePTR:   true,
+	dns.TypeSRV:   true,
+	dns.TypeCAA:   true,
+	dns.TypeDS:    true,
+	dns.TypeNAPTR: true,
+	dns.TypeDNAME: true,
+	dns.TypeHINFO: true,
+}
+
+// isUpdateOwned checks whether the DNSRecord has been created by the dynamic update of the zone.
+func isUpdateOwned(dnsRecord *monkalev1alpha1.DNSRecord, dnsZone *monkalev1alpha1.DNSZone) bool {
+	return isSourceRecordOf(dnsRecord, monkalev1alpha1.SourceKindDNSUpdate, types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace})
+}
+
+// buildUpdateRRsets builds the RRsets of the zone out of its DNSRecords. DNSRecords which can not be parsed are skipped,
+// since they are not published in the zone either. The validation status is not checked: the DNSRecords written by
+// the previous update may not be validated by the DNSRecord controller yet.
+func buildUpdateRRsets(dnsZone *monkalev1alpha1.DNSZone, dnsRecords *monkalev1alpha1.DNSRecordList) map[updateRRsetKey]*updateRRset {
+	origin := strings.ToLower(monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain))
+	rrsets := make(map[updateRRsetKey]*updateRRset)
+	for i := range dnsRecords.Items {
+		dnsRecord := &dnsRecords.Items[i]
+		if dnsRecord.Spec.Record == nil {
+			continue
+		}
+		record, err := render.ConstructRecord(*dnsRecord)
+		if err != nil {
+			continue
+		}
+		// records without TTL get the TTL of the zone
+		var rrs []dns.RR
+		recordParser := dns.NewZoneParser(strings.NewReader(fmt.Sprintf("$TTL %d\n%s", dnsZone.Spec.TTL, record)), origin, "")
+		for rr, ok := recordParser.Next(); ok; rr, ok = recordParser.Next() {
+			rrs = append(rrs, rr)
+		}
+		if recordParser.Err() != nil {
+			continue
+		}
+
+		owned := isUpdateOwned(dnsRecord, dnsZone)
+		for _, rr := range rrs {
+			key := updateRRsetKey{name: strings.ToLower(rr.Header().Name), rrtype: rr.Header().Rrtype}
+			rrset, exists := rrsets[key]
+			if !exists {
+				rrset = &updateRRset{owned: owned, ttl: rr.Header().Ttl}
+				rrsets[key] = rrset
+			}
+			// an RRset built of several DNSRecords is owned only if all of them are owned
+			rrset.owned = rrset.owned && owned
+			if owned {
+				rrset.dnsRecord = dnsRecord
+			}
+			rrset.rrs = append(rrset.rrs, rr)
+		}
+	}
+	return rrsets
+}
+
+// updateRRsetExists checks whether the RRset exists in the zone. SOA and NS records of the zone apex are generated out of the DNSZone.
+func updateRRsetExists(zone string, key updateRRsetKey, rrsets map[updateRRsetKey]*updateRRset) bool {
+	if key.name == zone && (key.rrtype == dns.TypeSOA || key.rrtype == dns.TypeNS) {
+		return true
+	}
+	rrset, ok := rrsets[key]
+	return ok && len(rrset.rrs) > 0
+}
+
+// updateNameInUse checks whether the name owns any RRset in the zone.
+func updateNameInUse(zone, name string, rrsets map[updateRRsetKey]*updateRRset) bool {
+	if name == zone {
+		return true
+	}
+	for key, rrset := range rrsets {
+		if key.name == name && len(rrset.rrs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUpdatePrerequisites checks the prerequisite section of the update message (RFC 2136 section 3.2).
+// Returns the response code, RcodeSuccess if all prerequisites are satisfied.
+func checkUpdatePrerequisites(zone string, prerequisites []dns.RR, rrsets map[updateRRsetKey]*updateRRset) int {
+	valueDependent := make(map[updateRRsetKey][]dns.RR)
+	for _, rr := range prerequisites {
+		header := rr.Header()
+		name := strings.ToLower(header.Name)
+		if header.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(zone, name) {
+			return dns.RcodeNotZone
+		}
+		key := updateRRsetKey{name: name, rrtype: header.Rrtype}
+		switch header.Class {
+		case dns.ClassANY:
+			if header.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if header.Rrtype == dns.TypeANY {
+				if !updateNameInUse(zone, name, rrsets) {
+					return dns.RcodeNameError
+				}
+			} else if !updateRRsetExists(zone, key, rrsets) {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if header.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if header.Rrtype == dns.TypeANY {
+				if updateNameInUse(zone, name, rrsets) {
+					return dns.RcodeYXDomain
+				}
+			} else if updateRRsetExists(zone, key, rrsets) {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			valueDependent[key] = append(valueDependent[key], rr)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	// value dependent prerequisites: the RRset must contain exactly the listed records
+	for key, expected := range valueDependent {
+		rrset, ok := rrsets[key]
+		if !ok || !equalRRs(rrset.rrs, expected) {
+			return dns.RcodeNXRrset
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// equalRRs compares two sets of records ignoring TTLs and the order.
+func equalRRs(rrs1, rrs2 []dns.RR) bool {
+	return containsRRs(rrs1, rrs2) && containsRRs(rrs2, rrs1)
+}
+
+// containsRRs checks whether every record of rrs2 is in rrs1.
+func containsRRs(rrs1, rrs2 []dns.RR) bool {
+	for _, rr2 := range rrs2 {
+		if indexRR(rrs1, rr2) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// indexRR returns the index of the record in the list, -1 if the list does not contain the record. TTLs are ignored.
+func indexRR(rrs []dns.RR, rr dns.RR) int {
+	for i := range rrs {
+		if dns.IsDuplicate(rrs[i], rr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// prescanUpdates checks the update section of the update message (RFC 2136 section 3.4.1).
+// Returns the response code, RcodeSuccess if the updates are well formed.
+func prescanUpdates(zone string, updates []dns.RR) int {
+	for _, rr := range updates {
+		header := rr.Header()
+		if !dns.IsSubDomain(zone, strings.ToLower(header.Name)) {
+			return dns.RcodeNotZone
+		}
+		switch header.Class {
+		case dns.ClassINET:
+			if header.Rrtype == dns.TypeANY || header.Rrtype == dns.TypeAXFR || header.Rrtype == dns.TypeIXFR {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if header.Ttl != 0 || header.Rdlength != 0 || header.Rrtype == dns.TypeAXFR || header.Rrtype == dns.TypeIXFR {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if header.Ttl != 0 || header.Rrtype == dns.TypeANY || header.Rrtype == dns.TypeAXFR || header.Rrtype == dns.TypeIXFR {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// applyUpdates applies the update section of the update message to the RRsets (RFC 2136 section 3.4.2).
+// Changes of the RRsets which are not owned by the update server are refused. SOA and NS records of the zone apex
+// are generated out of the DNSZone, so their updates are ignored. Returns the response code.
+func applyUpdates(zone string, updates []dns.RR, rrsets map[updateRRsetKey]*updateRRset) int {
+	if rcode := prescanUpdates(zone, updates); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+	for _, rr := range updates {
+		header := rr.Header()
+		name := strings.ToLower(header.Name)
+		key := updateRRsetKey{name: name, rrtype: header.Rrtype}
+		if header.Rrtype == dns.TypeSOA || (name == zone && header.Rrtype == dns.TypeNS) {
+			continue
+		}
+		switch header.Class {
+		case dns.ClassINET:
+			if !supportedUpdateTypes[header.Rrtype] {
+				return dns.RcodeRefused
+			}
+			// CNAME can not coexist with other data, such updates are ignored
+			if header.Rrtype == dns.TypeCNAME && updateNameInUse(zone, name, rrsetsWithout(rrsets, key)) {
+				continue
+			}
+			if header.Rrtype != dns.TypeCNAME && updateRRsetExists(zone, updateRRsetKey{name: name, rrtype: dns.TypeCNAME}, rrsets) {
+				continue
+			}
+			rrset, ok := rrsets[key]
+			if !ok {
+				rrset = &updateRRset{owned: true}
+				rrsets[key] = rrset
+			}
+			if !rrset.owned {
+				return dns.RcodeRefused
+			}
+			newRR := dns.Copy(rr)
+			newRR.Header().Name = name
+			if header.Rrtype == dns.TypeCNAME {
+				rrset.rrs = nil
+			}
+			if i := indexRR(rrset.rrs, newRR); i >= 0 {
+				rrset.rrs[i] = newRR
+			} else {
+				rrset.rrs = append(rrset.rrs, newRR)
+			}
+			rrset.ttl = header.Ttl
+			rrset.changed = true
+		case dns.ClassANY:
+			for rrsetKey, rrset := range rrsets {
+				if rrsetKey.name != name || (header.Rrtype != dns.TypeANY && rrsetKey.rrtype != header.Rrtype) || len(rrset.rrs) == 0 {
+					continue
+				}
+				if !rrset.owned {
+					return dns.RcodeRefused
+				}
+				rrset.rrs = nil
+				rrset.changed = true
+			}
+		case dns.ClassNONE:
+			rrset, ok := rrsets[key]
+			if !ok {
+				continue
+			}
+			deleteRR := dns.Copy(rr)
+			deleteRR.Header().Class = dns.ClassINET
+			i := indexRR(rrset.rrs, deleteRR)
+			if i < 0 {
+				continue
+			}
+			if !rrset.owned {
+				return dns.RcodeRefused
+			}
+			rrset.rrs = append(rrset.rrs[:i], rrset.rrs[i+1:]...)
+			rrset.changed = true
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// rrsetsWithout returns the RRsets except the one with the given key.
+func rrsetsWithout(rrsets map[updateRRsetKey]*updateRRset, key updateRRsetKey) map[updateRRsetKey]*updateRRset {
+	filtered := make(map[updateRRsetKey]*updateRRset, len(rrsets))
+	for rrsetKey, rrset := range rrsets {
+		if rrsetKey != key {
+			filtered[rrsetKey] = rrset
+		}
+	}
+	return filtered
+}
+
+// constructUpdateRecords builds the DNSRecords of the changed RRsets. Returns the DNSRecords to create or update,
+// and the DNSRecords to delete, because their RRsets have become empty. The DNSRecords pass the same validation
+// as the DNSRecords created by hand.
+func constructUpdateRecords(dnsZone *monkalev1alpha1.DNSZone, rrsets map[updateRRsetKey]*updateRRset) ([]monkalev1alpha1.DNSRecord, []monkalev1alpha1.DNSRecord, error) {
+	zoneRef := types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace}
+	keys := make([]updateRRsetKey, 0, len(rrsets))
+	for key, rrset := range rrsets {
+		if rrset.owned && rrset.changed {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].rrtype < keys[j].rrtype
+	})
+
+	var upserts, deletes []monkalev1alpha1.DNSRecord
+	for _, key := range keys {
+		rrset := rrsets[key]
+		if len(rrset.rrs) == 0 {
+			if rrset.dnsRecord != nil {
+				deletes = append(deletes, *rrset.dnsRecord)
+			}
+			continue
+		}
+
+		recordType := dns.TypeToString[key.rrtype]
+		record := monkalev1alpha1.Record{Name: key.name, Type: recordType, TTL: strconv.FormatUint(uint64(rrset.ttl), 10)}
+		var values []string
+		for _, rr := range rrset.rrs {
+			values = append(values, render.RRData(rr))
+		}
+		if len(values) == 1 {
+			record.Value = values[0]
+		} else {
+			record.Values = values
+		}
+
+		var dnsRecord monkalev1alpha1.DNSRecord
+		if rrset.dnsRecord != nil {
+			dnsRecord = *rrset.dnsRecord.DeepCopy()
+		} else {
+			dnsRecord = monkalev1alpha1.DNSRecord{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        getSourceRecordName(monkalev1alpha1.SourceKindDNSUpdate, zoneRef, key.name, recordType),
+					Namespace:   dnsZone.Namespace,
+					Labels:      getSourceRecordLabels(monkalev1alpha1.SourceKindDNSUpdate, zoneRef),
+					Annotations: getSourceRecordAnnotations(zoneRef),
+				},
+				Spec: monkalev1alpha1.DNSRecordSpec{
+					DNSZoneRef: &corev1.ObjectReference{Name: dnsZone.Name},
+				},
+			}
+		}
+		dnsRecord.Spec.Record = &record
+
+		generatedRecord, err := render.ConstructRecord(dnsRecord)
+		if err != nil {
+			return nil, nil, fmt.Errorf("record %s %s: %v", key.name, recordType, err)
+		}
+		if err := render.ValidateRecords(generatedRecord); err != nil {
+			return nil, nil, fmt.Errorf("record %s %s: %v", key.name, recordType, err)
+		}
+		upserts = append(upserts, dnsRecord)
+	}
+	return upserts, deletes, nil
+}
+
+// getUpdateDNSZone returns the DNSZone serving the zone of the update message. The zone must be served by exactly one Primary DNSZone.
+// Returns the response code, RcodeNotAuth if the zone is not managed by a DNSZone.
+func getUpdateDNSZone(zone string, dnsZones []monkalev1alpha1.DNSZone) (*monkalev1alpha1.DNSZone, int) {
+	var match *monkalev1alpha1.DNSZone
+	for i := range dnsZones {
+		if strings.ToLower(monkalev1alpha1.EnsureFQDN(dnsZones[i].Spec.Domain)) != zone {
+			continue
+		}
+		if match != nil {
+			return nil, dns.RcodeRefused
+		}
+		match = &dnsZones[i]
+	}
+	if match == nil || match.Spec.Type == monkalev1alpha1.DNSZoneTypeSecondary {
+		return nil, dns.RcodeNotAuth
+	}
+	return match, dns.RcodeSuccess
+}
+
+// getUpdateDNSRecord returns the copy of the DNSRecord of the zone with the name, nil if the zone has no such DNSRecord.
+func getUpdateDNSRecord(zoneRecords *monkalev1alpha1.DNSRecordList, name string) *monkalev1alpha1.DNSRecord {
+	for i := range zoneRecords.Items {
+		if zoneRecords.Items[i].Name == name {
+			return zoneRecords.Items[i].DeepCopy()
+		}
+	}
+	return nil
+}
+
+// constructUpdateSOA builds the SOA record of the DNSZone out of the zone header, so the clients can find the zone of their names.
+func constructUpdateSOA(dnsZone *monkalev1alpha1.DNSZone) (*dns.SOA, error) {
+	serial := dnsZone.Status.CurrentZoneSerial
+	if serial == "" {
+		serial = "0"
+	}
+	zonefile, err := render.ConstructZoneFile(dnsZone, "", serial)
+	if err != nil {
+		return nil, err
+	}
+	zoneParser := dns.NewZoneParser(strings.NewReader(zonefile), monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain), "")
+	for rr, ok := zoneParser.Next(); ok; rr, ok = zoneParser.Next() {
+		if soa, isSOA := rr.(*dns.SOA); isSOA {
+			return soa, nil
+		}
+	}
+	if err := zoneParser.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse zone header: %v", err)
+	}
+	return nil, fmt.Errorf("zone header does not contain the SOA record")
+}
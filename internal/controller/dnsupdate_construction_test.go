@@ -0,0 +1,394 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+const updateTestZone = "example.org."
+
+// mustNewRR parses the record of the update message.
+func mustNewRR(s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		panic(err)
+	}
+	return rr
+}
+
+// emptyRR returns the record without rdata, used by the prerequisites and the deletions of RRsets and names.
+func emptyRR(name string, rrtype, class uint16) dns.RR {
+	return &dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: rrtype, Class: class}}
+}
+
+// updateTestRRsets returns the RRsets of the example.org zone: the www, txt and app RRsets are owned by the update server,
+// the mail RRset has been created by hand.
+func updateTestRRsets() map[updateRRsetKey]*updateRRset {
+	dnsZone := &monkalev1alpha1.DNSZone{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-org", Namespace: "default"},
+		Spec:       monkalev1alpha1.DNSZoneSpec{Domain: "example.org", TTL: 3600},
+	}
+	zoneRef := types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace}
+	dnsRecord := func(name string, owned bool, record monkalev1alpha1.Record) monkalev1alpha1.DNSRecord {
+		dnsRecord := monkalev1alpha1.DNSRecord{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: dnsZone.Namespace},
+			Spec:       monkalev1alpha1.DNSRecordSpec{DNSZoneRef: &corev1.ObjectReference{Name: dnsZone.Name}, Record: &record},
+		}
+		if owned {
+			dnsRecord.Labels = getSourceRecordLabels(monkalev1alpha1.SourceKindDNSUpdate, zoneRef)
+			dnsRecord.Annotations = getSourceRecordAnnotations(zoneRef)
+		}
+		return dnsRecord
+	}
+	return buildUpdateRRsets(dnsZone, &monkalev1alpha1.DNSRecordList{Items: []monkalev1alpha1.DNSRecord{
+		dnsRecord("www", true, monkalev1alpha1.Record{Name: "www", Type: "A", Value: "192.0.2.10"}),
+		dnsRecord("txt", true, monkalev1alpha1.Record{Name: "txt", Type: "TXT", Values: []string{"one", "two"}}),
+		dnsRecord("app", true, monkalev1alpha1.Record{Name: "app", Type: "CNAME", Value: "www"}),
+		dnsRecord("mail", false, monkalev1alpha1.Record{Name: "mail", Type: "A", Value: "192.0.2.25"}),
+	}})
+}
+
+// getUpdateRRsetValues returns the values of the non-empty RRsets keyed by the owner name and the record type.
+func getUpdateRRsetValues(rrsets map[updateRRsetKey]*updateRRset) map[string][]string {
+	values := make(map[string][]string)
+	for key, rrset := range rrsets {
+		for _, rr := range rrset.rrs {
+			values[key.name+" "+dns.TypeToString[key.rrtype]] = append(values[key.name+" "+dns.TypeToString[key.rrtype]], render.RRData(rr))
+		}
+	}
+	for _, rrsetValues := range values {
+		sort.Strings(rrsetValues)
+	}
+	return values
+}
+
+// getChangedUpdateRRsets returns the sorted keys of the changed RRsets.
+func getChangedUpdateRRsets(rrsets map[updateRRsetKey]*updateRRset) []string {
+	var changed []string
+	for key, rrset := range rrsets {
+		if rrset.changed {
+			changed = append(changed, key.name+" "+dns.TypeToString[key.rrtype])
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func TestCheckUpdatePrerequisites(t *testing.T) {
+	tests := []struct {
+		name          string
+		prerequisites []dns.RR
+		wantRcode     int
+	}{
+		{name: "no prerequisites", wantRcode: dns.RcodeSuccess},
+		{name: "RRset exists", prerequisites: []dns.RR{emptyRR("www.example.org.", dns.TypeA, dns.ClassANY)}, wantRcode: dns.RcodeSuccess},
+		{name: "RRset exists, not owned", prerequisites: []dns.RR{emptyRR("mail.example.org.", dns.TypeA, dns.ClassANY)}, wantRcode: dns.RcodeSuccess},
+		{name: "RRset exists, apex SOA", prerequisites: []dns.RR{emptyRR("example.org.", dns.TypeSOA, dns.ClassANY)}, wantRcode: dns.RcodeSuccess},
+		{name: "RRset exists, apex NS", prerequisites: []dns.RR{emptyRR("example.org.", dns.TypeNS, dns.ClassANY)}, wantRcode: dns.RcodeSuccess},
+		{name: "RRset exists, missing", prerequisites: []dns.RR{emptyRR("www.example.org.", dns.TypeAAAA, dns.ClassANY)}, wantRcode: dns.RcodeNXRrset},
+		{name: "RRset exists, case insensitive", prerequisites: []dns.RR{emptyRR("WWW.Example.org.", dns.TypeA, dns.ClassANY)}, wantRcode: dns.RcodeSuccess},
+		{name: "RRset does not exist", prerequisites: []dns.RR{emptyRR("www.example.org.", dns.TypeAAAA, dns.ClassNONE)}, wantRcode: dns.RcodeSuccess},
+		{name: "RRset does not exist, present", prerequisites: []dns.RR{emptyRR("www.example.org.", dns.TypeA, dns.ClassNONE)}, wantRcode: dns.RcodeYXRrset},
+		{name: "RRset does not exist, apex SOA", prerequisites: []dns.RR{emptyRR("example.org.", dns.TypeSOA, dns.ClassNONE)}, wantRcode: dns.RcodeYXRrset},
+		{name: "name is in use", prerequisites: []dns.RR{emptyRR("txt.example.org.", dns.TypeANY, dns.ClassANY)}, wantRcode: dns.RcodeSuccess},
+		{name: "name is in use, apex", prerequisites: []dns.RR{emptyRR("example.org.", dns.TypeANY, dns.ClassANY)}, wantRcode: dns.RcodeSuccess},
+		{name: "name is in use, unused", prerequisites: []dns.RR{emptyRR("new.example.org.", dns.TypeANY, dns.ClassANY)}, wantRcode: dns.RcodeNameError},
+		{name: "name is not in use", prerequisites: []dns.RR{emptyRR("new.example.org.", dns.TypeANY, dns.ClassNONE)}, wantRcode: dns.RcodeSuccess},
+		{name: "name is not in use, used", prerequisites: []dns.RR{emptyRR("app.example.org.", dns.TypeANY, dns.ClassNONE)}, wantRcode: dns.RcodeYXDomain},
+		{name: "name is not in use, apex", prerequisites: []dns.RR{emptyRR("example.org.", dns.TypeANY, dns.ClassNONE)}, wantRcode: dns.RcodeYXDomain},
+		{
+			name:          "value dependent, exact RRset",
+			prerequisites: []dns.RR{mustNewRR(`txt.example.org. 0 IN TXT "two"`), mustNewRR(`txt.example.org. 0 IN TXT "one"`)},
+			wantRcode:     dns.RcodeSuccess,
+		},
+		{
+			name:          "value dependent, subset of RRset",
+			prerequisites: []dns.RR{mustNewRR(`txt.example.org. 0 IN TXT "one"`)},
+			wantRcode:     dns.RcodeNXRrset,
+		},
+		{
+			name:          "value dependent, superset of RRset",
+			prerequisites: []dns.RR{mustNewRR(`txt.example.org. 0 IN TXT "one"`), mustNewRR(`txt.example.org. 0 IN TXT "two"`), mustNewRR(`txt.example.org. 0 IN TXT "three"`)},
+			wantRcode:     dns.RcodeNXRrset,
+		},
+		{name: "value dependent, other value", prerequisites: []dns.RR{mustNewRR("www.example.org. 0 IN A 192.0.2.11")}, wantRcode: dns.RcodeNXRrset},
+		{name: "value dependent, missing RRset", prerequisites: []dns.RR{mustNewRR("new.example.org. 0 IN A 192.0.2.11")}, wantRcode: dns.RcodeNXRrset},
+		{
+			name:          "all prerequisites must be satisfied",
+			prerequisites: []dns.RR{emptyRR("www.example.org.", dns.TypeA, dns.ClassANY), emptyRR("www.example.org.", dns.TypeA, dns.ClassNONE)},
+			wantRcode:     dns.RcodeYXRrset,
+		},
+		{name: "non-zero TTL", prerequisites: []dns.RR{mustNewRR("www.example.org. 300 IN A 192.0.2.10")}, wantRcode: dns.RcodeFormatError},
+		{
+			name:          "rdata with class ANY",
+			prerequisites: []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "www.example.org.", Rrtype: dns.TypeA, Class: dns.ClassANY, Rdlength: 4}}},
+			wantRcode:     dns.RcodeFormatError,
+		},
+		{name: "unknown class", prerequisites: []dns.RR{emptyRR("www.example.org.", dns.TypeA, dns.ClassCHAOS)}, wantRcode: dns.RcodeFormatError},
+		{name: "name outside of the zone", prerequisites: []dns.RR{emptyRR("www.example.com.", dns.TypeA, dns.ClassANY)}, wantRcode: dns.RcodeNotZone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkUpdatePrerequisites(updateTestZone, tt.prerequisites, updateTestRRsets()); got != tt.wantRcode {
+				t.Errorf("checkUpdatePrerequisites() = %s, want %s", dns.RcodeToString[got], dns.RcodeToString[tt.wantRcode])
+			}
+		})
+	}
+}
+
+func TestPrescanUpdates(t *testing.T) {
+	tests := []struct {
+		name      string
+		updates   []dns.RR
+		wantRcode int
+	}{
+		{name: "no updates", wantRcode: dns.RcodeSuccess},
+		{name: "add to an RRset", updates: []dns.RR{mustNewRR("www.example.org. 300 IN A 192.0.2.11")}, wantRcode: dns.RcodeSuccess},
+		{name: "delete an RRset", updates: []dns.RR{emptyRR("www.example.org.", dns.TypeA, dns.ClassANY)}, wantRcode: dns.RcodeSuccess},
+		{name: "delete all RRsets of a name", updates: []dns.RR{emptyRR("www.example.org.", dns.TypeANY, dns.ClassANY)}, wantRcode: dns.RcodeSuccess},
+		{name: "delete an RR from an RRset", updates: []dns.RR{mustNewRR("www.example.org. 0 NONE A 192.0.2.10")}, wantRcode: dns.RcodeSuccess},
+		{name: "add of type ANY", updates: []dns.RR{emptyRR("www.example.org.", dns.TypeANY, dns.ClassINET)}, wantRcode: dns.RcodeFormatError},
+		{name: "add of type AXFR", updates: []dns.RR{emptyRR("www.example.org.", dns.TypeAXFR, dns.ClassINET)}, wantRcode: dns.RcodeFormatError},
+		{name: "delete an RRset of type IXFR", updates: []dns.RR{emptyRR("www.example.org.", dns.TypeIXFR, dns.ClassANY)}, wantRcode: dns.RcodeFormatError},
+		{
+			name:      "delete an RRset with non-zero TTL",
+			updates:   []dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "www.example.org.", Rrtype: dns.TypeA, Class: dns.ClassANY, Ttl: 300}}},
+			wantRcode: dns.RcodeFormatError,
+		},
+		{
+			name:      "delete an RRset with rdata",
+			updates:   []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "www.example.org.", Rrtype: dns.TypeA, Class: dns.ClassANY, Rdlength: 4}}},
+			wantRcode: dns.RcodeFormatError,
+		},
+		{name: "delete an RR with non-zero TTL", updates: []dns.RR{mustNewRR("www.example.org. 300 NONE A 192.0.2.10")}, wantRcode: dns.RcodeFormatError},
+		{name: "delete an RR of type ANY", updates: []dns.RR{emptyRR("www.example.org.", dns.TypeANY, dns.ClassNONE)}, wantRcode: dns.RcodeFormatError},
+		{name: "unknown class", updates: []dns.RR{mustNewRR("www.example.org. 300 CH A 192.0.2.11")}, wantRcode: dns.RcodeFormatError},
+		{name: "name outside of the zone", updates: []dns.RR{mustNewRR("www.example.com. 300 IN A 192.0.2.11")}, wantRcode: dns.RcodeNotZone},
+		{
+			name:      "any malformed update fails the message",
+			updates:   []dns.RR{mustNewRR("www.example.org. 300 IN A 192.0.2.11"), emptyRR("www.example.org.", dns.TypeANY, dns.ClassINET)},
+			wantRcode: dns.RcodeFormatError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prescanUpdates(updateTestZone, tt.updates); got != tt.wantRcode {
+				t.Errorf("prescanUpdates() = %s, want %s", dns.RcodeToString[got], dns.RcodeToString[tt.wantRcode])
+			}
+		})
+	}
+}
+
+func TestApplyUpdates(t *testing.T) {
+	initialValues := getUpdateRRsetValues(updateTestRRsets())
+	withValues := func(changes map[string][]string) map[string][]string {
+		values := make(map[string][]string)
+		for key, rrsetValues := range initialValues {
+			values[key] = rrsetValues
+		}
+		for key, rrsetValues := range changes {
+			if rrsetValues == nil {
+				delete(values, key)
+			} else {
+				values[key] = rrsetValues
+			}
+		}
+		return values
+	}
+
+	tests := []struct {
+		name        string
+		updates     []dns.RR
+		wantRcode   int
+		wantValues  map[string][]string
+		wantChanged []string
+	}{
+		{
+			name:        "add a new RRset",
+			updates:     []dns.RR{mustNewRR("new.example.org. 300 IN A 192.0.2.20")},
+			wantRcode:   dns.RcodeSuccess,
+			wantValues:  withValues(map[string][]string{"new.example.org. A": {"192.0.2.20"}}),
+			wantChanged: []string{"new.example.org. A"},
+		},
+		{
+			name:        "add to an owned RRset",
+			updates:     []dns.RR{mustNewRR("WWW.example.org. 300 IN A 192.0.2.11")},
+			wantRcode:   dns.RcodeSuccess,
+			wantValues:  withValues(map[string][]string{"www.example.org. A": {"192.0.2.10", "192.0.2.11"}}),
+			wantChanged: []string{"www.example.org. A"},
+		},
+		{
+			name:        "add a duplicate RR",
+			updates:     []dns.RR{mustNewRR("www.example.org. 300 IN A 192.0.2.10")},
+			wantRcode:   dns.RcodeSuccess,
+			wantValues:  initialValues,
+			wantChanged: []string{"www.example.org. A"},
+		},
+		{
+			name:        "add several values to a TXT RRset",
+			updates:     []dns.RR{mustNewRR(`txt.example.org. 300 IN TXT "three"`), mustNewRR(`txt.example.org. 300 IN TXT "four"`)},
+			wantRcode:   dns.RcodeSuccess,
+			wantValues:  withValues(map[string][]string{"txt.example.org. TXT": {`"four"`, `"one"`, `"three"`, `"two"`}}),
+			wantChanged: []string{"txt.example.org. TXT"},
+		},
+		{
+			name:        "replace a CNAME",
+			updates:     []dns.RR{mustNewRR("app.example.org. 300 IN CNAME mail.example.org.")},
+			wantRcode:   dns.RcodeSuccess,
+			wantValues:  withValues(map[string][]string{"app.example.org. CNAME": {"mail.example.org."}}),
+			wantChanged: []string{"app.example.org. CNAME"},
+		},
+		{
+			name:       "ignore a CNAME of a name in use",
+			updates:    []dns.RR{mustNewRR("www.example.org. 300 IN CNAME mail.example.org.")},
+			wantRcode:  dns.RcodeSuccess,
+			wantValues: initialValues,
+		},
+		{
+			name:       "ignore other data of a CNAME",
+			updates:    []dns.RR{mustNewRR("app.example.org. 300 IN A 192.0.2.20")},
+			wantRcode:  dns.RcodeSuccess,
+			wantValues: initialValues,
+		},
+		{
+			name:       "ignore a SOA change",
+			updates:    []dns.RR{mustNewRR("example.org. 300 IN SOA ns2.example.org. admin.example.org. 2024010101 3600 600 86400 300")},
+			wantRcode:  dns.RcodeSuccess,
+			wantValues: initialValues,
+		},
+		{
+			name:       "ignore a SOA deletion",
+			updates:    []dns.RR{emptyRR("example.org.", dns.TypeSOA, dns.ClassANY)},
+			wantRcode:  dns.RcodeSuccess,
+			wantValues: initialValues,
+		},
+		{
+			name:       "ignore an apex NS addition",
+			updates:    []dns.RR{mustNewRR("example.org. 300 IN NS ns2.example.org.")},
+			wantRcode:  dns.RcodeSuccess,
+			wantValues: initialValues,
+		},
+		{
+			name:       "ignore an apex NS deletion",
+			updates:    []dns.RR{emptyRR("example.org.", dns.TypeNS, dns.ClassANY), mustNewRR("example.org. 0 NONE NS ns1.example.org.")},
+			wantRcode:  dns.RcodeSuccess,
+			wantValues: initialValues,
+		},
+		{
+			name:        "add a delegation NS",
+			updates:     []dns.RR{mustNewRR("sub.example.org. 300 IN NS ns1.sub.example.org.")},
+			wantRcode:   dns.RcodeSuccess,
+			wantValues:  withValues(map[string][]string{"sub.example.org. NS": {"ns1.sub.example.org."}}),
+			wantChanged: []string{"sub.example.org. NS"},
+		},
+		{
+			name:        "delete an RRset",
+			updates:     []dns.RR{emptyRR("www.example.org.", dns.TypeA, dns.ClassANY)},
+			wantRcode:   dns.RcodeSuccess,
+			wantValues:  withValues(map[string][]string{"www.example.org. A": nil}),
+			wantChanged: []string{"www.example.org. A"},
+		},
+		{
+			name:        "delete all RRsets of a name",
+			updates:     []dns.RR{emptyRR("txt.example.org.", dns.TypeANY, dns.ClassANY)},
+			wantRcode:   dns.RcodeSuccess,
+			wantValues:  withValues(map[string][]string{"txt.example.org. TXT": nil}),
+			wantChanged: []string{"txt.example.org. TXT"},
+		},
+		{
+			name:        "delete one value of a TXT RRset",
+			updates:     []dns.RR{mustNewRR(`txt.example.org. 0 NONE TXT "one"`)},
+			wantRcode:   dns.RcodeSuccess,
+			wantValues:  withValues(map[string][]string{"txt.example.org. TXT": {`"two"`}}),
+			wantChanged: []string{"txt.example.org. TXT"},
+		},
+		{
+			name:        "delete all values of a TXT RRset",
+			updates:     []dns.RR{mustNewRR(`txt.example.org. 0 NONE TXT "one"`), mustNewRR(`txt.example.org. 0 NONE TXT "two"`)},
+			wantRcode:   dns.RcodeSuccess,
+			wantValues:  withValues(map[string][]string{"txt.example.org. TXT": nil}),
+			wantChanged: []string{"txt.example.org. TXT"},
+		},
+		{
+			name:        "add and delete values of a TXT RRset",
+			updates:     []dns.RR{mustNewRR(`txt.example.org. 300 IN TXT "three"`), mustNewRR(`txt.example.org. 0 NONE TXT "one"`)},
+			wantRcode:   dns.RcodeSuccess,
+			wantValues:  withValues(map[string][]string{"txt.example.org. TXT": {`"three"`, `"two"`}}),
+			wantChanged: []string{"txt.example.org. TXT"},
+		},
+		{
+			name:       "ignore the deletion of a missing RR",
+			updates:    []dns.RR{mustNewRR(`txt.example.org. 0 NONE TXT "three"`), mustNewRR("new.example.org. 0 NONE A 192.0.2.20")},
+			wantRcode:  dns.RcodeSuccess,
+			wantValues: initialValues,
+		},
+		{
+			name:      "refuse an addition to an RRset not owned",
+			updates:   []dns.RR{mustNewRR("mail.example.org. 300 IN A 192.0.2.26")},
+			wantRcode: dns.RcodeRefused,
+		},
+		{
+			name:      "refuse the deletion of an RRset not owned",
+			updates:   []dns.RR{emptyRR("mail.example.org.", dns.TypeA, dns.ClassANY)},
+			wantRcode: dns.RcodeRefused,
+		},
+		{
+			name:      "refuse the deletion of an RR not owned",
+			updates:   []dns.RR{mustNewRR("mail.example.org. 0 NONE A 192.0.2.25")},
+			wantRcode: dns.RcodeRefused,
+		},
+		{
+			name:      "refuse an unsupported record type",
+			updates:   []dns.RR{mustNewRR("www.example.org. 300 IN DNSKEY 256 3 13 dGVzdA==")},
+			wantRcode: dns.RcodeRefused,
+		},
+		{
+			name:      "refuse a malformed update",
+			updates:   []dns.RR{mustNewRR("new.example.org. 300 IN A 192.0.2.20"), emptyRR("www.example.org.", dns.TypeANY, dns.ClassINET)},
+			wantRcode: dns.RcodeFormatError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrsets := updateTestRRsets()
+			got := applyUpdates(updateTestZone, tt.updates, rrsets)
+			if got != tt.wantRcode {
+				t.Fatalf("applyUpdates() = %s, want %s", dns.RcodeToString[got], dns.RcodeToString[tt.wantRcode])
+			}
+			if got != dns.RcodeSuccess {
+				return
+			}
+			if values := getUpdateRRsetValues(rrsets); !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("applyUpdates() RRsets = %v, want %v", values, tt.wantValues)
+			}
+			if changed := getChangedUpdateRRsets(rrsets); !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("applyUpdates() changed RRsets = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
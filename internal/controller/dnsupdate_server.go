@@ -0,0 +1,285 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+const (
+	dnsUpdateRequestTimeout time.Duration = 10 * time.Second // dnsUpdateRequestTimeout limits the kubernetes API calls of one update message
+	dnsUpdateTSIGFudge      uint16        = 300              // dnsUpdateTSIGFudge is the allowed time difference of the signed messages in seconds
+)
+
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnsrecords,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnszones,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// DNSUpdateServer is the DNS server accepting TSIG signed RFC 2136 dynamic updates of the DNSZones.
+// Every update is translated into DNSRecords labeled as owned by the server, so the records are validated and
+// rendered into the zone the same way as the DNSRecords created by hand.
+type DNSUpdateServer struct {
+	// Client is used to write DNSRecords.
+	Client client.Client
+	// APIReader reads DNSZones and DNSRecords bypassing the cache, so the update messages always see the result of the previous ones.
+	APIReader client.Reader
+	// Addr is the UDP and TCP address the server listens on.
+	Addr string
+	// TSIGSecret is the Secret with the TSIG key the update messages must be signed with.
+	TSIGSecret types.NamespacedName
+
+	// mu serializes the update messages. The server runs on the leader only, so the messages are serialized across the replicas.
+	mu sync.Mutex
+}
+
+// writtenUpdateRecord is the DNSRecord written by the update message, kept to roll the message back.
+type writtenUpdateRecord struct {
+	dnsRecord *monkalev1alpha1.DNSRecord // the DNSRecord as written to the API server
+	previous  *monkalev1alpha1.DNSRecord // the DNSRecord before the update message, nil if it has been created
+	deleted   bool
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. The server runs on the leader only,
+// since the update messages are checked against the DNSRecords and must not be applied by two replicas at once.
+func (s *DNSUpdateServer) NeedLeaderElection() bool {
+	return true
+}
+
+// Start implements manager.Runnable. It runs the UDP and TCP servers until the context is canceled.
+func (s *DNSUpdateServer) Start(ctx context.Context) error {
+	secret := &corev1.Secret{}
+	if err := s.APIReader.Get(ctx, s.TSIGSecret, secret); err != nil {
+		return fmt.Errorf("failed to get TSIG secret %s: %v", s.TSIGSecret, err)
+	}
+	key, err := render.GetTSIGKey(secret)
+	if err != nil {
+		return err
+	}
+
+	tsigSecret := map[string]string{key.Name: key.Secret}
+	servers := []*dns.Server{
+		{Addr: s.Addr, Net: "udp", Handler: dns.HandlerFunc(s.serveDNS), TsigSecret: tsigSecret, MsgAcceptFunc: acceptDNSUpdateMsg},
+		{Addr: s.Addr, Net: "tcp", Handler: dns.HandlerFunc(s.serveDNS), TsigSecret: tsigSecret, MsgAcceptFunc: acceptDNSUpdateMsg},
+	}
+	errChan := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *dns.Server) {
+			errChan <- server.ListenAndServe()
+		}(server)
+	}
+	log.Log.Info("DNSUpdate server. Listening", "Address", s.Addr, "TSIG.KeyName", key.Name)
+
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-errChan:
+		err = fmt.Errorf("dns update server failed: %v", err)
+	}
+	for _, server := range servers {
+		_ = server.Shutdown()
+	}
+	return err
+}
+
+// acceptDNSUpdateMsg accepts the update messages, which are rejected by the default accept function of miekg/dns.
+// The sections of the update messages can contain any number of records. Other messages are checked by the default function.
+func acceptDNSUpdateMsg(dh dns.Header) dns.MsgAcceptAction {
+	isResponse := dh.Bits&(1<<15) != 0
+	opcode := int(dh.Bits>>11) & 0xF
+	if isResponse || opcode != dns.OpcodeUpdate {
+		return dns.DefaultMsgAcceptFunc(dh)
+	}
+	if dh.Qdcount != 1 {
+		return dns.MsgReject
+	}
+	return dns.MsgAccept
+}
+
+// serveDNS handles the DNS message. All messages must be signed with the TSIG key.
+// Besides the updates, the server answers SOA queries for the zone apexes, since the clients use them to find the zone of the name.
+func (s *DNSUpdateServer) serveDNS(w dns.ResponseWriter, request *dns.Msg) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsUpdateRequestTimeout)
+	defer cancel()
+
+	response := new(dns.Msg)
+	response.SetReply(request)
+	tsig := request.IsTsig()
+	switch {
+	case tsig == nil:
+		response.Rcode = dns.RcodeRefused
+	case w.TsigStatus() != nil:
+		log.Log.Info("DNSUpdate server. TSIG verification failed", "Remote", w.RemoteAddr().String(), "Error", w.TsigStatus().Error())
+		response.Rcode = dns.RcodeNotAuth
+	case request.Opcode == dns.OpcodeUpdate:
+		response.Rcode = s.handleUpdate(ctx, request, w.RemoteAddr().String())
+	case request.Opcode == dns.OpcodeQuery:
+		s.handleQuery(ctx, request, response)
+	default:
+		response.Rcode = dns.RcodeNotImplemented
+	}
+	if tsig != nil && w.TsigStatus() == nil {
+		response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, dnsUpdateTSIGFudge, time.Now().Unix())
+	}
+	if err := w.WriteMsg(response); err != nil {
+		log.Log.Error(err, "DNSUpdate server. Failed to write response", "Remote", w.RemoteAddr().String())
+	}
+}
+
+// handleQuery answers the SOA query for the zone apex of the Primary DNSZone. Other queries are refused.
+func (s *DNSUpdateServer) handleQuery(ctx context.Context, request, response *dns.Msg) {
+	if len(request.Question) != 1 || request.Question[0].Qtype != dns.TypeSOA {
+		response.Rcode = dns.RcodeRefused
+		return
+	}
+	dnsZones := monkalev1alpha1.DNSZoneList{}
+	if err := s.APIReader.List(ctx, &dnsZones); err != nil {
+		log.Log.Error(err, "DNSUpdate server. Failed to list DNSZones")
+		response.Rcode = dns.RcodeServerFailure
+		return
+	}
+	dnsZone, rcode := getUpdateDNSZone(strings.ToLower(request.Question[0].Name), dnsZones.Items)
+	if rcode != dns.RcodeSuccess {
+		response.Rcode = dns.RcodeRefused
+		return
+	}
+	soa, err := constructUpdateSOA(dnsZone)
+	if err != nil {
+		log.Log.Error(err, "DNSUpdate server. Failed to construct SOA record", "DNSZone.Name", dnsZone.Name)
+		response.Rcode = dns.RcodeServerFailure
+		return
+	}
+	response.Authoritative = true
+	response.Answer = []dns.RR{soa}
+}
+
+// handleUpdate applies the update message to the DNSZone. The prerequisites and the updates are checked against
+// the DNSRecords of the zone first, then the DNSRecords are written. Returns the response code.
+func (s *DNSUpdateServer) handleUpdate(ctx context.Context, request *dns.Msg, remote string) int {
+	if len(request.Question) != 1 || request.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	zone := strings.ToLower(dns.Fqdn(request.Question[0].Name))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dnsZones := monkalev1alpha1.DNSZoneList{}
+	if err := s.APIReader.List(ctx, &dnsZones); err != nil {
+		log.Log.Error(err, "DNSUpdate server. Failed to list DNSZones")
+		return dns.RcodeServerFailure
+	}
+	dnsZone, rcode := getUpdateDNSZone(zone, dnsZones.Items)
+	if rcode != dns.RcodeSuccess {
+		log.Log.Info("DNSUpdate server. Update refused. Zone is not served by a Primary DNSZone", "Zone", zone, "Remote", remote)
+		return rcode
+	}
+	logKV := []interface{}{"DNSZone.Name", dnsZone.Name, "DNSZone.Namespace", dnsZone.Namespace, "Remote", remote}
+
+	zoneRecords, err := listDNSZoneRecords(ctx, s.APIReader, dnsZone)
+	if err != nil {
+		log.Log.Error(err, "DNSUpdate server. Failed to list DNSRecords", logKV...)
+		return dns.RcodeServerFailure
+	}
+	rrsets := buildUpdateRRsets(dnsZone, &zoneRecords)
+
+	if rcode := checkUpdatePrerequisites(zone, request.Answer, rrsets); rcode != dns.RcodeSuccess {
+		log.Log.Info("DNSUpdate server. Prerequisites are not satisfied", append(logKV, "Rcode", dns.RcodeToString[rcode])...)
+		return rcode
+	}
+	if rcode := applyUpdates(zone, request.Ns, rrsets); rcode != dns.RcodeSuccess {
+		log.Log.Info("DNSUpdate server. Update refused", append(logKV, "Rcode", dns.RcodeToString[rcode])...)
+		return rcode
+	}
+	upserts, deletes, err := constructUpdateRecords(dnsZone, rrsets)
+	if err != nil {
+		log.Log.Error(err, "DNSUpdate server. Update refused. Record validation failure", logKV...)
+		return dns.RcodeRefused
+	}
+
+	// The DNSRecords are written with the resource versions they have been checked with, so the DNSRecords changed
+	// in the meantime fail the update. The update message is applied entirely or not at all, the written DNSRecords are rolled back.
+	written := []writtenUpdateRecord{}
+	for i := range upserts {
+		dnsRecord := &upserts[i]
+		previous := getUpdateDNSRecord(&zoneRecords, dnsRecord.Name)
+		if dnsRecord.ResourceVersion == "" {
+			err = s.Client.Create(ctx, dnsRecord)
+		} else {
+			err = s.Client.Update(ctx, dnsRecord)
+		}
+		if err != nil {
+			log.Log.Error(err, "DNSUpdate server. Failed to write DNSRecord", append(logKV, "DNSRecord.Name", dnsRecord.Name)...)
+			s.rollbackUpdate(ctx, written, logKV)
+			return dns.RcodeServerFailure
+		}
+		written = append(written, writtenUpdateRecord{dnsRecord: dnsRecord, previous: previous})
+	}
+	for i := range deletes {
+		dnsRecord := &deletes[i]
+		if err := s.Client.Delete(ctx, dnsRecord, client.Preconditions{ResourceVersion: &dnsRecord.ResourceVersion}); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			log.Log.Error(err, "DNSUpdate server. Failed to delete DNSRecord", append(logKV, "DNSRecord.Name", dnsRecord.Name)...)
+			s.rollbackUpdate(ctx, written, logKV)
+			return dns.RcodeServerFailure
+		}
+		written = append(written, writtenUpdateRecord{dnsRecord: dnsRecord, previous: dnsRecord, deleted: true})
+	}
+	log.Log.Info("DNSUpdate server. Update applied", append(logKV, "Written", len(upserts), "Deleted", len(deletes))...)
+	return dns.RcodeSuccess
+}
+
+// rollbackUpdate restores the DNSRecords written by the failed update message in the reverse order:
+// the created DNSRecords are deleted, the updated ones get their previous spec and labels back, the deleted ones are created again.
+// The DNSRecords which can not be restored, e.g. the deleted ones whose finalizer has not been removed yet, are logged.
+func (s *DNSUpdateServer) rollbackUpdate(ctx context.Context, written []writtenUpdateRecord, logKV []interface{}) {
+	for i := len(written) - 1; i >= 0; i-- {
+		var err error
+		switch record := written[i]; {
+		case record.previous == nil:
+			err = s.Client.Delete(ctx, record.dnsRecord, client.Preconditions{ResourceVersion: &record.dnsRecord.ResourceVersion})
+		case record.deleted:
+			restored := record.previous.DeepCopy()
+			restored.ObjectMeta = metav1.ObjectMeta{Name: restored.Name, Namespace: restored.Namespace, Labels: restored.Labels, Annotations: restored.Annotations}
+			err = s.Client.Create(ctx, restored)
+		default:
+			restored := record.previous.DeepCopy()
+			restored.ResourceVersion = record.dnsRecord.ResourceVersion
+			err = s.Client.Update(ctx, restored)
+		}
+		if err != nil {
+			log.Log.Error(err, "DNSUpdate server. Failed to roll back DNSRecord", append(logKV, "DNSRecord.Name", written[i].dnsRecord.Name)...)
+		}
+	}
+	log.Log.Info("DNSUpdate server. Update rolled back", append(logKV, "DNSRecords", len(written))...)
+}
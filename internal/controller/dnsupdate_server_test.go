@@ -0,0 +1,295 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// failingClient fails the writes of the DNSRecord with the given name, so the update message is applied partially.
+type failingClient struct {
+	client.Client
+	failName string
+}
+
+func (c failingClient) fail(obj client.Object) error {
+	if obj.GetName() != c.failName {
+		return nil
+	}
+	return apierrors.NewServiceUnavailable(fmt.Sprintf("write of %s failed", obj.GetName()))
+}
+
+func (c failingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.fail(obj); err != nil {
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c failingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := c.fail(obj); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c failingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := c.fail(obj); err != nil {
+		return err
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+var _ = Describe("DNSUpdate server", func() {
+	const (
+		namespace  = "dnsupdate-server"
+		tsigName   = "update-key."
+		tsigSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LXNlY3JldA=="
+	)
+	ctx := context.Background()
+	zoneRef := types.NamespacedName{Name: "example-org", Namespace: namespace}
+	var server *DNSUpdateServer
+
+	updateMsg := func(updates ...dns.RR) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.SetUpdate(updateTestZone)
+		msg.Ns = updates
+		return msg
+	}
+	recordName := func(hostname, recordType string) string {
+		return getSourceRecordName(monkalev1alpha1.SourceKindDNSUpdate, zoneRef, hostname, recordType)
+	}
+	listOwnedRecords := func() map[string]monkalev1alpha1.Record {
+		dnsRecords := &monkalev1alpha1.DNSRecordList{}
+		Expect(k8sClient.List(ctx, dnsRecords, client.InNamespace(namespace),
+			client.MatchingLabels{monkalev1alpha1.SourceKindLabel: monkalev1alpha1.SourceKindDNSUpdate})).To(Succeed())
+		records := make(map[string]monkalev1alpha1.Record)
+		for _, dnsRecord := range dnsRecords.Items {
+			Expect(dnsRecord.Annotations).To(HaveKeyWithValue(monkalev1alpha1.SourceNameAnnotation, zoneRef.Name))
+			records[dnsRecord.Name] = *dnsRecord.Spec.Record
+		}
+		return records
+	}
+
+	BeforeEach(func() {
+		server = &DNSUpdateServer{Client: k8sClient, APIReader: k8sClient, TSIGSecret: types.NamespacedName{Name: "tsig", Namespace: namespace}}
+
+		err := k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			Expect(err).NotTo(HaveOccurred())
+		}
+		dnsZone := &monkalev1alpha1.DNSZone{
+			ObjectMeta: metav1.ObjectMeta{Name: zoneRef.Name, Namespace: namespace},
+			Spec: monkalev1alpha1.DNSZoneSpec{
+				Domain:          "example.org",
+				PrimaryNS:       &monkalev1alpha1.PrimaryNS{Hostname: "ns1", IPAddress: "192.0.2.1", RecordType: "A"},
+				RespPersonEmail: "admin@example.org",
+				TTL:             3600,
+				ConnectorName:   "coredns",
+			},
+		}
+		Expect(k8sClient.Create(ctx, dnsZone)).To(Succeed())
+		handmade := &monkalev1alpha1.DNSRecord{
+			ObjectMeta: metav1.ObjectMeta{Name: "mail", Namespace: namespace},
+			Spec: monkalev1alpha1.DNSRecordSpec{
+				DNSZoneRef: &corev1.ObjectReference{Name: zoneRef.Name},
+				Record:     &monkalev1alpha1.Record{Name: "mail", Type: "A", Value: "192.0.2.25"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, handmade)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.DeleteAllOf(ctx, &monkalev1alpha1.DNSRecord{}, client.InNamespace(namespace))).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &monkalev1alpha1.DNSZone{}, client.InNamespace(namespace))).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &corev1.Secret{}, client.InNamespace(namespace))).To(Succeed())
+	})
+
+	It("refuses the updates of the zones not served by a DNSZone", func() {
+		msg := new(dns.Msg)
+		msg.SetUpdate("example.com.")
+		msg.Insert([]dns.RR{mustNewRR("www.example.com. 300 IN A 192.0.2.10")})
+		Expect(server.handleUpdate(ctx, msg, "test")).To(Equal(dns.RcodeNotAuth))
+		Expect(listOwnedRecords()).To(BeEmpty())
+	})
+
+	It("applies the update message entirely or not at all", func() {
+		By("applying the update message")
+		Expect(server.handleUpdate(ctx, updateMsg(
+			mustNewRR("www.example.org. 300 IN A 192.0.2.10"),
+			mustNewRR(`txt.example.org. 300 IN TXT "one"`),
+			mustNewRR("deleted.example.org. 300 IN A 192.0.2.30"),
+			mustNewRR("failing.example.org. 300 IN A 192.0.2.31"),
+		), "test")).To(Equal(dns.RcodeSuccess))
+		initial := listOwnedRecords()
+		Expect(initial).To(Equal(map[string]monkalev1alpha1.Record{
+			recordName("www.example.org.", "A"):     {Name: "www.example.org.", Type: "A", TTL: "300", Value: "192.0.2.10"},
+			recordName("txt.example.org.", "TXT"):   {Name: "txt.example.org.", Type: "TXT", TTL: "300", Value: `"one"`},
+			recordName("deleted.example.org.", "A"): {Name: "deleted.example.org.", Type: "A", TTL: "300", Value: "192.0.2.30"},
+			recordName("failing.example.org.", "A"): {Name: "failing.example.org.", Type: "A", TTL: "300", Value: "192.0.2.31"},
+		}))
+
+		By("refusing the update message with unsatisfied prerequisites")
+		msg := updateMsg(mustNewRR("www.example.org. 300 IN A 192.0.2.11"))
+		msg.Answer = []dns.RR{emptyRR("new.example.org.", dns.TypeA, dns.ClassANY)}
+		Expect(server.handleUpdate(ctx, msg, "test")).To(Equal(dns.RcodeNXRrset))
+		Expect(listOwnedRecords()).To(Equal(initial))
+
+		By("refusing the update message changing the DNSRecord created by hand")
+		Expect(server.handleUpdate(ctx, updateMsg(
+			mustNewRR("www.example.org. 300 IN A 192.0.2.11"),
+			emptyRR("mail.example.org.", dns.TypeA, dns.ClassANY),
+		), "test")).To(Equal(dns.RcodeRefused))
+		Expect(listOwnedRecords()).To(Equal(initial))
+
+		By("rolling back the partially applied update message")
+		// the DNSRecords are written in the order of the names: new is created, txt and www are updated,
+		// deleted is deleted, then the deletion of failing fails
+		server.Client = failingClient{Client: k8sClient, failName: recordName("failing.example.org.", "A")}
+		Expect(server.handleUpdate(ctx, updateMsg(
+			mustNewRR("www.example.org. 300 IN A 192.0.2.11"),
+			mustNewRR(`txt.example.org. 300 IN TXT "two"`),
+			mustNewRR("new.example.org. 300 IN A 192.0.2.20"),
+			emptyRR("deleted.example.org.", dns.TypeANY, dns.ClassANY),
+			emptyRR("failing.example.org.", dns.TypeANY, dns.ClassANY),
+		), "test")).To(Equal(dns.RcodeServerFailure))
+		Expect(listOwnedRecords()).To(Equal(initial))
+
+		By("applying the same update message once the writes succeed")
+		server.Client = k8sClient
+		Expect(server.handleUpdate(ctx, updateMsg(
+			mustNewRR("www.example.org. 300 IN A 192.0.2.11"),
+			mustNewRR(`txt.example.org. 300 IN TXT "two"`),
+			mustNewRR("new.example.org. 300 IN A 192.0.2.20"),
+			emptyRR("deleted.example.org.", dns.TypeANY, dns.ClassANY),
+			emptyRR("failing.example.org.", dns.TypeANY, dns.ClassANY),
+		), "test")).To(Equal(dns.RcodeSuccess))
+		Expect(listOwnedRecords()).To(Equal(map[string]monkalev1alpha1.Record{
+			recordName("www.example.org.", "A"):   {Name: "www.example.org.", Type: "A", TTL: "300", Values: []string{"192.0.2.10", "192.0.2.11"}},
+			recordName("txt.example.org.", "TXT"): {Name: "txt.example.org.", Type: "TXT", TTL: "300", Values: []string{`"one"`, `"two"`}},
+			recordName("new.example.org.", "A"):   {Name: "new.example.org.", Type: "A", TTL: "300", Value: "192.0.2.20"},
+		}))
+	})
+
+	Context("when the server is running", func() {
+		var addr string
+		var cancel context.CancelFunc
+		var done chan error
+
+		exchange := func(msg *dns.Msg, keyName, secret string) *dns.Msg {
+			dnsClient := &dns.Client{Net: "tcp", Timeout: 2 * time.Second}
+			if keyName != "" {
+				dnsClient.TsigSecret = map[string]string{keyName: secret}
+				msg.SetTsig(keyName, dns.HmacSHA256, dnsUpdateTSIGFudge, time.Now().Unix())
+			}
+			response, _, err := dnsClient.Exchange(msg, addr)
+			Expect(err).NotTo(HaveOccurred())
+			return response
+		}
+
+		BeforeEach(func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: server.TSIGSecret.Name, Namespace: namespace},
+				Data: map[string][]byte{
+					monkalev1alpha1.TSIGSecretKeyName:   []byte(tsigName),
+					monkalev1alpha1.TSIGSecretKeySecret: []byte(tsigSecret),
+				},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			addr = listener.Addr().String()
+			Expect(listener.Close()).To(Succeed())
+			server.Addr = addr
+
+			var serverCtx context.Context
+			serverCtx, cancel = context.WithCancel(ctx)
+			done = make(chan error, 1)
+			go func() {
+				defer GinkgoRecover()
+				done <- server.Start(serverCtx)
+			}()
+
+			// the SOA query of the zone apex is answered once the server listens
+			Eventually(func() error {
+				msg := new(dns.Msg)
+				msg.SetQuestion(updateTestZone, dns.TypeSOA)
+				msg.SetTsig(tsigName, dns.HmacSHA256, dnsUpdateTSIGFudge, time.Now().Unix())
+				dnsClient := &dns.Client{Net: "tcp", Timeout: time.Second, TsigSecret: map[string]string{tsigName: tsigSecret}}
+				_, _, err := dnsClient.Exchange(msg, addr)
+				return err
+			}, 10*time.Second, 100*time.Millisecond).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			cancel()
+			Eventually(done, 10*time.Second).Should(Receive(BeNil()))
+		})
+
+		It("answers the SOA query of the zone apex", func() {
+			msg := new(dns.Msg)
+			msg.SetQuestion(updateTestZone, dns.TypeSOA)
+			response := exchange(msg, tsigName, tsigSecret)
+			Expect(response.Rcode).To(Equal(dns.RcodeSuccess))
+			Expect(response.Answer).To(HaveLen(1))
+			Expect(response.Answer[0].(*dns.SOA).Ns).To(Equal("ns1.example.org."))
+		})
+
+		It("refuses the messages which are not signed with the TSIG key", func() {
+			update := func() *dns.Msg {
+				return updateMsg(mustNewRR("www.example.org. 300 IN A 192.0.2.10"))
+			}
+
+			By("refusing the unsigned update message")
+			Expect(exchange(update(), "", "").Rcode).To(Equal(dns.RcodeRefused))
+
+			By("refusing the update message signed with an unknown key")
+			Expect(exchange(update(), "other-key.", tsigSecret).Rcode).To(Equal(dns.RcodeNotAuth))
+
+			By("refusing the update message signed with a wrong secret")
+			Expect(exchange(update(), tsigName, "d3Jvbmctc2VjcmV0").Rcode).To(Equal(dns.RcodeNotAuth))
+
+			By("refusing the unsigned SOA query")
+			msg := new(dns.Msg)
+			msg.SetQuestion(updateTestZone, dns.TypeSOA)
+			Expect(exchange(msg, "", "").Rcode).To(Equal(dns.RcodeRefused))
+			Expect(listOwnedRecords()).To(BeEmpty())
+
+			By("applying the update message signed with the TSIG key")
+			response := exchange(update(), tsigName, tsigSecret)
+			Expect(response.Rcode).To(Equal(dns.RcodeSuccess))
+			Expect(response.IsTsig()).NotTo(BeNil())
+			Expect(listOwnedRecords()).To(HaveKey(recordName("www.example.org.", "A")))
+		})
+	})
+})
@@ -1,104 +1,31 @@
 package controller
 
 import (
-	"bytes"
 	"context"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"sort"
+	"strconv"
 	"strings"
-	"text/template"
+	"time"
 
+	"github.com/miekg/dns"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
 )
 
-// bakedRecords represents the records that are members of the Zonefile.
-type bakedRecords struct {
-	count         int
-	recordsString string
-}
-
-// constructZoneFile - constructs and validates Zone.
-func constructZoneFile(dnsZone *monkalev1alpha1.DNSZone, records string, serialNumber string) (string, error) {
-	var newZoneHeader string
-	newZoneHeaderValues := monkalev1alpha1.DNSZoneHeader{
-		DomainName:        monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain),
-		PrimaryNSHostname: dnsZone.Spec.PrimaryNS.Hostname,
-		PrimaryNSIp:       dnsZone.Spec.PrimaryNS.IPAddress,
-		PrimaryNSType:     dnsZone.Spec.PrimaryNS.RecordType,
-		RespPerson:        dnsZone.Spec.RespPersonEmail,
-		ZoneTTL:           dnsZone.Spec.TTL,
-		Serial:            serialNumber,
-		Refresh:           dnsZone.Spec.RefreshRate,
-		Retry:             dnsZone.Spec.RetryInterval,
-		Expire:            dnsZone.Spec.ExpireTime,
-		MinimumTTL:        dnsZone.Spec.MinimumTTL,
-	}
-	newZoneHeader, err := templateZoneHeader(newZoneHeaderValues)
-	if err != nil {
-		return "", fmt.Errorf("unable to template the zoneHeader: %v", err)
-	}
-	zonefileContent := newZoneHeader + records
-	return zonefileContent, nil
-}
-
-// constructZoneConfigMap constructs config map for the Zone
-func constructZoneConfigMap(cmObj string, dnsZone *monkalev1alpha1.DNSZone, zonefileContent string, upcomingCMAnnotations map[string]string) (corev1.ConfigMap, error) {
-	cm := corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        cmObj,
-			Namespace:   dnsZone.ObjectMeta.Namespace,
-			Labels:      map[string]string{"app": "coredns-addon-operator"},
-			Annotations: upcomingCMAnnotations,
-			OwnerReferences: []metav1.OwnerReference{
-				{
-					APIVersion: dnsZone.APIVersion,
-					Kind:       dnsZone.Kind,
-					Name:       dnsZone.Name,
-					UID:        dnsZone.UID,
-				},
-			},
-		},
-		Data: map[string]string{
-			monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain) + "zone": zonefileContent,
-		},
-	}
-	return cm, nil
-}
-
-// templateZoneHeader builds Zone header: SOA and first NS A record
-func templateZoneHeader(header monkalev1alpha1.DNSZoneHeader) (string, error) {
-	zoneTmpl := `$ORIGIN {{.DomainName}}
-$TTL {{ .ZoneTTL }}s
-@ IN SOA {{.PrimaryNSHostname}}.{{.DomainName}} {{.RespPerson}}. (
-	{{.Serial}}     ; Serial
-	{{.Refresh}}    ; Refresh
-	{{.Retry}}      ; Retry
-	{{.Expire}}     ; Expire
-	{{.MinimumTTL}} ; Minimum TTL
-)
-@ IN NS {{.PrimaryNSHostname}}.{{.DomainName}}
-{{.PrimaryNSHostname}} IN {{.PrimaryNSType}} {{.PrimaryNSIp}}
-`
-	tmpl, err := template.New("HEADER").Parse(zoneTmpl)
-	if err != nil {
-		return "", fmt.Errorf("could not template SOA or NS: %v", err)
-	}
+const maxLintFindings = 50 // maxLintFindings is the number of the lint findings listed in the DNSZone status
 
-	var result bytes.Buffer
-	if err := tmpl.Execute(&result, header); err != nil {
-		return "", fmt.Errorf("could not template SOA or NS: %v", err)
-	}
-	zoneHeader := result.String()
-	return zoneHeader, nil
-}
-
-// getGoodDnsRecords fetches all DNSRecords. fails if bad records found
-func (r *DNSZoneReconciler) getGoodDnsRecords(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone) (monkalev1alpha1.DNSRecordList, error) {
+// getDnsRecords fetches all DNSRecords of the DNSZone.
+func (r *DNSZoneReconciler) getDnsRecords(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone) (*monkalev1alpha1.DNSRecordList, error) {
 	records := &monkalev1alpha1.DNSRecordList{}
 	// list all DNSRecord with the same DNSZone.
 	fieldSelector := fields.OneTermEqualSelector(monkalev1alpha1.DnsRecordIndex, dnsZone.Name)
@@ -107,7 +34,16 @@ func (r *DNSZoneReconciler) getGoodDnsRecords(ctx context.Context, dnsZone *monk
 		Namespace:     dnsZone.Namespace,
 	}
 	if err := r.List(ctx, records, listOps); err != nil {
-		return monkalev1alpha1.DNSRecordList{}, fmt.Errorf("could not list DNSRecords: %v", err)
+		return nil, fmt.Errorf("could not list DNSRecords: %v", err)
+	}
+	return records, nil
+}
+
+// getGoodDnsRecords fetches all DNSRecords. fails if bad records found
+func (r *DNSZoneReconciler) getGoodDnsRecords(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone) (monkalev1alpha1.DNSRecordList, error) {
+	records, err := r.getDnsRecords(ctx, dnsZone)
+	if err != nil {
+		return monkalev1alpha1.DNSRecordList{}, err
 	}
 
 	// get only good records
@@ -126,21 +62,251 @@ func (r *DNSZoneReconciler) getGoodDnsRecords(ctx context.Context, dnsZone *monk
 	return goodRecords, nil
 }
 
-// bakeRecords bakes DNSRecords into the single Zone file compatible string.
-func bakeRecords(dnsRecords monkalev1alpha1.DNSRecordList) (bakedRecords, error) {
-	records := dnsRecords.Items
-	var sb strings.Builder
-	for i, record := range records {
-		sb.WriteString(record.Status.GeneratedRecord)
-		if i < len(records)-1 {
-			sb.WriteString("\n")
+// countPendingDNSRecords counts the DNSRecords changed since they have joined the zone.
+// The DNSRecord is not pending if its current generation has joined the zone, or has failed the validation.
+func countPendingDNSRecords(dnsRecords *monkalev1alpha1.DNSRecordList) int {
+	pendingRecords := 0
+	for _, dnsRecord := range dnsRecords.Items {
+		cond := meta.FindStatusCondition(dnsRecord.Status.Conditions, monkalev1alpha1.ConditionRecordTypeReady)
+		if cond != nil && cond.ObservedGeneration == dnsRecord.Generation && (cond.Reason == monkalev1alpha1.ConditionReasonRecordReady || cond.Reason == monkalev1alpha1.ConditionReasonRecordDegraded) {
+			continue
 		}
+		pendingRecords++
+	}
+	return pendingRecords
+}
+
+// deferZoneRender records the pending changes of the DNSZone, and returns how long the zone render is deferred,
+// so the DNSRecord changes arriving within spec.minRenderInterval since the first of them are rendered together.
+func deferZoneRender(dnsZone *monkalev1alpha1.DNSZone, pendingChanges int, now time.Time) time.Duration {
+	interval := time.Duration(dnsZone.Spec.MinRenderInterval) * time.Second
+	if pendingChanges == 0 || interval <= 0 {
+		return 0
 	}
-	linesCount := len(strings.Split(sb.String(), "\n"))
-	corednsEntries := bakedRecords{
-		count:         linesCount,
-		recordsString: sb.String(),
+	if dnsZone.Status.PendingSince == nil {
+		dnsZone.Status.PendingSince = &metav1.Time{Time: now}
 	}
+	dnsZone.Status.PendingChanges = pendingChanges
+	return dnsZone.Status.PendingSince.Add(interval).Sub(now)
+}
+
+// reverseNetwork represents the network from spec.reverseZones and its companion reverse DNSZone.
+type reverseNetwork struct {
+	cidr     string
+	network  *net.IPNet
+	domain   string // in-addr.arpa or ip6.arpa domain of the network
+	zoneName string // name of the companion DNSZone
+}
 
-	return corednsEntries, nil
+// getReverseNetwork parses the network from spec.reverseZones. The network must be aligned to the labels of
+// the reverse domain: IPv4 prefix length must be a multiple of 8, IPv6 prefix length must be a multiple of 4.
+func getReverseNetwork(dnsZone *monkalev1alpha1.DNSZone, cidr string) (reverseNetwork, error) {
+	_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil {
+		return reverseNetwork{}, fmt.Errorf("bad network %q: %v", cidr, err)
+	}
+	ones, bits := network.Mask.Size()
+	labelBits := 8
+	if bits == 128 {
+		labelBits = 4
+	}
+	if ones == 0 || ones == bits || ones%labelBits != 0 {
+		return reverseNetwork{}, fmt.Errorf("bad network %q: prefix length must be a multiple of %d between %d and %d", cidr, labelBits, labelBits, bits-labelBits)
+	}
+	reverseAddr, err := dns.ReverseAddr(network.IP.String())
+	if err != nil {
+		return reverseNetwork{}, fmt.Errorf("bad network %q: %v", cidr, err)
+	}
+	// drop the labels of the host part
+	labels := dns.SplitDomainName(reverseAddr)
+	domain := strings.Join(labels[(bits-ones)/labelBits:], ".")
+	return reverseNetwork{
+		cidr:     cidr,
+		network:  network,
+		domain:   domain,
+		zoneName: dnsZone.Name + "-" + strings.ReplaceAll(domain, ".", "-"),
+	}, nil
+}
+
+// constructReverseZone constructs the companion reverse DNSZone. SOA and NS settings are inherited from the forward DNSZone.
+// The primary name server of the forward zone is named absolute, so the reverse zone has no address record of it.
+func constructReverseZone(dnsZone *monkalev1alpha1.DNSZone, network reverseNetwork) monkalev1alpha1.DNSZone {
+	primaryNS := *dnsZone.Spec.PrimaryNS
+	primaryNS.Hostname = render.GetPrimaryNSName(dnsZone)
+	return monkalev1alpha1.DNSZone{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      network.zoneName,
+			Namespace: dnsZone.Namespace,
+			Labels:    map[string]string{monkalev1alpha1.DnsZoneReverseOfLabel: dnsZone.Name},
+		},
+		Spec: monkalev1alpha1.DNSZoneSpec{
+			CMPrefix:        dnsZone.Spec.CMPrefix,
+			Domain:          network.domain,
+			PrimaryNS:       &primaryNS,
+			RespPersonEmail: dnsZone.Spec.RespPersonEmail,
+			TTL:             dnsZone.Spec.TTL,
+			RefreshRate:     dnsZone.Spec.RefreshRate,
+			RetryInterval:   dnsZone.Spec.RetryInterval,
+			ExpireTime:      dnsZone.Spec.ExpireTime,
+			MinimumTTL:      dnsZone.Spec.MinimumTTL,
+			SerialStrategy:  dnsZone.Spec.SerialStrategy,
+			ConnectorName:   dnsZone.Spec.ConnectorName,
+		},
+	}
+}
+
+// getRecordFQDN returns the fully qualified owner name of the record in the zone.
+func getRecordFQDN(name, domain string) string {
+	switch {
+	case name == "" || name == "@":
+		return monkalev1alpha1.EnsureFQDN(domain)
+	case dns.IsFqdn(name):
+		return name
+	default:
+		return name + "." + monkalev1alpha1.EnsureFQDN(domain)
+	}
+}
+
+// constructPTRRecords derives PTR DNSRecords from the A and AAAA DNSRecords of the forward zone.
+// All hostnames of the address form one PTR RRset, with the lowest TTL of the forward records.
+// Wildcard records are skipped. Returns the PTR DNSRecords and the number of them per reverse network.
+func constructPTRRecords(dnsZone *monkalev1alpha1.DNSZone, networks []reverseNetwork, dnsRecords monkalev1alpha1.DNSRecordList) ([]monkalev1alpha1.DNSRecord, map[string]int) {
+	type ptrKey struct {
+		zoneName string
+		ip       string
+	}
+	type ptrSet struct {
+		ip        net.IP
+		hostnames map[string]bool
+		ttl       string
+	}
+	ptrSets := map[ptrKey]*ptrSet{}
+	for _, dnsRecord := range dnsRecords.Items {
+		record := dnsRecord.Spec.Record
+		if record == nil || (record.Type != "A" && record.Type != "AAAA") || strings.Contains(record.Name, "*") {
+			continue
+		}
+		hostname := strings.ToLower(getRecordFQDN(record.Name, dnsZone.Spec.Domain))
+		values := record.Values
+		if record.Value != "" {
+			values = append([]string{record.Value}, values...)
+		}
+		for _, value := range values {
+			ip := net.ParseIP(strings.TrimSpace(value))
+			if ip == nil {
+				continue
+			}
+			for _, network := range networks {
+				if !network.network.Contains(ip) {
+					continue
+				}
+				key := ptrKey{zoneName: network.zoneName, ip: ip.String()}
+				set, ok := ptrSets[key]
+				if !ok {
+					set = &ptrSet{ip: ip, hostnames: map[string]bool{}, ttl: record.TTL}
+					ptrSets[key] = set
+				}
+				set.hostnames[hostname] = true
+				if set.ttl != "" && (record.TTL == "" || ttlLess(record.TTL, set.ttl)) {
+					set.ttl = record.TTL
+				}
+			}
+		}
+	}
+
+	forwardObj := types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace}
+	counts := map[string]int{}
+	var ptrRecords []monkalev1alpha1.DNSRecord
+	for key, set := range ptrSets {
+		reverseAddr, err := dns.ReverseAddr(key.ip)
+		if err != nil {
+			continue
+		}
+		var hostnames []string
+		for hostname := range set.hostnames {
+			hostnames = append(hostnames, hostname)
+		}
+		sort.Strings(hostnames)
+		record := monkalev1alpha1.Record{Name: reverseAddr, Type: "PTR", TTL: set.ttl}
+		if len(hostnames) == 1 {
+			record.Value = hostnames[0]
+		} else {
+			record.Values = hostnames
+		}
+		ipName := strings.ReplaceAll(key.ip, ".", "-")
+		if set.ip.To4() == nil {
+			ipName = hex.EncodeToString(set.ip.To16())
+		}
+		ptrRecords = append(ptrRecords, monkalev1alpha1.DNSRecord{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        key.zoneName + "-" + ipName,
+				Namespace:   dnsZone.Namespace,
+				Labels:      getSourceRecordLabels(monkalev1alpha1.SourceKindDNSZone, forwardObj),
+				Annotations: getSourceRecordAnnotations(forwardObj),
+			},
+			Spec: monkalev1alpha1.DNSRecordSpec{
+				Record:     &record,
+				DNSZoneRef: &corev1.ObjectReference{Name: key.zoneName},
+			},
+		})
+		counts[key.zoneName]++
+	}
+	sort.Slice(ptrRecords, func(i, j int) bool {
+		return ptrRecords[i].Name < ptrRecords[j].Name
+	})
+	return ptrRecords, counts
+}
+
+// ttlLess compares two TTLs. Unparsable TTLs are considered greater.
+func ttlLess(ttl1, ttl2 string) bool {
+	t1, err1 := strconv.ParseUint(ttl1, 10, 32)
+	t2, err2 := strconv.ParseUint(ttl2, 10, 32)
+	if err1 != nil {
+		return false
+	}
+	return err2 != nil || t1 < t2
+}
+
+// getLintBlockedRequeueAfter returns the time to lint the zone blocked by the lint findings again, the retry interval of the zone.
+func getLintBlockedRequeueAfter(dnsZone *monkalev1alpha1.DNSZone) time.Duration {
+	requeueAfter := time.Duration(dnsZone.Spec.RetryInterval) * time.Second
+	if requeueAfter < time.Minute {
+		requeueAfter = time.Minute
+	}
+	return requeueAfter
+}
+
+// setDnsZoneLintResult reports the lint findings in status.lintFindings and in the Linted condition.
+// The DNSRecords excluded for the findings blocking publishing do not block the other records of the zone.
+func setDnsZoneLintResult(dnsZone *monkalev1alpha1.DNSZone, findings []monkalev1alpha1.LintFinding, blocking int, excluded int) {
+	status := metav1.ConditionTrue
+	reason := monkalev1alpha1.ConditionReasonLintPassed
+	message := "No lint findings"
+	if len(findings) > 0 {
+		reason = monkalev1alpha1.ConditionReasonLintFindings
+		message = fmt.Sprintf("%s. Publishing is not blocked", render.SummarizeLintFindings(findings))
+	}
+	if excluded > 0 {
+		message = fmt.Sprintf("%s. %d DNSRecords involved in the findings blocking publishing have been excluded from the zone", render.SummarizeLintFindings(findings), excluded)
+	}
+	if blocking > 0 {
+		status = metav1.ConditionFalse
+		reason = monkalev1alpha1.ConditionReasonLintBlocked
+		message = fmt.Sprintf("%s. %d of them block publishing, the previous version of the zone is preserved", render.SummarizeLintFindings(findings), blocking)
+	}
+
+	dnsZone.Status.LintFindings = nil
+	if len(findings) > maxLintFindings {
+		dnsZone.Status.LintFindings = findings[:maxLintFindings]
+	} else if len(findings) > 0 {
+		dnsZone.Status.LintFindings = findings
+	}
+	meta.SetStatusCondition(&dnsZone.Status.Conditions, metav1.Condition{
+		Type:               monkalev1alpha1.ConditionZoneTypeLinted,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: dnsZone.Generation,
+	})
 }
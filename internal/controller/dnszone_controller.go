@@ -19,6 +19,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,12 +34,14 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
 )
 
 // DNSZoneReconciler reconciles a DNSZone object
@@ -49,6 +52,7 @@ type DNSZoneReconciler struct {
 
 //+kubebuilder:rbac:groups=monkale.monkale.io,resources=dnszones,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=monkale.monkale.io,resources=dnszones/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=monkale.monkale.io,resources=dnszones/finalizers,verbs=update
 
@@ -157,10 +161,30 @@ func (r *DNSZoneReconciler) reconcileDelete(ctx context.Context, dnsZone *monkal
 // reconcileCreateOrUpdate reconciles if DNSZone resource has been created or updated
 func (r *DNSZoneReconciler) reconcileCreateOrUpdate(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone) (ctrl.Result, error) {
 	_ = log.FromContext(ctx)
+	// Secondary zones are transferred from the primaries, there is nothing to generate.
+	if dnsZone.Spec.Type == monkalev1alpha1.DNSZoneTypeSecondary {
+		return r.reconcileSecondary(ctx, dnsZone)
+	}
+	previousState := dnsZone.DeepCopy()
+
+	// Coalesce the DNSRecord changes arriving within spec.minRenderInterval into one zone render.
+	allDnsRecords, err := r.getDnsRecords(ctx, dnsZone)
+	if err != nil {
+		log.Log.Error(err, "DNSZone instance. Generate ZoneCM. Failed to get DNSRecords", "DNSZone.Name", dnsZone.Name)
+		return ctrl.Result{}, err
+	}
+	pendingChanges := countPendingDNSRecords(allDnsRecords)
+	if requeueAfter := deferZoneRender(dnsZone, pendingChanges, time.Now()); requeueAfter > 0 {
+		if err := r.dnsZoneUpdateStatus(ctx, previousState, dnsZone); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update status and condition: %v", err)
+		}
+		log.Log.Info("DNSZone instance. Generate ZoneCM. Waiting for more changes before the render", "DNSZone.Name", dnsZone.Name, "Pending changes", pendingChanges, "Requeue after", requeueAfter)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
 	// Get DNSRecords for the Zone.
 	log.Log.Info("DNSZone instance. Generate ZoneCM. Fetching DNSRecords", "DNSZone.Name", dnsZone.Name)
-	previousState := dnsZone.DeepCopy()
-	var records bakedRecords
+	var records render.BakedRecords
 	dnsRecordList, err := r.getGoodDnsRecords(ctx, dnsZone)
 	if err != nil {
 		log.Log.Error(err, "DNSZone instance. Generate ZoneCM. Failed to get DNSRecords", "DNSZone.Name", dnsZone.Name)
@@ -170,19 +194,77 @@ func (r *DNSZoneReconciler) reconcileCreateOrUpdate(ctx context.Context, dnsZone
 			return ctrl.Result{}, fmt.Errorf("failed to update status and condition: %v", err)
 		}
 		return ctrl.Result{}, err
-	} else if len(dnsRecordList.Items) <= 0 {
+	}
+
+	// Exclude the DNSRecords failing the validation within the zone, so they do not block the other records of the zone.
+	dnsRecordList, excludedRecords := render.IsolateInvalidRecords(dnsZone, dnsRecordList)
+	if err := r.degradeExcludedDnsRecords(ctx, dnsZone, excludedRecords); err != nil {
+		log.Log.Error(err, "DNSZone instance. Generate ZoneCM. Failed to update excluded DNSRecords", "DNSZone.Name", dnsZone.Name)
+		return ctrl.Result{}, err
+	}
+	if len(excludedRecords) > 0 {
+		log.Log.Info("DNSZone instance. Generate ZoneCM. Invalid DNSRecords have been excluded from the zone", "DNSZone.Name", dnsZone.Name, "Excluded", len(excludedRecords))
+	}
+
+	if len(dnsRecordList.Items) <= 0 {
 		// If no records, make it empty. It will generate only SOA and NS 1
-		records = bakedRecords{
-			count:         0,
-			recordsString: "",
+		records = render.BakedRecords{
+			Count:         0,
+			RecordsString: "",
 		}
 	} else {
 		// Convert DNSRecords to coredns entries
-		records, err = bakeRecords(dnsRecordList)
+		records, err = render.BakeRecords(dnsZone, dnsRecordList)
 		if err != nil {
 			log.Log.Error(err, "DNSZone instance. Generate ZoneCM. Failed to construct record list for coredns", "DNSZone.Name", dnsZone.Name)
 			return ctrl.Result{}, err
 		}
+		if len(records.AdjustedRRsets) > 0 {
+			log.Log.Info("DNSZone instance. Generate ZoneCM. TTLs within RRsets differ. The lowest TTL has been applied", "DNSZone.Name", dnsZone.Name, "RRsets", records.AdjustedRRsets)
+		}
+	}
+
+	// Lint the zone. The DNSRecords involved in the findings blocking publishing are excluded from the zone, the same way as the invalid records.
+	// The blocking findings which involve no DNSRecord preserve the previous version of the zone, user must fix them.
+	// The Ready condition keeps reporting the published version, the blocked changes are reported in the Linted condition.
+	// The pending changes are consumed by the render, also if it is blocked, so the pending state is reset on every path.
+	dnsZone.Status.PendingChanges = 0
+	dnsZone.Status.PendingSince = nil
+	dnsZone.Status.ExcludedRecords = excludedRecords
+	lintResult, err := render.LintAndIsolateRecords(dnsZone, dnsRecordList, records)
+	if err != nil {
+		message := fmt.Sprintf("Zone lint failure. Preserving the previous version. Error: %s", err)
+		dnsZone.Status.ValidationPassed = false
+		setDnsZoneCondition(dnsZone, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonZoneUpdateErr, message)
+		if err := r.dnsZoneUpdateStatus(ctx, previousState, dnsZone); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update status and condition: %v", err)
+		}
+		log.Log.Error(err, "DNSZone instance. Generate ZoneCM. Failed to lint zone. Will not reconcile again.", "DNSZone.Name", dnsZone.Name)
+		return ctrl.Result{}, nil
+	}
+	dnsRecordList, records = lintResult.DNSRecords, lintResult.Records
+	if err := r.degradeExcludedDnsRecords(ctx, dnsZone, lintResult.ExcludedRecords); err != nil {
+		log.Log.Error(err, "DNSZone instance. Generate ZoneCM. Failed to update excluded DNSRecords", "DNSZone.Name", dnsZone.Name)
+		return ctrl.Result{}, err
+	}
+	if len(lintResult.ExcludedRecords) > 0 {
+		dnsZone.Status.ExcludedRecords = append(dnsZone.Status.ExcludedRecords, lintResult.ExcludedRecords...)
+		log.Log.Info("DNSZone instance. Generate ZoneCM. DNSRecords involved in the blocking lint findings have been excluded from the zone", "DNSZone.Name", dnsZone.Name, "Excluded", len(lintResult.ExcludedRecords))
+	}
+	setDnsZoneLintResult(dnsZone, lintResult.Findings, lintResult.Blocking, len(lintResult.ExcludedRecords))
+	if lintResult.Blocking > 0 {
+		if err := r.dnsZoneUpdateStatus(ctx, previousState, dnsZone); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update status and condition: %v", err)
+		}
+		requeueAfter := getLintBlockedRequeueAfter(dnsZone)
+		log.Log.Info("DNSZone instance. Generate ZoneCM. Publishing blocked by the lint findings", "DNSZone.Name", dnsZone.Name, "Blocking findings", lintResult.Blocking, "Requeue after", requeueAfter)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	if err := r.dnsZoneUpdateStatus(ctx, previousState, dnsZone); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update status and condition: %v", err)
+	}
+	if len(lintResult.Findings) > 0 {
+		log.Log.Info("DNSZone instance. Generate ZoneCM. Zone has lint findings", "DNSZone.Name", dnsZone.Name, "Findings", len(lintResult.Findings))
 	}
 
 	// Construct and Apply zone CM
@@ -206,12 +288,226 @@ func (r *DNSZoneReconciler) reconcileCreateOrUpdate(ctx context.Context, dnsZone
 			return ctrl.Result{}, fmt.Errorf("failed to update status and condition: %v", err)
 		}
 	}
+
+	// Generate companion reverse zones and their PTR records.
+	if err := r.reconcileReverseZones(ctx, dnsZone, dnsRecordList); err != nil {
+		log.Log.Error(err, "DNSZone instance. Reverse zones. Failed to reconcile reverse zones", "DNSZone.Name", dnsZone.Name)
+		return ctrl.Result{}, err
+	}
 	log.Log.Info("DNSZone instance. Generate ZoneCM. Reconciled successfully", "DNSZone.Name", dnsZone.Name)
+	// Signed zones must be re-signed before the signatures expire, and the keys must be rolled over on time.
+	if dnsZone.Spec.DNSSEC != nil && dnsZone.Spec.DNSSEC.Enabled {
+		return ctrl.Result{RequeueAfter: getDNSSECRequeueAfter(dnsZone, time.Now())}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
+// degradeExcludedDnsRecords marks the DNSRecords excluded from the zone as Degraded with the parser error.
+// The DNSRecords already marked with the same error are not updated.
+func (r *DNSZoneReconciler) degradeExcludedDnsRecords(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone, excludedRecords []monkalev1alpha1.ExcludedDNSRecord) error {
+	for _, excludedRecord := range excludedRecords {
+		// refresh resource
+		dnsRecType := types.NamespacedName{Name: excludedRecord.Name, Namespace: dnsZone.Namespace}
+		dnsRecObj := &monkalev1alpha1.DNSRecord{}
+		if err := getObjFromK8s(ctx, r.Client, dnsRecType, dnsRecObj); err != nil {
+			return fmt.Errorf("failed to refresh DNSRecord resource: %v", err)
+		}
+		// update resource
+		message := fmt.Sprintf("Record has been excluded from the DNSZone %s: %s", dnsZone.Name, excludedRecord.Message)
+		cond := meta.FindStatusCondition(dnsRecObj.Status.Conditions, monkalev1alpha1.ConditionRecordTypeReady)
+		if cond != nil && cond.Reason == monkalev1alpha1.ConditionReasonRecordDegraded && cond.Message == message && cond.ObservedGeneration == dnsRecObj.Generation {
+			continue
+		}
+		setDnsRecordCondition(dnsRecObj, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonRecordDegraded, message)
+		if err := r.Status().Update(ctx, dnsRecObj); err != nil {
+			return fmt.Errorf("failed to update status and condition: %v", err)
+		}
+	}
+	return nil
+}
+
+// reconcileReverseZones creates, updates or deletes the companion reverse DNSZones of spec.reverseZones, and the PTR DNSRecords
+// derived from the A and AAAA records of the zone. The companion zones and the PTR records are owned by the forward zone.
+// They go through the regular DNSZone and DNSRecord pipeline, and are attached by the same DNSConnector.
+func (r *DNSZoneReconciler) reconcileReverseZones(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone, dnsRecordList monkalev1alpha1.DNSRecordList) error {
+	dnsZoneObj := types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace}
+	reverseZones := map[string]monkalev1alpha1.ReverseZone{}
+	var networks []reverseNetwork
+	for _, cidr := range dnsZone.Spec.ReverseZones {
+		network, err := getReverseNetwork(dnsZone, cidr)
+		if err != nil {
+			log.Log.Error(err, "DNSZone instance. Reverse zones. Skipping network", "DNSZone.Name", dnsZone.Name)
+			reverseZones[cidr] = monkalev1alpha1.ReverseZone{CIDR: cidr, Message: err.Error()}
+			continue
+		}
+		networks = append(networks, network)
+	}
+
+	// Create or update companion zones, delete the ones no longer desired.
+	var existingZoneList monkalev1alpha1.DNSZoneList
+	if err := r.List(ctx, &existingZoneList, client.InNamespace(dnsZone.Namespace), client.MatchingLabels{monkalev1alpha1.DnsZoneReverseOfLabel: dnsZone.Name}); err != nil {
+		return fmt.Errorf("failed to list reverse zones: %v", err)
+	}
+	existingZones := map[string]*monkalev1alpha1.DNSZone{}
+	for i := range existingZoneList.Items {
+		existingZones[existingZoneList.Items[i].Name] = &existingZoneList.Items[i]
+	}
+	var activeNetworks []reverseNetwork
+	for _, network := range networks {
+		desiredZone := constructReverseZone(dnsZone, network)
+		currentZone, found := existingZones[network.zoneName]
+		delete(existingZones, network.zoneName)
+		if !found {
+			if err := controllerutil.SetControllerReference(dnsZone, &desiredZone, r.Scheme); err != nil {
+				return fmt.Errorf("failed to set owner of reverse zone %s: %v", network.zoneName, err)
+			}
+			log.Log.Info("DNSZone instance. Reverse zones. Creating reverse zone", "DNSZone.Name", dnsZone.Name, "ReverseZone.Name", network.zoneName, "ReverseZone.Domain", network.domain)
+			if err := r.Create(ctx, &desiredZone); err != nil {
+				if !apierrors.IsAlreadyExists(err) {
+					return fmt.Errorf("failed to create reverse zone %s: %v", network.zoneName, err)
+				}
+				message := fmt.Sprintf("DNSZone %s already exists and is not managed by %s", network.zoneName, dnsZone.Name)
+				reverseZones[network.cidr] = monkalev1alpha1.ReverseZone{CIDR: network.cidr, Domain: network.domain, Message: message}
+				continue
+			}
+		} else if !equality.Semantic.DeepEqual(currentZone.Spec, desiredZone.Spec) {
+			log.Log.Info("DNSZone instance. Reverse zones. Updating reverse zone", "DNSZone.Name", dnsZone.Name, "ReverseZone.Name", network.zoneName, "ReverseZone.Domain", network.domain)
+			currentZone.Spec = desiredZone.Spec
+			if err := r.Update(ctx, currentZone); err != nil {
+				return fmt.Errorf("failed to update reverse zone %s: %v", network.zoneName, err)
+			}
+		}
+		activeNetworks = append(activeNetworks, network)
+	}
+	for name, zone := range existingZones {
+		log.Log.Info("DNSZone instance. Reverse zones. Deleting reverse zone", "DNSZone.Name", dnsZone.Name, "ReverseZone.Name", name)
+		if err := r.Delete(ctx, zone); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete reverse zone %s: %v", name, err)
+		}
+	}
+
+	// Publish PTR records
+	ptrRecords, ptrCounts := constructPTRRecords(dnsZone, activeNetworks, dnsRecordList)
+	for i := range ptrRecords {
+		if err := controllerutil.SetControllerReference(dnsZone, &ptrRecords[i], r.Scheme); err != nil {
+			return fmt.Errorf("failed to set owner of PTR record %s: %v", ptrRecords[i].Name, err)
+		}
+	}
+	if err := applySourceRecords(ctx, r.Client, monkalev1alpha1.SourceKindDNSZone, dnsZoneObj, ptrRecords); err != nil {
+		return err
+	}
+	for _, network := range activeNetworks {
+		reverseZones[network.cidr] = monkalev1alpha1.ReverseZone{CIDR: network.cidr, Domain: network.domain, DNSZoneName: network.zoneName, RecordCount: ptrCounts[network.zoneName]}
+	}
+
+	// Update DNSZone Status
+	if err := getObjFromK8s(ctx, r.Client, dnsZoneObj, dnsZone); err != nil {
+		return fmt.Errorf("failed to refresh DNSZone resource: %v", err)
+	}
+	previousState := dnsZone.DeepCopy()
+	dnsZone.Status.ReverseZones = nil
+	for _, cidr := range dnsZone.Spec.ReverseZones {
+		if reverseZone, ok := reverseZones[cidr]; ok {
+			dnsZone.Status.ReverseZones = append(dnsZone.Status.ReverseZones, reverseZone)
+		}
+	}
+	return r.dnsZoneUpdateStatus(ctx, previousState, dnsZone)
+}
+
+// reconcileSecondary reconciles the Secondary DNSZone. The zone ConfigMap carries no zonefile, only the primaries for the DNSConnector.
+// The serial of the zone is queried from the primaries every refresh interval of the zone.
+func (r *DNSZoneReconciler) reconcileSecondary(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+	previousState := dnsZone.DeepCopy()
+	cmConnObj := types.NamespacedName{Name: dnsZone.Spec.CMPrefix + dnsZone.Name, Namespace: dnsZone.Namespace}
+
+	// Validate primaries and zone transfer configuration
+	err := render.ValidatePrimaries(dnsZone.Spec.Primaries)
+	if err == nil && dnsZone.Spec.Transfer != nil {
+		err = r.validateZoneTransfer(ctx, dnsZone)
+	}
+	if err != nil {
+		message := fmt.Sprintf("Secondary zone configuration failure. Preserving the previous version. Error: %s", err)
+		dnsZone.Status.ValidationPassed = false
+		setDnsZoneCondition(dnsZone, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonZoneUpdateErr, message)
+		if err := r.dnsZoneUpdateStatus(ctx, previousState, dnsZone); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update status and condition: %v", err)
+		}
+		log.Log.Error(err, "DNSZone instance. Secondary zone. Invalid configuration", "DNSZone.Name", dnsZone.Name)
+		return ctrl.Result{}, err
+	}
+
+	// Construct the Zone ConfigMap
+	var currentCM corev1.ConfigMap
+	cmErr := r.Get(ctx, cmConnObj, &currentCM)
+	if cmErr != nil && !apierrors.IsNotFound(cmErr) {
+		log.Log.Error(cmErr, "DNSZone instance. Secondary zone. Error while fetching ConfigMap", "ConfigMap.metadata.name", cmConnObj.Name, "DNSZone.Name", dnsZone.Name)
+		return ctrl.Result{}, cmErr
+	}
+	// The serial is not known to the operator. It changes only when the primaries change, so the DNSConnector is not triggered on every transfer.
+	upcomingCMAnnotations := render.ConstructZoneAnnotations(dnsZone, "")
+	upcomingCM, err := render.ConstructZoneConfigMap(cmConnObj.Name, dnsZone, "", upcomingCMAnnotations)
+	if err != nil {
+		log.Log.Error(err, "DNSZone instance. Secondary zone. Failed to construct zoneCM", "ConfigMap.metadata.name", cmConnObj.Name, "DNSZone.Name", dnsZone.Name)
+		return ctrl.Result{}, err
+	}
+	upcomingCM.Data = nil
+
+	// Create or update the ConfigMap
+	if apierrors.IsNotFound(cmErr) {
+		log.Log.Info("DNSZone instance. Secondary zone. Creating ZoneCM", "ConfigMap.metadata.name", cmConnObj.Name, "DNSZone.Name", dnsZone.Name)
+		if err := r.Create(ctx, &upcomingCM); err != nil {
+			log.Log.Error(err, "DNSZone instance. Secondary zone. Failed to create ZoneCM", "ConfigMap.metadata.name", cmConnObj.Name, "DNSZone.Name", dnsZone.Name)
+			return ctrl.Result{}, err
+		}
+		message := fmt.Sprintf("Zone ConfigMap has been created: %s", cmConnObj.Name)
+		setDnsZoneCondition(dnsZone, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonZonePending, message)
+	} else if !compareZonefileConfigMaps(&currentCM, &upcomingCM) {
+		log.Log.Info("DNSZone instance. Secondary zone. Updating ZoneCM", "ConfigMap.metadata.name", cmConnObj.Name, "DNSZone.Name", dnsZone.Name)
+		if err := r.Update(ctx, &upcomingCM); err != nil {
+			log.Log.Error(err, "DNSZone instance. Secondary zone. Failed to update ZoneCM", "ConfigMap.metadata.name", cmConnObj.Name, "DNSZone.Name", dnsZone.Name)
+			return ctrl.Result{}, err
+		}
+		message := fmt.Sprintf("Zone ConfigMap has been updated: %s", cmConnObj.Name)
+		setDnsZoneCondition(dnsZone, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonZonePending, message)
+	}
+	if err := addFinalizer(ctx, r.Client, cmConnObj, &corev1.ConfigMap{}, monkalev1alpha1.DnsZonesFinalizerName); err != nil {
+		log.Log.Error(err, "DNSZone instance. Secondary zone. Failed to add finalizer", "ConfigMap.metadata.name", cmConnObj.Name, "DNSZone.Name", dnsZone.Name)
+		return ctrl.Result{}, err
+	}
+
+	// Query the serial of the zone from the primaries.
+	requeueAfter := time.Duration(dnsZone.Spec.RefreshRate) * time.Second
+	soa, err := querySOA(dnsZone.Spec.Domain, dnsZone.Spec.Primaries)
+	if err != nil {
+		log.Log.Error(err, "DNSZone instance. Secondary zone. Failed to query the serial from the primaries", "DNSZone.Name", dnsZone.Name)
+		requeueAfter = time.Duration(dnsZone.Spec.RetryInterval) * time.Second
+	} else {
+		dnsZone.Status.CurrentZoneSerial = strconv.FormatUint(uint64(soa.Serial), 10)
+		requeueAfter = time.Duration(soa.Refresh) * time.Second
+	}
+	if requeueAfter < time.Minute {
+		requeueAfter = time.Minute
+	} else if requeueAfter > time.Hour {
+		requeueAfter = time.Hour
+	}
+
+	// Update DNSZone Status
+	dnsZone.Status.RecordCount = 0
+	dnsZone.Status.ValidationPassed = true
+	dnsZone.Status.Checkpoint = true
+	dnsZone.Status.ZoneConfigmap = cmConnObj.Name
+	dnsZone.Status.DNSSEC = nil
+	dnsZone.Status.ReverseZones = nil
+	if err := r.dnsZoneUpdateStatus(ctx, previousState, dnsZone); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update status and condition: %v", err)
+	}
+	log.Log.Info("DNSZone instance. Secondary zone. Reconciled successfully", "DNSZone.Name", dnsZone.Name, "Serial", dnsZone.Status.CurrentZoneSerial)
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
 // createOrUpdateZoneCM constructs SOA,NS, fetches DNSrecords, validates the zone and then creates/updates Zone Config Map
-func (r *DNSZoneReconciler) createOrUpdateZoneCM(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone, bakedRecords bakedRecords) error {
+func (r *DNSZoneReconciler) createOrUpdateZoneCM(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone, bakedRecords render.BakedRecords) error {
 	_ = log.FromContext(ctx)
 	previousState := dnsZone.DeepCopy()
 	var currentCM corev1.ConfigMap
@@ -225,8 +521,8 @@ func (r *DNSZoneReconciler) createOrUpdateZoneCM(ctx context.Context, dnsZone *m
 		return cmErr
 	}
 
-	// Create new serial for the zone
-	serialNumber, err := monkalev1alpha1.DNSZoneGenerateSerial()
+	// Create new serial for the zone. It must be greater than the serial of the published zone configmap and the status.
+	serialNumber, err := monkalev1alpha1.DNSZoneGenerateSerial(dnsZone.Spec.SerialStrategy, dnsZone.Status.CurrentZoneSerial, currentCM.Annotations["SerialNumber"])
 	if err != nil {
 		log.Log.Error(err, "DNSZone instance. Reconciling ZoneCM. Could not generate Serial number", "ConfigMap.metadata.name", cmConnObj.Name, "DNSZone.Name", dnsZone.Name)
 		return err
@@ -234,7 +530,7 @@ func (r *DNSZoneReconciler) createOrUpdateZoneCM(ctx context.Context, dnsZone *m
 
 	// Construct the zone
 	log.Log.Info("DNSZone instance. Reconciling ZoneCM. Constructing zone", "ConfigMap.metadata.name", cmConnObj.Name, "DNSZone.Name", dnsZone.Name)
-	zone, err := constructZoneFile(dnsZone, bakedRecords.recordsString, serialNumber)
+	zone, err := render.ConstructZoneFile(dnsZone, bakedRecords.RecordsString, serialNumber)
 	if err != nil {
 		message := fmt.Sprintf("Zone construction failure: %s", err)
 		setDnsZoneCondition(dnsZone, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonRecordDegraded, message)
@@ -246,7 +542,7 @@ func (r *DNSZoneReconciler) createOrUpdateZoneCM(ctx context.Context, dnsZone *m
 	}
 
 	// Validate zone
-	if err := validateRecords(zone); err != nil {
+	if err := render.ValidateRecords(zone); err != nil {
 		// update status
 		if err := r.refreshDNSZoneResource(ctx, previousState); err != nil {
 			return fmt.Errorf("failed to refresh DNSZone resource: %v", err)
@@ -262,9 +558,37 @@ func (r *DNSZoneReconciler) createOrUpdateZoneCM(ctx context.Context, dnsZone *m
 		return nil
 	}
 
-	// Construct the Zone ConfigMap
-	upcomingCMAnnotations := map[string]string{"SerialNumber": serialNumber, "DomainName": dnsZone.Spec.Domain, "DNSZoneRef": dnsZone.Name}
-	upcomingCM, err := constructZoneConfigMap(cmConnObj.Name, dnsZone, zone, upcomingCMAnnotations)
+	// Construct the Zone ConfigMap. The DNSConnector renders the zone transfers to the secondaries out of the annotations.
+	upcomingCMAnnotations := render.ConstructZoneAnnotations(dnsZone, serialNumber)
+
+	// Allow zone transfers to the secondaries.
+	if dnsZone.Spec.Transfer != nil {
+		if err := r.validateZoneTransfer(ctx, dnsZone); err != nil {
+			message := fmt.Sprintf("Zone transfer configuration failure. Preserving the previous version. Error: %s", err)
+			setDnsZoneCondition(dnsZone, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonZoneUpdateErr, message)
+			if err := r.dnsZoneUpdateStatus(ctx, previousState, dnsZone); err != nil {
+				return fmt.Errorf("failed to update status and condition: %v", err)
+			}
+			log.Log.Error(err, "DNSZone instance. Reconciling ZoneCM. Invalid zone transfer configuration", "ConfigMap.metadata.name", cmConnObj.Name, "DNSZone.Name", dnsZone.Name)
+			return err
+		}
+	}
+
+	// Sign the zone
+	var dnssecStatus *monkalev1alpha1.DNSSECStatus
+	if dnsZone.Spec.DNSSEC != nil && dnsZone.Spec.DNSSEC.Enabled {
+		zone, dnssecStatus, err = r.signZoneFile(ctx, dnsZone, zone, upcomingCMAnnotations)
+		if err != nil {
+			message := fmt.Sprintf("Zone signing failure. Preserving the previous version. Error: %s", err)
+			setDnsZoneCondition(dnsZone, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonZoneUpdateErr, message)
+			if err := r.dnsZoneUpdateStatus(ctx, previousState, dnsZone); err != nil {
+				return fmt.Errorf("failed to update status and condition: %v", err)
+			}
+			log.Log.Error(err, "DNSZone instance. Reconciling ZoneCM. Failed to sign zone", "ConfigMap.metadata.name", cmConnObj.Name, "DNSZone.Name", dnsZone.Name)
+			return err
+		}
+	}
+	upcomingCM, err := render.ConstructZoneConfigMap(cmConnObj.Name, dnsZone, zone, upcomingCMAnnotations)
 	if err != nil {
 		if err := r.refreshDNSZoneResource(ctx, previousState); err != nil {
 			return fmt.Errorf("failed to refresh DNSZone resource: %v", err)
@@ -313,10 +637,11 @@ func (r *DNSZoneReconciler) createOrUpdateZoneCM(ctx context.Context, dnsZone *m
 
 	message := fmt.Sprintf("Zone ConfigMap has been created: %s", cmConnObj.Name)
 	setDnsZoneCondition(dnsZone, metav1.ConditionFalse, monkalev1alpha1.ConditionReasonZonePending, message)
-	dnsZone.Status.RecordCount = bakedRecords.count
+	dnsZone.Status.RecordCount = bakedRecords.Count
 	dnsZone.Status.ValidationPassed = true
 	dnsZone.Status.Checkpoint = true
 	dnsZone.Status.ZoneConfigmap = cmConnObj.Name
+	dnsZone.Status.DNSSEC = dnssecStatus
 	if err := r.dnsZoneUpdateStatus(ctx, previousState, dnsZone); err != nil {
 		return fmt.Errorf("failed to update status and condition: %v", err)
 	}
@@ -330,6 +655,93 @@ func (r *DNSZoneReconciler) createOrUpdateZoneCM(ctx context.Context, dnsZone *m
 	return nil
 }
 
+// signZoneFile loads the DNSSEC keys of the zone, rolls them over if needed, and signs the zone.
+// DNSSEC annotations are added to the upcoming zone ConfigMap annotations.
+func (r *DNSZoneReconciler) signZoneFile(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone, zone string, upcomingCMAnnotations map[string]string) (string, *monkalev1alpha1.DNSSECStatus, error) {
+	if dnsZone.Spec.DNSSEC.ResignBefore >= dnsZone.Spec.DNSSEC.SignatureValidity {
+		return "", nil, fmt.Errorf("resignBefore must be less than signatureValidity")
+	}
+	now := time.Now()
+	keys, err := r.getDNSSECKeys(ctx, dnsZone, now)
+	if err != nil {
+		return "", nil, err
+	}
+	signedZone, expiration, err := signZone(zone, dnsZone, keys, now)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := render.ValidateRecords(signedZone); err != nil {
+		return "", nil, fmt.Errorf("signed zone validation failure: %v", err)
+	}
+	dnssecStatus, err := constructDNSSECStatus(keys, dnsZone.Spec.DNSSEC, expiration)
+	if err != nil {
+		return "", nil, err
+	}
+	resignAt := expiration.Add(-time.Duration(dnsZone.Spec.DNSSEC.ResignBefore) * time.Second)
+	upcomingCMAnnotations["DNSSECKeys"] = keys.keyTags()
+	upcomingCMAnnotations["DNSSECResignAt"] = resignAt.UTC().Format(time.RFC3339)
+	return signedZone, dnssecStatus, nil
+}
+
+// validateZoneTransfer validates the addresses of the secondaries and the TSIG key Secret of the zone transfer.
+func (r *DNSZoneReconciler) validateZoneTransfer(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone) error {
+	if err := render.ValidateTransferTo(dnsZone.Spec.Transfer.To); err != nil {
+		return err
+	}
+	if dnsZone.Spec.Transfer.TSIGSecretName == "" {
+		return nil
+	}
+	var secret corev1.Secret
+	secretObj := types.NamespacedName{Name: dnsZone.Spec.Transfer.TSIGSecretName, Namespace: dnsZone.Namespace}
+	if err := r.Get(ctx, secretObj, &secret); err != nil {
+		return fmt.Errorf("failed to get TSIG secret %s: %v", secretObj.Name, err)
+	}
+	_, err := render.GetTSIGKey(&secret)
+	return err
+}
+
+// getDNSSECKeys fetches the DNSSEC keys of the zone from the Secret, generates and rolls over the keys.
+// The Secret is not owned by the DNSZone, so the keys survive the DNSZone deletion and the DS record in the parent zone stays valid.
+func (r *DNSZoneReconciler) getDNSSECKeys(ctx context.Context, dnsZone *monkalev1alpha1.DNSZone, now time.Time) (*dnssecKeys, error) {
+	var secret corev1.Secret
+	secretObj := types.NamespacedName{Name: dnsZone.Name + monkalev1alpha1.DnsZoneDNSSECSecretSuffix, Namespace: dnsZone.Namespace}
+	secretErr := r.Get(ctx, secretObj, &secret)
+	if secretErr != nil && !apierrors.IsNotFound(secretErr) {
+		return nil, fmt.Errorf("failed to get DNSSEC keys secret: %v", secretErr)
+	}
+	keys, err := parseDNSSECKeys(secret.Data)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := rolloverDNSSECKeys(keys, dnsZone, now)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return keys, nil
+	}
+
+	secret.Data = keys.toSecretData()
+	if apierrors.IsNotFound(secretErr) {
+		log.Log.Info("DNSZone instance. DNSSEC. Creating keys", "Secret.Name", secretObj.Name, "DNSZone.Name", dnsZone.Name)
+		secret.ObjectMeta = metav1.ObjectMeta{
+			Name:      secretObj.Name,
+			Namespace: secretObj.Namespace,
+			Labels:    map[string]string{"app": "coredns-addon-operator"},
+		}
+		secret.Type = corev1.SecretTypeOpaque
+		if err := r.Create(ctx, &secret); err != nil {
+			return nil, fmt.Errorf("failed to create DNSSEC keys secret: %v", err)
+		}
+		return keys, nil
+	}
+	log.Log.Info("DNSZone instance. DNSSEC. Rolling over keys", "Secret.Name", secretObj.Name, "DNSZone.Name", dnsZone.Name, "Keys", keys.keyTags())
+	if err := r.Update(ctx, &secret); err != nil {
+		return nil, fmt.Errorf("failed to update DNSSEC keys secret: %v", err)
+	}
+	return keys, nil
+}
+
 // setDnsZoneCondition adds or updates a given condition in the ManagedZone status.
 func setDnsZoneCondition(dnsZone *monkalev1alpha1.DNSZone, status metav1.ConditionStatus, reason, message string) {
 	now := metav1.Now()
@@ -377,25 +789,40 @@ func (r *DNSZoneReconciler) dnsZoneUpdateStatus(ctx context.Context, previous, c
 }
 
 // compareZonefileConfigMaps compares two configmaps with the zonefile.
-// during the check it will remove serial number. Returns true if they the same.
+// during the check it will remove serial number and DNSSEC records. Returns true if they the same.
+// Signed zones are not the same if the DNSSEC keys have changed or if the signatures are due to be renewed.
+// Zones are not the same if the zone transfer configuration has changed.
 func compareZonefileConfigMaps(previousCM, upcomingCM *corev1.ConfigMap) bool {
 	previousCMCopy := previousCM.DeepCopy()
 	upcomingCMCopy := upcomingCM.DeepCopy()
 
-	// Remove serial number from both conifgMaps
+	for _, annotation := range []string{"ZoneType", "Primaries", "DNSSECKeys", "TransferTo", "TSIGSecretName"} {
+		if previousCMCopy.Annotations[annotation] != upcomingCMCopy.Annotations[annotation] {
+			return false
+		}
+	}
+	if resignAt, ok := previousCMCopy.Annotations["DNSSECResignAt"]; ok {
+		resignAtTime, err := time.Parse(time.RFC3339, resignAt)
+		if err != nil || !time.Now().Before(resignAtTime) {
+			return false
+		}
+	}
+
+	// Remove serial number and DNSSEC records from both conifgMaps
 	for k, v := range previousCMCopy.Data {
-		previousCMCopy.Data[k] = removeSerialNumber(v)
+		previousCMCopy.Data[k] = removeSerialNumber(removeDNSSECRecords(v))
 	}
 
 	for k, v := range upcomingCMCopy.Data {
-		upcomingCMCopy.Data[k] = removeSerialNumber(v)
+		upcomingCMCopy.Data[k] = removeSerialNumber(removeDNSSECRecords(v))
 	}
 
 	// Do check
 	return equality.Semantic.DeepEqual(previousCMCopy.Data, upcomingCMCopy.Data)
 }
 
-// removeSerialNumber used to remove serial number from the zonefile string
+// removeSerialNumber used to remove serial number from the zonefile string.
+// The serial is expected on its own line marked with the "; Serial" comment, whatever the serial strategy is.
 func removeSerialNumber(zonefile string) string {
 	lines := strings.Split(zonefile, "\n")
 	for i, line := range lines {
@@ -415,8 +842,6 @@ func (r *DNSZoneReconciler) dnsRecordChangedReconcileRequest(ctx context.Context
 		log.Log.Error(nil, "DNSZone instance. Failed to cast dnsRecord to monkalev1alpha1.DNSRecord")
 		return []reconcile.Request{}
 	}
-	// delay before trying to reconcile. it avoids false positive logs
-	time.Sleep(3 * time.Second)
 	log.Log.Info("DNSZone instance. DNSRecord change detected. Requesting reconcilation for the zone", "DNSZone.Name", dnsRecordObj.Spec.DNSZoneRef.Name)
 	// Create a reconcile request for the associated DNSZone
 	return []reconcile.Request{
@@ -429,6 +854,33 @@ func (r *DNSZoneReconciler) dnsRecordChangedReconcileRequest(ctx context.Context
 	}
 }
 
+// dnsRecordChangedPredicate passes the DNSRecords that have been created, changed or deleted, and the DNSRecords
+// that have been validated by the DNSRecord controller, so the zone is rendered with the validated records only.
+func dnsRecordChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldRecord, ok := e.ObjectOld.(*monkalev1alpha1.DNSRecord)
+			if !ok {
+				return true
+			}
+			newRecord, ok := e.ObjectNew.(*monkalev1alpha1.DNSRecord)
+			if !ok {
+				return true
+			}
+			return oldRecord.Generation != newRecord.Generation || oldRecord.Status.ValidationPassed != newRecord.Status.ValidationPassed || getRecordObservedGeneration(oldRecord) != getRecordObservedGeneration(newRecord)
+		},
+	}
+}
+
+// getRecordObservedGeneration returns the generation of the DNSRecord the Ready condition has been set for.
+func getRecordObservedGeneration(dnsRecord *monkalev1alpha1.DNSRecord) int64 {
+	cond := meta.FindStatusCondition(dnsRecord.Status.Conditions, monkalev1alpha1.ConditionRecordTypeReady)
+	if cond == nil {
+		return 0
+	}
+	return cond.ObservedGeneration
+}
+
 // SetupWithManager sets up the controller with the Manager.
 // https://book.kubebuilder.io/reference/watching-resources/externally-managed
 func (r *DNSZoneReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -446,10 +898,10 @@ func (r *DNSZoneReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	// DNSZone is primary resource, DNSRecord is secondary.
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&monkalev1alpha1.DNSZone{}).WithEventFilter(predicate.GenerationChangedPredicate{}).
+		For(&monkalev1alpha1.DNSZone{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Watches(
 			&monkalev1alpha1.DNSRecord{},
 			handler.EnqueueRequestsFromMapFunc(r.dnsRecordChangedReconcileRequest),
-			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+			builder.WithPredicates(dnsRecordChangedPredicate())).
 		Complete(r)
 }
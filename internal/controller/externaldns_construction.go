@@ -0,0 +1,281 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+// externalDNSEndpoint is the Endpoint of the external-dns webhook provider protocol.
+type externalDNSEndpoint struct {
+	DNSName          string                                `json:"dnsName,omitempty"`
+	Targets          []string                              `json:"targets,omitempty"`
+	RecordType       string                                `json:"recordType,omitempty"`
+	SetIdentifier    string                                `json:"setIdentifier,omitempty"`
+	RecordTTL        int64                                 `json:"recordTTL,omitempty"`
+	Labels           map[string]string                     `json:"labels,omitempty"`
+	ProviderSpecific []externalDNSProviderSpecificProperty `json:"providerSpecific,omitempty"`
+}
+
+// externalDNSProviderSpecificProperty is the provider specific property of the external-dns Endpoint.
+type externalDNSProviderSpecificProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// externalDNSChanges is the set of changes external-dns applies to the records. The fields are not tagged upstream.
+type externalDNSChanges struct {
+	Create    []externalDNSEndpoint `json:"Create"`
+	UpdateOld []externalDNSEndpoint `json:"UpdateOld"`
+	UpdateNew []externalDNSEndpoint `json:"UpdateNew"`
+	Delete    []externalDNSEndpoint `json:"Delete"`
+}
+
+// externalDNSDomainFilter is the domain filter returned by the negotiation, it limits external-dns to the domain of the DNSZone.
+type externalDNSDomainFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// externalDNSRecordTypes are the record types supported by the webhook provider.
+var externalDNSRecordTypes = map[string]bool{
+	"A":     true,
+	"AAAA":  true,
+	"CNAME": true,
+	"TXT":   true,
+	"SRV":   true,
+	"NS":    true,
+	"PTR":   true,
+	"MX":    true,
+	"NAPTR": true,
+	"CAA":   true,
+}
+
+// getExternalDNSTarget converts the rdata to the external-dns target. external-dns uses hostnames without the trailing dot.
+func getExternalDNSTarget(rrtype uint16, rdata string) string {
+	switch rrtype {
+	case dns.TypeA, dns.TypeAAAA, dns.TypeTXT, dns.TypeCAA:
+		return rdata
+	}
+	if len(rdata) > 1 {
+		return strings.TrimSuffix(rdata, ".")
+	}
+	return rdata
+}
+
+// constructExternalDNSEndpoints builds the external-dns Endpoints out of the RRsets of the zone, sorted by name and type.
+// The RRsets which are not owned by the webhook provider are returned too, so the registry of external-dns can tell they are not its own.
+func constructExternalDNSEndpoints(rrsets map[updateRRsetKey]*updateRRset) []externalDNSEndpoint {
+	endpoints := []externalDNSEndpoint{}
+	for key, rrset := range rrsets {
+		recordType := dns.TypeToString[key.rrtype]
+		if !externalDNSRecordTypes[recordType] || len(rrset.rrs) == 0 {
+			continue
+		}
+		endpoint := externalDNSEndpoint{
+			DNSName:    strings.TrimSuffix(key.name, "."),
+			RecordType: recordType,
+			RecordTTL:  int64(rrset.ttl),
+		}
+		for _, rr := range rrset.rrs {
+			endpoint.Targets = append(endpoint.Targets, getExternalDNSTarget(key.rrtype, render.RRData(rr)))
+		}
+		sort.Strings(endpoint.Targets)
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].DNSName != endpoints[j].DNSName {
+			return endpoints[i].DNSName < endpoints[j].DNSName
+		}
+		return endpoints[i].RecordType < endpoints[j].RecordType
+	})
+	return endpoints
+}
+
+// adjustExternalDNSEndpoints normalizes the desired Endpoints the same way the records are returned,
+// so external-dns does not plan updates for the records which are already in place. Targets which can not be parsed
+// are left as is, they are refused when the changes are applied.
+func adjustExternalDNSEndpoints(endpoints []externalDNSEndpoint) []externalDNSEndpoint {
+	adjusted := make([]externalDNSEndpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		endpoint.DNSName = strings.TrimSuffix(strings.ToLower(endpoint.DNSName), ".")
+		endpoint.ProviderSpecific = nil
+		targets := make([]string, 0, len(endpoint.Targets))
+		for _, target := range endpoint.Targets {
+			rr, err := dns.NewRR(fmt.Sprintf("%s IN %s %s", dns.Fqdn(endpoint.DNSName), endpoint.RecordType, target))
+			if err != nil || rr == nil {
+				targets = append(targets, target)
+				continue
+			}
+			targets = append(targets, getExternalDNSTarget(rr.Header().Rrtype, render.RRData(rr)))
+		}
+		sort.Strings(targets)
+		endpoint.Targets = targets
+		adjusted = append(adjusted, endpoint)
+	}
+	return adjusted
+}
+
+// constructExternalDNSRecord builds the DNSRecord of the Endpoint. The DNSRecord owns the whole RRset of the Endpoint.
+// If the RRset already has the DNSRecord owned by the webhook provider, the DNSRecord is updated.
+// The DNSRecord passes the same validation as the DNSRecords created by hand.
+func constructExternalDNSRecord(dnsZone *monkalev1alpha1.DNSZone, endpoint externalDNSEndpoint, existing *monkalev1alpha1.DNSRecord) (monkalev1alpha1.DNSRecord, error) {
+	name := strings.ToLower(dns.Fqdn(endpoint.DNSName))
+	if !hostnameInZone(name, dnsZone.Spec.Domain) {
+		return monkalev1alpha1.DNSRecord{}, fmt.Errorf("%s does not belong to the domain %s", endpoint.DNSName, dnsZone.Spec.Domain)
+	}
+	if !externalDNSRecordTypes[endpoint.RecordType] {
+		return monkalev1alpha1.DNSRecord{}, fmt.Errorf("%s: record type %s is not supported", endpoint.DNSName, endpoint.RecordType)
+	}
+	if len(endpoint.Targets) == 0 {
+		return monkalev1alpha1.DNSRecord{}, fmt.Errorf("%s %s: targets must not be empty", endpoint.DNSName, endpoint.RecordType)
+	}
+
+	record := monkalev1alpha1.Record{Name: name, Type: endpoint.RecordType}
+	if endpoint.RecordTTL > 0 {
+		record.TTL = strconv.FormatInt(endpoint.RecordTTL, 10)
+	}
+	var values []string
+	for _, target := range endpoint.Targets {
+		// hostnames of the targets are relative to the root, so they are parsed with the default origin.
+		rr, err := dns.NewRR(fmt.Sprintf("%s IN %s %s", name, endpoint.RecordType, target))
+		if err != nil || rr == nil {
+			return monkalev1alpha1.DNSRecord{}, fmt.Errorf("%s %s: bad target %q: %v", endpoint.DNSName, endpoint.RecordType, target, err)
+		}
+		values = append(values, render.RRData(rr))
+	}
+	sort.Strings(values)
+	values = uniqueStrings(values)
+	if len(values) == 1 {
+		record.Value = values[0]
+	} else {
+		record.Values = values
+	}
+
+	zoneRef := types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace}
+	var dnsRecord monkalev1alpha1.DNSRecord
+	if existing != nil {
+		dnsRecord = *existing.DeepCopy()
+	} else {
+		dnsRecord = monkalev1alpha1.DNSRecord{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        getSourceRecordName(monkalev1alpha1.SourceKindExternalDNS, zoneRef, name, endpoint.RecordType),
+				Namespace:   dnsZone.Namespace,
+				Labels:      getSourceRecordLabels(monkalev1alpha1.SourceKindExternalDNS, zoneRef),
+				Annotations: getSourceRecordAnnotations(zoneRef),
+			},
+			Spec: monkalev1alpha1.DNSRecordSpec{
+				DNSZoneRef: &corev1.ObjectReference{Name: dnsZone.Name},
+			},
+		}
+	}
+	dnsRecord.Spec.Record = &record
+
+	generatedRecord, err := render.ConstructRecord(dnsRecord)
+	if err != nil {
+		return monkalev1alpha1.DNSRecord{}, fmt.Errorf("%s %s: %v", endpoint.DNSName, endpoint.RecordType, err)
+	}
+	if err := render.ValidateRecords(generatedRecord); err != nil {
+		return monkalev1alpha1.DNSRecord{}, fmt.Errorf("%s %s: %v", endpoint.DNSName, endpoint.RecordType, err)
+	}
+	return dnsRecord, nil
+}
+
+// isExternalDNSOwned checks whether the DNSRecord has been created by the external-dns webhook provider for the zone.
+func isExternalDNSOwned(dnsRecord *monkalev1alpha1.DNSRecord, dnsZone *monkalev1alpha1.DNSZone) bool {
+	return isSourceRecordOf(dnsRecord, monkalev1alpha1.SourceKindExternalDNS, types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace})
+}
+
+// planExternalDNSChanges applies the changes to the DNSRecords of the zone. Returns the DNSRecords to create or update,
+// and the DNSRecords to delete. Changes of the records which are not owned by the webhook provider are refused,
+// and nothing is applied if any of the changes is invalid.
+func planExternalDNSChanges(dnsZone *monkalev1alpha1.DNSZone, dnsRecords *monkalev1alpha1.DNSRecordList, changes *externalDNSChanges) ([]monkalev1alpha1.DNSRecord, []monkalev1alpha1.DNSRecord, error) {
+	type rrsetKey struct {
+		name       string
+		recordType string
+	}
+	owned := make(map[rrsetKey]*monkalev1alpha1.DNSRecord)
+	notOwned := make(map[rrsetKey]bool)
+	for i := range dnsRecords.Items {
+		dnsRecord := &dnsRecords.Items[i]
+		if dnsRecord.Spec.Record == nil {
+			continue
+		}
+		key := rrsetKey{name: strings.ToLower(getRecordFQDN(dnsRecord.Spec.Record.Name, dnsZone.Spec.Domain)), recordType: dnsRecord.Spec.Record.Type}
+		if isExternalDNSOwned(dnsRecord, dnsZone) {
+			owned[key] = dnsRecord
+		} else {
+			notOwned[key] = true
+		}
+	}
+	getKey := func(endpoint externalDNSEndpoint) (rrsetKey, error) {
+		key := rrsetKey{name: strings.ToLower(dns.Fqdn(endpoint.DNSName)), recordType: endpoint.RecordType}
+		if notOwned[key] {
+			return key, fmt.Errorf("%s %s is not managed by external-dns", endpoint.DNSName, endpoint.RecordType)
+		}
+		return key, nil
+	}
+
+	// deletes go first, then updates and creates. The last change of the RRset wins.
+	desired := make(map[rrsetKey]*externalDNSEndpoint)
+	deleted := make(map[rrsetKey]bool)
+	for _, endpoint := range changes.Delete {
+		key, err := getKey(endpoint)
+		if err != nil {
+			return nil, nil, err
+		}
+		deleted[key] = true
+	}
+	for _, endpoints := range [][]externalDNSEndpoint{changes.UpdateNew, changes.Create} {
+		for i := range endpoints {
+			key, err := getKey(endpoints[i])
+			if err != nil {
+				return nil, nil, err
+			}
+			desired[key] = &endpoints[i]
+			delete(deleted, key)
+		}
+	}
+
+	var upserts, deletes []monkalev1alpha1.DNSRecord
+	for key := range deleted {
+		if dnsRecord, ok := owned[key]; ok {
+			deletes = append(deletes, *dnsRecord)
+		}
+	}
+	for key, endpoint := range desired {
+		dnsRecord, err := constructExternalDNSRecord(dnsZone, *endpoint, owned[key])
+		if err != nil {
+			return nil, nil, err
+		}
+		upserts = append(upserts, dnsRecord)
+	}
+	sort.Slice(upserts, func(i, j int) bool { return upserts[i].Name < upserts[j].Name })
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Name < deletes[j].Name })
+	return upserts, deletes, nil
+}
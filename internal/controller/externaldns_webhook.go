@@ -0,0 +1,237 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+const (
+	externalDNSMediaType       string        = "application/external.dns.webhook+json;version=1" // externalDNSMediaType is the media type of the webhook provider protocol
+	externalDNSShutdownTimeout time.Duration = 5 * time.Second                                   // externalDNSShutdownTimeout limits the graceful shutdown of the webhook server
+)
+
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnsrecords,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnszones,verbs=get;list;watch
+
+// ExternalDNSWebhook is the external-dns webhook provider. It serves the negotiate, records and adjustendpoints endpoints
+// of the webhook protocol, and maps the Endpoints of external-dns to DNSRecords of the DNSZone.
+// The DNSRecords are labeled as owned by the webhook provider, other DNSRecords of the DNSZone are never changed.
+type ExternalDNSWebhook struct {
+	// Client is used to write DNSRecords.
+	Client client.Client
+	// APIReader reads DNSZones and DNSRecords bypassing the cache, so the records always reflect the applied changes.
+	APIReader client.Reader
+	// Addr is the address the HTTP server listens on.
+	Addr string
+	// DNSZone is the DNSZone the records are published to.
+	DNSZone types.NamespacedName
+
+	// mu serializes the changes.
+	mu sync.Mutex
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. The server runs in the manager pod and every replica
+// serves the requests, the DNSRecords are written with the resourceVersion they were read with.
+// The server has no authentication, the access is limited by the NetworkPolicy in config/network-policy.
+func (h *ExternalDNSWebhook) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable. It runs the HTTP server until the context is canceled.
+func (h *ExternalDNSWebhook) Start(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              h.Addr,
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.ListenAndServe()
+	}()
+	log.Log.Info("ExternalDNS webhook. Listening", "Address", h.Addr, "DNSZone.Name", h.DNSZone.Name, "DNSZone.Namespace", h.DNSZone.Namespace)
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), externalDNSShutdownTimeout)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	case err := <-errChan:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("external-dns webhook server failed: %v", err)
+	}
+}
+
+// ServeHTTP implements http.Handler. It routes the requests of the webhook protocol.
+func (h *ExternalDNSWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		h.negotiate(w, r)
+	case r.URL.Path == "/records" && r.Method == http.MethodGet:
+		h.getRecords(w, r)
+	case r.URL.Path == "/records" && r.Method == http.MethodPost:
+		h.applyChanges(w, r)
+	case r.URL.Path == "/adjustendpoints" && r.Method == http.MethodPost:
+		h.adjustEndpoints(w, r)
+	case r.URL.Path == "/healthz" && r.Method == http.MethodGet:
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/" || r.URL.Path == "/records" || r.URL.Path == "/adjustendpoints":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// negotiate returns the domain filter of the DNSZone.
+func (h *ExternalDNSWebhook) negotiate(w http.ResponseWriter, r *http.Request) {
+	dnsZone, err := h.getDNSZone(r.Context())
+	if err != nil {
+		log.Log.Error(err, "ExternalDNS webhook. Negotiation failed")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, externalDNSDomainFilter{Include: []string{strings.TrimSuffix(strings.ToLower(dnsZone.Spec.Domain), ".")}})
+}
+
+// getRecords returns the records of the DNSZone as Endpoints.
+func (h *ExternalDNSWebhook) getRecords(w http.ResponseWriter, r *http.Request) {
+	dnsZone, err := h.getDNSZone(r.Context())
+	if err != nil {
+		log.Log.Error(err, "ExternalDNS webhook. Failed to get records")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dnsRecords, err := listDNSZoneRecords(r.Context(), h.APIReader, dnsZone)
+	if err != nil {
+		log.Log.Error(err, "ExternalDNS webhook. Failed to get records", "DNSZone.Name", dnsZone.Name)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, constructExternalDNSEndpoints(buildUpdateRRsets(dnsZone, &dnsRecords)))
+}
+
+// adjustEndpoints normalizes the desired Endpoints of external-dns.
+func (h *ExternalDNSWebhook) adjustEndpoints(w http.ResponseWriter, r *http.Request) {
+	var endpoints []externalDNSEndpoint
+	if err := json.NewDecoder(r.Body).Decode(&endpoints); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode endpoints: %v", err), http.StatusBadRequest)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, adjustExternalDNSEndpoints(endpoints))
+}
+
+// applyChanges applies the changes planned by external-dns to the DNSRecords of the DNSZone.
+// Invalid changes and changes of the records not owned by the webhook provider are refused with 400, nothing is applied then.
+func (h *ExternalDNSWebhook) applyChanges(w http.ResponseWriter, r *http.Request) {
+	var changes externalDNSChanges
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode changes: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ctx := r.Context()
+	dnsZone, err := h.getDNSZone(ctx)
+	if err != nil {
+		log.Log.Error(err, "ExternalDNS webhook. Failed to apply changes")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logKV := []interface{}{"DNSZone.Name", dnsZone.Name, "DNSZone.Namespace", dnsZone.Namespace}
+	dnsRecords, err := listDNSZoneRecords(ctx, h.APIReader, dnsZone)
+	if err != nil {
+		log.Log.Error(err, "ExternalDNS webhook. Failed to apply changes", logKV...)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	upserts, deletes, err := planExternalDNSChanges(dnsZone, &dnsRecords, &changes)
+	if err != nil {
+		log.Log.Error(err, "ExternalDNS webhook. Changes refused", logKV...)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current := make(map[string]*monkalev1alpha1.DNSRecord)
+	for i := range dnsRecords.Items {
+		current[dnsRecords.Items[i].Name] = &dnsRecords.Items[i]
+	}
+	for i := range upserts {
+		dnsRecord := &upserts[i]
+		switch existing, ok := current[dnsRecord.Name]; {
+		case dnsRecord.ResourceVersion == "":
+			err = h.Client.Create(ctx, dnsRecord)
+		case ok && equality.Semantic.DeepEqual(existing.Spec, dnsRecord.Spec):
+			continue
+		default:
+			err = h.Client.Update(ctx, dnsRecord)
+		}
+		if err != nil {
+			log.Log.Error(err, "ExternalDNS webhook. Failed to write DNSRecord", append(logKV, "DNSRecord.Name", dnsRecord.Name)...)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for i := range deletes {
+		if err := h.Client.Delete(ctx, &deletes[i], client.Preconditions{ResourceVersion: &deletes[i].ResourceVersion}); err != nil && !apierrors.IsNotFound(err) {
+			log.Log.Error(err, "ExternalDNS webhook. Failed to delete DNSRecord", append(logKV, "DNSRecord.Name", deletes[i].Name)...)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	log.Log.Info("ExternalDNS webhook. Changes applied", append(logKV, "Written", len(upserts), "Deleted", len(deletes))...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getDNSZone fetches the DNSZone of the webhook provider. Secondary zones can not be changed.
+func (h *ExternalDNSWebhook) getDNSZone(ctx context.Context) (*monkalev1alpha1.DNSZone, error) {
+	dnsZone := &monkalev1alpha1.DNSZone{}
+	if err := h.APIReader.Get(ctx, h.DNSZone, dnsZone); err != nil {
+		return nil, fmt.Errorf("failed to get DNSZone %s: %v", h.DNSZone, err)
+	}
+	if dnsZone.Spec.Type == monkalev1alpha1.DNSZoneTypeSecondary {
+		return nil, fmt.Errorf("DNSZone %s is a Secondary zone", h.DNSZone)
+	}
+	return dnsZone, nil
+}
+
+// writeJSON writes the response of the webhook protocol.
+func (h *ExternalDNSWebhook) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", externalDNSMediaType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Log.Error(err, "ExternalDNS webhook. Failed to write response")
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+var _ = Describe("ExternalDNS webhook", func() {
+	const namespace = "externaldns-webhook"
+	ctx := context.Background()
+	zoneRef := types.NamespacedName{Name: "example-org", Namespace: namespace}
+	var webhook *ExternalDNSWebhook
+
+	serve := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload bytes.Buffer
+		if body != nil {
+			Expect(json.NewEncoder(&payload).Encode(body)).To(Succeed())
+		}
+		recorder := httptest.NewRecorder()
+		webhook.ServeHTTP(recorder, httptest.NewRequest(method, path, &payload))
+		return recorder
+	}
+	getRecords := func() []externalDNSEndpoint {
+		response := serve(http.MethodGet, "/records", nil)
+		Expect(response.Code).To(Equal(http.StatusOK))
+		var endpoints []externalDNSEndpoint
+		Expect(json.NewDecoder(response.Body).Decode(&endpoints)).To(Succeed())
+		return endpoints
+	}
+	listOwnedRecords := func() []monkalev1alpha1.DNSRecord {
+		dnsRecords := &monkalev1alpha1.DNSRecordList{}
+		Expect(k8sClient.List(ctx, dnsRecords, client.InNamespace(namespace),
+			client.MatchingLabels{monkalev1alpha1.SourceKindLabel: monkalev1alpha1.SourceKindExternalDNS})).To(Succeed())
+		return dnsRecords.Items
+	}
+
+	BeforeEach(func() {
+		webhook = &ExternalDNSWebhook{Client: k8sClient, APIReader: k8sClient, DNSZone: zoneRef}
+
+		err := k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			Expect(err).NotTo(HaveOccurred())
+		}
+		dnsZone := &monkalev1alpha1.DNSZone{
+			ObjectMeta: metav1.ObjectMeta{Name: zoneRef.Name, Namespace: namespace},
+			Spec: monkalev1alpha1.DNSZoneSpec{
+				Domain:          "example.org",
+				PrimaryNS:       &monkalev1alpha1.PrimaryNS{Hostname: "ns1", IPAddress: "192.0.2.1", RecordType: "A"},
+				RespPersonEmail: "admin@example.org",
+				TTL:             3600,
+				ConnectorName:   "coredns",
+			},
+		}
+		Expect(k8sClient.Create(ctx, dnsZone)).To(Succeed())
+		handmade := &monkalev1alpha1.DNSRecord{
+			ObjectMeta: metav1.ObjectMeta{Name: "mail", Namespace: namespace},
+			Spec: monkalev1alpha1.DNSRecordSpec{
+				DNSZoneRef: &corev1.ObjectReference{Name: zoneRef.Name},
+				Record:     &monkalev1alpha1.Record{Name: "mail", Type: "A", Value: "192.0.2.25"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, handmade)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.DeleteAllOf(ctx, &monkalev1alpha1.DNSRecord{}, client.InNamespace(namespace))).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &monkalev1alpha1.DNSZone{}, client.InNamespace(namespace))).To(Succeed())
+	})
+
+	It("negotiates the domain of the DNSZone", func() {
+		response := serve(http.MethodGet, "/", nil)
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Header().Get("Content-Type")).To(Equal(externalDNSMediaType))
+		var domainFilter externalDNSDomainFilter
+		Expect(json.NewDecoder(response.Body).Decode(&domainFilter)).To(Succeed())
+		Expect(domainFilter.Include).To(Equal([]string{"example.org"}))
+	})
+
+	It("returns the records of the DNSZone including the DNSRecords not created by external-dns", func() {
+		Expect(getRecords()).To(Equal([]externalDNSEndpoint{
+			{DNSName: "mail.example.org", Targets: []string{"192.0.2.25"}, RecordType: "A", RecordTTL: 3600},
+		}))
+	})
+
+	It("adjusts the endpoints", func() {
+		response := serve(http.MethodPost, "/adjustendpoints", []externalDNSEndpoint{
+			{DNSName: "WWW.Example.org.", Targets: []string{"app.example.org."}, RecordType: "CNAME"},
+			{DNSName: "txt.example.org", Targets: []string{"v=spf1"}, RecordType: "TXT",
+				ProviderSpecific: []externalDNSProviderSpecificProperty{{Name: "alias", Value: "true"}}},
+		})
+		Expect(response.Code).To(Equal(http.StatusOK))
+		var endpoints []externalDNSEndpoint
+		Expect(json.NewDecoder(response.Body).Decode(&endpoints)).To(Succeed())
+		Expect(endpoints).To(Equal([]externalDNSEndpoint{
+			{DNSName: "www.example.org", Targets: []string{"app.example.org"}, RecordType: "CNAME"},
+			{DNSName: "txt.example.org", Targets: []string{`"v=spf1"`}, RecordType: "TXT"},
+		}))
+	})
+
+	It("applies the changes to the DNSRecords owned by the webhook provider", func() {
+		By("creating a record")
+		www := externalDNSEndpoint{DNSName: "www.example.org", Targets: []string{"192.0.2.10"}, RecordType: "A", RecordTTL: 300}
+		Expect(serve(http.MethodPost, "/records", externalDNSChanges{Create: []externalDNSEndpoint{www}}).Code).To(Equal(http.StatusNoContent))
+		owned := listOwnedRecords()
+		Expect(owned).To(HaveLen(1))
+		Expect(owned[0].Labels).To(HaveKeyWithValue(monkalev1alpha1.SourceNameLabel, zoneRef.Name))
+		Expect(owned[0].Annotations).To(HaveKeyWithValue(monkalev1alpha1.SourceNameAnnotation, zoneRef.Name))
+		Expect(owned[0].Spec.Record).To(Equal(&monkalev1alpha1.Record{Name: "www.example.org.", Type: "A", TTL: "300", Value: "192.0.2.10"}))
+		Expect(getRecords()).To(ContainElement(www))
+
+		By("updating the record")
+		updated := www
+		updated.Targets = []string{"192.0.2.11", "192.0.2.12"}
+		changes := externalDNSChanges{UpdateOld: []externalDNSEndpoint{www}, UpdateNew: []externalDNSEndpoint{updated}}
+		Expect(serve(http.MethodPost, "/records", changes).Code).To(Equal(http.StatusNoContent))
+		owned = listOwnedRecords()
+		Expect(owned).To(HaveLen(1))
+		Expect(owned[0].Spec.Record.Values).To(Equal([]string{"192.0.2.11", "192.0.2.12"}))
+
+		By("deleting the record")
+		Expect(serve(http.MethodPost, "/records", externalDNSChanges{Delete: []externalDNSEndpoint{updated}}).Code).To(Equal(http.StatusNoContent))
+		Expect(listOwnedRecords()).To(BeEmpty())
+	})
+
+	It("refuses the changes of the DNSRecords not created by external-dns", func() {
+		changes := externalDNSChanges{Create: []externalDNSEndpoint{
+			{DNSName: "api.example.org", Targets: []string{"192.0.2.30"}, RecordType: "A"},
+			{DNSName: "mail.example.org", Targets: []string{"192.0.2.26"}, RecordType: "A"},
+		}}
+		Expect(serve(http.MethodPost, "/records", changes).Code).To(Equal(http.StatusBadRequest))
+		Expect(listOwnedRecords()).To(BeEmpty())
+
+		handmade := &monkalev1alpha1.DNSRecord{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "mail", Namespace: namespace}, handmade)).To(Succeed())
+		Expect(handmade.Spec.Record.Value).To(Equal("192.0.2.25"))
+	})
+
+	It("refuses the records out of the domain of the DNSZone", func() {
+		changes := externalDNSChanges{Create: []externalDNSEndpoint{{DNSName: "www.example.com", Targets: []string{"192.0.2.10"}, RecordType: "A"}}}
+		Expect(serve(http.MethodPost, "/records", changes).Code).To(Equal(http.StatusBadRequest))
+		Expect(listOwnedRecords()).To(BeEmpty())
+	})
+})
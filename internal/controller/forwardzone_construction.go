@@ -0,0 +1,91 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// getProvisionedForwardZones builds the list of provisioned forward zones.
+func getProvisionedForwardZones(forwardZones *monkalev1alpha1.DNSForwardZoneList) []monkalev1alpha1.ProvisionedDNSForwardZone {
+	forwardZoneStats := []monkalev1alpha1.ProvisionedDNSForwardZone{}
+	for _, forwardZone := range forwardZones.Items {
+		forwardZoneStats = append(forwardZoneStats, monkalev1alpha1.ProvisionedDNSForwardZone{
+			Name:       forwardZone.Name,
+			Domain:     forwardZone.Spec.Domain,
+			Generation: forwardZone.Generation,
+		})
+	}
+	return forwardZoneStats
+}
+
+// getRevertedForwardZones compares the provisioned forward zones with the attempted ones.
+// Returns the forward zones that have been added, changed or removed by the reverted update.
+func getRevertedForwardZones(provisioned, attempted []monkalev1alpha1.ProvisionedDNSForwardZone) []monkalev1alpha1.ProvisionedDNSForwardZone {
+	reverted := []monkalev1alpha1.ProvisionedDNSForwardZone{}
+	provisionedSet := make(map[monkalev1alpha1.ProvisionedDNSForwardZone]bool)
+	for _, forwardZone := range provisioned {
+		provisionedSet[forwardZone] = true
+	}
+	attemptedNames := make(map[string]bool)
+	for _, forwardZone := range attempted {
+		attemptedNames[forwardZone.Name] = true
+		if !provisionedSet[forwardZone] {
+			reverted = append(reverted, forwardZone)
+		}
+	}
+	for _, forwardZone := range provisioned {
+		if !attemptedNames[forwardZone.Name] {
+			reverted = append(reverted, forwardZone)
+		}
+	}
+	return reverted
+}
+
+// equalProvisionedForwardZones returns true if both lists contain the same forward zones with the same generations.
+func equalProvisionedForwardZones(a, b []monkalev1alpha1.ProvisionedDNSForwardZone) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	forwardZoneSet := make(map[monkalev1alpha1.ProvisionedDNSForwardZone]int)
+	for _, forwardZone := range a {
+		forwardZoneSet[forwardZone]++
+	}
+	for _, forwardZone := range b {
+		if forwardZoneSet[forwardZone] == 0 {
+			return false
+		}
+		forwardZoneSet[forwardZone]--
+	}
+	return true
+}
+
+// countProvisionedForwardZoneChanges counts the forward zones added, removed or changed compared to the provisioned forward zones.
+func countProvisionedForwardZoneChanges(provisioned, upcoming []monkalev1alpha1.ProvisionedDNSForwardZone) int {
+	provisionedForwardZones := make(map[string]monkalev1alpha1.ProvisionedDNSForwardZone)
+	for _, forwardZone := range provisioned {
+		provisionedForwardZones[forwardZone.Name] = forwardZone
+	}
+	changes := 0
+	for _, forwardZone := range upcoming {
+		if provisionedForwardZone, ok := provisionedForwardZones[forwardZone.Name]; !ok || provisionedForwardZone != forwardZone {
+			changes++
+		}
+		delete(provisionedForwardZones, forwardZone.Name)
+	}
+	return changes + len(provisionedForwardZones)
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// HTTPRouteSourceReconciler publishes DNSRecords from Gateway API HTTPRoute hostnames
+type HTTPRouteSourceReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes/finalizers,verbs=update
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnsrecords,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnszones,verbs=get;list;watch
+
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.15.0/pkg/reconcile
+func (r *HTTPRouteSourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+	var httpRoute gatewayv1beta1.HTTPRoute
+
+	// Fetch HTTPRoute from kubernetes
+	if err := r.Get(ctx, req.NamespacedName, &httpRoute); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Log.Error(err, "HTTPRoute source. Failed to get HTTPRoute", "HTTPRoute.Name", req.Name, "HTTPRoute.Namespace", req.Namespace)
+		return ctrl.Result{}, err
+	}
+
+	targets, err := r.getHTTPRouteTargets(ctx, &httpRoute)
+	if err != nil {
+		log.Log.Error(err, "HTTPRoute source. Failed to get Gateway addresses", "HTTPRoute.Name", httpRoute.Name, "HTTPRoute.Namespace", httpRoute.Namespace)
+		return ctrl.Result{}, err
+	}
+
+	return reconcileSource(ctx, r.Client, sourceObject{
+		kind:      monkalev1alpha1.SourceKindHTTPRoute,
+		obj:       &httpRoute,
+		hostnames: getHTTPRouteHostnames(&httpRoute),
+		targets:   targets,
+	})
+}
+
+// getHTTPRouteHostnames returns the hostnames of the HTTPRoute.
+func getHTTPRouteHostnames(httpRoute *gatewayv1beta1.HTTPRoute) []string {
+	var hostnames []string
+	for _, hostname := range httpRoute.Spec.Hostnames {
+		hostnames = append(hostnames, string(hostname))
+	}
+	return normalizeHostnames(hostnames)
+}
+
+// getHTTPRouteGateways returns the Gateways referenced by the parentRefs of the HTTPRoute.
+func getHTTPRouteGateways(httpRoute *gatewayv1beta1.HTTPRoute) []types.NamespacedName {
+	var gateways []types.NamespacedName
+	for _, parentRef := range httpRoute.Spec.ParentRefs {
+		if parentRef.Group != nil && string(*parentRef.Group) != gatewayv1beta1.GroupName {
+			continue
+		}
+		if parentRef.Kind != nil && string(*parentRef.Kind) != "Gateway" {
+			continue
+		}
+		gateway := types.NamespacedName{Name: string(parentRef.Name), Namespace: httpRoute.Namespace}
+		if parentRef.Namespace != nil {
+			gateway.Namespace = string(*parentRef.Namespace)
+		}
+		gateways = append(gateways, gateway)
+	}
+	return gateways
+}
+
+// getHTTPRouteTargets returns the addresses of the Gateways the HTTPRoute is attached to.
+func (r *HTTPRouteSourceReconciler) getHTTPRouteTargets(ctx context.Context, httpRoute *gatewayv1beta1.HTTPRoute) ([]string, error) {
+	var targets []string
+	for _, gatewayObj := range getHTTPRouteGateways(httpRoute) {
+		var gateway gatewayv1beta1.Gateway
+		if err := r.Get(ctx, gatewayObj, &gateway); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get Gateway %s: %v", gatewayObj, err)
+		}
+		for _, address := range gateway.Status.Addresses {
+			if address.Type != nil && *address.Type != gatewayv1beta1.IPAddressType && *address.Type != gatewayv1beta1.HostnameAddressType {
+				continue
+			}
+			targets = append(targets, address.Value)
+		}
+	}
+	return targets, nil
+}
+
+// dnsRecordChangedReconcileRequest restores DNSRecords of the HTTPRoute if they have been changed or deleted by hand.
+func (r *HTTPRouteSourceReconciler) dnsRecordChangedReconcileRequest(ctx context.Context, obj client.Object) []reconcile.Request {
+	return sourceRecordReconcileRequest(monkalev1alpha1.SourceKindHTTPRoute, obj)
+}
+
+// dnsZoneChangedReconcileRequest reconciles all HTTPRoutes when DNSZones are created, changed or deleted.
+func (r *HTTPRouteSourceReconciler) dnsZoneChangedReconcileRequest(ctx context.Context, obj client.Object) []reconcile.Request {
+	return listSourceReconcileRequests(ctx, r.Client, &gatewayv1beta1.HTTPRouteList{}, nil)
+}
+
+// gatewayChangedReconcileRequest reconciles HTTPRoutes attached to the Gateway, when the Gateway addresses change.
+func (r *HTTPRouteSourceReconciler) gatewayChangedReconcileRequest(ctx context.Context, obj client.Object) []reconcile.Request {
+	gatewayObj := types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}
+	return listSourceReconcileRequests(ctx, r.Client, &gatewayv1beta1.HTTPRouteList{}, func(routeObj client.Object) bool {
+		httpRoute, ok := routeObj.(*gatewayv1beta1.HTTPRoute)
+		if !ok {
+			return false
+		}
+		for _, gateway := range getHTTPRouteGateways(httpRoute) {
+			if gateway == gatewayObj {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Gateways are watched, since the addresses published for HTTPRoutes are in the Gateway status.
+func (r *HTTPRouteSourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("httproute-source").
+		For(&gatewayv1beta1.HTTPRoute{}).
+		Watches(
+			&gatewayv1beta1.Gateway{},
+			handler.EnqueueRequestsFromMapFunc(r.gatewayChangedReconcileRequest)).
+		Watches(
+			&monkalev1alpha1.DNSRecord{},
+			handler.EnqueueRequestsFromMapFunc(r.dnsRecordChangedReconcileRequest),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(
+			&monkalev1alpha1.DNSZone{},
+			handler.EnqueueRequestsFromMapFunc(r.dnsZoneChangedReconcileRequest),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
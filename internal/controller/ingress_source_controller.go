@@ -0,0 +1,118 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// IngressSourceReconciler publishes DNSRecords from Ingress hosts
+type IngressSourceReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/finalizers,verbs=update
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnsrecords,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnszones,verbs=get;list;watch
+
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.15.0/pkg/reconcile
+func (r *IngressSourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+	var ingress networkingv1.Ingress
+
+	// Fetch Ingress from kubernetes
+	if err := r.Get(ctx, req.NamespacedName, &ingress); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Log.Error(err, "Ingress source. Failed to get Ingress", "Ingress.Name", req.Name, "Ingress.Namespace", req.Namespace)
+		return ctrl.Result{}, err
+	}
+
+	return reconcileSource(ctx, r.Client, sourceObject{
+		kind:      monkalev1alpha1.SourceKindIngress,
+		obj:       &ingress,
+		hostnames: getIngressHostnames(&ingress),
+		targets:   getIngressTargets(&ingress),
+	})
+}
+
+// getIngressHostnames returns the hosts of the Ingress rules.
+func getIngressHostnames(ingress *networkingv1.Ingress) []string {
+	var hostnames []string
+	for _, rule := range ingress.Spec.Rules {
+		hostnames = append(hostnames, rule.Host)
+	}
+	return normalizeHostnames(hostnames)
+}
+
+// getIngressTargets returns the load balancer addresses of the Ingress.
+func getIngressTargets(ingress *networkingv1.Ingress) []string {
+	var targets []string
+	for _, lbIngress := range ingress.Status.LoadBalancer.Ingress {
+		if lbIngress.IP != "" {
+			targets = append(targets, lbIngress.IP)
+		}
+		if lbIngress.Hostname != "" {
+			targets = append(targets, lbIngress.Hostname)
+		}
+	}
+	return targets
+}
+
+// dnsRecordChangedReconcileRequest restores DNSRecords of the Ingress if they have been changed or deleted by hand.
+func (r *IngressSourceReconciler) dnsRecordChangedReconcileRequest(ctx context.Context, obj client.Object) []reconcile.Request {
+	return sourceRecordReconcileRequest(monkalev1alpha1.SourceKindIngress, obj)
+}
+
+// dnsZoneChangedReconcileRequest reconciles all Ingresses when DNSZones are created, changed or deleted.
+func (r *IngressSourceReconciler) dnsZoneChangedReconcileRequest(ctx context.Context, obj client.Object) []reconcile.Request {
+	return listSourceReconcileRequests(ctx, r.Client, &networkingv1.IngressList{}, nil)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Ingress status is watched too, since the load balancer addresses are published there.
+func (r *IngressSourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("ingress-source").
+		For(&networkingv1.Ingress{}).
+		Watches(
+			&monkalev1alpha1.DNSRecord{},
+			handler.EnqueueRequestsFromMapFunc(r.dnsRecordChangedReconcileRequest),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(
+			&monkalev1alpha1.DNSZone{},
+			handler.EnqueueRequestsFromMapFunc(r.dnsZoneChangedReconcileRequest),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -23,8 +23,13 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
 )
 
+// deploymentProgressDeadlineExceeded is the reason of the Progressing condition of the Deployment that failed to progress within progressDeadlineSeconds.
+const deploymentProgressDeadlineExceeded string = "ProgressDeadlineExceeded"
+
 // Look up for object by resource name + name + namespace. Updates context.
 func getObjFromK8s(ctx context.Context, cl client.Client, obj types.NamespacedName, resource client.Object) error {
 	if err := cl.Get(ctx, obj, resource); err != nil {
@@ -33,17 +38,104 @@ func getObjFromK8s(ctx context.Context, cl client.Client, obj types.NamespacedNa
 	return nil
 }
 
-// isStatefulSetReady checks if the StatefulSet is ready
-func isStatefulSetReady(sts *appsv1.StatefulSet) bool {
-	return sts.Status.ReadyReplicas == *sts.Spec.Replicas
+// listDNSZoneRecords lists the DNSRecords of the DNSZone. The field index is not available outside of the cache,
+// so the DNSRecords of the namespace are filtered by hand.
+func listDNSZoneRecords(ctx context.Context, reader client.Reader, dnsZone *monkalev1alpha1.DNSZone) (monkalev1alpha1.DNSRecordList, error) {
+	allRecords := monkalev1alpha1.DNSRecordList{}
+	if err := reader.List(ctx, &allRecords, client.InNamespace(dnsZone.Namespace)); err != nil {
+		return monkalev1alpha1.DNSRecordList{}, fmt.Errorf("failed to list DNSRecords: %v", err)
+	}
+	zoneRecords := monkalev1alpha1.DNSRecordList{}
+	for _, dnsRecord := range allRecords.Items {
+		if dnsRecord.Spec.DNSZoneRef != nil && dnsRecord.Spec.DNSZoneRef.Name == dnsZone.Name {
+			zoneRecords.Items = append(zoneRecords.Items, dnsRecord)
+		}
+	}
+	return zoneRecords, nil
+}
+
+// isStatefulSetRolledOut checks if the StatefulSet has completed the rollout, the same way as kubectl rollout status does.
+// The OnDelete strategy never rolls out the pods, there is no rollout to wait for once the update has been observed.
+// Returns the reason while the rollout is in progress.
+func isStatefulSetRolledOut(sts *appsv1.StatefulSet) (bool, string, error) {
+	if sts.Status.ObservedGeneration == 0 || sts.Generation > sts.Status.ObservedGeneration {
+		return false, "waiting for statefulset spec update to be observed", nil
+	}
+	if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return true, "", nil
+	}
+	if sts.Spec.Replicas != nil && sts.Status.ReadyReplicas < *sts.Spec.Replicas {
+		return false, fmt.Sprintf("waiting for %d pods to be ready", *sts.Spec.Replicas-sts.Status.ReadyReplicas), nil
+	}
+	if rollingUpdate := sts.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil && sts.Spec.Replicas != nil {
+		if sts.Status.UpdatedReplicas < *sts.Spec.Replicas-*rollingUpdate.Partition {
+			return false, fmt.Sprintf("waiting for partitioned roll out to finish: %d out of %d new pods have been updated", sts.Status.UpdatedReplicas, *sts.Spec.Replicas-*rollingUpdate.Partition), nil
+		}
+		return true, "", nil
+	}
+	if sts.Status.UpdateRevision != sts.Status.CurrentRevision {
+		return false, fmt.Sprintf("waiting for statefulset rolling update to complete %d pods at revision %s", sts.Status.UpdatedReplicas, sts.Status.UpdateRevision), nil
+	}
+	return true, "", nil
+}
+
+// isDeploymentRolledOut checks if the Deployment has completed the rollout, the same way as kubectl rollout status does.
+// Returns the reason while the rollout is in progress, and an error if the progress deadline has been exceeded.
+func isDeploymentRolledOut(deploy *appsv1.Deployment) (bool, string, error) {
+	if deploy.Generation > deploy.Status.ObservedGeneration {
+		return false, "waiting for deployment spec update to be observed", nil
+	}
+	for _, condition := range deploy.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == deploymentProgressDeadlineExceeded {
+			return false, "", fmt.Errorf("deployment %s exceeded its progress deadline", deploy.Name)
+		}
+	}
+	if deploy.Spec.Replicas != nil && deploy.Status.UpdatedReplicas < *deploy.Spec.Replicas {
+		return false, fmt.Sprintf("waiting for rollout to finish: %d out of %d new replicas have been updated", deploy.Status.UpdatedReplicas, *deploy.Spec.Replicas), nil
+	}
+	if deploy.Status.Replicas > deploy.Status.UpdatedReplicas {
+		return false, fmt.Sprintf("waiting for rollout to finish: %d old replicas are pending termination", deploy.Status.Replicas-deploy.Status.UpdatedReplicas), nil
+	}
+	if deploy.Status.AvailableReplicas < deploy.Status.UpdatedReplicas {
+		return false, fmt.Sprintf("waiting for rollout to finish: %d of %d updated replicas are available", deploy.Status.AvailableReplicas, deploy.Status.UpdatedReplicas), nil
+	}
+	return true, "", nil
 }
 
-// isDeploymentReady checks if the Deployment is ready
-func isDeploymentReady(deploy *appsv1.Deployment) bool {
-	return deploy.Status.ReadyReplicas == *deploy.Spec.Replicas
+// isDaemonSetRolledOut checks if the DaemonSet has completed the rollout, the same way as kubectl rollout status does.
+// The OnDelete strategy never rolls out the pods, there is no rollout to wait for once the update has been observed.
+// Returns the reason while the rollout is in progress.
+func isDaemonSetRolledOut(ds *appsv1.DaemonSet) (bool, string, error) {
+	if ds.Generation > ds.Status.ObservedGeneration {
+		return false, "waiting for daemon set spec update to be observed", nil
+	}
+	if ds.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+		return true, "", nil
+	}
+	if ds.Status.UpdatedNumberScheduled < ds.Status.DesiredNumberScheduled {
+		return false, fmt.Sprintf("waiting for daemon set rollout to finish: %d out of %d new pods have been updated", ds.Status.UpdatedNumberScheduled, ds.Status.DesiredNumberScheduled), nil
+	}
+	if ds.Status.NumberAvailable < ds.Status.DesiredNumberScheduled {
+		return false, fmt.Sprintf("waiting for daemon set rollout to finish: %d of %d updated pods are available", ds.Status.NumberAvailable, ds.Status.DesiredNumberScheduled), nil
+	}
+	return true, "", nil
 }
 
-// isDaemonSetReady checks if the DaemonSet is ready
-func isDaemonSetReady(ds *appsv1.DaemonSet) bool {
-	return ds.Status.NumberReady == ds.Status.DesiredNumberScheduled
+// isCorednsRolledOut checks if the provided StatefulSet, Deployment, or DaemonSet has completed the rollout of the given generation.
+// Returns the reason while the rollout is in progress, and an error if the rollout has failed or can not be tracked.
+func isCorednsRolledOut(corednsDeployment client.Object, generation int64) (bool, string, error) {
+	// the cache has not seen the update yet
+	if corednsDeployment.GetGeneration() < generation {
+		return false, "waiting for the update to be observed", nil
+	}
+	switch res := corednsDeployment.(type) {
+	case *appsv1.StatefulSet:
+		return isStatefulSetRolledOut(res)
+	case *appsv1.Deployment:
+		return isDeploymentRolledOut(res)
+	case *appsv1.DaemonSet:
+		return isDaemonSetRolledOut(res)
+	default:
+		return false, "", fmt.Errorf("unsupported resource type: %T", res)
+	}
 }
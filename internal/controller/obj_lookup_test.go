@@ -0,0 +1,151 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestIsDeploymentRolledOut(t *testing.T) {
+	deployment := func(replicas *int32, status appsv1.DeploymentStatus) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "coredns", Generation: 2},
+			Spec:       appsv1.DeploymentSpec{Replicas: replicas},
+			Status:     status,
+		}
+	}
+	progressDeadlineExceeded := []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: deploymentProgressDeadlineExceeded}}
+	tests := []struct {
+		name       string
+		deployment *appsv1.Deployment
+		want       bool
+		wantErr    bool
+	}{
+		{name: "rolled out", deployment: deployment(int32Ptr(2), appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}), want: true},
+		{name: "generation not observed", deployment: deployment(int32Ptr(2), appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2})},
+		{name: "replicas not updated", deployment: deployment(int32Ptr(2), appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, AvailableReplicas: 2})},
+		{name: "old replicas pending termination", deployment: deployment(int32Ptr(2), appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2})},
+		{name: "updated replicas not available", deployment: deployment(int32Ptr(2), appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1})},
+		{name: "unset replicas", deployment: deployment(nil, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}), want: true},
+		{name: "progress deadline exceeded", deployment: deployment(int32Ptr(2), appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, Conditions: progressDeadlineExceeded}), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason, err := isDeploymentRolledOut(tt.deployment)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("isDeploymentRolledOut() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("isDeploymentRolledOut() = %v, want %v", got, tt.want)
+			}
+			if !got && !tt.wantErr && reason == "" {
+				t.Errorf("isDeploymentRolledOut() in progress without the reason")
+			}
+		})
+	}
+}
+
+func TestIsStatefulSetRolledOut(t *testing.T) {
+	statefulSet := func(strategy appsv1.StatefulSetUpdateStrategy, status appsv1.StatefulSetStatus) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "coredns", Generation: 2},
+			Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(3), UpdateStrategy: strategy},
+			Status:     status,
+		}
+	}
+	rollingUpdate := appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}
+	partitioned := appsv1.StatefulSetUpdateStrategy{
+		Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: int32Ptr(1)},
+	}
+	onDelete := appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+	tests := []struct {
+		name        string
+		statefulSet *appsv1.StatefulSet
+		want        bool
+	}{
+		{name: "rolled out", statefulSet: statefulSet(rollingUpdate, appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 3, CurrentRevision: "r2", UpdateRevision: "r2"}), want: true},
+		{name: "generation not observed", statefulSet: statefulSet(rollingUpdate, appsv1.StatefulSetStatus{ObservedGeneration: 1, ReadyReplicas: 3, CurrentRevision: "r2", UpdateRevision: "r2"})},
+		{name: "observed generation unset", statefulSet: statefulSet(rollingUpdate, appsv1.StatefulSetStatus{ReadyReplicas: 3, CurrentRevision: "r2", UpdateRevision: "r2"})},
+		{name: "replicas not ready", statefulSet: statefulSet(rollingUpdate, appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 2, CurrentRevision: "r2", UpdateRevision: "r2"})},
+		{name: "revision not rolled out", statefulSet: statefulSet(rollingUpdate, appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 1, CurrentRevision: "r1", UpdateRevision: "r2"})},
+		{name: "partition rolled out", statefulSet: statefulSet(partitioned, appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 2, CurrentRevision: "r1", UpdateRevision: "r2"}), want: true},
+		{name: "partition not rolled out", statefulSet: statefulSet(partitioned, appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 1, CurrentRevision: "r1", UpdateRevision: "r2"})},
+		{name: "OnDelete observed", statefulSet: statefulSet(onDelete, appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, CurrentRevision: "r1", UpdateRevision: "r2"}), want: true},
+		{name: "OnDelete generation not observed", statefulSet: statefulSet(onDelete, appsv1.StatefulSetStatus{ObservedGeneration: 1, ReadyReplicas: 3})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason, err := isStatefulSetRolledOut(tt.statefulSet)
+			if err != nil {
+				t.Fatalf("isStatefulSetRolledOut() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("isStatefulSetRolledOut() = %v, want %v", got, tt.want)
+			}
+			if !got && reason == "" {
+				t.Errorf("isStatefulSetRolledOut() in progress without the reason")
+			}
+		})
+	}
+}
+
+func TestIsDaemonSetRolledOut(t *testing.T) {
+	daemonSet := func(strategy appsv1.DaemonSetUpdateStrategyType, status appsv1.DaemonSetStatus) *appsv1.DaemonSet {
+		return &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "coredns", Generation: 2},
+			Spec:       appsv1.DaemonSetSpec{UpdateStrategy: appsv1.DaemonSetUpdateStrategy{Type: strategy}},
+			Status:     status,
+		}
+	}
+	rollingUpdate := appsv1.RollingUpdateDaemonSetStrategyType
+	onDelete := appsv1.OnDeleteDaemonSetStrategyType
+	tests := []struct {
+		name      string
+		daemonSet *appsv1.DaemonSet
+		want      bool
+	}{
+		{name: "rolled out", daemonSet: daemonSet(rollingUpdate, appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 3}), want: true},
+		{name: "generation not observed", daemonSet: daemonSet(rollingUpdate, appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 3})},
+		{name: "pods not updated", daemonSet: daemonSet(rollingUpdate, appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 2, NumberAvailable: 3})},
+		{name: "pods not available", daemonSet: daemonSet(rollingUpdate, appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 2})},
+		{name: "OnDelete observed", daemonSet: daemonSet(onDelete, appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 0, NumberAvailable: 3}), want: true},
+		{name: "OnDelete generation not observed", daemonSet: daemonSet(onDelete, appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 3})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason, err := isDaemonSetRolledOut(tt.daemonSet)
+			if err != nil {
+				t.Fatalf("isDaemonSetRolledOut() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("isDaemonSetRolledOut() = %v, want %v", got, tt.want)
+			}
+			if !got && reason == "" {
+				t.Errorf("isDaemonSetRolledOut() in progress without the reason")
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+const (
+	corednsDNSPort              string        = "53"            // corednsDNSPort is the port of the generated server blocks
+	corednsSOAQueryTimeout      time.Duration = 2 * time.Second // corednsSOAQueryTimeout limits the SOA query sent to CoreDNS
+	corednsSOACheckTimeout      time.Duration = 5 * time.Second // corednsSOACheckTimeout limits all SOA queries of one verification check
+	corednsSOAQueryConcurrency  int           = 16              // corednsSOAQueryConcurrency is the number of the SOA queries sent to CoreDNS at once
+	corednsRolloutCheckInterval time.Duration = 5 * time.Second // corednsRolloutCheckInterval is how often the rollout in progress is checked
+)
+
+// setRolloutPhase moves the rollout of the DNSConnector to the phase. The transition time is updated only if the phase changes.
+func setRolloutPhase(dnsConnector *monkalev1alpha1.DNSConnector, phase, message string) {
+	if dnsConnector.Status.Rollout == nil {
+		dnsConnector.Status.Rollout = &monkalev1alpha1.ConnectorRollout{}
+	}
+	rollout := dnsConnector.Status.Rollout
+	if rollout.Phase != phase {
+		rollout.Phase = phase
+		rollout.LastTransitionTime = metav1.Now()
+	}
+	rollout.Message = message
+}
+
+// deferRollout records the pending changes of the DNSConnector, and returns how long the rollout is deferred,
+// so the changes arriving within spec.minRolloutInterval since the first of them are rolled out together.
+func deferRollout(dnsConnector *monkalev1alpha1.DNSConnector, pendingChanges int, now time.Time) time.Duration {
+	interval := time.Duration(dnsConnector.Spec.MinRolloutInterval) * time.Second
+	if pendingChanges == 0 || interval <= 0 {
+		return 0
+	}
+	if dnsConnector.Status.PendingSince == nil {
+		dnsConnector.Status.PendingSince = &metav1.Time{Time: now}
+	}
+	dnsConnector.Status.PendingChanges = pendingChanges
+	return dnsConnector.Status.PendingSince.Add(interval).Sub(now)
+}
+
+// isRolloutInProgress checks whether the applied changes are being rolled out.
+// The rollout in the Applying phase has been interrupted, the changes are applied again.
+func isRolloutInProgress(rollout *monkalev1alpha1.ConnectorRollout) bool {
+	return rollout != nil && (rollout.Phase == monkalev1alpha1.RolloutPhaseWaitingForRollout || rollout.Phase == monkalev1alpha1.RolloutPhaseVerifying)
+}
+
+// isRolloutTimedOut checks whether the rollout has been in the current phase longer than the timeout.
+func isRolloutTimedOut(rollout *monkalev1alpha1.ConnectorRollout, timeout time.Duration) bool {
+	return time.Since(rollout.LastTransitionTime.Time) > timeout
+}
+
+// getRolloutRequeueAfter returns when the rollout is checked again: after the check interval, or when the phase times out.
+func getRolloutRequeueAfter(rollout *monkalev1alpha1.ConnectorRollout, timeout time.Duration) time.Duration {
+	remaining := time.Until(rollout.LastTransitionTime.Add(timeout))
+	if remaining > 0 && remaining < corednsRolloutCheckInterval {
+		return remaining
+	}
+	return corednsRolloutCheckInterval
+}
+
+// getRolloutDNSZones returns the DNSZones being rolled out.
+func getRolloutDNSZones(dnsZones *monkalev1alpha1.DNSZoneList, zones []monkalev1alpha1.ProvisionedDNSZone) monkalev1alpha1.DNSZoneList {
+	zoneNames := make(map[string]bool)
+	for _, zone := range zones {
+		zoneNames[zone.Name] = true
+	}
+	rolloutZones := monkalev1alpha1.DNSZoneList{}
+	for _, dnsZone := range dnsZones.Items {
+		if zoneNames[dnsZone.Name] {
+			rolloutZones.Items = append(rolloutZones.Items, dnsZone)
+		}
+	}
+	return rolloutZones
+}
+
+// getRolloutForwardZones returns the DNSForwardZones being rolled out.
+func getRolloutForwardZones(forwardZones *monkalev1alpha1.DNSForwardZoneList, zones []monkalev1alpha1.ProvisionedDNSForwardZone) monkalev1alpha1.DNSForwardZoneList {
+	zoneNames := make(map[string]bool)
+	for _, zone := range zones {
+		zoneNames[zone.Name] = true
+	}
+	rolloutForwardZones := monkalev1alpha1.DNSForwardZoneList{}
+	for _, forwardZone := range forwardZones.Items {
+		if zoneNames[forwardZone.Name] {
+			rolloutForwardZones.Items = append(rolloutForwardZones.Items, forwardZone)
+		}
+	}
+	return rolloutForwardZones
+}
+
+// getReloadZoneFileVolumes returns the zonefile volumes and volume mounts of the Reload rollout strategy sorted by name.
+// Every zonefile configmap is mounted as a directory, so the kubelet updates the zonefile in place. The volumes depend
+// on the set of zones only, the pod template is not changed by the record changes.
+func getReloadZoneFileVolumes(dnsConnector *monkalev1alpha1.DNSConnector, configMaps *corev1.ConfigMapList) ([]corev1.Volume, []corev1.VolumeMount, error) {
+	desiredVolumes, err := getDesiredVolumes(configMaps)
+	if err != nil {
+		return nil, nil, err
+	}
+	volumeNames := make([]string, 0, len(desiredVolumes))
+	for volumeName := range desiredVolumes {
+		volumeNames = append(volumeNames, volumeName)
+	}
+	sort.Strings(volumeNames)
+
+	volumes := make([]corev1.Volume, 0, len(volumeNames))
+	volumeMounts := make([]corev1.VolumeMount, 0, len(volumeNames))
+	for _, volumeName := range volumeNames {
+		configMapName := desiredVolumes[volumeName][0]
+		cmZoneKey := desiredVolumes[volumeName][1]
+		volumes = append(volumes, corev1.Volume{
+			Name: volumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: configMapName,
+					},
+					Items: []corev1.KeyToPath{
+						{
+							Key:  cmZoneKey,
+							Path: cmZoneKey,
+						},
+					},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: fmt.Sprintf("%s/%s", dnsConnector.Spec.CorednsDeployment.ZoneFileMountDir, volumeName),
+			ReadOnly:  true,
+		})
+	}
+	return volumes, volumeMounts, nil
+}
+
+// zoneSerial is the serial of the zone CoreDNS is expected to serve.
+type zoneSerial struct {
+	name   string
+	domain string
+	serial uint32
+}
+
+// getRolloutZoneSerials returns the serials of the zone ConfigMaps applied by the rollout.
+// Zones without the serial, e.g. Secondary zones whose serial is controlled by the primaries, are skipped.
+func getRolloutZoneSerials(zones []monkalev1alpha1.ProvisionedDNSZone) ([]zoneSerial, error) {
+	serials := []zoneSerial{}
+	for _, zone := range zones {
+		if zone.SerialNumber == "" {
+			continue
+		}
+		serial, err := strconv.ParseUint(zone.SerialNumber, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad serial of the DNSZone %s: %v", zone.Name, err)
+		}
+		serials = append(serials, zoneSerial{name: zone.Name, domain: dns.Fqdn(zone.Domain), serial: uint32(serial)})
+	}
+	sort.Slice(serials, func(i, j int) bool {
+		return serials[i].name < serials[j].name
+	})
+	return serials, nil
+}
+
+// getVerificationAddress returns the configured verification address with the port. The default port is 53.
+func getVerificationAddress(address string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.Trim(address, "[]"), corednsDNSPort)
+}
+
+// getPodVerificationTargets returns the addresses of the ready CoreDNS pods by the pod name.
+func getPodVerificationTargets(pods *corev1.PodList) map[string]string {
+	targets := make(map[string]string)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if isPodReady(pod) {
+			targets["pod "+pod.Name] = net.JoinHostPort(pod.Status.PodIP, corednsDNSPort)
+		}
+	}
+	return targets
+}
+
+// getCorednsPodSelector returns the pod selector of the provided StatefulSet, Deployment, or DaemonSet.
+func getCorednsPodSelector(corednsDeployment client.Object) (labels.Selector, error) {
+	var selector *metav1.LabelSelector
+	switch res := corednsDeployment.(type) {
+	case *appsv1.StatefulSet:
+		selector = res.Spec.Selector
+	case *appsv1.Deployment:
+		selector = res.Spec.Selector
+	case *appsv1.DaemonSet:
+		selector = res.Spec.Selector
+	default:
+		return nil, fmt.Errorf("unsupported resource type: %T", res)
+	}
+	if selector == nil {
+		return nil, fmt.Errorf("%s has no pod selector", corednsDeployment.GetName())
+	}
+	return metav1.LabelSelectorAsSelector(selector)
+}
+
+// isPodReady checks if the pod is ready to serve queries.
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.PodIP == "" {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// queryZoneSerial queries the SOA record of the zone served at the address and returns its serial.
+func queryZoneSerial(ctx context.Context, address, domainName string) (uint32, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domainName), dns.TypeSOA)
+	msg.RecursionDesired = false
+	dnsClient := &dns.Client{Timeout: corednsSOAQueryTimeout}
+	resp, _, err := dnsClient.ExchangeContext(ctx, msg, address)
+	if err != nil {
+		return 0, fmt.Errorf("SOA query failed: %v", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return 0, fmt.Errorf("SOA query failed: %s", dns.RcodeToString[resp.Rcode])
+	}
+	for _, rr := range resp.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf("no SOA record in the answer")
+}
+
+// checkServedSerials queries every target for the SOA of every zone. Returns the mismatches by the DNSZone name,
+// the zones served with the expected or a newer serial by all targets are not listed.
+// The queries are sent concurrently, and all of them are limited by corednsSOACheckTimeout, so the check does not stall the reconcile.
+func checkServedSerials(ctx context.Context, targets map[string]string, zones []zoneSerial) map[string]string {
+	targetNames := make([]string, 0, len(targets))
+	for targetName := range targets {
+		targetNames = append(targetNames, targetName)
+	}
+	sort.Strings(targetNames)
+
+	type queryResult struct {
+		serial uint32
+		err    error
+	}
+	results := make([][]queryResult, len(zones))
+	for i := range results {
+		results[i] = make([]queryResult, len(targetNames))
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, corednsSOACheckTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, corednsSOAQueryConcurrency)
+	for i, zone := range zones {
+		for j, targetName := range targetNames {
+			wg.Add(1)
+			go func(i, j int, address, domain string) {
+				defer wg.Done()
+				select {
+				case semaphore <- struct{}{}:
+					defer func() { <-semaphore }()
+				case <-checkCtx.Done():
+					results[i][j].err = fmt.Errorf("SOA query failed: %v", checkCtx.Err())
+					return
+				}
+				results[i][j].serial, results[i][j].err = queryZoneSerial(checkCtx, address, domain)
+			}(i, j, targets[targetName], zone.domain)
+		}
+	}
+	wg.Wait()
+
+	// the first target in the order of the names is reported, so the message does not change between the checks
+	mismatches := make(map[string]string)
+	for i, zone := range zones {
+		if len(targetNames) == 0 {
+			mismatches[zone.name] = "no ready coredns pods"
+			continue
+		}
+		for j, targetName := range targetNames {
+			served, err := results[i][j].serial, results[i][j].err
+			if err != nil {
+				mismatches[zone.name] = fmt.Sprintf("%s: %v", targetName, err)
+				break
+			}
+			// the zone rendered again during the rollout may already be served with a newer serial
+			if served != zone.serial && !monkalev1alpha1.SerialIsGreater(served, zone.serial) {
+				mismatches[zone.name] = fmt.Sprintf("%s serves serial %d, expected %d", targetName, served, zone.serial)
+				break
+			}
+		}
+	}
+	return mismatches
+}
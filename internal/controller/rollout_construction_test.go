@@ -0,0 +1,63 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+func TestRolloutTimeout(t *testing.T) {
+	const timeout = 2 * time.Minute
+	tests := []struct {
+		name             string
+		phaseAge         time.Duration
+		wantTimedOut     bool
+		wantRequeueAfter time.Duration
+		maxRequeueAfter  time.Duration
+	}{
+		{name: "phase just started", phaseAge: 0, wantRequeueAfter: corednsRolloutCheckInterval},
+		{name: "timeout far away", phaseAge: time.Minute, wantRequeueAfter: corednsRolloutCheckInterval},
+		{name: "timeout within the check interval", phaseAge: timeout - 2*time.Second, maxRequeueAfter: 2 * time.Second},
+		{name: "timed out", phaseAge: timeout + time.Second, wantTimedOut: true, wantRequeueAfter: corednsRolloutCheckInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rollout := &monkalev1alpha1.ConnectorRollout{
+				Phase:              monkalev1alpha1.RolloutPhaseWaitingForRollout,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-tt.phaseAge)),
+			}
+			if got := isRolloutTimedOut(rollout, timeout); got != tt.wantTimedOut {
+				t.Errorf("isRolloutTimedOut() = %v, want %v", got, tt.wantTimedOut)
+			}
+			got := getRolloutRequeueAfter(rollout, timeout)
+			if tt.maxRequeueAfter > 0 {
+				if got <= 0 || got > tt.maxRequeueAfter {
+					t.Errorf("getRolloutRequeueAfter() = %v, want within (0, %v]", got, tt.maxRequeueAfter)
+				}
+				return
+			}
+			if got != tt.wantRequeueAfter {
+				t.Errorf("getRolloutRequeueAfter() = %v, want %v", got, tt.wantRequeueAfter)
+			}
+		})
+	}
+}
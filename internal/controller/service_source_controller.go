@@ -0,0 +1,139 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// ServiceSourceReconciler publishes DNSRecords from annotated Services
+type ServiceSourceReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=core,resources=services/finalizers,verbs=update
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnsrecords,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monkale.monkale.io,resources=dnszones,verbs=get;list;watch
+
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.15.0/pkg/reconcile
+func (r *ServiceSourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+	var service corev1.Service
+
+	// Fetch Service from kubernetes
+	if err := r.Get(ctx, req.NamespacedName, &service); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Log.Error(err, "Service source. Failed to get Service", "Service.Name", req.Name, "Service.Namespace", req.Namespace)
+		return ctrl.Result{}, err
+	}
+
+	return reconcileSource(ctx, r.Client, sourceObject{
+		kind:      monkalev1alpha1.SourceKindService,
+		obj:       &service,
+		hostnames: getSourceHostnames(&service),
+		targets:   getServiceTargets(&service),
+	})
+}
+
+// getServiceTargets returns the addresses of the Service in the order of preference:
+// LoadBalancer ingress for LoadBalancer Services, external IPs, cluster IPs. ExternalName Services are published as CNAME.
+func getServiceTargets(service *corev1.Service) []string {
+	var targets []string
+	switch service.Spec.Type {
+	case corev1.ServiceTypeExternalName:
+		if service.Spec.ExternalName != "" {
+			targets = append(targets, service.Spec.ExternalName)
+		}
+		return targets
+	case corev1.ServiceTypeLoadBalancer:
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				targets = append(targets, ingress.IP)
+			}
+			if ingress.Hostname != "" {
+				targets = append(targets, ingress.Hostname)
+			}
+		}
+		return targets
+	}
+
+	if len(service.Spec.ExternalIPs) > 0 {
+		return append(targets, service.Spec.ExternalIPs...)
+	}
+	clusterIPs := service.Spec.ClusterIPs
+	if len(clusterIPs) == 0 && service.Spec.ClusterIP != "" {
+		clusterIPs = []string{service.Spec.ClusterIP}
+	}
+	for _, ip := range clusterIPs {
+		if ip != "" && ip != corev1.ClusterIPNone {
+			targets = append(targets, ip)
+		}
+	}
+	return targets
+}
+
+// serviceSourcePredicate passes only Services which are annotated or still have DNSRecords to clean up.
+func serviceSourcePredicate(obj client.Object) bool {
+	_, annotated := obj.GetAnnotations()[monkalev1alpha1.SourceHostnameAnnotation]
+	return annotated || controllerutil.ContainsFinalizer(obj, monkalev1alpha1.SourceFinalizerName)
+}
+
+// dnsRecordChangedReconcileRequest restores DNSRecords of the Service if they have been changed or deleted by hand.
+func (r *ServiceSourceReconciler) dnsRecordChangedReconcileRequest(ctx context.Context, obj client.Object) []reconcile.Request {
+	return sourceRecordReconcileRequest(monkalev1alpha1.SourceKindService, obj)
+}
+
+// dnsZoneChangedReconcileRequest reconciles annotated Services when DNSZones are created, changed or deleted.
+func (r *ServiceSourceReconciler) dnsZoneChangedReconcileRequest(ctx context.Context, obj client.Object) []reconcile.Request {
+	return listSourceReconcileRequests(ctx, r.Client, &corev1.ServiceList{}, serviceSourcePredicate)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Service status is watched too, since LoadBalancer ingress is published there.
+func (r *ServiceSourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("service-source").
+		For(&corev1.Service{}, builder.WithPredicates(predicate.NewPredicateFuncs(serviceSourcePredicate))).
+		Watches(
+			&monkalev1alpha1.DNSRecord{},
+			handler.EnqueueRequestsFromMapFunc(r.dnsRecordChangedReconcileRequest),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(
+			&monkalev1alpha1.DNSZone{},
+			handler.EnqueueRequestsFromMapFunc(r.dnsZoneChangedReconcileRequest),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
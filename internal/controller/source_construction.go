@@ -0,0 +1,337 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// getSourceHostnames parses the hostname annotation of the source object.
+func getSourceHostnames(obj client.Object) []string {
+	return normalizeHostnames(strings.Split(obj.GetAnnotations()[monkalev1alpha1.SourceHostnameAnnotation], ","))
+}
+
+// normalizeHostnames converts hostnames to lower case FQDNs and removes empty and duplicate ones.
+func normalizeHostnames(hostnames []string) []string {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, hostname := range hostnames {
+		hostname = strings.ToLower(strings.TrimSpace(hostname))
+		if hostname == "" || seen[dns.Fqdn(hostname)] {
+			continue
+		}
+		seen[dns.Fqdn(hostname)] = true
+		normalized = append(normalized, dns.Fqdn(hostname))
+	}
+	return normalized
+}
+
+// getSourceDNSZoneRef parses the DNSZone annotation of the source object.
+// The DNSZone can be referenced as "name" (same namespace as the source object) or "namespace/name".
+// Returns false if the annotation is not set.
+func getSourceDNSZoneRef(obj client.Object) (types.NamespacedName, bool, error) {
+	ref := strings.TrimSpace(obj.GetAnnotations()[monkalev1alpha1.SourceDNSZoneAnnotation])
+	if ref == "" {
+		return types.NamespacedName{}, false, nil
+	}
+	parts := strings.Split(ref, "/")
+	switch {
+	case len(parts) == 1:
+		return types.NamespacedName{Namespace: obj.GetNamespace(), Name: parts[0]}, true, nil
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, true, nil
+	default:
+		return types.NamespacedName{}, true, fmt.Errorf("bad %s annotation %q, expected \"name\" or \"namespace/name\"", monkalev1alpha1.SourceDNSZoneAnnotation, ref)
+	}
+}
+
+// getSourceTTL parses the TTL annotation of the source object. Empty TTL means the zone default.
+func getSourceTTL(obj client.Object) (string, error) {
+	ttl := strings.TrimSpace(obj.GetAnnotations()[monkalev1alpha1.SourceTTLAnnotation])
+	if ttl == "" {
+		return "", nil
+	}
+	if _, err := strconv.ParseUint(ttl, 10, 31); err != nil {
+		return "", fmt.Errorf("bad %s annotation %q: %v", monkalev1alpha1.SourceTTLAnnotation, ttl, err)
+	}
+	return ttl, nil
+}
+
+// hostnameInZone checks whether the hostname belongs to the domain of the zone.
+func hostnameInZone(hostname, domain string) bool {
+	return dns.IsSubDomain(dns.Fqdn(strings.ToLower(domain)), dns.Fqdn(strings.ToLower(hostname)))
+}
+
+// getLongestMatchingDNSZone returns the DNSZone whose domain is the longest matching suffix of the hostname.
+func getLongestMatchingDNSZone(hostname string, dnsZones []monkalev1alpha1.DNSZone) (*monkalev1alpha1.DNSZone, bool) {
+	var match *monkalev1alpha1.DNSZone
+	for i := range dnsZones {
+		if !hostnameInZone(hostname, dnsZones[i].Spec.Domain) {
+			continue
+		}
+		if match == nil || dns.CountLabel(dns.Fqdn(dnsZones[i].Spec.Domain)) > dns.CountLabel(dns.Fqdn(match.Spec.Domain)) {
+			match = &dnsZones[i]
+		}
+	}
+	return match, match != nil
+}
+
+// isSourceAllowed checks whether the sources of the namespace may publish records into the DNSZone.
+// The sources in the namespace of the DNSZone are always allowed, the other namespaces must be listed in spec.allowedSourceNamespaces.
+func isSourceAllowed(dnsZone *monkalev1alpha1.DNSZone, namespace string) bool {
+	if namespace == dnsZone.Namespace {
+		return true
+	}
+	for _, allowed := range dnsZone.Spec.AllowedSourceNamespaces {
+		if allowed == namespace || allowed == monkalev1alpha1.SourceNamespacesAll {
+			return true
+		}
+	}
+	return false
+}
+
+// getSourceRecordLabels returns the labels which tie DNSRecords to their source object.
+func getSourceRecordLabels(sourceKind string, source types.NamespacedName) map[string]string {
+	return map[string]string{
+		monkalev1alpha1.SourceKindLabel:      sourceKind,
+		monkalev1alpha1.SourceNamespaceLabel: source.Namespace,
+		monkalev1alpha1.SourceNameLabel:      getSourceNameLabelValue(source.Name),
+	}
+}
+
+// getSourceRecordAnnotations returns the annotations which keep the full name of the source object of DNSRecords.
+func getSourceRecordAnnotations(source types.NamespacedName) map[string]string {
+	return map[string]string{
+		monkalev1alpha1.SourceNameAnnotation: source.Name,
+	}
+}
+
+// getSourceNameLabelValue returns the value of the source name label. Object names may be longer than a label value,
+// such names are truncated and suffixed with the hash of the full name.
+func getSourceNameLabelValue(name string) string {
+	if len(validation.IsValidLabelValue(name)) == 0 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	prefix := strings.TrimRight(name[:validation.LabelValueMaxLength-11], "-.")
+	return prefix + "-" + hex.EncodeToString(sum[:])[:10]
+}
+
+// isSourceRecordOf checks whether the DNSRecord has been published by the source object.
+// The DNSRecords without the source name annotation, created by the earlier versions, are matched by the labels only.
+func isSourceRecordOf(dnsRecord client.Object, sourceKind string, source types.NamespacedName) bool {
+	labels := dnsRecord.GetLabels()
+	if labels[monkalev1alpha1.SourceKindLabel] != sourceKind ||
+		labels[monkalev1alpha1.SourceNamespaceLabel] != source.Namespace ||
+		labels[monkalev1alpha1.SourceNameLabel] != getSourceNameLabelValue(source.Name) {
+		return false
+	}
+	name, found := dnsRecord.GetAnnotations()[monkalev1alpha1.SourceNameAnnotation]
+	return !found || name == source.Name
+}
+
+// getSourceRecordName generates the DNSRecord name for the hostname and the record type published by the source object.
+// Falls back to the hash of the hostname if the readable name is not a valid resource name.
+func getSourceRecordName(sourceKind string, source types.NamespacedName, hostname, recordType string) string {
+	host := strings.TrimSuffix(hostname, ".")
+	host = strings.ReplaceAll(host, "*", "wildcard")
+	host = strings.ReplaceAll(host, ".", "-")
+	name := strings.ToLower(fmt.Sprintf("%s-%s-%s-%s-%s", sourceKind, source.Namespace, source.Name, host, recordType))
+	if len(validation.IsDNS1123Subdomain(name)) == 0 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(hostname))
+	name = strings.ToLower(fmt.Sprintf("%s-%s-%s-%s-%s", sourceKind, source.Namespace, source.Name, hex.EncodeToString(sum[:])[:10], recordType))
+	if len(validation.IsDNS1123Subdomain(name)) == 0 {
+		return name
+	}
+	sum = sha256.Sum256([]byte(source.String() + "/" + hostname))
+	return strings.ToLower(fmt.Sprintf("%s-%s-%s", sourceKind, hex.EncodeToString(sum[:])[:20], recordType))
+}
+
+// constructSourceRecords generates DNSRecords publishing the targets under the hostnames.
+// IPv4 targets are published as A RRset, IPv6 targets as AAAA RRset. A hostname target is published as CNAME,
+// only if there are no IP targets, since CNAME cannot coexist with other records.
+func constructSourceRecords(sourceKind string, source types.NamespacedName, zone types.NamespacedName, hostnames, targets []string, ttl string) []monkalev1alpha1.DNSRecord {
+	var ipv4, ipv6, aliases []string
+	for _, target := range targets {
+		if ip := net.ParseIP(target); ip != nil {
+			if ip.To4() != nil {
+				ipv4 = append(ipv4, ip.String())
+			} else {
+				ipv6 = append(ipv6, ip.String())
+			}
+			continue
+		}
+		aliases = append(aliases, dns.Fqdn(strings.ToLower(target)))
+	}
+	sort.Strings(ipv4)
+	sort.Strings(ipv6)
+	sort.Strings(aliases)
+
+	rrsets := map[string][]string{}
+	if len(ipv4) > 0 {
+		rrsets["A"] = uniqueStrings(ipv4)
+	}
+	if len(ipv6) > 0 {
+		rrsets["AAAA"] = uniqueStrings(ipv6)
+	}
+	if len(rrsets) == 0 && len(aliases) > 0 {
+		rrsets["CNAME"] = aliases[:1]
+	}
+
+	var dnsRecords []monkalev1alpha1.DNSRecord
+	for _, hostname := range hostnames {
+		for _, recordType := range []string{"A", "AAAA", "CNAME"} {
+			values, ok := rrsets[recordType]
+			if !ok {
+				continue
+			}
+			record := monkalev1alpha1.Record{Name: hostname, Type: recordType, TTL: ttl}
+			if len(values) == 1 {
+				record.Value = values[0]
+			} else {
+				record.Values = values
+			}
+			dnsRecords = append(dnsRecords, monkalev1alpha1.DNSRecord{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        getSourceRecordName(sourceKind, source, hostname, recordType),
+					Namespace:   zone.Namespace,
+					Labels:      getSourceRecordLabels(sourceKind, source),
+					Annotations: getSourceRecordAnnotations(source),
+				},
+				Spec: monkalev1alpha1.DNSRecordSpec{
+					Record:     &record,
+					DNSZoneRef: &corev1.ObjectReference{Name: zone.Name},
+				},
+			})
+		}
+	}
+	return dnsRecords
+}
+
+// uniqueStrings removes duplicates from the sorted slice.
+func uniqueStrings(sorted []string) []string {
+	var unique []string
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
+// listSourceRecords lists DNSRecords published by the source object in all namespaces.
+func listSourceRecords(ctx context.Context, cl client.Client, sourceKind string, source types.NamespacedName) (*monkalev1alpha1.DNSRecordList, error) {
+	var dnsRecords monkalev1alpha1.DNSRecordList
+	if err := cl.List(ctx, &dnsRecords, client.MatchingLabels(getSourceRecordLabels(sourceKind, source))); err != nil {
+		return nil, fmt.Errorf("failed to list DNSRecords of %s %s: %v", sourceKind, source, err)
+	}
+	// The truncated names of different sources may share the label value.
+	items := dnsRecords.Items[:0]
+	for i := range dnsRecords.Items {
+		if isSourceRecordOf(&dnsRecords.Items[i], sourceKind, source) {
+			items = append(items, dnsRecords.Items[i])
+		}
+	}
+	dnsRecords.Items = items
+	return &dnsRecords, nil
+}
+
+// applySourceRecords creates or updates the desired DNSRecords of the source object and deletes the ones no longer desired.
+func applySourceRecords(ctx context.Context, cl client.Client, sourceKind string, source types.NamespacedName, desired []monkalev1alpha1.DNSRecord) error {
+	existing, err := listSourceRecords(ctx, cl, sourceKind, source)
+	if err != nil {
+		return err
+	}
+	existingByName := map[types.NamespacedName]*monkalev1alpha1.DNSRecord{}
+	for i := range existing.Items {
+		existingByName[types.NamespacedName{Namespace: existing.Items[i].Namespace, Name: existing.Items[i].Name}] = &existing.Items[i]
+	}
+
+	for i := range desired {
+		dnsRecord := &desired[i]
+		key := types.NamespacedName{Namespace: dnsRecord.Namespace, Name: dnsRecord.Name}
+		current, found := existingByName[key]
+		delete(existingByName, key)
+		if !found {
+			if err := cl.Create(ctx, dnsRecord); err != nil {
+				if !apierrors.IsAlreadyExists(err) {
+					return fmt.Errorf("failed to create DNSRecord %s: %v", key, err)
+				}
+				return fmt.Errorf("DNSRecord %s already exists and is not managed by %s %s", key, sourceKind, source)
+			}
+			continue
+		}
+		if equality.Semantic.DeepEqual(current.Spec, dnsRecord.Spec) && current.Annotations[monkalev1alpha1.SourceNameAnnotation] == source.Name {
+			continue
+		}
+		current.Spec = dnsRecord.Spec
+		metav1.SetMetaDataAnnotation(&current.ObjectMeta, monkalev1alpha1.SourceNameAnnotation, source.Name)
+		if err := cl.Update(ctx, current); err != nil {
+			return fmt.Errorf("failed to update DNSRecord %s: %v", key, err)
+		}
+	}
+
+	for key, dnsRecord := range existingByName {
+		if err := cl.Delete(ctx, dnsRecord); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete DNSRecord %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// deleteSourceRecords deletes all DNSRecords published by the source object.
+func deleteSourceRecords(ctx context.Context, cl client.Client, sourceKind string, source types.NamespacedName) error {
+	return applySourceRecords(ctx, cl, sourceKind, source, nil)
+}
+
+// sourceRecordReconcileRequest maps the DNSRecord to the reconcile request of its source object.
+// Used to restore DNSRecords modified or deleted by hand.
+func sourceRecordReconcileRequest(sourceKind string, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	if labels[monkalev1alpha1.SourceKindLabel] != sourceKind || labels[monkalev1alpha1.SourceNameLabel] == "" {
+		return nil
+	}
+	name, found := obj.GetAnnotations()[monkalev1alpha1.SourceNameAnnotation]
+	if !found {
+		name = labels[monkalev1alpha1.SourceNameLabel]
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Namespace: labels[monkalev1alpha1.SourceNamespaceLabel],
+		Name:      name,
+	}}}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// longName returns a valid object name of the given length.
+func longName(prefix string, length int) string {
+	return prefix + strings.Repeat("a", length-len(prefix))
+}
+
+func TestGetSourceNameLabelValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		wantValue string
+	}{
+		{name: "short name", source: "example-com", wantValue: "example-com"},
+		{name: "63 characters", source: longName("zone-", 63), wantValue: longName("zone-", 63)},
+		{name: "64 characters", source: longName("zone-", 64)},
+		{name: "253 characters", source: longName("zone-", 253)},
+		{name: "truncated at a dash", source: strings.Repeat("a", 51) + "-b" + strings.Repeat("c", 60)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getSourceNameLabelValue(tt.source)
+			if errs := validation.IsValidLabelValue(got); len(errs) != 0 {
+				t.Fatalf("getSourceNameLabelValue() = %s is not a label value: %v", got, errs)
+			}
+			if tt.wantValue != "" && got != tt.wantValue {
+				t.Errorf("getSourceNameLabelValue() = %s, want %s", got, tt.wantValue)
+			}
+			if len(tt.source) > validation.LabelValueMaxLength && !strings.HasPrefix(tt.source, strings.TrimRight(got[:len(got)-11], "-.")) {
+				t.Errorf("getSourceNameLabelValue() = %s, want the prefix of %s", got, tt.source)
+			}
+		})
+	}
+
+	// The names sharing the truncated prefix get different label values.
+	if getSourceNameLabelValue(longName("zone-", 100)) == getSourceNameLabelValue(longName("zone-", 101)) {
+		t.Errorf("getSourceNameLabelValue() is the same for the names sharing the prefix")
+	}
+}
+
+func TestIsSourceRecordOf(t *testing.T) {
+	zone := types.NamespacedName{Namespace: "dns", Name: longName("zone-", 100)}
+	sibling := types.NamespacedName{Namespace: "dns", Name: longName("zone-", 101)}
+	dnsRecord := func(sourceKind string, source types.NamespacedName, annotations map[string]string) *monkalev1alpha1.DNSRecord {
+		return &monkalev1alpha1.DNSRecord{ObjectMeta: metav1.ObjectMeta{
+			Name:        "record",
+			Namespace:   "dns",
+			Labels:      getSourceRecordLabels(sourceKind, source),
+			Annotations: annotations,
+		}}
+	}
+	tests := []struct {
+		name      string
+		dnsRecord *monkalev1alpha1.DNSRecord
+		want      bool
+	}{
+		{name: "published by the source", dnsRecord: dnsRecord(monkalev1alpha1.SourceKindExternalDNS, zone, getSourceRecordAnnotations(zone)), want: true},
+		{name: "without the annotation", dnsRecord: dnsRecord(monkalev1alpha1.SourceKindExternalDNS, zone, nil), want: true},
+		{name: "another source kind", dnsRecord: dnsRecord(monkalev1alpha1.SourceKindDNSUpdate, zone, getSourceRecordAnnotations(zone))},
+		{name: "another namespace", dnsRecord: dnsRecord(monkalev1alpha1.SourceKindExternalDNS, types.NamespacedName{Namespace: "other", Name: zone.Name}, getSourceRecordAnnotations(zone))},
+		{name: "another source", dnsRecord: dnsRecord(monkalev1alpha1.SourceKindExternalDNS, sibling, getSourceRecordAnnotations(sibling))},
+		{name: "annotation of another source", dnsRecord: dnsRecord(monkalev1alpha1.SourceKindExternalDNS, zone, getSourceRecordAnnotations(sibling))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSourceRecordOf(tt.dnsRecord, monkalev1alpha1.SourceKindExternalDNS, zone); got != tt.want {
+				t.Errorf("isSourceRecordOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceRecordReconcileRequest(t *testing.T) {
+	short := types.NamespacedName{Namespace: "default", Name: "web"}
+	long := types.NamespacedName{Namespace: "default", Name: longName("web-", 120)}
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		want        *types.NamespacedName
+	}{
+		{name: "short name", labels: getSourceRecordLabels(monkalev1alpha1.SourceKindService, short), annotations: getSourceRecordAnnotations(short), want: &short},
+		{name: "long name", labels: getSourceRecordLabels(monkalev1alpha1.SourceKindService, long), annotations: getSourceRecordAnnotations(long), want: &long},
+		{name: "without the annotation", labels: getSourceRecordLabels(monkalev1alpha1.SourceKindService, short), want: &short},
+		{name: "another source kind", labels: getSourceRecordLabels(monkalev1alpha1.SourceKindIngress, short), annotations: getSourceRecordAnnotations(short)},
+		{name: "not a source record"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dnsRecord := &monkalev1alpha1.DNSRecord{ObjectMeta: metav1.ObjectMeta{Name: "record", Labels: tt.labels, Annotations: tt.annotations}}
+			requests := sourceRecordReconcileRequest(monkalev1alpha1.SourceKindService, dnsRecord)
+			if tt.want == nil {
+				if len(requests) != 0 {
+					t.Errorf("sourceRecordReconcileRequest() = %v, want none", requests)
+				}
+				return
+			}
+			if len(requests) != 1 || requests[0].NamespacedName != *tt.want {
+				t.Errorf("sourceRecordReconcileRequest() = %v, want %v", requests, *tt.want)
+			}
+		})
+	}
+}
+
+func TestConstructSourceRecordsLongSourceName(t *testing.T) {
+	zone := types.NamespacedName{Namespace: "dns", Name: "example-com"}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: longName("ingress-", 200)},
+		Spec:       networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{Host: "web.example.com"}}},
+	}
+	httpRoute := &gatewayv1beta1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: longName("httproute-", 253)},
+		Spec:       gatewayv1beta1.HTTPRouteSpec{Hostnames: []gatewayv1beta1.Hostname{"app.example.com"}},
+	}
+	tests := []struct {
+		name       string
+		sourceKind string
+		source     types.NamespacedName
+		hostnames  []string
+	}{
+		{name: "Ingress", sourceKind: monkalev1alpha1.SourceKindIngress, source: types.NamespacedName{Namespace: ingress.Namespace, Name: ingress.Name}, hostnames: getIngressHostnames(ingress)},
+		{name: "HTTPRoute", sourceKind: monkalev1alpha1.SourceKindHTTPRoute, source: types.NamespacedName{Namespace: httpRoute.Namespace, Name: httpRoute.Name}, hostnames: getHTTPRouteHostnames(httpRoute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dnsRecords := constructSourceRecords(tt.sourceKind, tt.source, zone, tt.hostnames, []string{"192.0.2.10"}, "")
+			if len(dnsRecords) != 1 {
+				t.Fatalf("constructSourceRecords() = %d DNSRecords, want 1", len(dnsRecords))
+			}
+			dnsRecord := &dnsRecords[0]
+			if errs := validation.IsDNS1123Subdomain(dnsRecord.Name); len(errs) != 0 {
+				t.Errorf("constructSourceRecords() name %s is not valid: %v", dnsRecord.Name, errs)
+			}
+			if errs := metav1validation.ValidateLabels(dnsRecord.Labels, field.NewPath("metadata", "labels")); len(errs) != 0 {
+				t.Errorf("constructSourceRecords() labels are not valid: %v", errs)
+			}
+			if got := dnsRecord.Annotations[monkalev1alpha1.SourceNameAnnotation]; got != tt.source.Name {
+				t.Errorf("constructSourceRecords() source name annotation = %s, want %s", got, tt.source.Name)
+			}
+			if !isSourceRecordOf(dnsRecord, tt.sourceKind, tt.source) {
+				t.Errorf("isSourceRecordOf() = false, want true")
+			}
+			requests := sourceRecordReconcileRequest(tt.sourceKind, dnsRecord)
+			if len(requests) != 1 || requests[0].NamespacedName != tt.source {
+				t.Errorf("sourceRecordReconcileRequest() = %v, want %v", requests, tt.source)
+			}
+		})
+	}
+}
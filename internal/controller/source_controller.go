@@ -0,0 +1,174 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// sourceObject is the kubernetes object reconciled by the source controllers, together with
+// the hostnames and the targets it publishes.
+type sourceObject struct {
+	kind      string
+	obj       client.Object
+	hostnames []string
+	targets   []string
+}
+
+// reconcileSource publishes DNSRecords of the source object. Used by all source controllers.
+// If the source object is deleted or has no hostnames, its DNSRecords are deleted and the finalizer is removed.
+func reconcileSource(ctx context.Context, cl client.Client, source sourceObject) (ctrl.Result, error) {
+	sourceObj := types.NamespacedName{Name: source.obj.GetName(), Namespace: source.obj.GetNamespace()}
+	logKV := []interface{}{"Source.Kind", source.kind, "Source.Name", sourceObj.Name, "Source.Namespace", sourceObj.Namespace}
+
+	// Source object has been deleted or does not publish hostnames anymore. Clean up its DNSRecords.
+	if !source.obj.GetDeletionTimestamp().IsZero() || len(source.hostnames) == 0 {
+		if !controllerutil.ContainsFinalizer(source.obj, monkalev1alpha1.SourceFinalizerName) {
+			return ctrl.Result{}, nil
+		}
+		log.Log.Info("Source instance. Source is being deleted or has no hostnames. Removing DNSRecords", logKV...)
+		if err := deleteSourceRecords(ctx, cl, source.kind, sourceObj); err != nil {
+			log.Log.Error(err, "Source instance. Failed to delete DNSRecords", logKV...)
+			return ctrl.Result{}, err
+		}
+		clientK8sObj := source.obj.DeepCopyObject().(client.Object)
+		if err := removeFinalizer(ctx, cl, sourceObj, clientK8sObj, monkalev1alpha1.SourceFinalizerName); err != nil {
+			log.Log.Error(err, "Source instance. Failed to delete finalizer", logKV...)
+			return ctrl.Result{}, err
+		}
+		log.Log.Info("Source instance. DNSRecords have been deleted", logKV...)
+		return ctrl.Result{}, nil
+	}
+
+	// Source object publishes hostnames. Add finalizer.
+	if !controllerutil.ContainsFinalizer(source.obj, monkalev1alpha1.SourceFinalizerName) {
+		clientK8sObj := source.obj.DeepCopyObject().(client.Object)
+		if err := addFinalizer(ctx, cl, sourceObj, clientK8sObj, monkalev1alpha1.SourceFinalizerName); err != nil {
+			log.Log.Error(err, "Source instance. Failed to add finalizer", logKV...)
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	log.Log.Info("Source instance. Reconciling", logKV...)
+	ttl, err := getSourceTTL(source.obj)
+	if err != nil {
+		log.Log.Error(err, "Source instance. Bad TTL", logKV...)
+		return ctrl.Result{}, nil
+	}
+	zoneHostnames, err := getSourceZoneHostnames(ctx, cl, source.obj, source.hostnames)
+	if err != nil {
+		log.Log.Error(err, "Source instance. Failed to find DNSZones", logKV...)
+		return ctrl.Result{}, err
+	}
+	if len(source.targets) == 0 {
+		log.Log.Info("Source instance. Source has no addresses yet", logKV...)
+	}
+
+	var desired []monkalev1alpha1.DNSRecord
+	for zoneRef, hostnames := range zoneHostnames {
+		desired = append(desired, constructSourceRecords(source.kind, sourceObj, zoneRef, hostnames, source.targets, ttl)...)
+	}
+	if err := applySourceRecords(ctx, cl, source.kind, sourceObj, desired); err != nil {
+		log.Log.Error(err, "Source instance. Failed to publish DNSRecords", logKV...)
+		return ctrl.Result{}, err
+	}
+
+	log.Log.Info("Source instance. DNSRecords have been published", append(logKV, "Records", len(desired))...)
+	return ctrl.Result{}, nil
+}
+
+// getSourceZoneHostnames groups the hostnames by the DNSZone they belong to.
+// If the source object references the DNSZone by annotation, only this DNSZone is considered.
+// Otherwise the DNSZone whose domain is the longest matching suffix of the hostname is chosen.
+// Hostnames which do not belong to any DNSZone are skipped, since out of zone data breaks the whole zone.
+// Hostnames of the DNSZone which does not allow the sources of the namespace of the object are skipped as well,
+// they are not published into a shorter matching DNSZone, since the chosen DNSZone would shadow them.
+func getSourceZoneHostnames(ctx context.Context, cl client.Client, obj client.Object, hostnames []string) (map[types.NamespacedName][]string, error) {
+	var dnsZones []monkalev1alpha1.DNSZone
+	zoneRef, referenced, err := getSourceDNSZoneRef(obj)
+	if err != nil {
+		return nil, err
+	}
+	if referenced {
+		var dnsZone monkalev1alpha1.DNSZone
+		if err := cl.Get(ctx, zoneRef, &dnsZone); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("failed to get DNSZone %s: %v", zoneRef, err)
+			}
+		} else {
+			dnsZones = append(dnsZones, dnsZone)
+		}
+	} else {
+		var dnsZoneList monkalev1alpha1.DNSZoneList
+		if err := cl.List(ctx, &dnsZoneList); err != nil {
+			return nil, fmt.Errorf("failed to list DNSZones: %v", err)
+		}
+		dnsZones = dnsZoneList.Items
+	}
+
+	zoneHostnames := map[types.NamespacedName][]string{}
+	for _, hostname := range hostnames {
+		dnsZone, found := getLongestMatchingDNSZone(hostname, dnsZones)
+		if !found {
+			log.Log.Info("Source instance. No DNSZone matches the hostname. Skipping", "Source.Name", obj.GetName(), "Source.Namespace", obj.GetNamespace(), "Hostname", hostname)
+			continue
+		}
+		if !isSourceAllowed(dnsZone, obj.GetNamespace()) {
+			log.Log.Info("Source instance. DNSZone does not allow the sources of the namespace, see spec.allowedSourceNamespaces. Skipping", "Source.Name", obj.GetName(), "Source.Namespace", obj.GetNamespace(), "Hostname", hostname, "DNSZone.Name", dnsZone.Name, "DNSZone.Namespace", dnsZone.Namespace)
+			continue
+		}
+		key := types.NamespacedName{Name: dnsZone.Name, Namespace: dnsZone.Namespace}
+		zoneHostnames[key] = append(zoneHostnames[key], hostname)
+	}
+	return zoneHostnames, nil
+}
+
+// listSourceReconcileRequests returns reconcile requests for all objects of the list which pass the filter.
+// Used to reconcile source objects when DNSZones are created, changed or deleted.
+func listSourceReconcileRequests(ctx context.Context, cl client.Client, list client.ObjectList, filter func(client.Object) bool) []reconcile.Request {
+	if err := cl.List(ctx, list); err != nil {
+		log.Log.Error(err, "Source instance. Failed to list source objects")
+		return nil
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		log.Log.Error(err, "Source instance. Failed to extract source objects")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, item := range items {
+		obj, ok := item.(client.Object)
+		if !ok || (filter != nil && !filter(obj)) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}})
+	}
+	return requests
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// querySOATimeout is the timeout of the SOA query to the primary name servers of the Secondary zones.
+const querySOATimeout time.Duration = 5 * time.Second
+
+// getPrimaryAddress returns the address of the primary name server with the port. The default port is 53.
+func getPrimaryAddress(primary string) string {
+	if net.ParseIP(primary) != nil {
+		return net.JoinHostPort(primary, "53")
+	}
+	return primary
+}
+
+// querySOA queries the primary name servers for the SOA record of the domain, in the order they are listed.
+// Returns the SOA record of the first primary that answers.
+func querySOA(domain string, primaries []string) (*dns.SOA, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domain), dns.TypeSOA)
+	dnsClient := &dns.Client{Timeout: querySOATimeout}
+	var errs []string
+	for _, primary := range primaries {
+		response, _, err := dnsClient.Exchange(msg, getPrimaryAddress(primary))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", primary, err))
+			continue
+		}
+		if response.Rcode != dns.RcodeSuccess {
+			errs = append(errs, fmt.Sprintf("%s: %s", primary, dns.RcodeToString[response.Rcode]))
+			continue
+		}
+		for _, rr := range response.Answer {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return soa, nil
+			}
+		}
+		errs = append(errs, fmt.Sprintf("%s: no SOA record in the answer", primary))
+	}
+	return nil, fmt.Errorf("failed to query SOA of %s: %s", domain, strings.Join(errs, "; "))
+}
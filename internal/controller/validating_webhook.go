@@ -0,0 +1,253 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+// The validating webhooks reject the bad input on kubectl apply, instead of reporting it in the status after the fact.
+// They run the same record construction and validation as the controllers.
+// The objects being deleted, and the updates that do not change the spec, e.g. the finalizers, are never rejected.
+
+//+kubebuilder:webhook:path=/validate-monkale-monkale-io-v1alpha1-dnsrecord,mutating=false,failurePolicy=fail,sideEffects=None,groups=monkale.monkale.io,resources=dnsrecords,verbs=create;update,versions=v1alpha1,name=vdnsrecord.monkale.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-monkale-monkale-io-v1alpha1-dnszone,mutating=false,failurePolicy=fail,sideEffects=None,groups=monkale.monkale.io,resources=dnszones,verbs=create;update,versions=v1alpha1,name=vdnszone.monkale.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-monkale-monkale-io-v1alpha1-dnsconnector,mutating=false,failurePolicy=fail,sideEffects=None,groups=monkale.monkale.io,resources=dnsconnectors,verbs=create;update,versions=v1alpha1,name=vdnsconnector.monkale.io,admissionReviewVersions=v1
+
+// DNSRecordValidator validates DNSRecords against the referenced DNSZone and the other DNSRecords of the zone.
+type DNSRecordValidator struct {
+	client.Client
+}
+
+// SetupWebhookWithManager registers the DNSRecord validating webhook.
+// The DNSRecords of the zone are looked up with the DnsRecordIndex registered by the DNSZone controller.
+func (v *DNSRecordValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&monkalev1alpha1.DNSRecord{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate validates the new DNSRecord.
+func (v *DNSRecordValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	dnsRecord, ok := obj.(*monkalev1alpha1.DNSRecord)
+	if !ok {
+		return nil, fmt.Errorf("expected a DNSRecord, got %T", obj)
+	}
+	return v.validateDNSRecord(ctx, dnsRecord)
+}
+
+// ValidateUpdate validates the changed spec of the DNSRecord.
+func (v *DNSRecordValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldRecord, ok := oldObj.(*monkalev1alpha1.DNSRecord)
+	if !ok {
+		return nil, fmt.Errorf("expected a DNSRecord, got %T", oldObj)
+	}
+	dnsRecord, ok := newObj.(*monkalev1alpha1.DNSRecord)
+	if !ok {
+		return nil, fmt.Errorf("expected a DNSRecord, got %T", newObj)
+	}
+	if !dnsRecord.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(oldRecord.Spec, dnsRecord.Spec) {
+		return nil, nil
+	}
+	return v.validateDNSRecord(ctx, dnsRecord)
+}
+
+// ValidateDelete never rejects the deletion of the DNSRecord.
+func (v *DNSRecordValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateDNSRecord constructs and validates the record, then checks it against the domain of the DNSZone
+// and the CNAME records of the zone. If the DNSZone does not exist yet, only the record itself is validated.
+func (v *DNSRecordValidator) validateDNSRecord(ctx context.Context, dnsRecord *monkalev1alpha1.DNSRecord) (admission.Warnings, error) {
+	if dnsRecord.Spec.Record == nil || dnsRecord.Spec.DNSZoneRef == nil {
+		return nil, fmt.Errorf("record and dnsZoneRef are required")
+	}
+	record, err := render.ConstructRecord(*dnsRecord)
+	if err != nil {
+		return nil, fmt.Errorf("record construction failure: %v", err)
+	}
+	if err := validateRecordAddresses(dnsRecord.Spec.Record); err != nil {
+		return nil, fmt.Errorf("record validation failure: %v", err)
+	}
+	if err := render.ValidateRecords(record); err != nil {
+		return nil, fmt.Errorf("record validation failure: %v", err)
+	}
+
+	var dnsZone monkalev1alpha1.DNSZone
+	dnsZoneObj := types.NamespacedName{Name: dnsRecord.Spec.DNSZoneRef.Name, Namespace: dnsRecord.Namespace}
+	if err := v.Get(ctx, dnsZoneObj, &dnsZone); err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.Warnings{fmt.Sprintf("DNSZone %s not found, the record is not checked against the zone", dnsZoneObj.Name)}, nil
+		}
+		return nil, fmt.Errorf("could not get DNSZone %s: %v", dnsZoneObj.Name, err)
+	}
+	zoneOrigin := monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain)
+	rrs, err := render.ParseRecords(record, zoneOrigin)
+	if err != nil {
+		return nil, fmt.Errorf("record validation failure: %v", err)
+	}
+	if err := validateRecordsInZone(rrs, zoneOrigin); err != nil {
+		return nil, err
+	}
+
+	// the CNAME records must not coexist with other data at the same owner name
+	dnsRecords := &monkalev1alpha1.DNSRecordList{}
+	listOps := &client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(monkalev1alpha1.DnsRecordIndex, dnsZone.Name),
+		Namespace:     dnsZone.Namespace,
+	}
+	if err := v.List(ctx, dnsRecords, listOps); err != nil {
+		return nil, fmt.Errorf("could not list DNSRecords: %v", err)
+	}
+	zoneRecords := make(map[string][]recordOwner)
+	for _, zoneRecord := range dnsRecords.Items {
+		if zoneRecord.Name == dnsRecord.Name || !zoneRecord.DeletionTimestamp.IsZero() || zoneRecord.Spec.Record == nil {
+			continue
+		}
+		zoneRecordString, err := render.ConstructRecord(zoneRecord)
+		if err != nil {
+			continue
+		}
+		zoneRRs, err := render.ParseRecords(zoneRecordString, zoneOrigin)
+		if err != nil {
+			continue
+		}
+		zoneRecords[zoneRecord.Name] = getRecordOwners(zoneRRs)
+	}
+	if err := validateCNAMEConflicts(getRecordOwners(rrs), zoneRecords); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// DNSZoneValidator validates the SOA and NS records of the DNSZones.
+type DNSZoneValidator struct {
+	client.Client
+}
+
+// SetupWebhookWithManager registers the DNSZone validating webhook.
+func (v *DNSZoneValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&monkalev1alpha1.DNSZone{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate validates the new DNSZone.
+func (v *DNSZoneValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	dnsZone, ok := obj.(*monkalev1alpha1.DNSZone)
+	if !ok {
+		return nil, fmt.Errorf("expected a DNSZone, got %T", obj)
+	}
+	return nil, validateDNSZone(dnsZone)
+}
+
+// ValidateUpdate validates the changed spec of the DNSZone.
+func (v *DNSZoneValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldZone, ok := oldObj.(*monkalev1alpha1.DNSZone)
+	if !ok {
+		return nil, fmt.Errorf("expected a DNSZone, got %T", oldObj)
+	}
+	dnsZone, ok := newObj.(*monkalev1alpha1.DNSZone)
+	if !ok {
+		return nil, fmt.Errorf("expected a DNSZone, got %T", newObj)
+	}
+	if !dnsZone.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(oldZone.Spec, dnsZone.Spec) {
+		return nil, nil
+	}
+	return nil, validateDNSZone(dnsZone)
+}
+
+// ValidateDelete never rejects the deletion of the DNSZone.
+func (v *DNSZoneValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// DNSConnectorValidator validates that the CoreDNS deployment of the DNSConnector exists.
+type DNSConnectorValidator struct {
+	client.Client
+}
+
+// SetupWebhookWithManager registers the DNSConnector validating webhook.
+func (v *DNSConnectorValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&monkalev1alpha1.DNSConnector{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate validates the new DNSConnector.
+func (v *DNSConnectorValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	dnsConnector, ok := obj.(*monkalev1alpha1.DNSConnector)
+	if !ok {
+		return nil, fmt.Errorf("expected a DNSConnector, got %T", obj)
+	}
+	return nil, v.validateDNSConnector(ctx, dnsConnector)
+}
+
+// ValidateUpdate validates the changed spec of the DNSConnector.
+func (v *DNSConnectorValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldConnector, ok := oldObj.(*monkalev1alpha1.DNSConnector)
+	if !ok {
+		return nil, fmt.Errorf("expected a DNSConnector, got %T", oldObj)
+	}
+	dnsConnector, ok := newObj.(*monkalev1alpha1.DNSConnector)
+	if !ok {
+		return nil, fmt.Errorf("expected a DNSConnector, got %T", newObj)
+	}
+	if !dnsConnector.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(oldConnector.Spec.CorednsDeployment, dnsConnector.Spec.CorednsDeployment) {
+		return nil, nil
+	}
+	return nil, v.validateDNSConnector(ctx, dnsConnector)
+}
+
+// ValidateDelete never rejects the deletion of the DNSConnector.
+func (v *DNSConnectorValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateDNSConnector checks that the CoreDNS deployment of the given type and name exists in the namespace of the DNSConnector.
+func (v *DNSConnectorValidator) validateDNSConnector(ctx context.Context, dnsConnector *monkalev1alpha1.DNSConnector) error {
+	corednsDeployment := dnsConnector.Spec.CorednsDeployment
+	corednsResObj, err := monkalev1alpha1.AssertCorednsDeploymentType(corednsDeployment.Type)
+	if err != nil {
+		return fmt.Errorf("corednsDeployment.type: %v", err)
+	}
+	corednsResType := types.NamespacedName{Name: corednsDeployment.Name, Namespace: dnsConnector.Namespace}
+	if err := v.Get(ctx, corednsResType, corednsResObj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("corednsDeployment: %s %s not found in namespace %s", corednsDeployment.Type, corednsDeployment.Name, dnsConnector.Namespace)
+		}
+		return fmt.Errorf("could not get coredns deployment: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+	"github.com/monkale.io/coredns-manager-operator/internal/render"
+)
+
+// recordOwner is the owner name and the type of the resource records of a DNSRecord.
+type recordOwner struct {
+	name   string
+	rrType string
+}
+
+// validateRecordAddresses checks that the values of the A records are IPv4 addresses, and the values of the AAAA records are IPv6 addresses.
+func validateRecordAddresses(record *monkalev1alpha1.Record) error {
+	values := record.Values
+	if record.Value != "" {
+		values = []string{record.Value}
+	}
+	for _, value := range values {
+		switch record.Type {
+		case "A":
+			if ip := net.ParseIP(value); ip == nil || ip.To4() == nil || strings.Contains(value, ":") {
+				return fmt.Errorf("value %q of the A record is not an IPv4 address", value)
+			}
+		case "AAAA":
+			if ip := net.ParseIP(value); ip == nil || !strings.Contains(value, ":") {
+				return fmt.Errorf("value %q of the AAAA record is not an IPv6 address", value)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRecordsInZone checks that the resource records belong to the zone, and that the CNAME record is neither
+// at the zone apex, where it would coexist with the SOA and NS records, nor has more than one value.
+func validateRecordsInZone(rrs []dns.RR, zoneOrigin string) error {
+	cnames := 0
+	for _, rr := range rrs {
+		name := rr.Header().Name
+		if !dns.IsSubDomain(zoneOrigin, name) {
+			return fmt.Errorf("record name %s is outside of the zone %s", name, zoneOrigin)
+		}
+		if rr.Header().Rrtype != dns.TypeCNAME {
+			continue
+		}
+		if dns.CanonicalName(name) == dns.CanonicalName(zoneOrigin) {
+			return fmt.Errorf("CNAME record at the zone apex %s coexists with the SOA and NS records", zoneOrigin)
+		}
+		cnames++
+	}
+	if cnames > 1 {
+		return fmt.Errorf("CNAME record must have a single value")
+	}
+	return nil
+}
+
+// getRecordOwners returns the owner names and the types of the resource records.
+func getRecordOwners(rrs []dns.RR) []recordOwner {
+	seen := make(map[recordOwner]bool)
+	owners := []recordOwner{}
+	for _, rr := range rrs {
+		owner := recordOwner{
+			name:   dns.CanonicalName(rr.Header().Name),
+			rrType: dns.TypeToString[rr.Header().Rrtype],
+		}
+		if !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+	return owners
+}
+
+// validateCNAMEConflicts checks that the CNAME records do not coexist with other data at the same owner name (RFC 1034, section 3.6.2).
+// zoneRecords maps the names of the other DNSRecords of the zone to their owners. The DNSSEC signatures may coexist with the CNAME.
+func validateCNAMEConflicts(owners []recordOwner, zoneRecords map[string][]recordOwner) error {
+	recordNames := make([]string, 0, len(zoneRecords))
+	for recordName := range zoneRecords {
+		recordNames = append(recordNames, recordName)
+	}
+	sort.Strings(recordNames)
+	for _, owner := range owners {
+		for _, recordName := range recordNames {
+			for _, zoneOwner := range zoneRecords[recordName] {
+				if owner.name != zoneOwner.name || owner.rrType == "RRSIG" || zoneOwner.rrType == "RRSIG" || owner.rrType == "NSEC" || zoneOwner.rrType == "NSEC" {
+					continue
+				}
+				if owner.rrType == "CNAME" || zoneOwner.rrType == "CNAME" {
+					return fmt.Errorf("%s record %s coexists with the %s record of the DNSRecord %s. CNAME records must not coexist with other data", owner.rrType, owner.name, zoneOwner.rrType, recordName)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateDNSZone checks that the address of the primary name server matches its record type,
+// and that the SOA and NS records of the zone pass the same validation as the zone file. Secondary zones are not generated.
+func validateDNSZone(dnsZone *monkalev1alpha1.DNSZone) error {
+	if dnsZone.Spec.Type == monkalev1alpha1.DNSZoneTypeSecondary {
+		return nil
+	}
+	if primaryNS := dnsZone.Spec.PrimaryNS; primaryNS != nil {
+		ip := net.ParseIP(primaryNS.IPAddress)
+		switch {
+		case ip == nil:
+			return fmt.Errorf("primaryNS.ipAddress %q is not an IP address", primaryNS.IPAddress)
+		case primaryNS.RecordType == "A" && (ip.To4() == nil || strings.Contains(primaryNS.IPAddress, ":")):
+			return fmt.Errorf("primaryNS.ipAddress %q is not an IPv4 address, but primaryNS.recordType is A", primaryNS.IPAddress)
+		case primaryNS.RecordType == "AAAA" && !strings.Contains(primaryNS.IPAddress, ":"):
+			return fmt.Errorf("primaryNS.ipAddress %q is not an IPv6 address, but primaryNS.recordType is AAAA", primaryNS.IPAddress)
+		}
+	}
+	zone, err := render.ConstructZoneFile(dnsZone, "", "1")
+	if err != nil {
+		return fmt.Errorf("zone construction failure: %v", err)
+	}
+	if err := render.ValidateRecords(zone); err != nil {
+		return fmt.Errorf("zone validation failure: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+const (
+	ZonefileVolumePrefix          string = "dnszone-" // ZonefileVolumePrefix is the name prefix of the volumes and volume mounts that carry zonefile configMaps
+	corednsReloadPlugin           string = "reload"   // corednsReloadPlugin is the CoreDNS plugin that reloads the changed Corefile
+	corednsZonefileReloadInterval string = "10s"      // corednsZonefileReloadInterval is how often the file plugin checks the zonefile for a new serial
+)
+
+// GenerateCorefileCM is used to generate Corefile based on originalCorefile(string), DNSZone's zonefile configMaps and DNSForwardZones.
+// receives original corednsConfCM, zoneConfigMaps, forwardZones and TSIG keys of the zone transfers by zonefile configMap name as args.
+// The server blocks of the zones are merged into the Corefile by their zone keys, see mergeCorefile.
+func GenerateCorefileCM(dnsConnector *monkalev1alpha1.DNSConnector, corednsConfCM *corev1.ConfigMap, zoneConfigMaps *corev1.ConfigMapList, forwardZones *monkalev1alpha1.DNSForwardZoneList, tsigKeys map[string]TSIGKey) (corev1.ConfigMap, error) {
+	corefileBlocks := make(map[string]string)
+
+	cmDataKey := dnsConnector.Spec.CorednsCM.CorefileKey
+	newCorednsConfCM := corednsConfCM.DeepCopy()
+
+	corednsCorefileContent, ok := corednsConfCM.Data[cmDataKey]
+	if !ok {
+		return corev1.ConfigMap{}, fmt.Errorf("key %s not found in CoreDNS ConfigMap", cmDataKey)
+	}
+
+	for _, configMap := range zoneConfigMaps.Items {
+		// extract domain
+		domainName, ok := configMap.Annotations["DomainName"]
+		if !ok {
+			return corev1.ConfigMap{}, fmt.Errorf("configMap %s does not have a domain annotation", configMap.Name)
+		}
+
+		// get enabled plugins
+		pluginString := ""
+		for _, plugin := range GetZonePlugins(dnsConnector) {
+			pluginString += fmt.Sprintf("\n\t%s", plugin)
+		}
+
+		// Secondary zones are transferred from the primaries, other zones are served from the zonefile.
+		var zoneDirective string
+		if configMap.Annotations["ZoneType"] == monkalev1alpha1.DNSZoneTypeSecondary {
+			secondaryString, err := constructSecondaryBlock(strings.Fields(configMap.Annotations["Primaries"]))
+			if err != nil {
+				return corev1.ConfigMap{}, fmt.Errorf("configMap %s: %v", configMap.Name, err)
+			}
+			zoneDirective = secondaryString
+		} else {
+			// Ensure that zonefile contains zonefile in the cm.data
+			zonefileName := monkalev1alpha1.EnsureFQDN(domainName) + "zone"
+			if _, ok := configMap.Data[zonefileName]; !ok {
+				return corev1.ConfigMap{}, fmt.Errorf("configMap %s does not contain zonefile data", configMap.Name)
+			}
+			zoneDirective = constructFileDirective(dnsConnector, domainName)
+		}
+
+		// zone transfers to the secondaries
+		var transferTo []string
+		if to := configMap.Annotations["TransferTo"]; to != "" {
+			transferTo = strings.Fields(to)
+		}
+		var transferKey *TSIGKey
+		if _, ok := configMap.Annotations["TSIGSecretName"]; ok {
+			key, ok := tsigKeys[configMap.Name]
+			if !ok {
+				return corev1.ConfigMap{}, fmt.Errorf("TSIG key for configMap %s not found", configMap.Name)
+			}
+			transferKey = &key
+		}
+		transferString, err := constructTransferBlock(transferTo, transferKey)
+		if err != nil {
+			return corev1.ConfigMap{}, fmt.Errorf("configMap %s: %v", configMap.Name, err)
+		}
+
+		// generate zone config block
+		configBlock := fmt.Sprintf("%s:53 {\n\t%s%s%s\n}", domainName, zoneDirective, transferString, pluginString)
+		if err := validateCorefileBlock(configBlock); err != nil {
+			return corev1.ConfigMap{}, fmt.Errorf("invalid server block for the domain %s: %v", domainName, err)
+		}
+		if err := addCorefileBlock(corefileBlocks, domainName, configBlock); err != nil {
+			return corev1.ConfigMap{}, fmt.Errorf("configMap %s: %v", configMap.Name, err)
+		}
+	}
+
+	for _, forwardZone := range forwardZones.Items {
+		forwardBlock, err := ConstructForwardBlock(&forwardZone, GetZonePlugins(dnsConnector))
+		if err != nil {
+			return corev1.ConfigMap{}, fmt.Errorf("DNSForwardZone %s: %v", forwardZone.Name, err)
+		}
+		if err := addCorefileBlock(corefileBlocks, forwardZone.Spec.Domain, forwardBlock); err != nil {
+			return corev1.ConfigMap{}, fmt.Errorf("DNSForwardZone %s: %v", forwardZone.Name, err)
+		}
+	}
+
+	// the server blocks generated before belong to the DNSConnector
+	managedKeys := getManagedCorefileKeys(dnsConnector, corednsConfCM)
+	corefileContent, err := mergeCorefile(corednsCorefileContent, corefileBlocks, managedKeys)
+	if err != nil {
+		return corev1.ConfigMap{}, err
+	}
+
+	// modify configmap
+	newCorednsConfCM.Data[cmDataKey] = corefileContent
+	generatedKeys := make([]string, 0, len(corefileBlocks))
+	for key := range corefileBlocks {
+		generatedKeys = append(generatedKeys, key)
+	}
+	sort.Strings(generatedKeys)
+	if newCorednsConfCM.Annotations == nil {
+		newCorednsConfCM.Annotations = make(map[string]string)
+	}
+	newCorednsConfCM.Annotations[monkalev1alpha1.CorefileManagedBlocksAnnotation] = strings.Join(generatedKeys, ",")
+
+	return *newCorednsConfCM, nil
+}
+
+// addCorefileBlock adds the generated server block of the domain. Every domain can be served by one zone only.
+func addCorefileBlock(corefileBlocks map[string]string, domainName, block string) error {
+	key, err := normalizeCorefileKey(domainName + ":53")
+	if err != nil {
+		return err
+	}
+	if _, ok := corefileBlocks[key]; ok {
+		return fmt.Errorf("domain %s is already served by another zone", domainName)
+	}
+	corefileBlocks[key] = block
+	return nil
+}
+
+// getManagedCorefileKeys returns the keys of the server blocks generated by the DNSConnector before. The keys are taken from the
+// annotation of the CoreDNS ConfigMap, and from the status of the DNSConnector, which also covers the Corefiles of the previous versions.
+func getManagedCorefileKeys(dnsConnector *monkalev1alpha1.DNSConnector, corednsConfCM *corev1.ConfigMap) map[string]bool {
+	managedKeys := make(map[string]bool)
+	for _, key := range strings.Split(corednsConfCM.Annotations[monkalev1alpha1.CorefileManagedBlocksAnnotation], ",") {
+		if key != "" {
+			managedKeys[key] = true
+		}
+	}
+	var domains []string
+	for _, zone := range dnsConnector.Status.ProvisionedDNSZones {
+		domains = append(domains, zone.Domain)
+	}
+	for _, zone := range dnsConnector.Status.ProvisionedForwardZones {
+		domains = append(domains, zone.Domain)
+	}
+	if lastRollback := dnsConnector.Status.LastRollback; lastRollback != nil {
+		for _, zone := range lastRollback.AttemptedZones {
+			domains = append(domains, zone.Domain)
+		}
+		for _, zone := range lastRollback.AttemptedForwardZones {
+			domains = append(domains, zone.Domain)
+		}
+	}
+	for _, domain := range domains {
+		if key, err := normalizeCorefileKey(domain + ":53"); err == nil {
+			managedKeys[key] = true
+		}
+	}
+	return managedKeys
+}
+
+// GetZonefileVolumeName returns the volume name for the zone domain. Volume names are limited to 63 characters,
+// long domains, such as ip6.arpa reverse zones, are named after the hash of the domain.
+func GetZonefileVolumeName(domainName string) string {
+	volumeName := ZonefileVolumePrefix + strings.ReplaceAll(domainName, ".", "-")
+	volumeName = strings.TrimSuffix(volumeName, "-")
+	if len(volumeName) <= validation.DNS1123LabelMaxLength {
+		return volumeName
+	}
+	sum := sha256.Sum256([]byte(monkalev1alpha1.EnsureFQDN(domainName)))
+	return ZonefileVolumePrefix + hex.EncodeToString(sum[:])[:32]
+}
+
+// IsReloadRollout checks whether the changes are reloaded by CoreDNS instead of restarting the pods.
+func IsReloadRollout(dnsConnector *monkalev1alpha1.DNSConnector) bool {
+	return dnsConnector.Spec.RolloutStrategy == monkalev1alpha1.RolloutStrategyReload
+}
+
+// getZonefilePath returns the path of the zonefile in the CoreDNS container. With the Reload rollout strategy
+// every zonefile is mounted into its own directory, subPath mounts never receive the ConfigMap updates.
+func getZonefilePath(dnsConnector *monkalev1alpha1.DNSConnector, domainName string) string {
+	zonefileName := monkalev1alpha1.EnsureFQDN(domainName) + "zone"
+	if IsReloadRollout(dnsConnector) {
+		return fmt.Sprintf("%s/%s/%s", dnsConnector.Spec.CorednsDeployment.ZoneFileMountDir, GetZonefileVolumeName(domainName), zonefileName)
+	}
+	return fmt.Sprintf("%s/%s", dnsConnector.Spec.CorednsDeployment.ZoneFileMountDir, zonefileName)
+}
+
+// constructFileDirective builds the file plugin configuration of the zone server block.
+// With the Reload rollout strategy the file plugin checks the zonefile for a new serial periodically.
+func constructFileDirective(dnsConnector *monkalev1alpha1.DNSConnector, domainName string) string {
+	zonefilePath := getZonefilePath(dnsConnector, domainName)
+	if IsReloadRollout(dnsConnector) {
+		return fmt.Sprintf("file %s {\n\t\treload %s\n\t}", zonefilePath, corednsZonefileReloadInterval)
+	}
+	return fmt.Sprintf("file %s", zonefilePath)
+}
+
+// GetZonePlugins returns the plugins enabled in the generated server blocks.
+// With the Reload rollout strategy the reload plugin is enabled, so CoreDNS picks up the changed Corefile.
+func GetZonePlugins(dnsConnector *monkalev1alpha1.DNSConnector) []string {
+	plugins := append([]string{}, dnsConnector.Spec.CorednsZoneEnaledPlugins...)
+	if !IsReloadRollout(dnsConnector) {
+		return plugins
+	}
+	for _, plugin := range plugins {
+		if plugin == corednsReloadPlugin {
+			return plugins
+		}
+	}
+	return append(plugins, corednsReloadPlugin)
+}
@@ -0,0 +1,423 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// corefileLegacyMarkerPrefix is the prefix of the comment lines, which marked the managed server blocks in the previous versions.
+const corefileLegacyMarkerPrefix string = "# COREDNS CONTROLLER MANAGED BLOCK"
+
+// corefileDefaultPorts are the default ports of the CoreDNS transports.
+var corefileDefaultPorts = map[string]string{
+	"dns":   "53",
+	"tls":   "853",
+	"quic":  "853",
+	"grpc":  "443",
+	"https": "443",
+}
+
+// CorefileError is the error of a Corefile which can not be parsed, or which contains conflicting server blocks.
+type CorefileError struct {
+	line    int
+	message string
+}
+
+func (e *CorefileError) Error() string {
+	if e.line > 0 {
+		return fmt.Sprintf("corefile line %d: %s", e.line, e.message)
+	}
+	return "corefile: " + e.message
+}
+
+// corefileToken is a token of the Corefile.
+type corefileToken struct {
+	text   string
+	line   int
+	quoted bool
+	start  int // start is the offset of the first byte of the token in the Corefile
+	end    int // end is the offset after the last byte of the token in the Corefile
+}
+
+// corefileServerBlock is a server block of the Corefile.
+type corefileServerBlock struct {
+	// keys are the zone keys of the server block as written, e.g. "example.com:53" or "dns://.".
+	keys []string
+	// line is the line of the first key.
+	line int
+	// start and end are the offsets of the server block in the Corefile, from the first key to the closing brace.
+	start int
+	end   int
+}
+
+// isSnippet reports whether the server block is a snippet definition, e.g. "(common) { ... }", which is only imported by other blocks.
+func (b *corefileServerBlock) isSnippet() bool {
+	return len(b.keys) == 1 && strings.HasPrefix(b.keys[0], "(") && strings.HasSuffix(b.keys[0], ")")
+}
+
+// lexCorefile splits the Corefile into tokens the same way as the caddyfile lexer of CoreDNS:
+// tokens are separated by whitespace, "#" at the start of a token begins a comment until the end of the line,
+// and quoted tokens can contain whitespace and escaped quotes.
+func lexCorefile(content string) ([]corefileToken, error) {
+	var tokens []corefileToken
+	line := 1
+	for i := 0; i < len(content); {
+		char := content[i]
+		switch {
+		case char == '\n':
+			line++
+			i++
+		case char == ' ' || char == '\t' || char == '\r':
+			i++
+		case char == '#':
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+		case char == '"':
+			token := corefileToken{line: line, quoted: true, start: i}
+			var text strings.Builder
+			i++
+			closed := false
+			for i < len(content) {
+				if content[i] == '\\' && i+1 < len(content) && content[i+1] == '"' {
+					text.WriteByte('"')
+					i += 2
+					continue
+				}
+				if content[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				if content[i] == '\n' {
+					line++
+				}
+				text.WriteByte(content[i])
+				i++
+			}
+			if !closed {
+				return nil, &CorefileError{line: token.line, message: "unterminated quoted string"}
+			}
+			token.text = text.String()
+			token.end = i
+			tokens = append(tokens, token)
+		default:
+			token := corefileToken{line: line, start: i}
+			for i < len(content) && !strings.ContainsRune(" \t\r\n", rune(content[i])) {
+				i++
+			}
+			token.text = content[token.start:i]
+			token.end = i
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// isCorefileBrace checks whether the token is the unquoted brace.
+func isCorefileBrace(token corefileToken, brace string) bool {
+	return !token.quoted && token.text == brace
+}
+
+// parseCorefile parses the Corefile into server blocks following the caddyfile grammar:
+// every server block starts with one or more zone keys on one line (a key ending with a comma continues the keys
+// on the next line), followed by the block body in braces. A single server block can omit the braces.
+// Top level "import" directives are skipped.
+func parseCorefile(content string) ([]corefileServerBlock, error) {
+	tokens, err := lexCorefile(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []corefileServerBlock
+	for i := 0; i < len(tokens); {
+		// top level import of other Corefiles, e.g. "import custom/*.server"
+		if !tokens[i].quoted && tokens[i].text == "import" {
+			importLine := tokens[i].line
+			for i < len(tokens) && tokens[i].line == importLine {
+				i++
+			}
+			continue
+		}
+		if isCorefileBrace(tokens[i], "{") || isCorefileBrace(tokens[i], "}") {
+			return nil, &CorefileError{line: tokens[i].line, message: fmt.Sprintf("unexpected %q, expected server block keys", tokens[i].text)}
+		}
+
+		// keys
+		block := corefileServerBlock{line: tokens[i].line, start: tokens[i].start}
+		keysLine := tokens[i].line
+		for i < len(tokens) && !isCorefileBrace(tokens[i], "{") && (tokens[i].line == keysLine || len(block.keys) > 0 && strings.HasSuffix(tokens[i-1].text, ",")) {
+			if isCorefileBrace(tokens[i], "}") {
+				return nil, &CorefileError{line: tokens[i].line, message: "unexpected \"}\""}
+			}
+			keysLine = tokens[i].line
+			for _, key := range strings.Split(tokens[i].text, ",") {
+				if key != "" {
+					block.keys = append(block.keys, key)
+				}
+			}
+			i++
+		}
+		if len(block.keys) == 0 {
+			return nil, &CorefileError{line: block.line, message: "server block without keys"}
+		}
+
+		// server block without braces, the rest of the Corefile is its body
+		if i >= len(tokens) || !isCorefileBrace(tokens[i], "{") {
+			if len(blocks) > 0 {
+				return nil, &CorefileError{line: block.line, message: fmt.Sprintf("server block %s must be enclosed in braces", strings.Join(block.keys, " "))}
+			}
+			for j := i; j < len(tokens); j++ {
+				if isCorefileBrace(tokens[j], "{") || isCorefileBrace(tokens[j], "}") {
+					return nil, &CorefileError{line: tokens[j].line, message: fmt.Sprintf("unexpected %q, server block %s must be enclosed in braces", tokens[j].text, strings.Join(block.keys, " "))}
+				}
+			}
+			block.end = len(content)
+			blocks = append(blocks, block)
+			break
+		}
+
+		// body
+		depth := 0
+		for ; i < len(tokens); i++ {
+			if isCorefileBrace(tokens[i], "{") {
+				depth++
+			} else if isCorefileBrace(tokens[i], "}") {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		if depth != 0 {
+			return nil, &CorefileError{line: block.line, message: fmt.Sprintf("server block %s is not closed", strings.Join(block.keys, " "))}
+		}
+		block.end = tokens[i].end
+		blocks = append(blocks, block)
+		i++
+	}
+	return blocks, nil
+}
+
+// corefileKeyPort matches the port suffix of the zone key.
+var corefileKeyPort = regexp.MustCompile(`:([0-9]+)$`)
+
+// normalizeCorefileKey returns the transport, the zone and the port of the server block key as "transport://zone:port".
+// The zone is the lower case FQDN, reverse networks are converted to the reverse zone, missing parts get the defaults of CoreDNS.
+func normalizeCorefileKey(key string) (string, error) {
+	transport := "dns"
+	zone := key
+	if idx := strings.Index(key, "://"); idx >= 0 {
+		transport = strings.ToLower(key[:idx])
+		zone = key[idx+3:]
+	}
+	defaultPort, ok := corefileDefaultPorts[transport]
+	if !ok {
+		return "", fmt.Errorf("unsupported transport %s in the key %s", transport, key)
+	}
+
+	port := defaultPort
+	if match := corefileKeyPort.FindStringSubmatch(zone); match != nil && (!strings.Contains(zone, "/") || strings.LastIndex(zone, ":") > strings.LastIndex(zone, "/")) {
+		port = match[1]
+		zone = strings.TrimSuffix(zone, match[0])
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("bad port in the key %s", key)
+	}
+
+	if _, network, err := net.ParseCIDR(zone); err == nil {
+		// CoreDNS serves the reverse zones of the network. For the masks not on the label boundary
+		// the zone of the network address is used.
+		ones, bits := network.Mask.Size()
+		reverse, err := dns.ReverseAddr(network.IP.String())
+		if err != nil {
+			return "", fmt.Errorf("bad network in the key %s: %v", key, err)
+		}
+		labels := dns.SplitDomainName(reverse)
+		step := 8
+		if bits == 128 {
+			step = 4
+		}
+		skip := (bits - ones) / step
+		if skip > len(labels) {
+			skip = len(labels)
+		}
+		zone = dns.Fqdn(strings.Join(labels[skip:], "."))
+	}
+	if zone == "" {
+		zone = "."
+	}
+	if _, ok := dns.IsDomainName(zone); !ok {
+		return "", fmt.Errorf("bad zone in the key %s", key)
+	}
+	return fmt.Sprintf("%s://%s:%s", transport, strings.ToLower(dns.Fqdn(zone)), port), nil
+}
+
+// ValidateCorefile parses the Corefile and checks that no zone is served by two server blocks on the same transport and port,
+// which makes CoreDNS fail to start.
+func ValidateCorefile(content string) error {
+	blocks, err := parseCorefile(content)
+	if err != nil {
+		return err
+	}
+	servedBy := make(map[string]int)
+	for _, block := range blocks {
+		if block.isSnippet() {
+			continue
+		}
+		for _, key := range block.keys {
+			normalizedKey, err := normalizeCorefileKey(key)
+			if err != nil {
+				return &CorefileError{line: block.line, message: err.Error()}
+			}
+			if line, ok := servedBy[normalizedKey]; ok {
+				return &CorefileError{line: block.line, message: fmt.Sprintf("zone %s is already served by the server block on line %d", normalizedKey, line)}
+			}
+			servedBy[normalizedKey] = block.line
+		}
+	}
+	return nil
+}
+
+// mergeCorefile replaces the managed server blocks of the Corefile with the generated blocks.
+// The server blocks are identified by their zone keys: a server block with the single key from the managed set belongs to
+// the DNSConnector, it is replaced with the generated block of the key, or removed if the key is not generated anymore.
+// Duplicates of the managed blocks are removed, the other server blocks and the comments are preserved as is.
+// The generated blocks that are not in the Corefile yet are appended in the order of their keys.
+// Returns an error if a server block that does not belong to the DNSConnector serves one of the generated zones.
+func mergeCorefile(content string, generated map[string]string, managed map[string]bool) (string, error) {
+	blocks, err := parseCorefile(content)
+	if err != nil {
+		return "", err
+	}
+
+	var corefileBuilder strings.Builder
+	written := make(map[string]bool)
+	offset := 0
+	removed := false
+	for _, block := range blocks {
+		gap := stripLegacyCorefileMarkers(content[offset:block.start])
+		if removed {
+			gap = trimRemovedBlockGap(corefileBuilder.String(), gap)
+		}
+		corefileBuilder.WriteString(gap)
+		offset = block.end
+		removed = false
+
+		if block.isSnippet() {
+			corefileBuilder.WriteString(content[block.start:block.end])
+			continue
+		}
+		var normalizedKeys []string
+		for _, key := range block.keys {
+			normalizedKey, err := normalizeCorefileKey(key)
+			if err != nil {
+				return "", &CorefileError{line: block.line, message: err.Error()}
+			}
+			normalizedKeys = append(normalizedKeys, normalizedKey)
+		}
+
+		if len(normalizedKeys) == 1 && managed[normalizedKeys[0]] {
+			if generatedBlock, ok := generated[normalizedKeys[0]]; ok && !written[normalizedKeys[0]] {
+				corefileBuilder.WriteString(generatedBlock)
+				written[normalizedKeys[0]] = true
+			} else {
+				removed = true
+			}
+			continue
+		}
+		for _, normalizedKey := range normalizedKeys {
+			if _, ok := generated[normalizedKey]; ok {
+				return "", &CorefileError{line: block.line, message: fmt.Sprintf("zone %s is served by the server block %s, which is not managed by the DNSConnector", normalizedKey, strings.Join(block.keys, " "))}
+			}
+		}
+		corefileBuilder.WriteString(content[block.start:block.end])
+	}
+	gap := stripLegacyCorefileMarkers(content[offset:])
+	if removed {
+		gap = trimRemovedBlockGap(corefileBuilder.String(), gap)
+		if strings.TrimSpace(gap) == "" {
+			// the removed block was the last one, keep a single newline at the end
+			trimmed := strings.TrimRight(corefileBuilder.String(), "\n")
+			corefileBuilder.Reset()
+			corefileBuilder.WriteString(trimmed)
+			gap = ""
+			if trimmed != "" {
+				gap = "\n"
+			}
+		}
+	}
+	corefileBuilder.WriteString(gap)
+
+	var appended []string
+	for key := range generated {
+		if !written[key] {
+			appended = append(appended, key)
+		}
+	}
+	sort.Strings(appended)
+	corefile := corefileBuilder.String()
+	if len(appended) > 0 {
+		corefile = strings.TrimRight(corefile, "\n") + "\n"
+		for _, key := range appended {
+			corefile += "\n" + generated[key] + "\n"
+		}
+	}
+	return corefile, nil
+}
+
+// trimRemovedBlockGap trims the whitespace the removed server block leaves behind in the gap before the next server block:
+// the rest of the line of its closing brace, and the blank lines separating it from the next block if the written
+// Corefile already ends with a blank line. The comments and the other content of the gap are preserved.
+func trimRemovedBlockGap(written, gap string) string {
+	if idx := strings.IndexByte(gap, '\n'); idx >= 0 && strings.TrimSpace(gap[:idx]) == "" {
+		gap = gap[idx+1:]
+	}
+	if written != "" && !strings.HasSuffix(written, "\n\n") {
+		return gap
+	}
+	for {
+		idx := strings.IndexByte(gap, '\n')
+		if idx < 0 || strings.TrimSpace(gap[:idx]) != "" {
+			return gap
+		}
+		gap = gap[idx+1:]
+	}
+}
+
+// stripLegacyCorefileMarkers removes the comment lines, which marked the managed server blocks in the previous versions.
+func stripLegacyCorefileMarkers(text string) string {
+	if !strings.Contains(text, corefileLegacyMarkerPrefix) {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), corefileLegacyMarkerPrefix) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
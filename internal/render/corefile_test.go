@@ -0,0 +1,298 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLexCorefile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{name: "whitespace", content: ".:53 {\n\terrors\r\n  forward . 8.8.8.8\n}", want: []string{".:53", "{", "errors", "forward", ".", "8.8.8.8", "}"}},
+		{name: "comments", content: "# zone\n.:53 { # main\n\terrors#not-a-comment\n}\n#end", want: []string{".:53", "{", "errors#not-a-comment", "}"}},
+		{name: "quoted tokens", content: `hosts { fallthrough "a b" "say \"hi\"" "# no comment" }`, want: []string{"hosts", "{", "fallthrough", "a b", `say "hi"`, "# no comment", "}"}},
+		{name: "quoted brace", content: `. { template "{" }`, want: []string{".", "{", "template", "{", "}"}},
+		{name: "multiline quoted token", content: "\"a\nb\" c", want: []string{"a\nb", "c"}},
+		{name: "unterminated quoted token", content: `. { log "oops }`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lexCorefile(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lexCorefile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := []string{}
+			for _, token := range tokens {
+				got = append(got, token.text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lexCorefile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// the lines and the offsets point to the token in the Corefile
+	content := "# comment\n.:53 {\n\t\"quoted token\"\n}"
+	tokens, err := lexCorefile(content)
+	if err != nil {
+		t.Fatalf("lexCorefile() error = %v", err)
+	}
+	quoted := tokens[2]
+	if quoted.line != 3 || !quoted.quoted || content[quoted.start:quoted.end] != `"quoted token"` {
+		t.Errorf("lexCorefile() quoted token = %+v, want line 3 and the offsets of the quoted token", quoted)
+	}
+}
+
+func TestParseCorefile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name:    "server blocks",
+			content: ".:53 {\n\terrors\n\tforward . /etc/resolv.conf {\n\t\tmax_concurrent 1000\n\t}\n}\n\nexample.com:53 {\n\tfile /etc/zone\n}\n",
+			want:    [][]string{{".:53"}, {"example.com:53"}},
+		},
+		{
+			name:    "several keys",
+			content: "example.com example.org:5353 {\n\tlog\n}\na.com, b.com,\nc.com {\n\tlog\n}\n",
+			want:    [][]string{{"example.com", "example.org:5353"}, {"a.com", "b.com", "c.com"}},
+		},
+		{
+			name:    "import and snippet",
+			content: "(common) {\n\terrors\n}\nimport custom/*.server\n.:53 {\n\timport common\n}\n",
+			want:    [][]string{{"(common)"}, {".:53"}},
+		},
+		{
+			name:    "quoted braces in the body",
+			content: ".:53 {\n\ttemplate IN A {\n\t\tanswer \"{{ .Name }} 60 IN A 127.0.0.1\"\n\t}\n}\nexample.com {\n}\n",
+			want:    [][]string{{".:53"}, {"example.com"}},
+		},
+		{
+			name:    "single server block without braces",
+			content: ".:53\nerrors\nforward . 8.8.8.8\n",
+			want:    [][]string{{".:53"}},
+		},
+		{name: "not closed", content: ".:53 {\n\terrors\n", wantErr: true},
+		{name: "unexpected closing brace", content: ".:53 {\n}\n}\n", wantErr: true},
+		{name: "block without keys", content: "{\n\terrors\n}\n", wantErr: true},
+		{name: "second block without braces", content: ".:53 {\n}\nexample.com\nlog\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := parseCorefile(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCorefile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := [][]string{}
+			for _, block := range blocks {
+				got = append(got, block.keys)
+				if !strings.HasPrefix(tt.content[block.start:], block.keys[0]) {
+					t.Errorf("parseCorefile() block %v starts at %q", block.keys, tt.content[block.start:])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCorefile() keys = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCorefileKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: ".", want: "dns://.:53"},
+		{key: "Example.COM", want: "dns://example.com.:53"},
+		{key: "example.com.:53", want: "dns://example.com.:53"},
+		{key: "dns://example.com:5353", want: "dns://example.com.:5353"},
+		{key: "tls://example.com", want: "tls://example.com.:853"},
+		{key: "10.0.0.0/8", want: "dns://10.in-addr.arpa.:53"},
+		{key: "10.0.0.0/24:5353", want: "dns://0.0.10.in-addr.arpa.:5353"},
+		{key: "ftp://example.com", wantErr: true},
+		{key: "example.com:99999", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeCorefileKey(tt.key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeCorefileKey(%s) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeCorefileKey(%s) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCorefile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: ".:53 {\n}\nexample.com:53 {\n}\nexample.com:5353 {\n}\ntls://example.com {\n}\n"},
+		{name: "duplicate key", content: ".:53 {\n}\nexample.com:53 {\n}\nexample.com:53 {\n}\n", wantErr: true},
+		{name: "duplicate key with default port", content: "example.com {\n}\nEXAMPLE.com.:53 {\n}\n", wantErr: true},
+		{name: "duplicate key within a block", content: "example.com example.com. {\n}\n", wantErr: true},
+		{name: "duplicate reverse zone", content: "10.0.0.0/8 {\n}\n10.in-addr.arpa {\n}\n", wantErr: true},
+		{name: "snippets are not served", content: "(example.com) {\n}\nexample.com {\n\timport example.com\n}\n"},
+		{name: "bad transport", content: "ftp://example.com {\n}\n", wantErr: true},
+		{name: "syntax error", content: ".:53 {\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateCorefile(tt.content); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCorefile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMergeCorefile(t *testing.T) {
+	const rootBlock = ".:53 {\n\terrors\n\tforward . /etc/resolv.conf\n}"
+	const exampleKey = "dns://example.com.:53"
+	const exampleBlock = "example.com:53 {\n\tfile /opt/coredns/example.com.zone\n}"
+	const otherKey = "dns://other.com.:53"
+	const otherBlock = "other.com:53 {\n\tfile /opt/coredns/other.com.zone\n}"
+	tests := []struct {
+		name      string
+		content   string
+		generated map[string]string
+		managed   map[string]bool
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "append generated blocks in the order of the keys",
+			content:   rootBlock + "\n",
+			generated: map[string]string{otherKey: otherBlock, exampleKey: exampleBlock},
+			want:      rootBlock + "\n\n" + exampleBlock + "\n\n" + otherBlock + "\n",
+		},
+		{
+			name:      "replace managed block in place",
+			content:   "# main\n" + rootBlock + "\n\nexample.com:53 {\n\tfile /old\n}\n\n# custom\ncustom.com {\n\tlog\n}\n",
+			generated: map[string]string{exampleKey: exampleBlock},
+			managed:   map[string]bool{exampleKey: true},
+			want:      "# main\n" + rootBlock + "\n\n" + exampleBlock + "\n\n# custom\ncustom.com {\n\tlog\n}\n",
+		},
+		{
+			name:    "remove managed block in the middle",
+			content: rootBlock + "\n\nexample.com:53 {\n\tfile /old\n}\n\ncustom.com {\n\tlog\n}\n",
+			managed: map[string]bool{exampleKey: true},
+			want:    rootBlock + "\n\ncustom.com {\n\tlog\n}\n",
+		},
+		{
+			name:    "remove managed block at the end",
+			content: rootBlock + "\n\nexample.com:53 {\n\tfile /old\n}\n",
+			managed: map[string]bool{exampleKey: true},
+			want:    rootBlock + "\n",
+		},
+		{
+			name:    "remove managed block at the start",
+			content: "example.com:53 {\n\tfile /old\n}\n\n" + rootBlock + "\n",
+			managed: map[string]bool{exampleKey: true},
+			want:    rootBlock + "\n",
+		},
+		{
+			name:      "preserve whitespace of unmanaged content",
+			content:   rootBlock + "\n\n\n\ncustom.com {\n\tlog\n\n\n\n\terrors\n}\n\n\nexample.com:53 {\n\tfile /old\n}\n",
+			generated: map[string]string{exampleKey: exampleBlock},
+			managed:   map[string]bool{exampleKey: true},
+			want:      rootBlock + "\n\n\n\ncustom.com {\n\tlog\n\n\n\n\terrors\n}\n\n\n" + exampleBlock + "\n",
+		},
+		{
+			name:      "remove duplicates of managed blocks",
+			content:   rootBlock + "\n\nexample.com:53 {\n\tfile /old\n}\n\nexample.com. {\n\tfile /older\n}\n",
+			generated: map[string]string{exampleKey: exampleBlock},
+			managed:   map[string]bool{exampleKey: true},
+			want:      rootBlock + "\n\n" + exampleBlock + "\n",
+		},
+		{
+			name:      "keep import and snippets",
+			content:   "(common) {\n\terrors\n}\nimport custom/*.server\n" + rootBlock + "\n",
+			generated: map[string]string{exampleKey: exampleBlock},
+			want:      "(common) {\n\terrors\n}\nimport custom/*.server\n" + rootBlock + "\n\n" + exampleBlock + "\n",
+		},
+		{
+			name:      "keep comments with braces and quoted tokens",
+			content:   "# example.com:53 { is managed }\n.:53 {\n\ttemplate IN TXT {\n\t\tanswer \"{{ .Name }} 60 IN TXT \\\"}\\\"\"\n\t}\n}\n",
+			generated: map[string]string{exampleKey: exampleBlock},
+			want:      "# example.com:53 { is managed }\n.:53 {\n\ttemplate IN TXT {\n\t\tanswer \"{{ .Name }} 60 IN TXT \\\"}\\\"\"\n\t}\n}\n\n" + exampleBlock + "\n",
+		},
+		{
+			name:      "unmanaged block collides with generated zone",
+			content:   rootBlock + "\n\nexample.com {\n\tforward . 10.0.0.1\n}\n",
+			generated: map[string]string{exampleKey: exampleBlock},
+			wantErr:   true,
+		},
+		{
+			name:      "unmanaged multi-key block collides with generated zone",
+			content:   rootBlock + "\n\nexample.com other.org {\n\tforward . 10.0.0.1\n}\n",
+			generated: map[string]string{exampleKey: exampleBlock},
+			managed:   map[string]bool{exampleKey: true},
+			wantErr:   true,
+		},
+		{
+			name: "migrate legacy markers",
+			content: rootBlock + "\n\n" + corefileLegacyMarkerPrefix + " example.com START\nexample.com:53 {\n\tfile /old\n}\n" +
+				corefileLegacyMarkerPrefix + " example.com END\n\n" + corefileLegacyMarkerPrefix + " other.com START\nother.com:53 {\n\tfile /old\n}\n" +
+				corefileLegacyMarkerPrefix + " other.com END\n",
+			generated: map[string]string{exampleKey: exampleBlock},
+			managed:   map[string]bool{exampleKey: true, otherKey: true},
+			want:      rootBlock + "\n\n" + exampleBlock + "\n",
+		},
+		{
+			name:    "syntax error",
+			content: rootBlock + "\nexample.com {\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeCorefile(tt.content, tt.generated, tt.managed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mergeCorefile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("mergeCorefile() =\n%q\nwant\n%q", got, tt.want)
+			}
+			if err := ValidateCorefile(got); err != nil {
+				t.Errorf("mergeCorefile() result is invalid: %v", err)
+			}
+		})
+	}
+}
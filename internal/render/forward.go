@@ -0,0 +1,131 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// validateForwardUpstreams checks the upstreams of the forward zone. Each upstream is an IP address or an IP address with the port,
+// optionally prefixed with dns:// or tls://. With the TLS server name all upstreams must be tls://.
+func validateForwardUpstreams(upstreams []string, tlsServerName string) error {
+	if len(upstreams) == 0 {
+		return fmt.Errorf("upstreams must contain at least one address")
+	}
+	for _, upstream := range upstreams {
+		isTLS := strings.HasPrefix(upstream, "tls://")
+		address := strings.TrimPrefix(strings.TrimPrefix(upstream, "tls://"), "dns://")
+		if tlsServerName != "" && !isTLS {
+			return fmt.Errorf("upstream %q must be tls:// when tlsServerName is set", upstream)
+		}
+		if net.ParseIP(address) != nil {
+			continue
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) == nil {
+			return fmt.Errorf("upstream %q is not an IP address", upstream)
+		}
+		if portNumber, err := strconv.Atoi(port); err != nil || portNumber < 1 || portNumber > 65535 {
+			return fmt.Errorf("upstream %q has a bad port", upstream)
+		}
+	}
+	if tlsServerName != "" {
+		if _, ok := dns.IsDomainName(tlsServerName); !ok || strings.ContainsAny(tlsServerName, " \t") {
+			return fmt.Errorf("tlsServerName %q is not a domain name", tlsServerName)
+		}
+	}
+	return nil
+}
+
+// ConstructForwardBlock builds the server block of the forward zone. Enabled plugins of the DNSConnector are added to the block.
+func ConstructForwardBlock(forwardZone *monkalev1alpha1.DNSForwardZone, plugins []string) (string, error) {
+	spec := forwardZone.Spec
+	if _, ok := dns.IsDomainName(spec.Domain); !ok || strings.ContainsAny(spec.Domain, " \t{}") {
+		return "", fmt.Errorf("domain %q is not a domain name", spec.Domain)
+	}
+	if err := validateForwardUpstreams(spec.Upstreams, spec.TLSServerName); err != nil {
+		return "", err
+	}
+
+	var blockBuilder strings.Builder
+	blockBuilder.WriteString(fmt.Sprintf("%s:53 {\n\tforward . %s {", spec.Domain, strings.Join(spec.Upstreams, " ")))
+	switch spec.Policy {
+	case "":
+	case monkalev1alpha1.ForwardPolicyRandom, monkalev1alpha1.ForwardPolicyRoundRobin, monkalev1alpha1.ForwardPolicySequential:
+		blockBuilder.WriteString(fmt.Sprintf("\n\t\tpolicy %s", spec.Policy))
+	default:
+		return "", fmt.Errorf("unsupported policy: %s", spec.Policy)
+	}
+	if spec.HealthCheck > 0 {
+		blockBuilder.WriteString(fmt.Sprintf("\n\t\thealth_check %ds", spec.HealthCheck))
+	}
+	if spec.TLSServerName != "" {
+		blockBuilder.WriteString(fmt.Sprintf("\n\t\ttls_servername %s", spec.TLSServerName))
+	}
+	blockBuilder.WriteString("\n\t}")
+	for _, plugin := range plugins {
+		blockBuilder.WriteString(fmt.Sprintf("\n\t%s", plugin))
+	}
+	blockBuilder.WriteString("\n}")
+
+	block := blockBuilder.String()
+	if err := validateCorefileBlock(block); err != nil {
+		return "", err
+	}
+	return block, nil
+}
+
+// InvalidForwardZone is the DNSForwardZone skipped by the DNSConnector, and the reason.
+type InvalidForwardZone struct {
+	ForwardZone monkalev1alpha1.DNSForwardZone
+	Err         error
+}
+
+// FilterForwardZones filters out the invalid DNSForwardZones of the DNSConnector: forward zones with bad upstreams,
+// and forward zones whose domain is already served by a zone ConfigMap or by a preceding DNSForwardZone.
+// Returns the good forward zones and the invalid ones with the reason.
+func FilterForwardZones(dnsConnector *monkalev1alpha1.DNSConnector, zoneConfigMaps *corev1.ConfigMapList, forwardZones *monkalev1alpha1.DNSForwardZoneList) (monkalev1alpha1.DNSForwardZoneList, []InvalidForwardZone) {
+	servedDomains := make(map[string]string)
+	for _, configMap := range zoneConfigMaps.Items {
+		servedDomains[strings.ToLower(monkalev1alpha1.EnsureFQDN(configMap.Annotations["DomainName"]))] = "DNSZone " + configMap.Annotations["DNSZoneRef"]
+	}
+
+	goodForwardZones := monkalev1alpha1.DNSForwardZoneList{}
+	var invalidForwardZones []InvalidForwardZone
+	for _, forwardZone := range forwardZones.Items {
+		domain := strings.ToLower(monkalev1alpha1.EnsureFQDN(forwardZone.Spec.Domain))
+		_, err := ConstructForwardBlock(&forwardZone, GetZonePlugins(dnsConnector))
+		if servedBy, exists := servedDomains[domain]; err == nil && exists {
+			err = fmt.Errorf("domain %s is already served by %s", forwardZone.Spec.Domain, servedBy)
+		}
+		if err != nil {
+			invalidForwardZones = append(invalidForwardZones, InvalidForwardZone{ForwardZone: forwardZone, Err: err})
+			continue
+		}
+		servedDomains[domain] = "DNSForwardZone " + forwardZone.Name
+		goodForwardZones.Items = append(goodForwardZones.Items, forwardZone)
+	}
+	return goodForwardZones, invalidForwardZones
+}
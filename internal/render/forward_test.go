@@ -0,0 +1,68 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+func TestFilterForwardZones(t *testing.T) {
+	forwardZone := func(name, domain string, upstreams ...string) monkalev1alpha1.DNSForwardZone {
+		return monkalev1alpha1.DNSForwardZone{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-system"},
+			Spec:       monkalev1alpha1.DNSForwardZoneSpec{Domain: domain, Upstreams: upstreams, ConnectorName: "coredns"},
+		}
+	}
+	dnsConnector := &monkalev1alpha1.DNSConnector{ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: "kube-system"}}
+	zoneConfigMaps := &corev1.ConfigMapList{Items: []corev1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "coredns-zone-example-com",
+			Annotations: map[string]string{"DomainName": "example.com", "DNSZoneRef": "example-com"},
+		},
+	}}}
+	forwardZones := &monkalev1alpha1.DNSForwardZoneList{Items: []monkalev1alpha1.DNSForwardZone{
+		forwardZone("corp", "corp.local", "10.0.0.1", "10.0.0.2:5353"),
+		forwardZone("bad-upstream", "lab.local", "not-an-ip"),
+		forwardZone("served-by-zone", "Example.com.", "10.0.0.1"),
+		forwardZone("served-by-forward-zone", "corp.local.", "10.0.0.3"),
+		forwardZone("tls", "secure.local", "tls://10.0.0.4"),
+	}}
+
+	good, invalid := FilterForwardZones(dnsConnector, zoneConfigMaps, forwardZones)
+	var goodNames, invalidNames []string
+	for _, forwardZone := range good.Items {
+		goodNames = append(goodNames, forwardZone.Name)
+	}
+	for _, forwardZone := range invalid {
+		if forwardZone.Err == nil {
+			t.Errorf("FilterForwardZones() invalid forward zone %s without the reason", forwardZone.ForwardZone.Name)
+		}
+		invalidNames = append(invalidNames, forwardZone.ForwardZone.Name)
+	}
+	if want := []string{"corp", "tls"}; !reflect.DeepEqual(goodNames, want) {
+		t.Errorf("FilterForwardZones() good forward zones = %v, want %v", goodNames, want)
+	}
+	if want := []string{"bad-upstream", "served-by-zone", "served-by-forward-zone"}; !reflect.DeepEqual(invalidNames, want) {
+		t.Errorf("FilterForwardZones() invalid forward zones = %v, want %v", invalidNames, want)
+	}
+}
@@ -0,0 +1,348 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+const importCMPrefix string = "coredns-zone-" // importCMPrefix is the default cmPrefix of the DNSZone
+
+// importRecordTypes are the record types a DNSRecord supports.
+var importRecordTypes = map[uint16]bool{
+	dns.TypeA: true, dns.TypeAAAA: true, dns.TypeCNAME: true, dns.TypeMX: true, dns.TypeTXT: true, dns.TypeNS: true,
+	dns.TypePTR: true, dns.TypeSRV: true, dns.TypeCAA: true, dns.TypeDS: true, dns.TypeNAPTR: true, dns.TypeDNAME: true,
+	dns.TypeHINFO: true,
+}
+
+// importDNSSECTypes are the record types of a signed zone. The operator signs the zone itself, see spec.dnssec.
+var importDNSSECTypes = map[uint16]bool{
+	dns.TypeRRSIG: true, dns.TypeNSEC: true, dns.TypeNSEC3: true, dns.TypeNSEC3PARAM: true, dns.TypeDNSKEY: true,
+}
+
+// ImportOptions are the options of the zone file import.
+type ImportOptions struct {
+	Origin            string // the domain of the zone, the relative names of the zone file are completed with it
+	Namespace         string // the namespace of the DNSZone and the DNSRecords
+	ZoneName          string // the name of the DNSZone, derived from the origin if not set
+	ConnectorName     string // the DNSConnector of the DNSZone
+	PrimaryNSHostname string // overrides the primary name server taken from the SOA record
+	PrimaryNSIP       string // overrides the address of the primary name server taken from the zone
+	RespPersonEmail   string // overrides the email taken from the SOA record
+}
+
+// ImportResult is the DNSZone and the DNSRecords imported from the zone file.
+type ImportResult struct {
+	DNSZone    monkalev1alpha1.DNSZone
+	DNSRecords []monkalev1alpha1.DNSRecord
+	Warnings   []string // the records which are not imported
+}
+
+// importRRset is the RRset of the zone file imported into one DNSRecord.
+type importRRset struct {
+	name       string
+	recordType string
+	ttl        uint32
+	values     []string
+}
+
+// ImportZone parses the RFC 1035 zone file, and converts it into the DNSZone and one DNSRecord per RRset.
+// $ORIGIN, $TTL and $INCLUDE directives are supported, the included files are resolved relative to the filename.
+// The SOA record and the primary name server records are covered by the DNSZone. The records the operator cannot
+// serve, e.g. out of zone or DNSSEC records, are skipped and reported as warnings.
+func ImportZone(reader io.Reader, filename string, options ImportOptions) (*ImportResult, error) {
+	if options.Origin == "" || options.Origin == "." {
+		return nil, fmt.Errorf("the origin of the zone must be set")
+	}
+	origin := dns.CanonicalName(options.Origin)
+	zoneName := options.ZoneName
+	if zoneName == "" {
+		zoneName = strings.ReplaceAll(strings.TrimSuffix(origin, "."), ".", "-")
+	}
+	if errs := validation.IsDNS1123Subdomain(zoneName); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid DNSZone name %s: %s", zoneName, strings.Join(errs, ", "))
+	}
+
+	var rrs []dns.RR
+	zoneParser := dns.NewZoneParser(reader, origin, filename)
+	zoneParser.SetIncludeAllowed(true)
+	for rr, ok := zoneParser.Next(); ok; rr, ok = zoneParser.Next() {
+		rr.Header().Name = dns.CanonicalName(rr.Header().Name)
+		rrs = append(rrs, rr)
+	}
+	if err := zoneParser.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse the zone file: %v", err)
+	}
+
+	var soa *dns.SOA
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeSOA && rr.Header().Name == origin {
+			soa = rr.(*dns.SOA)
+			break
+		}
+	}
+	if soa == nil {
+		return nil, fmt.Errorf("the zone file has no SOA record of %s", origin)
+	}
+
+	result := &ImportResult{}
+	dnsZone, err := importDNSZone(soa, rrs, zoneName, options)
+	if err != nil {
+		return nil, err
+	}
+	result.DNSZone = dnsZone
+	primaryNS := dns.CanonicalName(dnsZone.Spec.PrimaryNS.Hostname + "." + origin)
+
+	var rrsets []*importRRset
+	rrsetsByKey := make(map[string]*importRRset)
+	for _, rr := range rrs {
+		header := rr.Header()
+		recordType := dns.TypeToString[header.Rrtype]
+		rdata := RRData(rr)
+		switch {
+		case header.Class != dns.ClassINET:
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s %s: skipped, only records of class IN are supported", header.Name, recordType))
+			continue
+		case !dns.IsSubDomain(origin, header.Name):
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s %s: skipped, the record is out of the zone %s", header.Name, recordType, origin))
+			continue
+		case header.Rrtype == dns.TypeSOA:
+			continue
+		case importDNSSECTypes[header.Rrtype]:
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s %s: skipped, the zone is signed by the operator if spec.dnssec is enabled", header.Name, recordType))
+			continue
+		case !importRecordTypes[header.Rrtype]:
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s %s: skipped, the record type is not supported", header.Name, recordType))
+			continue
+		case header.Rrtype == dns.TypeNS && header.Name == origin && dns.CanonicalName(rr.(*dns.NS).Ns) == primaryNS:
+			// the NS record of the primary name server is generated by the DNSZone
+			continue
+		case header.Name == primaryNS && recordType == dnsZone.Spec.PrimaryNS.RecordType && net.ParseIP(rdata).Equal(net.ParseIP(dnsZone.Spec.PrimaryNS.IPAddress)):
+			// the address of the primary name server is generated by the DNSZone
+			continue
+		}
+
+		key := header.Name + "/" + recordType
+		rrset, ok := rrsetsByKey[key]
+		if !ok {
+			name := "@"
+			if header.Name != origin {
+				name = strings.TrimSuffix(header.Name, "."+origin)
+			}
+			rrset = &importRRset{name: name, recordType: recordType, ttl: header.Ttl}
+			rrsetsByKey[key] = rrset
+			rrsets = append(rrsets, rrset)
+		}
+		if header.Ttl < rrset.ttl {
+			rrset.ttl = header.Ttl
+		}
+		if !containsString(rrset.values, rdata) {
+			rrset.values = append(rrset.values, rdata)
+		}
+	}
+
+	usedNames := make(map[string]bool)
+	for _, rrset := range rrsets {
+		dnsRecord := importDNSRecord(rrset, zoneName, soa.Hdr.Ttl, usedNames, options)
+		// the record must produce the same RRset once it is rendered into the zone
+		record, err := ConstructRecord(dnsRecord)
+		if err == nil {
+			_, err = ParseRecords(record, origin)
+		}
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s %s: skipped, %v", rrset.name, rrset.recordType, err))
+			continue
+		}
+		result.DNSRecords = append(result.DNSRecords, dnsRecord)
+	}
+	return result, nil
+}
+
+// importDNSZone converts the SOA record into the DNSZone. The primary name server is the SOA MNAME, which must be within
+// the zone and have an A or AAAA record, unless it is overridden by the options.
+func importDNSZone(soa *dns.SOA, rrs []dns.RR, zoneName string, options ImportOptions) (monkalev1alpha1.DNSZone, error) {
+	origin := soa.Hdr.Name
+	primaryNS := dns.CanonicalName(soa.Ns)
+	hostname := options.PrimaryNSHostname
+	if hostname == "" {
+		if primaryNS == origin || !dns.IsSubDomain(origin, primaryNS) {
+			return monkalev1alpha1.DNSZone{}, fmt.Errorf("the primary name server %s of the SOA record is not within the zone, set the primary name server hostname", primaryNS)
+		}
+		hostname = strings.TrimSuffix(primaryNS, "."+origin)
+	}
+	primaryNS = dns.CanonicalName(hostname + "." + origin)
+
+	ipAddress := options.PrimaryNSIP
+	if ipAddress == "" {
+		ipAddress = getImportAddress(rrs, primaryNS)
+		if ipAddress == "" {
+			return monkalev1alpha1.DNSZone{}, fmt.Errorf("the primary name server %s has no A or AAAA record in the zone, set the primary name server IP address", primaryNS)
+		}
+	}
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return monkalev1alpha1.DNSZone{}, fmt.Errorf("invalid primary name server IP address %s", ipAddress)
+	}
+	recordType := "A"
+	if ip.To4() == nil {
+		recordType = "AAAA"
+	}
+
+	email := options.RespPersonEmail
+	if email == "" {
+		var err error
+		if email, err = mboxToEmail(soa.Mbox); err != nil {
+			return monkalev1alpha1.DNSZone{}, err
+		}
+	}
+
+	return monkalev1alpha1.DNSZone{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: monkalev1alpha1.GroupVersion.String(),
+			Kind:       "DNSZone",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      zoneName,
+			Namespace: options.Namespace,
+		},
+		Spec: monkalev1alpha1.DNSZoneSpec{
+			CMPrefix: importCMPrefix,
+			Domain:   strings.TrimSuffix(origin, "."),
+			PrimaryNS: &monkalev1alpha1.PrimaryNS{
+				Hostname:   hostname,
+				IPAddress:  ip.String(),
+				RecordType: recordType,
+			},
+			RespPersonEmail: email,
+			TTL:             uint(soa.Hdr.Ttl),
+			RefreshRate:     uint(soa.Refresh),
+			RetryInterval:   uint(soa.Retry),
+			ExpireTime:      uint(soa.Expire),
+			MinimumTTL:      uint(soa.Minttl),
+			ConnectorName:   options.ConnectorName,
+		},
+	}, nil
+}
+
+// getImportAddress returns the address of the first A record of the name, or of its first AAAA record if it has no A records.
+func getImportAddress(rrs []dns.RR, name string) string {
+	for _, rr := range rrs {
+		if a, ok := rr.(*dns.A); ok && a.Hdr.Name == name {
+			return a.A.String()
+		}
+	}
+	for _, rr := range rrs {
+		if aaaa, ok := rr.(*dns.AAAA); ok && aaaa.Hdr.Name == name {
+			return aaaa.AAAA.String()
+		}
+	}
+	return ""
+}
+
+// importDNSRecord converts the RRset into the DNSRecord. The TTL is omitted if it matches the TTL of the zone.
+func importDNSRecord(rrset *importRRset, zoneName string, zoneTTL uint32, usedNames map[string]bool, options ImportOptions) monkalev1alpha1.DNSRecord {
+	record := &monkalev1alpha1.Record{
+		Name: rrset.name,
+		Type: rrset.recordType,
+	}
+	if rrset.ttl != zoneTTL {
+		record.TTL = strconv.FormatUint(uint64(rrset.ttl), 10)
+	}
+	if len(rrset.values) == 1 {
+		record.Value = rrset.values[0]
+	} else {
+		record.Values = rrset.values
+	}
+
+	return monkalev1alpha1.DNSRecord{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: monkalev1alpha1.GroupVersion.String(),
+			Kind:       "DNSRecord",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getImportRecordName(zoneName, rrset.name, rrset.recordType, usedNames),
+			Namespace: options.Namespace,
+		},
+		Spec: monkalev1alpha1.DNSRecordSpec{
+			Record:     record,
+			DNSZoneRef: &corev1.ObjectReference{Name: zoneName},
+		},
+	}
+}
+
+// getImportRecordName generates the DNSRecord name for the record name and the record type, e.g. "example-com-www-a".
+// Falls back to the hash of the record name if the readable name is not a valid resource name, or is already used.
+func getImportRecordName(zoneName, name, recordType string, usedNames map[string]bool) string {
+	host := name
+	if host == "@" {
+		host = "apex"
+	}
+	host = strings.ReplaceAll(host, "*", "wildcard")
+	host = strings.ReplaceAll(host, "_", "")
+	host = strings.ReplaceAll(host, ".", "-")
+	recordName := strings.ToLower(fmt.Sprintf("%s-%s-%s", zoneName, host, recordType))
+	if len(validation.IsDNS1123Subdomain(recordName)) > 0 || usedNames[recordName] {
+		sum := sha256.Sum256([]byte(name + "/" + recordType))
+		recordName = strings.ToLower(fmt.Sprintf("%s-%s-%s", zoneName, hex.EncodeToString(sum[:])[:10], recordType))
+		if len(validation.IsDNS1123Subdomain(recordName)) > 0 {
+			sum = sha256.Sum256([]byte(zoneName + "/" + name + "/" + recordType))
+			recordName = strings.ToLower(fmt.Sprintf("%s-%s", hex.EncodeToString(sum[:])[:20], recordType))
+		}
+	}
+	usedNames[recordName] = true
+	return recordName
+}
+
+// mboxToEmail converts the SOA RNAME into the email: the first unescaped dot separates the user name from the domain.
+func mboxToEmail(mbox string) (string, error) {
+	mbox = strings.TrimSuffix(mbox, ".")
+	if strings.Contains(mbox, "@") {
+		return mbox, nil
+	}
+	for i := 0; i < len(mbox); i++ {
+		switch mbox[i] {
+		case '\\':
+			i++
+		case '.':
+			return strings.ReplaceAll(mbox[:i], `\.`, ".") + "@" + mbox[i+1:], nil
+		}
+	}
+	return "", fmt.Errorf("the responsible person %s of the SOA record is not an email, set the responsible person email", mbox)
+}
+
+// containsString reports whether the string is in the slice.
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
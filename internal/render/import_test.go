@@ -0,0 +1,251 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+const importTestSOA = `@ 3600 IN SOA ns1 hostmaster (1 7200 1800 1209600 300)
+@ IN NS ns1
+ns1 IN A 192.0.2.1
+`
+
+// importTestRecord is the part of the imported DNSRecord compared by the tests.
+type importTestRecord struct {
+	name   string
+	record monkalev1alpha1.Record
+}
+
+func getImportTestRecords(result *ImportResult) []importTestRecord {
+	var records []importTestRecord
+	for _, dnsRecord := range result.DNSRecords {
+		records = append(records, importTestRecord{name: dnsRecord.Name, record: *dnsRecord.Spec.Record})
+	}
+	return records
+}
+
+func TestImportZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		zone     string
+		include  map[string]string
+		want     []importTestRecord
+		warnings int
+	}{
+		{
+			name: "relative and absolute names",
+			zone: "$TTL 3600\n" + importTestSOA + `www IN A 192.0.2.10
+mail.example.com. IN A 192.0.2.20
+@ IN MX 10 mail
+`,
+			want: []importTestRecord{
+				{name: "example-com-www-a", record: monkalev1alpha1.Record{Name: "www", Type: "A", Value: "192.0.2.10"}},
+				{name: "example-com-mail-a", record: monkalev1alpha1.Record{Name: "mail", Type: "A", Value: "192.0.2.20"}},
+				{name: "example-com-apex-mx", record: monkalev1alpha1.Record{Name: "@", Type: "MX", Value: "10 mail.example.com."}},
+			},
+		},
+		{
+			name: "origin directive",
+			zone: "$TTL 3600\n" + importTestSOA + `$ORIGIN lab.example.com.
+host1 IN A 10.0.0.1
+$ORIGIN example.org.
+host2 IN A 10.0.0.2
+`,
+			want: []importTestRecord{
+				{name: "example-com-host1-lab-a", record: monkalev1alpha1.Record{Name: "host1.lab", Type: "A", Value: "10.0.0.1"}},
+			},
+			warnings: 1,
+		},
+		{
+			name: "ttl directive",
+			zone: "$TTL 3600\n" + importTestSOA + `www IN A 192.0.2.10
+$TTL 60
+api IN A 192.0.2.11
+www IN A 192.0.2.12
+`,
+			want: []importTestRecord{
+				{name: "example-com-www-a", record: monkalev1alpha1.Record{Name: "www", Type: "A", TTL: "60", Values: []string{"192.0.2.10", "192.0.2.12"}}},
+				{name: "example-com-api-a", record: monkalev1alpha1.Record{Name: "api", Type: "A", TTL: "60", Value: "192.0.2.11"}},
+			},
+		},
+		{
+			name:    "include directive",
+			zone:    "$TTL 3600\n" + importTestSOA + "$INCLUDE hosts.inc lab.example.com.\nwww IN A 192.0.2.10\n",
+			include: map[string]string{"hosts.inc": "host1 IN A 10.0.0.1\n"},
+			want: []importTestRecord{
+				{name: "example-com-host1-lab-a", record: monkalev1alpha1.Record{Name: "host1.lab", Type: "A", Value: "10.0.0.1"}},
+				{name: "example-com-www-a", record: monkalev1alpha1.Record{Name: "www", Type: "A", Value: "192.0.2.10"}},
+			},
+		},
+		{
+			name: "name collisions",
+			zone: "$TTL 3600\n" + importTestSOA + `www-a IN A 192.0.2.10
+www.a IN A 192.0.2.11
+_sip._tcp IN SRV 10 5 5060 sip
+*.dev IN CNAME www
+`,
+			want: []importTestRecord{
+				{name: "example-com-www-a-a", record: monkalev1alpha1.Record{Name: "www-a", Type: "A", Value: "192.0.2.10"}},
+				{name: "example-com-ad2ae27e44-a", record: monkalev1alpha1.Record{Name: "www.a", Type: "A", Value: "192.0.2.11"}},
+				{name: "example-com-sip-tcp-srv", record: monkalev1alpha1.Record{Name: "_sip._tcp", Type: "SRV", Value: "10 5 5060 sip.example.com."}},
+				{name: "example-com-wildcard-dev-cname", record: monkalev1alpha1.Record{Name: "*.dev", Type: "CNAME", Value: "www.example.com."}},
+			},
+		},
+		{
+			name: "skipped records",
+			zone: "$TTL 3600\n" + importTestSOA + `@ IN NS ns2.provider.net.
+ns1 IN A 192.0.2.2
+@ IN DNSKEY 257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==
+@ IN SSHFP 1 1 123456789abcdef67890123456789abcdef67890
+chaos CH TXT "x"
+`,
+			want: []importTestRecord{
+				{name: "example-com-apex-ns", record: monkalev1alpha1.Record{Name: "@", Type: "NS", Value: "ns2.provider.net."}},
+				{name: "example-com-ns1-a", record: monkalev1alpha1.Record{Name: "ns1", Type: "A", Value: "192.0.2.2"}},
+			},
+			warnings: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "db.example.com")
+			for name, content := range tt.include {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			result, err := ImportZone(strings.NewReader(tt.zone), filename, ImportOptions{Origin: "example.com", ConnectorName: "coredns"})
+			if err != nil {
+				t.Fatalf("ImportZone() error = %v", err)
+			}
+			if got := getImportTestRecords(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ImportZone() records = %+v, want %+v", got, tt.want)
+			}
+			if len(result.Warnings) != tt.warnings {
+				t.Errorf("ImportZone() warnings = %q, want %d warnings", result.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestImportZoneSOA(t *testing.T) {
+	zone := `$ORIGIN example.com.
+$TTL 600
+@ IN SOA ns1 john\.doe (1 7200 1800 1209600 300)
+ns1 IN AAAA 2001:db8::1
+ns1 IN A 192.0.2.1
+ns1 IN A 192.0.2.2
+`
+	result, err := ImportZone(strings.NewReader(zone), "", ImportOptions{Origin: "example.com.", ConnectorName: "coredns"})
+	if err != nil {
+		t.Fatalf("ImportZone() error = %v", err)
+	}
+	want := monkalev1alpha1.DNSZoneSpec{
+		CMPrefix:        "coredns-zone-",
+		Domain:          "example.com",
+		PrimaryNS:       &monkalev1alpha1.PrimaryNS{Hostname: "ns1", IPAddress: "192.0.2.1", RecordType: "A"},
+		RespPersonEmail: "john.doe@example.com",
+		TTL:             600,
+		RefreshRate:     7200,
+		RetryInterval:   1800,
+		ExpireTime:      1209600,
+		MinimumTTL:      300,
+		ConnectorName:   "coredns",
+	}
+	if !reflect.DeepEqual(result.DNSZone.Spec, want) {
+		t.Errorf("ImportZone() DNSZone spec = %+v, want %+v", result.DNSZone.Spec, want)
+	}
+	if result.DNSZone.Name != "example-com" {
+		t.Errorf("ImportZone() DNSZone name = %s, want example-com", result.DNSZone.Name)
+	}
+	// the primary name server address is generated by the DNSZone, the other addresses are imported
+	if got := getImportTestRecords(result); len(got) != 2 || got[0].record.Value != "2001:db8::1" || got[1].record.Value != "192.0.2.2" {
+		t.Errorf("ImportZone() records = %+v, want the AAAA record and the second A record", got)
+	}
+}
+
+func TestImportZoneErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		zone    string
+		options ImportOptions
+	}{
+		{name: "no origin", zone: importTestSOA},
+		{name: "no SOA record", zone: "www 3600 IN A 192.0.2.10\n", options: ImportOptions{Origin: "example.com"}},
+		{name: "invalid DNSZone name", zone: importTestSOA, options: ImportOptions{Origin: "example.com", ZoneName: "Example"}},
+		{name: "primary name server out of the zone", zone: "@ 3600 IN SOA ns1.provider.net. hostmaster 1 7200 1800 1209600 300\n", options: ImportOptions{Origin: "example.com"}},
+		{name: "primary name server without address", zone: "@ 3600 IN SOA ns1 hostmaster 1 7200 1800 1209600 300\n", options: ImportOptions{Origin: "example.com"}},
+		{name: "syntax error", zone: importTestSOA + "www IN A 192.0.2\n", options: ImportOptions{Origin: "example.com"}},
+		{name: "include not found", zone: importTestSOA + "$INCLUDE missing.inc\n", options: ImportOptions{Origin: "example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "db.example.com")
+			if _, err := ImportZone(strings.NewReader(tt.zone), filename, tt.options); err == nil {
+				t.Errorf("ImportZone() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestImportZoneOverrides(t *testing.T) {
+	zone := "@ 3600 IN SOA ns1.provider.net. hostmaster.provider.net. 1 7200 1800 1209600 300\n"
+	result, err := ImportZone(strings.NewReader(zone), "", ImportOptions{
+		Origin:            "example.com",
+		PrimaryNSHostname: "ns",
+		PrimaryNSIP:       "2001:db8::53",
+		RespPersonEmail:   "admin@example.com",
+	})
+	if err != nil {
+		t.Fatalf("ImportZone() error = %v", err)
+	}
+	want := &monkalev1alpha1.PrimaryNS{Hostname: "ns", IPAddress: "2001:db8::53", RecordType: "AAAA"}
+	if !reflect.DeepEqual(result.DNSZone.Spec.PrimaryNS, want) || result.DNSZone.Spec.RespPersonEmail != "admin@example.com" {
+		t.Errorf("ImportZone() DNSZone spec = %+v, want the overrides", result.DNSZone.Spec)
+	}
+}
+
+func TestGetImportRecordName(t *testing.T) {
+	usedNames := make(map[string]bool)
+	tests := []struct {
+		name       string
+		recordType string
+		want       string
+	}{
+		{name: "@", recordType: "MX", want: "example-com-apex-mx"},
+		{name: "WWW", recordType: "A", want: "example-com-www-a"},
+		{name: "www", recordType: "AAAA", want: "example-com-www-aaaa"},
+		{name: "*", recordType: "A", want: "example-com-wildcard-a"},
+		{name: "_dmarc", recordType: "TXT", want: "example-com-dmarc-txt"},
+		{name: "a.b", recordType: "A", want: "example-com-a-b-a"},
+		{name: "a-b", recordType: "A", want: "example-com-cf88ea0421-a"},
+		{name: `a\032b`, recordType: "A", want: "example-com-51380b9cd0-a"},
+	}
+	for _, tt := range tests {
+		if got := getImportRecordName("example-com", tt.name, tt.recordType, usedNames); got != tt.want {
+			t.Errorf("getImportRecordName(%q, %s) = %s, want %s", tt.name, tt.recordType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// defaultLintSeverities are the severities of the lint checks unless they are overridden in spec.lint.severities.
+var defaultLintSeverities = map[string]string{
+	monkalev1alpha1.LintCheckCNAMEAndOtherData: monkalev1alpha1.LintSeverityError,
+	monkalev1alpha1.LintCheckMissingGlue:       monkalev1alpha1.LintSeverityError,
+	monkalev1alpha1.LintCheckTargetIsCNAME:     monkalev1alpha1.LintSeverityWarning,
+	monkalev1alpha1.LintCheckDanglingTarget:    monkalev1alpha1.LintSeverityWarning,
+	monkalev1alpha1.LintCheckDuplicateRR:       monkalev1alpha1.LintSeverityWarning,
+	monkalev1alpha1.LintCheckTTLMismatch:       monkalev1alpha1.LintSeverityInfo,
+}
+
+// lintSeverityRank orders the severities, the most severe first.
+var lintSeverityRank = map[string]int{
+	monkalev1alpha1.LintSeverityError:   0,
+	monkalev1alpha1.LintSeverityWarning: 1,
+	monkalev1alpha1.LintSeverityInfo:    2,
+}
+
+// LintDNSZone lints the zone assembled out of the SOA and NS records of the zone and the baked records.
+// Returns the findings with the severities of the zone policy, and the number of the findings that block publishing.
+func LintDNSZone(dnsZone *monkalev1alpha1.DNSZone, records BakedRecords) ([]monkalev1alpha1.LintFinding, int, error) {
+	origin := monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain)
+	header, err := ConstructZoneFile(dnsZone, "", "1")
+	if err != nil {
+		return nil, 0, fmt.Errorf("zone construction failure: %v", err)
+	}
+	headerRRs, err := ParseRecords(header, origin)
+	if err != nil {
+		return nil, 0, fmt.Errorf("zone validation failure: %v", err)
+	}
+	zoneRRs := make([]ZoneRR, 0, len(headerRRs)+len(records.ZoneRRs))
+	for _, rr := range headerRRs {
+		zoneRRs = append(zoneRRs, ZoneRR{RR: rr})
+	}
+	zoneRRs = append(zoneRRs, records.ZoneRRs...)
+	findings, blocking := applyLintPolicy(dnsZone.Spec.Lint, lintZone(origin, zoneRRs))
+	return findings, blocking, nil
+}
+
+// lintZone checks the logic of the zone, which the zone file parser does not:
+// CNAME records coexisting with other data, MX, SRV and NS targets that are CNAMEs, in-zone targets that do not resolve,
+// duplicate records, TTL mismatches within the RRsets and in-zone name servers without the A or AAAA records.
+// The severities of the findings are not set.
+func lintZone(origin string, zoneRRs []ZoneRR) []monkalev1alpha1.LintFinding {
+	origin = dns.CanonicalName(origin)
+	owners := make(map[string]map[uint16][]ZoneRR)
+	ownerNames := []string{}
+	for _, zrr := range zoneRRs {
+		name := dns.CanonicalName(zrr.RR.Header().Name)
+		if owners[name] == nil {
+			owners[name] = make(map[uint16][]ZoneRR)
+			ownerNames = append(ownerNames, name)
+		}
+		rrType := zrr.RR.Header().Rrtype
+		owners[name][rrType] = append(owners[name][rrType], zrr)
+	}
+
+	// belowZoneCut returns true if the name is delegated to a child zone, so it is resolved by the child name servers.
+	belowZoneCut := func(name string) bool {
+		for n := name; n != origin && dns.IsSubDomain(origin, n); n = getParentName(n) {
+			if len(owners[n][dns.TypeNS]) > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	// lookup returns the records of the name, or of the wildcard matching the name.
+	lookup := func(name string) map[uint16][]ZoneRR {
+		if rrs, ok := owners[name]; ok {
+			return rrs
+		}
+		for n := getParentName(name); dns.IsSubDomain(origin, n); n = getParentName(n) {
+			if rrs, ok := owners["*."+n]; ok {
+				return rrs
+			}
+			if nameExists(n, ownerNames) {
+				break
+			}
+			if n == origin {
+				break
+			}
+		}
+		return nil
+	}
+
+	findings := []monkalev1alpha1.LintFinding{}
+	for _, name := range ownerNames {
+		rrsets := owners[name]
+		rrTypes := make([]uint16, 0, len(rrsets))
+		for rrType := range rrsets {
+			rrTypes = append(rrTypes, rrType)
+		}
+		sort.Slice(rrTypes, func(i, j int) bool { return rrTypes[i] < rrTypes[j] })
+
+		// CNAME and other data
+		if cnames := rrsets[dns.TypeCNAME]; len(cnames) > 0 {
+			otherTypes := []string{}
+			involved := []ZoneRR{}
+			for _, rrType := range rrTypes {
+				involved = append(involved, rrsets[rrType]...)
+				if rrType == dns.TypeCNAME || rrType == dns.TypeRRSIG || rrType == dns.TypeNSEC || rrType == dns.TypeNSEC3 {
+					continue
+				}
+				otherTypes = append(otherTypes, dns.TypeToString[rrType])
+			}
+			if len(otherTypes) > 0 {
+				findings = append(findings, monkalev1alpha1.LintFinding{
+					Check:      monkalev1alpha1.LintCheckCNAMEAndOtherData,
+					Name:       name,
+					Type:       "CNAME",
+					Message:    fmt.Sprintf("CNAME record coexists with the %s records. CNAME records must not coexist with other data (RFC 1034, section 3.6.2)", strings.Join(otherTypes, ", ")),
+					DNSRecords: getZoneRRsDNSRecords(involved),
+				})
+			} else if targets := countDistinctRdata(cnames); targets > 1 {
+				findings = append(findings, monkalev1alpha1.LintFinding{
+					Check:      monkalev1alpha1.LintCheckCNAMEAndOtherData,
+					Name:       name,
+					Type:       "CNAME",
+					Message:    fmt.Sprintf("%d CNAME records with different targets. The owner name must have a single CNAME record", targets),
+					DNSRecords: getZoneRRsDNSRecords(cnames),
+				})
+			}
+		}
+
+		for _, rrType := range rrTypes {
+			rrset := rrsets[rrType]
+			typeName := dns.TypeToString[rrType]
+
+			// Duplicate records
+			reported := make(map[string]bool)
+			for i := range rrset {
+				for j := i + 1; j < len(rrset); j++ {
+					if !dns.IsDuplicate(rrset[i].RR, rrset[j].RR) {
+						continue
+					}
+					rdata := RRData(rrset[i].RR)
+					if reported[rdata] {
+						continue
+					}
+					reported[rdata] = true
+					findings = append(findings, monkalev1alpha1.LintFinding{
+						Check:      monkalev1alpha1.LintCheckDuplicateRR,
+						Name:       name,
+						Type:       typeName,
+						Message:    fmt.Sprintf("%s record %s is defined more than once", typeName, rdata),
+						DNSRecords: getZoneRRsDNSRecords([]ZoneRR{rrset[i], rrset[j]}),
+					})
+				}
+			}
+
+			// TTL mismatch within the RRset. The signatures have the TTL of the RRset they cover.
+			if rrType != dns.TypeRRSIG {
+				ttls := []uint32{}
+				seenTTLs := make(map[uint32]bool)
+				for _, zrr := range rrset {
+					if ttl := zrr.RR.Header().Ttl; !seenTTLs[ttl] {
+						seenTTLs[ttl] = true
+						ttls = append(ttls, ttl)
+					}
+				}
+				if len(ttls) > 1 {
+					sort.Slice(ttls, func(i, j int) bool { return ttls[i] < ttls[j] })
+					ttlStrings := make([]string, 0, len(ttls))
+					for _, ttl := range ttls {
+						ttlStrings = append(ttlStrings, strconv.FormatUint(uint64(ttl), 10))
+					}
+					findings = append(findings, monkalev1alpha1.LintFinding{
+						Check:      monkalev1alpha1.LintCheckTTLMismatch,
+						Name:       name,
+						Type:       typeName,
+						Message:    fmt.Sprintf("TTLs of the %s RRset differ: %s. All records of the RRset must have the same TTL (RFC 2181, section 5.2)", typeName, strings.Join(ttlStrings, ", ")),
+						DNSRecords: getZoneRRsDNSRecords(rrset),
+					})
+				}
+			}
+
+			// Targets
+			checkedTargets := make(map[string]bool)
+			for _, zrr := range rrset {
+				target := getRecordTarget(zrr.RR)
+				if target == "" || target == "." || checkedTargets[target] || !dns.IsSubDomain(origin, target) {
+					continue
+				}
+				checkedTargets[target] = true
+				finding := monkalev1alpha1.LintFinding{Name: name, Type: typeName, DNSRecords: getZoneRRsDNSRecords([]ZoneRR{zrr})}
+				targetRRs := lookup(target)
+				switch {
+				case rrType != dns.TypeCNAME && len(targetRRs[dns.TypeCNAME]) > 0:
+					finding.Check = monkalev1alpha1.LintCheckTargetIsCNAME
+					finding.Message = fmt.Sprintf("%s target %s is a CNAME. %s targets must have A or AAAA records (RFC 2181, section 10.3)", typeName, target, typeName)
+				case rrType == dns.TypeNS && len(targetRRs[dns.TypeA]) == 0 && len(targetRRs[dns.TypeAAAA]) == 0:
+					finding.Check = monkalev1alpha1.LintCheckMissingGlue
+					finding.Message = fmt.Sprintf("name server %s is inside the zone, but has no A or AAAA records", target)
+				case rrType == dns.TypeNS || belowZoneCut(target):
+					continue
+				case rrType == dns.TypeCNAME && targetRRs == nil:
+					finding.Check = monkalev1alpha1.LintCheckDanglingTarget
+					finding.Message = fmt.Sprintf("CNAME target %s does not exist in the zone", target)
+				case rrType != dns.TypeCNAME && len(targetRRs[dns.TypeA]) == 0 && len(targetRRs[dns.TypeAAAA]) == 0:
+					finding.Check = monkalev1alpha1.LintCheckDanglingTarget
+					finding.Message = fmt.Sprintf("%s target %s has no A or AAAA records in the zone", typeName, target)
+				default:
+					continue
+				}
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+// applyLintPolicy sets the severities of the findings according to spec.lint, drops the ignored findings, and orders them by severity.
+// Returns the findings and the number of the findings that block publishing.
+func applyLintPolicy(lint *monkalev1alpha1.ZoneLint, findings []monkalev1alpha1.LintFinding) ([]monkalev1alpha1.LintFinding, int) {
+	severities := make(map[string]string, len(defaultLintSeverities))
+	for check, severity := range defaultLintSeverities {
+		severities[check] = severity
+	}
+	blockOn := getLintBlockOn(lint)
+	if lint != nil {
+		for _, override := range lint.Severities {
+			severities[override.Check] = override.Severity
+		}
+	}
+
+	result := []monkalev1alpha1.LintFinding{}
+	blocking := 0
+	for _, finding := range findings {
+		severity := severities[finding.Check]
+		if _, ok := lintSeverityRank[severity]; !ok {
+			continue
+		}
+		finding.Severity = severity
+		if isBlockingLintFinding(blockOn, finding) {
+			blocking++
+		}
+		result = append(result, finding)
+	}
+	sortLintFindings(result)
+	return result, blocking
+}
+
+// getLintBlockOn returns the lowest severity of the findings that block publishing of the zone.
+func getLintBlockOn(lint *monkalev1alpha1.ZoneLint) string {
+	if lint == nil || lint.BlockOn == "" {
+		return monkalev1alpha1.LintSeverityError
+	}
+	return lint.BlockOn
+}
+
+// isBlockingLintFinding returns true if the finding with the severity of the zone policy blocks publishing.
+func isBlockingLintFinding(blockOn string, finding monkalev1alpha1.LintFinding) bool {
+	return blockOn != monkalev1alpha1.LintBlockOnNone && lintSeverityRank[finding.Severity] <= lintSeverityRank[blockOn]
+}
+
+// sortLintFindings orders the findings by severity, the most severe first.
+func sortLintFindings(findings []monkalev1alpha1.LintFinding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		return lintSeverityRank[findings[i].Severity] < lintSeverityRank[findings[j].Severity]
+	})
+}
+
+// LintResult represents the lint of the zone, whose DNSRecords involved in the findings blocking publishing have been excluded.
+type LintResult struct {
+	DNSRecords      monkalev1alpha1.DNSRecordList       // DNSRecords published in the zone
+	Records         BakedRecords                        // baked records of the published DNSRecords
+	Findings        []monkalev1alpha1.LintFinding       // findings ordered by severity, including the findings the DNSRecords have been excluded for
+	Blocking        int                                 // findings blocking publishing, which involve no DNSRecord to exclude
+	ExcludedRecords []monkalev1alpha1.ExcludedDNSRecord // DNSRecords excluded for the findings blocking publishing
+}
+
+// LintAndIsolateRecords lints the zone and excludes the DNSRecords involved in the findings blocking publishing,
+// so they do not block the other records of the zone, the same way IsolateInvalidRecords excludes the invalid records.
+// The remaining records are baked and linted again, until no finding blocks publishing.
+// The findings blocking publishing which involve no DNSRecord, e.g. of the SOA and NS records of the zone, keep blocking publishing.
+func LintAndIsolateRecords(dnsZone *monkalev1alpha1.DNSZone, dnsRecords monkalev1alpha1.DNSRecordList, records BakedRecords) (LintResult, error) {
+	result := LintResult{DNSRecords: dnsRecords, Records: records}
+	blockOn := getLintBlockOn(dnsZone.Spec.Lint)
+	excludedFindings := []monkalev1alpha1.LintFinding{}
+	for {
+		findings, blocking, err := LintDNSZone(dnsZone, result.Records)
+		if err != nil {
+			return result, err
+		}
+		result.Findings, result.Blocking = findings, blocking
+		if blocking == 0 {
+			break
+		}
+
+		// every DNSRecord is excluded for the first blocking finding it is involved in
+		excluded := make(map[string]string)
+		for _, finding := range findings {
+			if !isBlockingLintFinding(blockOn, finding) || len(finding.DNSRecords) == 0 {
+				continue
+			}
+			excludedFindings = append(excludedFindings, finding)
+			for _, name := range finding.DNSRecords {
+				if _, ok := excluded[name]; !ok {
+					excluded[name] = fmt.Sprintf("lint %s %s: %s %s: %s", finding.Severity, finding.Check, finding.Name, finding.Type, finding.Message)
+				}
+			}
+		}
+		goodRecords := monkalev1alpha1.DNSRecordList{}
+		for _, dnsRecord := range result.DNSRecords.Items {
+			if message, ok := excluded[dnsRecord.Name]; ok {
+				result.ExcludedRecords = append(result.ExcludedRecords, monkalev1alpha1.ExcludedDNSRecord{Name: dnsRecord.Name, Message: message})
+				continue
+			}
+			goodRecords.Items = append(goodRecords.Items, dnsRecord)
+		}
+		if len(goodRecords.Items) == len(result.DNSRecords.Items) {
+			break
+		}
+		result.DNSRecords = goodRecords
+		result.Records = BakedRecords{}
+		if len(goodRecords.Items) > 0 {
+			if result.Records, err = BakeRecords(dnsZone, goodRecords); err != nil {
+				return result, err
+			}
+		}
+	}
+	if len(excludedFindings) > 0 {
+		result.Findings = append(excludedFindings, result.Findings...)
+		sortLintFindings(result.Findings)
+	}
+	return result, nil
+}
+
+// SummarizeLintFindings returns the number of the findings per severity, e.g. "3 lint findings: 1 Error, 2 Warning".
+func SummarizeLintFindings(findings []monkalev1alpha1.LintFinding) string {
+	counts := make(map[string]int)
+	for _, finding := range findings {
+		counts[finding.Severity]++
+	}
+	parts := []string{}
+	for _, severity := range []string{monkalev1alpha1.LintSeverityError, monkalev1alpha1.LintSeverityWarning, monkalev1alpha1.LintSeverityInfo} {
+		if counts[severity] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[severity], severity))
+		}
+	}
+	return fmt.Sprintf("%d lint findings: %s", len(findings), strings.Join(parts, ", "))
+}
+
+// getRecordTarget returns the canonical target name of the CNAME, MX, SRV and NS records, or an empty string for the other records.
+func getRecordTarget(rr dns.RR) string {
+	switch v := rr.(type) {
+	case *dns.CNAME:
+		return dns.CanonicalName(v.Target)
+	case *dns.MX:
+		return dns.CanonicalName(v.Mx)
+	case *dns.SRV:
+		return dns.CanonicalName(v.Target)
+	case *dns.NS:
+		return dns.CanonicalName(v.Ns)
+	}
+	return ""
+}
+
+// getParentName returns the name without its first label.
+func getParentName(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[off:]
+}
+
+// nameExists returns true if the name owns records, or it is an empty non-terminal of the owner names.
+func nameExists(name string, ownerNames []string) bool {
+	for _, owner := range ownerNames {
+		if dns.IsSubDomain(name, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// countDistinctRdata returns the number of the distinct records of the RRset, not counting the duplicates.
+func countDistinctRdata(rrset []ZoneRR) int {
+	rdatas := make(map[string]bool)
+	for _, zrr := range rrset {
+		rdatas[strings.ToLower(RRData(zrr.RR))] = true
+	}
+	return len(rdatas)
+}
+
+// getZoneRRsDNSRecords returns the sorted names of the DNSRecords the records come from.
+func getZoneRRsDNSRecords(zoneRRs []ZoneRR) []string {
+	seen := make(map[string]bool)
+	dnsRecords := []string{}
+	for _, zrr := range zoneRRs {
+		if zrr.DNSRecord == "" || seen[zrr.DNSRecord] {
+			continue
+		}
+		seen[zrr.DNSRecord] = true
+		dnsRecords = append(dnsRecords, zrr.DNSRecord)
+	}
+	sort.Strings(dnsRecords)
+	if len(dnsRecords) == 0 {
+		return nil
+	}
+	return dnsRecords
+}
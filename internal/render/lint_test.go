@@ -0,0 +1,138 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"reflect"
+	"testing"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+func TestLintAndIsolateRecords(t *testing.T) {
+	tests := []struct {
+		name         string
+		lint         *monkalev1alpha1.ZoneLint
+		records      monkalev1alpha1.DNSRecordList
+		wantGood     []string
+		wantExcluded []string
+		wantChecks   []string
+	}{
+		{
+			name:         "no findings",
+			records:      getTestDNSRecords([2]string{"www", "www IN A 192.0.2.10"}, [2]string{"mail", "@ IN MX 10 www"}),
+			wantGood:     []string{"www", "mail"},
+			wantExcluded: []string{},
+			wantChecks:   []string{},
+		},
+		{
+			name: "records of the blocking finding are excluded",
+			records: getTestDNSRecords(
+				[2]string{"www", "www IN A 192.0.2.10"},
+				[2]string{"www-cname", "www IN CNAME app"},
+				[2]string{"app", "app IN A 192.0.2.20"},
+			),
+			wantGood:     []string{"app"},
+			wantExcluded: []string{"www", "www-cname"},
+			wantChecks:   []string{monkalev1alpha1.LintCheckCNAMEAndOtherData},
+		},
+		{
+			name: "findings not blocking publishing",
+			records: getTestDNSRecords(
+				[2]string{"www", "www IN A 192.0.2.10"},
+				[2]string{"mail", "@ IN MX 10 mail"},
+			),
+			wantGood:     []string{"www", "mail"},
+			wantExcluded: []string{},
+			wantChecks:   []string{monkalev1alpha1.LintCheckDanglingTarget},
+		},
+		{
+			name: "blocking findings disabled by the policy",
+			lint: &monkalev1alpha1.ZoneLint{BlockOn: monkalev1alpha1.LintBlockOnNone},
+			records: getTestDNSRecords(
+				[2]string{"www", "www IN A 192.0.2.10"},
+				[2]string{"www-cname", "www IN CNAME app"},
+			),
+			wantGood:     []string{"www", "www-cname"},
+			wantExcluded: []string{},
+			wantChecks:   []string{monkalev1alpha1.LintCheckCNAMEAndOtherData, monkalev1alpha1.LintCheckDanglingTarget},
+		},
+		{
+			name: "exclusion reveals the next blocking finding",
+			lint: &monkalev1alpha1.ZoneLint{Severities: []monkalev1alpha1.LintSeverity{
+				{Check: monkalev1alpha1.LintCheckDanglingTarget, Severity: monkalev1alpha1.LintSeverityError},
+			}},
+			records: getTestDNSRecords(
+				[2]string{"www", "www IN A 192.0.2.10"},
+				[2]string{"www-cname", "www IN CNAME app"},
+				[2]string{"app", "app IN A 192.0.2.20"},
+				[2]string{"mail", "@ IN MX 10 www"},
+			),
+			wantGood:     []string{"app"},
+			wantExcluded: []string{"www", "www-cname", "mail"},
+			wantChecks:   []string{monkalev1alpha1.LintCheckCNAMEAndOtherData, monkalev1alpha1.LintCheckDanglingTarget},
+		},
+		{
+			name: "finding with the records of the zone header",
+			lint: &monkalev1alpha1.ZoneLint{BlockOn: monkalev1alpha1.LintSeverityWarning},
+			records: getTestDNSRecords(
+				[2]string{"www", "www IN A 192.0.2.10"},
+				[2]string{"ns1", "ns1 IN A 192.0.2.1"},
+			),
+			wantGood:     []string{"www"},
+			wantExcluded: []string{"ns1"},
+			wantChecks:   []string{monkalev1alpha1.LintCheckDuplicateRR},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dnsZone := getTestDNSZone()
+			dnsZone.Spec.Lint = tt.lint
+			records, err := BakeRecords(dnsZone, tt.records)
+			if err != nil {
+				t.Fatalf("BakeRecords() error = %v", err)
+			}
+			result, err := LintAndIsolateRecords(dnsZone, tt.records, records)
+			if err != nil {
+				t.Fatalf("LintAndIsolateRecords() error = %v", err)
+			}
+			if result.Blocking != 0 {
+				t.Errorf("LintAndIsolateRecords() blocking = %d, want 0", result.Blocking)
+			}
+			if got := getDNSRecordNames(result.DNSRecords); !reflect.DeepEqual(got, tt.wantGood) {
+				t.Errorf("LintAndIsolateRecords() good records = %v, want %v", got, tt.wantGood)
+			}
+			if got := getExcludedDNSRecordNames(result.ExcludedRecords); !reflect.DeepEqual(got, tt.wantExcluded) {
+				t.Errorf("LintAndIsolateRecords() excluded records = %v, want %v", got, tt.wantExcluded)
+			}
+			checks := []string{}
+			for _, finding := range result.Findings {
+				checks = append(checks, finding.Check)
+			}
+			if !reflect.DeepEqual(checks, tt.wantChecks) {
+				t.Errorf("LintAndIsolateRecords() findings = %v, want %v", checks, tt.wantChecks)
+			}
+			for _, zrr := range result.Records.ZoneRRs {
+				for _, excluded := range result.ExcludedRecords {
+					if zrr.DNSRecord == excluded.Name {
+						t.Errorf("LintAndIsolateRecords() baked records contain the excluded DNSRecord %s", excluded.Name)
+					}
+				}
+			}
+		})
+	}
+}
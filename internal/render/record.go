@@ -0,0 +1,179 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// ConstructRecord builds DNS record according to RFC1035: "name [ttl] IN type rdata".
+// The rdata is either taken from the value as is, or rendered out of the typed record data.
+// If the record has multiple values, it returns every resource record of the RRset separated by a new line.
+func ConstructRecord(dnsRecord monkalev1alpha1.DNSRecord) (string, error) {
+	record := dnsRecord.Spec.Record
+	rdatas, err := constructRecordData(record)
+	if err != nil {
+		return "", fmt.Errorf("could not construct DNS Record: %v", err)
+	}
+
+	lines := make([]string, 0, len(rdatas))
+	for _, rdata := range rdatas {
+		var sb strings.Builder
+		sb.WriteString(record.Name)
+		if record.TTL != "" {
+			sb.WriteString(" " + record.TTL)
+		}
+		sb.WriteString(" IN " + record.Type + " " + rdata)
+		lines = append(lines, sb.String())
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// constructRecordData returns the rdata of every record of the RRset. If the typed record data is set, the record is
+// rendered through the miekg/dns RR type, so numbers, quoting and escaping are always correct.
+func constructRecordData(record *monkalev1alpha1.Record) ([]string, error) {
+	dataFields := 0
+	for _, isSet := range []bool{record.Value != "", len(record.Values) > 0, record.MX != nil, record.SRV != nil, record.CAA != nil, record.TXT != nil, record.NAPTR != nil} {
+		if isSet {
+			dataFields++
+		}
+	}
+	if dataFields == 0 {
+		return nil, fmt.Errorf("either value, values or typed record data must be set")
+	}
+	if dataFields > 1 {
+		return nil, fmt.Errorf("value, values and typed record data (mx, srv, caa, txt, naptr) are mutually exclusive")
+	}
+	if record.Value != "" {
+		return []string{record.Value}, nil
+	}
+	if len(record.Values) > 0 {
+		seen := make(map[string]bool)
+		for _, value := range record.Values {
+			if value == "" {
+				return nil, fmt.Errorf("values must not contain empty strings")
+			}
+			if seen[value] {
+				return nil, fmt.Errorf("duplicate value: %s", value)
+			}
+			seen[value] = true
+		}
+		return record.Values, nil
+	}
+
+	var rr dns.RR
+	switch {
+	case record.MX != nil && record.Type == "MX":
+		rr = &dns.MX{
+			Preference: record.MX.Preference,
+			Mx:         record.MX.Exchange,
+		}
+	case record.SRV != nil && record.Type == "SRV":
+		rr = &dns.SRV{
+			Priority: record.SRV.Priority,
+			Weight:   record.SRV.Weight,
+			Port:     record.SRV.Port,
+			Target:   record.SRV.Target,
+		}
+	case record.CAA != nil && record.Type == "CAA":
+		rr = &dns.CAA{
+			Flag:  record.CAA.Flag,
+			Tag:   record.CAA.Tag,
+			Value: escapeCharacterString(record.CAA.Value),
+		}
+	case record.TXT != nil && record.Type == "TXT":
+		rr = &dns.TXT{
+			Txt: splitTXTStrings(record.TXT.Strings),
+		}
+	case record.NAPTR != nil && record.Type == "NAPTR":
+		replacement := record.NAPTR.Replacement
+		if replacement == "" {
+			replacement = "."
+		}
+		rr = &dns.NAPTR{
+			Order:       record.NAPTR.Order,
+			Preference:  record.NAPTR.Preference,
+			Flags:       escapeCharacterString(record.NAPTR.Flags),
+			Service:     escapeCharacterString(record.NAPTR.Service),
+			Regexp:      escapeCharacterString(record.NAPTR.Regexp),
+			Replacement: replacement,
+		}
+	default:
+		return nil, fmt.Errorf("typed record data does not match record type %s", record.Type)
+	}
+
+	return []string{RRData(rr)}, nil
+}
+
+// RRData returns the record data of the resource record.
+// RR.String() returns "<header>\t<rdata>", the header is cut off.
+func RRData(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// splitTXTStrings splits TXT strings into chunks of maximum 255 bytes, and escapes them.
+func splitTXTStrings(txtStrings []string) []string {
+	const maxTXTStringLength = 255
+	chunks := []string{}
+	for _, txt := range txtStrings {
+		for len(txt) > maxTXTStringLength {
+			chunks = append(chunks, escapeCharacterString(txt[:maxTXTStringLength]))
+			txt = txt[maxTXTStringLength:]
+		}
+		chunks = append(chunks, escapeCharacterString(txt))
+	}
+	return chunks
+}
+
+// escapeCharacterString escapes backslashes and double quotes, so miekg/dns prints the string as is.
+func escapeCharacterString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
+
+// ValidateRecords performs syntax check of DNSRecords provided as a string.
+func ValidateRecords(records string) error {
+	_, err := ParseRecords(records, ".")
+	return err
+}
+
+// ParseRecords parses DNSRecords provided as a string. The relative names are completed with the origin.
+func ParseRecords(records string, origin string) ([]dns.RR, error) {
+	var rrs []dns.RR
+	recordReader := strings.NewReader(records)
+	recordParser := dns.NewZoneParser(recordReader, origin, "")
+	for {
+		rr, ok := recordParser.Next()
+		if !ok {
+			break
+		}
+		if err := recordParser.Err(); err != nil {
+			return nil, fmt.Errorf("error parsing record: %v", err)
+		}
+		rrs = append(rrs, rr)
+	}
+	// Check for any final errors
+	if err := recordParser.Err(); err != nil {
+		return nil, fmt.Errorf("error parsing records: %v", err)
+	}
+	return rrs, nil
+}
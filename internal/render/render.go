@@ -0,0 +1,304 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render renders the zone files and the Corefile out of the DNSZones, DNSRecords, DNSForwardZones and DNSConnectors.
+// The reconcilers and the offline render command share the package, so the zone files and the Corefile can be previewed
+// without a cluster.
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// offlineTSIGSecret replaces the TSIG secrets missing from the manifests in the rendered Corefile.
+const offlineTSIGSecret string = "<missing-tsig-secret>"
+
+// Manifests are the resources the zone files and the Corefile are rendered out of.
+type Manifests struct {
+	DNSZones        []monkalev1alpha1.DNSZone
+	DNSRecords      []monkalev1alpha1.DNSRecord
+	DNSForwardZones []monkalev1alpha1.DNSForwardZone
+	DNSConnectors   []monkalev1alpha1.DNSConnector
+	ConfigMaps      []corev1.ConfigMap // CoreDNS ConfigMaps of the DNSConnectors
+	Secrets         []corev1.Secret    // TSIG keys of the zone transfers
+}
+
+// Options are the options of the offline render.
+type Options struct {
+	Serial   string // Serial of the zones. Generated with the serial strategy of the zone if empty
+	Corefile string // Corefile the server blocks are merged into. The CoreDNS ConfigMap of the manifests is used if empty
+}
+
+// Result is the outcome of the offline render.
+type Result struct {
+	ZoneConfigMaps    []corev1.ConfigMap // zone ConfigMaps of the DNSZones, sorted by name
+	CorednsConfigMaps []corev1.ConfigMap // CoreDNS ConfigMaps with the generated server blocks, one per DNSConnector
+	Warnings          []string           // problems the operator reports in the status without blocking the zone
+}
+
+// renderedZone is the zone ConfigMap of the DNSZone.
+type renderedZone struct {
+	dnsZone   *monkalev1alpha1.DNSZone
+	configMap corev1.ConfigMap
+}
+
+// Render renders the manifests the same way the reconcilers do: the DNSRecords failing the validation or involved in the lint findings
+// blocking publishing are excluded from the zone, the lint findings are reported as warnings. The problems which make the operator preserve the previous version of the zone
+// or of the Corefile fail the render. Reverse zones and DNSSEC signatures depend on the cluster state and are not rendered.
+func Render(manifests *Manifests, options Options) (*Result, error) {
+	if options.Corefile != "" && len(manifests.DNSConnectors) > 1 {
+		return nil, fmt.Errorf("the Corefile can be provided for a single DNSConnector only, found %d DNSConnectors", len(manifests.DNSConnectors))
+	}
+	result := &Result{}
+	var errs []string
+
+	dnsZones := append([]monkalev1alpha1.DNSZone{}, manifests.DNSZones...)
+	sort.Slice(dnsZones, func(i, j int) bool {
+		return dnsZones[i].Spec.CMPrefix+dnsZones[i].Name < dnsZones[j].Spec.CMPrefix+dnsZones[j].Name
+	})
+	renderedZones := []renderedZone{}
+	for i := range dnsZones {
+		dnsZone := &dnsZones[i]
+		configMap, warnings, err := renderDNSZone(dnsZone, manifests, options)
+		result.Warnings = append(result.Warnings, warnings...)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("DNSZone %s: %v", dnsZone.Name, err))
+			continue
+		}
+		renderedZones = append(renderedZones, renderedZone{dnsZone: dnsZone, configMap: configMap})
+		result.ZoneConfigMaps = append(result.ZoneConfigMaps, configMap)
+	}
+
+	for i := range manifests.DNSConnectors {
+		dnsConnector := &manifests.DNSConnectors[i]
+		configMap, warnings, err := renderDNSConnector(dnsConnector, renderedZones, manifests, options)
+		result.Warnings = append(result.Warnings, warnings...)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("DNSConnector %s: %v", dnsConnector.Name, err))
+			continue
+		}
+		result.CorednsConfigMaps = append(result.CorednsConfigMaps, configMap)
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return result, nil
+}
+
+// renderDNSZone renders the zone ConfigMap of the DNSZone. Secondary zones carry no zonefile, only the primaries.
+func renderDNSZone(dnsZone *monkalev1alpha1.DNSZone, manifests *Manifests, options Options) (corev1.ConfigMap, []string, error) {
+	var warnings []string
+	cmName := dnsZone.Spec.CMPrefix + dnsZone.Name
+	if dnsZone.Spec.Transfer != nil {
+		if err := ValidateTransferTo(dnsZone.Spec.Transfer.To); err != nil {
+			return corev1.ConfigMap{}, nil, fmt.Errorf("zone transfer configuration failure: %v", err)
+		}
+	}
+
+	if dnsZone.Spec.Type == monkalev1alpha1.DNSZoneTypeSecondary {
+		if err := ValidatePrimaries(dnsZone.Spec.Primaries); err != nil {
+			return corev1.ConfigMap{}, nil, fmt.Errorf("secondary zone configuration failure: %v", err)
+		}
+		configMap, err := ConstructZoneConfigMap(cmName, dnsZone, "", ConstructZoneAnnotations(dnsZone, ""))
+		if err != nil {
+			return corev1.ConfigMap{}, nil, err
+		}
+		configMap.Data = nil
+		return configMap, nil, nil
+	}
+
+	if len(dnsZone.Spec.ReverseZones) > 0 {
+		warnings = append(warnings, fmt.Sprintf("DNSZone %s: reverse zones are not rendered offline", dnsZone.Name))
+	}
+	if dnsZone.Spec.DNSSEC != nil && dnsZone.Spec.DNSSEC.Enabled {
+		warnings = append(warnings, fmt.Sprintf("DNSZone %s: DNSSEC signing keys are not available offline, the zone is rendered unsigned", dnsZone.Name))
+	}
+
+	// Construct the DNSRecords of the zone, the invalid ones are Degraded and left out of the zone.
+	dnsRecords := monkalev1alpha1.DNSRecordList{}
+	for _, dnsRecord := range manifests.DNSRecords {
+		if dnsRecord.Namespace != dnsZone.Namespace || dnsRecord.Spec.DNSZoneRef == nil || dnsRecord.Spec.DNSZoneRef.Name != dnsZone.Name {
+			continue
+		}
+		if dnsRecord.Spec.Record == nil {
+			warnings = append(warnings, fmt.Sprintf("DNSRecord %s: record is not set", dnsRecord.Name))
+			continue
+		}
+		record, err := ConstructRecord(dnsRecord)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("DNSRecord %s: Record construction failure: %v", dnsRecord.Name, err))
+			continue
+		}
+		if err := ValidateRecords(record); err != nil {
+			warnings = append(warnings, fmt.Sprintf("DNSRecord %s: Record validation failure: %v", dnsRecord.Name, err))
+			continue
+		}
+		dnsRecord.Status.GeneratedRecord = record
+		dnsRecords.Items = append(dnsRecords.Items, dnsRecord)
+	}
+	sort.Slice(dnsRecords.Items, func(i, j int) bool {
+		return dnsRecords.Items[i].Name < dnsRecords.Items[j].Name
+	})
+
+	dnsRecords, excludedRecords := IsolateInvalidRecords(dnsZone, dnsRecords)
+	for _, excludedRecord := range excludedRecords {
+		warnings = append(warnings, fmt.Sprintf("DNSRecord %s: Record has been excluded from the DNSZone %s: %s", excludedRecord.Name, dnsZone.Name, excludedRecord.Message))
+	}
+	records := BakedRecords{}
+	if len(dnsRecords.Items) > 0 {
+		var err error
+		records, err = BakeRecords(dnsZone, dnsRecords)
+		if err != nil {
+			return corev1.ConfigMap{}, warnings, err
+		}
+		if len(records.AdjustedRRsets) > 0 {
+			warnings = append(warnings, fmt.Sprintf("DNSZone %s: TTLs within RRsets differ. The lowest TTL has been applied to %s", dnsZone.Name, strings.Join(records.AdjustedRRsets, ", ")))
+		}
+	}
+
+	// Lint the zone, the DNSRecords involved in the findings blocking publishing are excluded.
+	// The blocking findings which involve no DNSRecord fail the render.
+	lintResult, err := LintAndIsolateRecords(dnsZone, dnsRecords, records)
+	if err != nil {
+		return corev1.ConfigMap{}, warnings, fmt.Errorf("zone lint failure: %v", err)
+	}
+	records = lintResult.Records
+	for _, finding := range lintResult.Findings {
+		warnings = append(warnings, fmt.Sprintf("DNSZone %s: lint %s %s: %s %s: %s", dnsZone.Name, finding.Severity, finding.Check, finding.Name, finding.Type, finding.Message))
+	}
+	for _, excludedRecord := range lintResult.ExcludedRecords {
+		warnings = append(warnings, fmt.Sprintf("DNSRecord %s: Record has been excluded from the DNSZone %s: %s", excludedRecord.Name, dnsZone.Name, excludedRecord.Message))
+	}
+	if lintResult.Blocking > 0 {
+		return corev1.ConfigMap{}, warnings, fmt.Errorf("%s. %d of them block publishing", SummarizeLintFindings(lintResult.Findings), lintResult.Blocking)
+	}
+
+	serialNumber := options.Serial
+	if serialNumber == "" {
+		serialNumber, err = monkalev1alpha1.DNSZoneGenerateSerial(dnsZone.Spec.SerialStrategy, dnsZone.Status.CurrentZoneSerial)
+		if err != nil {
+			return corev1.ConfigMap{}, warnings, fmt.Errorf("could not generate serial number: %v", err)
+		}
+	}
+	zone, err := ConstructZoneFile(dnsZone, records.RecordsString, serialNumber)
+	if err != nil {
+		return corev1.ConfigMap{}, warnings, fmt.Errorf("zone construction failure: %v", err)
+	}
+	if err := ValidateRecords(zone); err != nil {
+		return corev1.ConfigMap{}, warnings, fmt.Errorf("zone validation failure: %v", err)
+	}
+	configMap, err := ConstructZoneConfigMap(cmName, dnsZone, zone, ConstructZoneAnnotations(dnsZone, serialNumber))
+	if err != nil {
+		return corev1.ConfigMap{}, warnings, err
+	}
+	return configMap, warnings, nil
+}
+
+// renderDNSConnector merges the server blocks of the zones and of the forward zones of the DNSConnector into its CoreDNS ConfigMap.
+func renderDNSConnector(dnsConnector *monkalev1alpha1.DNSConnector, renderedZones []renderedZone, manifests *Manifests, options Options) (corev1.ConfigMap, []string, error) {
+	var warnings []string
+	corednsConfCM, err := getCorednsConfCM(dnsConnector, manifests, options)
+	if err != nil {
+		return corev1.ConfigMap{}, nil, err
+	}
+
+	zoneConfigMaps := corev1.ConfigMapList{}
+	tsigKeys := make(map[string]TSIGKey)
+	for _, zone := range renderedZones {
+		if zone.dnsZone.Namespace != dnsConnector.Namespace || zone.dnsZone.Spec.ConnectorName != dnsConnector.Name {
+			continue
+		}
+		zoneConfigMaps.Items = append(zoneConfigMaps.Items, zone.configMap)
+		secretName, ok := zone.configMap.Annotations["TSIGSecretName"]
+		if !ok {
+			continue
+		}
+		secret := findSecret(manifests, secretName, zone.dnsZone.Namespace)
+		if secret == nil {
+			warnings = append(warnings, fmt.Sprintf("DNSZone %s: TSIG Secret %s is not in the manifests, the Corefile is rendered with a placeholder key", zone.dnsZone.Name, secretName))
+			tsigKeys[zone.configMap.Name] = TSIGKey{Name: strings.ToLower(monkalev1alpha1.EnsureFQDN(secretName)), Secret: offlineTSIGSecret}
+			continue
+		}
+		key, err := GetTSIGKey(secret)
+		if err != nil {
+			return corev1.ConfigMap{}, warnings, fmt.Errorf("DNSZone %s: %v", zone.dnsZone.Name, err)
+		}
+		tsigKeys[zone.configMap.Name] = key
+	}
+
+	// The forward zones with bad upstreams, and the forward zones of the domains served by another zone are skipped.
+	forwardZones := monkalev1alpha1.DNSForwardZoneList{}
+	for _, forwardZone := range manifests.DNSForwardZones {
+		if forwardZone.Namespace == dnsConnector.Namespace && forwardZone.Spec.ConnectorName == dnsConnector.Name {
+			forwardZones.Items = append(forwardZones.Items, forwardZone)
+		}
+	}
+	sort.Slice(forwardZones.Items, func(i, j int) bool {
+		return forwardZones.Items[i].Name < forwardZones.Items[j].Name
+	})
+	goodForwardZones, invalidForwardZones := FilterForwardZones(dnsConnector, &zoneConfigMaps, &forwardZones)
+	for _, invalid := range invalidForwardZones {
+		warnings = append(warnings, fmt.Sprintf("DNSForwardZone %s: Invalid forward zone: %v", invalid.ForwardZone.Name, invalid.Err))
+	}
+
+	updatedCorefileCM, err := GenerateCorefileCM(dnsConnector, &corednsConfCM, &zoneConfigMaps, &goodForwardZones, tsigKeys)
+	if err != nil {
+		return corev1.ConfigMap{}, warnings, fmt.Errorf("failed to generate Corefile: %v", err)
+	}
+	if err := ValidateCorefile(updatedCorefileCM.Data[dnsConnector.Spec.CorednsCM.CorefileKey]); err != nil {
+		return corev1.ConfigMap{}, warnings, fmt.Errorf("generated Corefile is invalid: %v", err)
+	}
+	return updatedCorefileCM, warnings, nil
+}
+
+// getCorednsConfCM returns the CoreDNS ConfigMap of the DNSConnector. The Corefile of the options takes precedence over the
+// ConfigMap of the manifests.
+func getCorednsConfCM(dnsConnector *monkalev1alpha1.DNSConnector, manifests *Manifests, options Options) (corev1.ConfigMap, error) {
+	corednsCM := dnsConnector.Spec.CorednsCM
+	if options.Corefile != "" {
+		configMap := corev1.ConfigMap{
+			Data: map[string]string{corednsCM.CorefileKey: options.Corefile},
+		}
+		configMap.Name = corednsCM.Name
+		configMap.Namespace = dnsConnector.Namespace
+		configMap.APIVersion = "v1"
+		configMap.Kind = "ConfigMap"
+		return configMap, nil
+	}
+	for _, configMap := range manifests.ConfigMaps {
+		if configMap.Name == corednsCM.Name && configMap.Namespace == dnsConnector.Namespace {
+			return *configMap.DeepCopy(), nil
+		}
+	}
+	return corev1.ConfigMap{}, fmt.Errorf("CoreDNS ConfigMap %s is not in the manifests, and no Corefile is provided", corednsCM.Name)
+}
+
+// findSecret returns the Secret of the manifests, nil if it is not found.
+func findSecret(manifests *Manifests, name, namespace string) *corev1.Secret {
+	for i := range manifests.Secrets {
+		if manifests.Secrets[i].Name == name && manifests.Secrets[i].Namespace == namespace {
+			return &manifests.Secrets[i]
+		}
+	}
+	return nil
+}
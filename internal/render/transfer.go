@@ -0,0 +1,130 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// TSIGKey is the TSIG key used to authenticate zone transfers.
+type TSIGKey struct {
+	Name   string
+	Secret string
+}
+
+// ValidatePrimaries checks the addresses of the primary name servers of the Secondary zone.
+// Each address must be an IP address, or an IP address with the port.
+func ValidatePrimaries(primaries []string) error {
+	if len(primaries) == 0 {
+		return fmt.Errorf("primaries must contain at least one address")
+	}
+	for _, address := range primaries {
+		if address == "*" {
+			return fmt.Errorf("primaries address %q is not an IP address", address)
+		}
+	}
+	if err := ValidateTransferTo(primaries); err != nil {
+		return fmt.Errorf("primaries: %v", err)
+	}
+	return nil
+}
+
+// ValidateTransferTo checks the addresses of the secondary name servers. Each address must be "*", an IP address,
+// or an IP address with the port.
+func ValidateTransferTo(to []string) error {
+	if len(to) == 0 {
+		return fmt.Errorf("transfer.to must contain at least one address")
+	}
+	for _, address := range to {
+		if address == "*" {
+			continue
+		}
+		if net.ParseIP(address) != nil {
+			continue
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) == nil {
+			return fmt.Errorf("transfer.to address %q is not an IP address", address)
+		}
+		if portNumber, err := strconv.Atoi(port); err != nil || portNumber < 1 || portNumber > 65535 {
+			return fmt.Errorf("transfer.to address %q has a bad port", address)
+		}
+	}
+	return nil
+}
+
+// GetTSIGKey extracts the TSIG key from the Secret. The key name must be a domain name, and the secret must be base64 encoded.
+func GetTSIGKey(secret *corev1.Secret) (TSIGKey, error) {
+	name := strings.TrimSpace(string(secret.Data[monkalev1alpha1.TSIGSecretKeyName]))
+	key := strings.TrimSpace(string(secret.Data[monkalev1alpha1.TSIGSecretKeySecret]))
+	if name == "" || key == "" {
+		return TSIGKey{}, fmt.Errorf("secret %s must contain %s and %s keys", secret.Name, monkalev1alpha1.TSIGSecretKeyName, monkalev1alpha1.TSIGSecretKeySecret)
+	}
+	if _, ok := dns.IsDomainName(name); !ok {
+		return TSIGKey{}, fmt.Errorf("TSIG key name %q of the secret %s is not a domain name", name, secret.Name)
+	}
+	if _, err := base64.StdEncoding.DecodeString(key); err != nil {
+		return TSIGKey{}, fmt.Errorf("TSIG secret of the secret %s is not base64 encoded: %v", secret.Name, err)
+	}
+	return TSIGKey{Name: strings.ToLower(dns.Fqdn(name)), Secret: key}, nil
+}
+
+// constructSecondaryBlock builds the secondary plugin configuration of the Secondary zone server block.
+func constructSecondaryBlock(primaries []string) (string, error) {
+	if err := ValidatePrimaries(primaries); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("secondary {\n\t\ttransfer from %s\n\t}", strings.Join(primaries, " ")), nil
+}
+
+// constructTransferBlock builds the transfer and tsig plugin configuration of the zone server block.
+// With the TSIG key, AXFR and IXFR requests must be signed. Returns an empty string if transfers are not allowed.
+func constructTransferBlock(transferTo []string, key *TSIGKey) (string, error) {
+	if len(transferTo) == 0 {
+		return "", nil
+	}
+	if err := ValidateTransferTo(transferTo); err != nil {
+		return "", err
+	}
+	var blockBuilder strings.Builder
+	blockBuilder.WriteString(fmt.Sprintf("\n\ttransfer {\n\t\tto %s\n\t}", strings.Join(transferTo, " ")))
+	if key != nil {
+		blockBuilder.WriteString(fmt.Sprintf("\n\ttsig {\n\t\tsecret %s %s\n\t\trequire AXFR IXFR\n\t}", key.Name, key.Secret))
+	}
+	return blockBuilder.String(), nil
+}
+
+// validateCorefileBlock checks the generated server block before it is applied: it must be parsed as exactly one server block.
+func validateCorefileBlock(block string) error {
+	blocks, err := parseCorefile(block)
+	if err != nil {
+		return err
+	}
+	if len(blocks) != 1 || blocks[0].isSnippet() {
+		return fmt.Errorf("expected exactly one server block, got %d", len(blocks))
+	}
+	return nil
+}
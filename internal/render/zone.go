@@ -0,0 +1,257 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+// ZoneRR is the resource record of the zone and the DNSRecord it comes from. The SOA and NS records of the zone have no DNSRecord.
+type ZoneRR struct {
+	RR        dns.RR
+	DNSRecord string
+}
+
+// BakedRecords represents the records that are members of the Zonefile.
+type BakedRecords struct {
+	Count          int
+	RecordsString  string
+	AdjustedRRsets []string // RRsets whose TTL has been lowered to match the other records of the RRset
+	ZoneRRs        []ZoneRR // parsed records with their original TTLs, linted before the zone is published
+}
+
+// ConstructZoneFile - constructs and validates Zone.
+func ConstructZoneFile(dnsZone *monkalev1alpha1.DNSZone, records string, serialNumber string) (string, error) {
+	var newZoneHeader string
+	if dnsZone.Spec.PrimaryNS == nil || dnsZone.Spec.RespPersonEmail == "" {
+		return "", fmt.Errorf("primaryNS and respPersonEmail are required for Primary zones")
+	}
+	newZoneHeaderValues := monkalev1alpha1.DNSZoneHeader{
+		DomainName:        monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain),
+		PrimaryNSName:     GetPrimaryNSName(dnsZone),
+		PrimaryNSHostname: dnsZone.Spec.PrimaryNS.Hostname,
+		PrimaryNSIp:       dnsZone.Spec.PrimaryNS.IPAddress,
+		PrimaryNSType:     dnsZone.Spec.PrimaryNS.RecordType,
+		RespPerson:        dnsZone.Spec.RespPersonEmail,
+		ZoneTTL:           dnsZone.Spec.TTL,
+		Serial:            serialNumber,
+		Refresh:           dnsZone.Spec.RefreshRate,
+		Retry:             dnsZone.Spec.RetryInterval,
+		Expire:            dnsZone.Spec.ExpireTime,
+		MinimumTTL:        dnsZone.Spec.MinimumTTL,
+	}
+	// the address of the name server out of the zone is not the data of the zone
+	if dns.IsFqdn(dnsZone.Spec.PrimaryNS.Hostname) {
+		newZoneHeaderValues.PrimaryNSIp = ""
+	}
+	newZoneHeader, err := templateZoneHeader(newZoneHeaderValues)
+	if err != nil {
+		return "", fmt.Errorf("unable to template the zoneHeader: %v", err)
+	}
+	zonefileContent := newZoneHeader + records
+	return zonefileContent, nil
+}
+
+// GetPrimaryNSName returns the FQDN of the primary name server of the zone. Relative hostnames belong to the zone.
+func GetPrimaryNSName(dnsZone *monkalev1alpha1.DNSZone) string {
+	if dns.IsFqdn(dnsZone.Spec.PrimaryNS.Hostname) {
+		return dnsZone.Spec.PrimaryNS.Hostname
+	}
+	return dnsZone.Spec.PrimaryNS.Hostname + "." + monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain)
+}
+
+// ConstructZoneConfigMap constructs config map for the Zone
+func ConstructZoneConfigMap(cmObj string, dnsZone *monkalev1alpha1.DNSZone, zonefileContent string, upcomingCMAnnotations map[string]string) (corev1.ConfigMap, error) {
+	cm := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        cmObj,
+			Namespace:   dnsZone.ObjectMeta.Namespace,
+			Labels:      map[string]string{"app": "coredns-addon-operator"},
+			Annotations: upcomingCMAnnotations,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: dnsZone.APIVersion,
+					Kind:       dnsZone.Kind,
+					Name:       dnsZone.Name,
+					UID:        dnsZone.UID,
+				},
+			},
+		},
+		Data: map[string]string{
+			monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain) + "zone": zonefileContent,
+		},
+	}
+	return cm, nil
+}
+
+// ConstructZoneAnnotations builds the annotations of the zone ConfigMap. The DNSConnector renders the server block of the zone
+// out of them: the domain, the primaries of the Secondary zone, and the zone transfers to the secondaries.
+func ConstructZoneAnnotations(dnsZone *monkalev1alpha1.DNSZone, serialNumber string) map[string]string {
+	annotations := map[string]string{"SerialNumber": serialNumber, "DomainName": dnsZone.Spec.Domain, "DNSZoneRef": dnsZone.Name}
+	if dnsZone.Spec.Type == monkalev1alpha1.DNSZoneTypeSecondary {
+		annotations["ZoneType"] = monkalev1alpha1.DNSZoneTypeSecondary
+		annotations["Primaries"] = strings.Join(dnsZone.Spec.Primaries, " ")
+	}
+	if dnsZone.Spec.Transfer != nil {
+		annotations["TransferTo"] = strings.Join(dnsZone.Spec.Transfer.To, " ")
+		if dnsZone.Spec.Transfer.TSIGSecretName != "" {
+			annotations["TSIGSecretName"] = dnsZone.Spec.Transfer.TSIGSecretName
+		}
+	}
+	return annotations
+}
+
+// templateZoneHeader builds Zone header: SOA and first NS A record
+func templateZoneHeader(header monkalev1alpha1.DNSZoneHeader) (string, error) {
+	zoneTmpl := `$ORIGIN {{.DomainName}}
+$TTL {{ .ZoneTTL }}s
+@ IN SOA {{.PrimaryNSName}} {{.RespPerson}}. (
+	{{.Serial}}     ; Serial
+	{{.Refresh}}    ; Refresh
+	{{.Retry}}      ; Retry
+	{{.Expire}}     ; Expire
+	{{.MinimumTTL}} ; Minimum TTL
+)
+@ IN NS {{.PrimaryNSName}}
+{{if .PrimaryNSIp}}{{.PrimaryNSHostname}} IN {{.PrimaryNSType}} {{.PrimaryNSIp}}
+{{end}}`
+	tmpl, err := template.New("HEADER").Parse(zoneTmpl)
+	if err != nil {
+		return "", fmt.Errorf("could not template SOA or NS: %v", err)
+	}
+
+	var result bytes.Buffer
+	if err := tmpl.Execute(&result, header); err != nil {
+		return "", fmt.Errorf("could not template SOA or NS: %v", err)
+	}
+	zoneHeader := result.String()
+	return zoneHeader, nil
+}
+
+// IsolateInvalidRecords validates every DNSRecord within the zone, and splits them into the records published in the zone
+// and the records excluded from the zone with the parser error, so one invalid record does not block the other records.
+// If the SOA and NS records of the zone fail the validation, the DNSRecords are not to blame and none of them is excluded.
+func IsolateInvalidRecords(dnsZone *monkalev1alpha1.DNSZone, dnsRecords monkalev1alpha1.DNSRecordList) (monkalev1alpha1.DNSRecordList, []monkalev1alpha1.ExcludedDNSRecord) {
+	header, err := ConstructZoneFile(dnsZone, "", "1")
+	if err != nil {
+		return dnsRecords, nil
+	}
+	if err := ValidateRecords(header); err != nil {
+		return dnsRecords, nil
+	}
+
+	origin := monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain)
+	goodRecords := monkalev1alpha1.DNSRecordList{}
+	excludedRecords := []monkalev1alpha1.ExcludedDNSRecord{}
+	for _, record := range dnsRecords.Items {
+		// the relative names of the records are completed with the zone origin, the same way as in the zone file
+		if _, err := ParseRecords(record.Status.GeneratedRecord, origin); err != nil {
+			excludedRecords = append(excludedRecords, monkalev1alpha1.ExcludedDNSRecord{Name: record.Name, Message: err.Error()})
+			continue
+		}
+		goodRecords.Items = append(goodRecords.Items, record)
+	}
+	if len(excludedRecords) == 0 {
+		return goodRecords, nil
+	}
+	return goodRecords, excludedRecords
+}
+
+// BakeRecords bakes DNSRecords into the single Zone file compatible string.
+// Resource records with the same owner name and type form an RRset, and all of them must have the same TTL (RFC 2181).
+// If TTLs within the RRset differ, the lowest TTL is applied to every resource record of the RRset.
+func BakeRecords(dnsZone *monkalev1alpha1.DNSZone, dnsRecords monkalev1alpha1.DNSRecordList) (BakedRecords, error) {
+	type rrsetKey struct {
+		name   string
+		rrType string
+	}
+	type zoneLine struct {
+		line     string
+		rrset    rrsetKey
+		ttl      uint32
+		explicit bool
+	}
+
+	origin := monkalev1alpha1.EnsureFQDN(dnsZone.Spec.Domain)
+	zoneLines := []zoneLine{}
+	zoneRRs := []ZoneRR{}
+	rrsetTTLs := make(map[rrsetKey][]uint32)
+	for _, record := range dnsRecords.Items {
+		for _, line := range strings.Split(record.Status.GeneratedRecord, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			parser := dns.NewZoneParser(strings.NewReader(fmt.Sprintf("$TTL %d\n%s", dnsZone.Spec.TTL, line)), origin, "")
+			rr, ok := parser.Next()
+			if !ok || parser.Err() != nil {
+				return BakedRecords{}, fmt.Errorf("could not parse record %s of DNSRecord %s: %v", line, record.Name, parser.Err())
+			}
+			key := rrsetKey{name: strings.ToLower(rr.Header().Name), rrType: dns.TypeToString[rr.Header().Rrtype]}
+			parts := strings.SplitN(line, " ", 3)
+			zoneLines = append(zoneLines, zoneLine{line: line, rrset: key, ttl: rr.Header().Ttl, explicit: len(parts) > 1 && parts[1] != "IN"})
+			rrsetTTLs[key] = append(rrsetTTLs[key], rr.Header().Ttl)
+			zoneRRs = append(zoneRRs, ZoneRR{RR: rr, DNSRecord: record.Name})
+		}
+	}
+
+	var sb strings.Builder
+	adjustedRRsets := []string{}
+	adjustedRRsetKeys := make(map[rrsetKey]bool)
+	for i, zoneLine := range zoneLines {
+		line := zoneLine.line
+		lowestTTL := zoneLine.ttl
+		for _, ttl := range rrsetTTLs[zoneLine.rrset] {
+			if ttl < lowestTTL {
+				lowestTTL = ttl
+			}
+		}
+		if lowestTTL != zoneLine.ttl {
+			// replace the ttl, the line is formatted as "name [ttl] IN type rdata"
+			parts := strings.SplitN(line, " ", 3)
+			if zoneLine.explicit {
+				line = fmt.Sprintf("%s %d %s", parts[0], lowestTTL, parts[2])
+			} else {
+				line = fmt.Sprintf("%s %d %s %s", parts[0], lowestTTL, parts[1], parts[2])
+			}
+			if !adjustedRRsetKeys[zoneLine.rrset] {
+				adjustedRRsetKeys[zoneLine.rrset] = true
+				adjustedRRsets = append(adjustedRRsets, fmt.Sprintf("%s %s", zoneLine.rrset.name, zoneLine.rrset.rrType))
+			}
+		}
+		sb.WriteString(line)
+		if i < len(zoneLines)-1 {
+			sb.WriteString("\n")
+		}
+	}
+	corednsEntries := BakedRecords{
+		Count:          len(zoneLines),
+		RecordsString:  sb.String(),
+		AdjustedRRsets: adjustedRRsets,
+		ZoneRRs:        zoneRRs,
+	}
+
+	return corednsEntries, nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2024 monkale.io.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monkalev1alpha1 "github.com/monkale.io/coredns-manager-operator/api/v1alpha1"
+)
+
+func getTestDNSZone() *monkalev1alpha1.DNSZone {
+	return &monkalev1alpha1.DNSZone{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-com", Namespace: "kube-system"},
+		Spec: monkalev1alpha1.DNSZoneSpec{
+			Domain:          "example.com",
+			PrimaryNS:       &monkalev1alpha1.PrimaryNS{Hostname: "ns1", IPAddress: "192.0.2.1", RecordType: "A"},
+			RespPersonEmail: "admin@example.com",
+			TTL:             3600,
+			RefreshRate:     7200,
+			RetryInterval:   3600,
+			ExpireTime:      1209600,
+			MinimumTTL:      3600,
+		},
+	}
+}
+
+// getTestDNSRecords returns the DNSRecords with the generated records by the DNSRecord name.
+func getTestDNSRecords(generatedRecords ...[2]string) monkalev1alpha1.DNSRecordList {
+	dnsRecords := monkalev1alpha1.DNSRecordList{}
+	for _, generated := range generatedRecords {
+		dnsRecord := monkalev1alpha1.DNSRecord{ObjectMeta: metav1.ObjectMeta{Name: generated[0], Namespace: "kube-system"}}
+		dnsRecord.Status.GeneratedRecord = generated[1]
+		dnsRecords.Items = append(dnsRecords.Items, dnsRecord)
+	}
+	return dnsRecords
+}
+
+func getDNSRecordNames(dnsRecords monkalev1alpha1.DNSRecordList) []string {
+	names := []string{}
+	for _, dnsRecord := range dnsRecords.Items {
+		names = append(names, dnsRecord.Name)
+	}
+	return names
+}
+
+func getExcludedDNSRecordNames(excludedRecords []monkalev1alpha1.ExcludedDNSRecord) []string {
+	names := []string{}
+	for _, excluded := range excludedRecords {
+		if excluded.Message == "" {
+			names = append(names, excluded.Name+" without message")
+			continue
+		}
+		names = append(names, excluded.Name)
+	}
+	return names
+}
+
+func TestIsolateInvalidRecords(t *testing.T) {
+	tests := []struct {
+		name         string
+		records      monkalev1alpha1.DNSRecordList
+		wantGood     []string
+		wantExcluded []string
+	}{
+		{
+			name:         "all records valid",
+			records:      getTestDNSRecords([2]string{"www", "www IN A 192.0.2.10"}, [2]string{"mail", "@ IN MX 10 mail.example.com."}),
+			wantGood:     []string{"www", "mail"},
+			wantExcluded: []string{},
+		},
+		{
+			name: "one bad record",
+			records: getTestDNSRecords(
+				[2]string{"www", "www IN A 192.0.2.10"},
+				[2]string{"bad-ip", "api IN A 192.0.2"},
+				[2]string{"mail", "@ IN MX 10 mail.example.com."},
+			),
+			wantGood:     []string{"www", "mail"},
+			wantExcluded: []string{"bad-ip"},
+		},
+		{
+			name: "several bad records",
+			records: getTestDNSRecords(
+				[2]string{"bad-ip", "api IN A 192.0.2"},
+				[2]string{"www", "www IN A 192.0.2.10"},
+				[2]string{"bad-mx", "@ IN MX mail.example.com."},
+				[2]string{"bad-rrset", "app IN A 192.0.2.20\napp IN A 192.0.2.300"},
+				[2]string{"txt", `@ IN TXT "v=spf1 -all"`},
+			),
+			wantGood:     []string{"www", "txt"},
+			wantExcluded: []string{"bad-ip", "bad-mx", "bad-rrset"},
+		},
+		{
+			name: "all records bad",
+			records: getTestDNSRecords(
+				[2]string{"bad-ip", "api IN A 192.0.2"},
+				[2]string{"bad-type", "www IN BOGUS 192.0.2.10"},
+			),
+			wantGood:     []string{},
+			wantExcluded: []string{"bad-ip", "bad-type"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			good, excluded := IsolateInvalidRecords(getTestDNSZone(), tt.records)
+			if got := getDNSRecordNames(good); !reflect.DeepEqual(got, tt.wantGood) {
+				t.Errorf("IsolateInvalidRecords() good records = %v, want %v", got, tt.wantGood)
+			}
+			if got := getExcludedDNSRecordNames(excluded); !reflect.DeepEqual(got, tt.wantExcluded) {
+				t.Errorf("IsolateInvalidRecords() excluded records = %v, want %v", got, tt.wantExcluded)
+			}
+		})
+	}
+}
+
+func TestIsolateInvalidRecordsBadHeader(t *testing.T) {
+	// the zone header is invalid, the DNSRecords are not to blame
+	dnsZone := getTestDNSZone()
+	dnsZone.Spec.PrimaryNS.IPAddress = "192.0.2"
+	records := getTestDNSRecords([2]string{"www", "www IN A 192.0.2.10"}, [2]string{"bad-ip", "api IN A 192.0.2"})
+	good, excluded := IsolateInvalidRecords(dnsZone, records)
+	if got := getDNSRecordNames(good); !reflect.DeepEqual(got, []string{"www", "bad-ip"}) {
+		t.Errorf("IsolateInvalidRecords() good records = %v, want every record", got)
+	}
+	if len(excluded) != 0 {
+		t.Errorf("IsolateInvalidRecords() excluded records = %v, want none", excluded)
+	}
+}
+
+func TestConstructZoneFileHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		domain   string
+		hostname string
+		wantNS   string
+		wantRRs  []string
+	}{
+		{
+			name:     "name server in the zone",
+			domain:   "example.com",
+			hostname: "ns1",
+			wantNS:   "ns1.example.com.",
+			wantRRs:  []string{"SOA", "NS", "A"},
+		},
+		{
+			// the reverse zone names the name server of the forward zone
+			name:     "reverse zone",
+			domain:   "2.0.192.in-addr.arpa",
+			hostname: "ns1.example.com.",
+			wantNS:   "ns1.example.com.",
+			wantRRs:  []string{"SOA", "NS"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dnsZone := getTestDNSZone()
+			dnsZone.Spec.Domain = tt.domain
+			dnsZone.Spec.PrimaryNS.Hostname = tt.hostname
+			header, err := ConstructZoneFile(dnsZone, "", "1")
+			if err != nil {
+				t.Fatalf("ConstructZoneFile() error = %v", err)
+			}
+			var rrTypes []string
+			zoneParser := dns.NewZoneParser(strings.NewReader(header), "", "")
+			for rr, ok := zoneParser.Next(); ok; rr, ok = zoneParser.Next() {
+				rrTypes = append(rrTypes, dns.TypeToString[rr.Header().Rrtype])
+				switch rr := rr.(type) {
+				case *dns.SOA:
+					if rr.Ns != tt.wantNS {
+						t.Errorf("ConstructZoneFile() SOA MNAME = %s, want %s", rr.Ns, tt.wantNS)
+					}
+				case *dns.NS:
+					if rr.Ns != tt.wantNS {
+						t.Errorf("ConstructZoneFile() NS = %s, want %s", rr.Ns, tt.wantNS)
+					}
+				case *dns.A:
+					if rr.Hdr.Name != tt.wantNS {
+						t.Errorf("ConstructZoneFile() A record of %s, want %s", rr.Hdr.Name, tt.wantNS)
+					}
+				}
+			}
+			if err := zoneParser.Err(); err != nil {
+				t.Fatalf("ConstructZoneFile() header does not parse: %v", err)
+			}
+			if !reflect.DeepEqual(rrTypes, tt.wantRRs) {
+				t.Errorf("ConstructZoneFile() header records = %v, want %v", rrTypes, tt.wantRRs)
+			}
+		})
+	}
+}